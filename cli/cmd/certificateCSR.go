@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+func newCertificateCSR() *cobra.Command {
+	var csrFilename string
+	var quoteFilename string
+
+	cmd := &cobra.Command{
+		Use:   "csr <IP:PORT>",
+		Short: "Requests a certificate signing request for the intermediate CA of the Marblerun Coordinator",
+		Long: `
+Requests a certificate signing request for a new intermediate CA key, generated inside the Marblerun Coordinator.
+Sign the request with your own CA and upload the certificate using "marblerun certificate set".
+The quote for the request can optionally be saved to verify it was created inside the enclave.
+Users have to authenticate themselves using a certificate and private key,
+and need permissions in the manifest to set an external CA.
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hostName := args[0]
+			caCert, err := verifyCoordinator(hostName, eraConfig, insecureEra)
+			if err != nil {
+				return err
+			}
+
+			// Load client certificate and key
+			clCert, err := tls.LoadX509KeyPair(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
+
+			return cliCertificateCSR(hostName, csrFilename, quoteFilename, clCert, caCert)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&csrFilename, "output", "o", "marblerunIntermediateCA.csr", "File to save the certificate signing request to")
+	cmd.Flags().StringVarP(&quoteFilename, "quote", "q", "", "File to save the quote for the certificate signing request to")
+	cmd.Flags().StringVarP(&userCertFile, "cert", "c", "", "PEM encoded Marblerun user certificate file (required)")
+	cmd.Flags().StringVarP(&userKeyFile, "key", "k", "", "PEM encoded Marblerun user key file (required)")
+	cmd.MarkFlagRequired("cert")
+	cmd.MarkFlagRequired("key")
+
+	return cmd
+}
+
+// cliCertificateCSR requests a certificate signing request for the intermediate CA of the Marblerun Coordinator
+func cliCertificateCSR(host string, output string, quoteOutput string, clCert tls.Certificate, caCert []*pem.Block) error {
+	client, err := restClient(caCert, &clCert)
+	if err != nil {
+		return err
+	}
+
+	url := url.URL{Scheme: "https", Host: host, Path: "intermediate/csr"}
+	resp, err := client.Post(url.String(), "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		csr := gjson.GetBytes(respBody, "data.CSR").String()
+		if err := ioutil.WriteFile(output, []byte(csr), 0644); err != nil {
+			return err
+		}
+		fmt.Println("Certificate signing request written to", output)
+		if quoteOutput != "" {
+			quote, err := base64.StdEncoding.DecodeString(gjson.GetBytes(respBody, "data.Quote").String())
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(quoteOutput, quote, 0644); err != nil {
+				return err
+			}
+			fmt.Println("Quote written to", quoteOutput)
+		}
+	case http.StatusBadRequest:
+		// Something went wrong
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to create certificate signing request: %s", response)
+	case http.StatusUnauthorized:
+		// User was not authorized
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to authorize user: %s", response)
+	default:
+		return fmt.Errorf("error connecting to server: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return nil
+}
@@ -38,6 +38,9 @@ func cliCertificateChain(host string, output string, configFilename string, inse
 	if len(certs) == 1 {
 		fmt.Println("WARNING: Only received root certificate from host.")
 	}
+	if len(certs) > 2 {
+		fmt.Println("The root certificate was rotated recently. The chain includes the previous root and the cross-signed root certificates.")
+	}
 
 	var chain []byte
 	for _, cert := range certs {
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+func newCertificateRotate() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rotate <IP:PORT>",
+		Short: "Rotates the root certificate of the Marblerun Coordinator",
+		Long: `
+Replaces the root CA of the Marblerun Coordinator with a newly generated one.
+The previous and new root certificate are cross-signed and both served in the certificate chain during a transition period.
+The intermediate CA and all shared certificates are regenerated, Marbles need to be restarted to receive them.
+Users have to authenticate themselves using a certificate and private key,
+and need permissions in the manifest to rotate the root CA.
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hostName := args[0]
+			caCert, err := verifyCoordinator(hostName, eraConfig, insecureEra)
+			if err != nil {
+				return err
+			}
+
+			// Load client certificate and key
+			clCert, err := tls.LoadX509KeyPair(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
+
+			return cliCertificateRotate(hostName, clCert, caCert)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&userCertFile, "cert", "c", "", "PEM encoded Marblerun user certificate file (required)")
+	cmd.Flags().StringVarP(&userKeyFile, "key", "k", "", "PEM encoded Marblerun user key file (required)")
+	cmd.MarkFlagRequired("cert")
+	cmd.MarkFlagRequired("key")
+
+	return cmd
+}
+
+// cliCertificateRotate rotates the root CA of the Marblerun Coordinator
+func cliCertificateRotate(host string, clCert tls.Certificate, caCert []*pem.Block) error {
+	client, err := restClient(caCert, &clCert)
+	if err != nil {
+		return err
+	}
+
+	url := url.URL{Scheme: "https", Host: host, Path: "rootca/rotate"}
+	resp, err := client.Post(url.String(), "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		fmt.Println("Root certificate successfully rotated")
+	case http.StatusBadRequest:
+		// Something went wrong
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to rotate root certificate: %s", response)
+	case http.StatusUnauthorized:
+		// User was not authorized
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to authorize user: %s", response)
+	default:
+		return fmt.Errorf("error connecting to server: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return nil
+}
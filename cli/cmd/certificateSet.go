@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+func newCertificateSet() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set <IP:PORT> <certificate_chain.pem>",
+		Short: "Sets the intermediate certificate of the Marblerun Coordinator issued by an external CA",
+		Long: `
+Sets the intermediate certificate of the Marblerun Coordinator issued by an external CA for the last certificate signing request.
+The file has to contain the PEM encoded intermediate certificate, followed by the certificates of the external CA up to its root.
+Afterwards, the certificates of Marbles and secrets chain up to the root of the external CA. Marbles need to be restarted to receive them.
+Users have to authenticate themselves using a certificate and private key,
+and need permissions in the manifest to set an external CA.
+`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hostName := args[0]
+			certChain, err := ioutil.ReadFile(args[1])
+			if err != nil {
+				return err
+			}
+
+			caCert, err := verifyCoordinator(hostName, eraConfig, insecureEra)
+			if err != nil {
+				return err
+			}
+
+			// Load client certificate and key
+			clCert, err := tls.LoadX509KeyPair(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
+
+			return cliCertificateSet(hostName, certChain, clCert, caCert)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&userCertFile, "cert", "c", "", "PEM encoded Marblerun user certificate file (required)")
+	cmd.Flags().StringVarP(&userKeyFile, "key", "k", "", "PEM encoded Marblerun user key file (required)")
+	cmd.MarkFlagRequired("cert")
+	cmd.MarkFlagRequired("key")
+
+	return cmd
+}
+
+// cliCertificateSet sets the intermediate certificate of the Marblerun Coordinator issued by an external CA
+func cliCertificateSet(host string, certChain []byte, clCert tls.Certificate, caCert []*pem.Block) error {
+	client, err := restClient(caCert, &clCert)
+	if err != nil {
+		return err
+	}
+
+	url := url.URL{Scheme: "https", Host: host, Path: "intermediate"}
+	resp, err := client.Post(url.String(), "application/x-pem-file", bytes.NewReader(certChain))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		fmt.Println("Intermediate certificate successfully set")
+	case http.StatusBadRequest:
+		// Something went wrong
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to set intermediate certificate: %s", response)
+	case http.StatusUnauthorized:
+		// User was not authorized
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to authorize user: %s", response)
+	default:
+		return fmt.Errorf("error connecting to server: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/edgelesssys/marblerun/coordinator/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateRotate(t *testing.T) {
+	assert := assert.New(t)
+	authorized := true
+	s, host, cert := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodPost, r.Method)
+		assert.Equal("/rootca/rotate", r.RequestURI)
+		if !authorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		serverResp := server.GeneralResponse{
+			Status: "success",
+		}
+		assert.NoError(json.NewEncoder(w).Encode(serverResp))
+	}))
+	defer s.Close()
+
+	err := cliCertificateRotate(host, tls.Certificate{}, []*pem.Block{cert})
+	assert.NoError(err)
+
+	authorized = false
+	err = cliCertificateRotate(host, tls.Certificate{}, []*pem.Block{cert})
+	assert.Error(err)
+}
+
+func TestCertificateCSR(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, host, cert := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodPost, r.Method)
+		assert.Equal("/intermediate/csr", r.RequestURI)
+		serverResp := server.GeneralResponse{
+			Status: "success",
+			Data: struct {
+				CSR   string
+				Quote []byte
+			}{"csr", []byte("quote")},
+		}
+		assert.NoError(json.NewEncoder(w).Encode(serverResp))
+	}))
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	csrFile := filepath.Join(dir, "intermediate.csr")
+	quoteFile := filepath.Join(dir, "intermediate.quote")
+
+	require.NoError(cliCertificateCSR(host, csrFile, quoteFile, tls.Certificate{}, []*pem.Block{cert}))
+	csr, err := ioutil.ReadFile(csrFile)
+	require.NoError(err)
+	assert.Equal("csr", string(csr))
+	quote, err := ioutil.ReadFile(quoteFile)
+	require.NoError(err)
+	assert.Equal("quote", string(quote))
+}
+
+func TestCertificateSet(t *testing.T) {
+	assert := assert.New(t)
+	s, host, cert := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodPost, r.Method)
+		assert.Equal("/intermediate", r.RequestURI)
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(err)
+		if string(body) != "chain" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		serverResp := server.GeneralResponse{
+			Status: "success",
+		}
+		assert.NoError(json.NewEncoder(w).Encode(serverResp))
+	}))
+	defer s.Close()
+
+	err := cliCertificateSet(host, []byte("chain"), tls.Certificate{}, []*pem.Block{cert})
+	assert.NoError(err)
+
+	err = cliCertificateSet(host, []byte("invalid"), tls.Certificate{}, []*pem.Block{cert})
+	assert.Error(err)
+}
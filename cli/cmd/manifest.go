@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"crypto/tls"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -25,8 +26,12 @@ or return a signature of the currently set manifest to the user`,
 
 	cmd.PersistentFlags().StringVar(&eraConfig, "era-config", "", "Path to remote attestation config file in json format, if none provided the newest configuration will be loaded from github")
 	cmd.PersistentFlags().BoolVarP(&insecureEra, "insecure", "i", false, "Set to skip quote verification, needed when running in simulation mode")
+	cmd.AddCommand(newManifestCheck())
+	cmd.AddCommand(newManifestDiff())
 	cmd.AddCommand(newManifestGet())
+	cmd.AddCommand(newManifestInit())
 	cmd.AddCommand(newManifestLog())
+	cmd.AddCommand(newManifestPackage())
 	cmd.AddCommand(newManifestSet())
 	cmd.AddCommand(newManifestSignature())
 	cmd.AddCommand(newManifestUpdate())
@@ -36,8 +41,10 @@ or return a signature of the currently set manifest to the user`,
 }
 
 // cliDataGet requests data from the Coordinators rest api
-func cliDataGet(host, target, jsonPath string, cert []*pem.Block) ([]byte, error) {
-	client, err := restClient(cert, nil)
+//
+// clCert is optional and authenticates the request as a Marblerun user.
+func cliDataGet(host, target, jsonPath string, clCert *tls.Certificate, cert []*pem.Block) ([]byte, error) {
+	client, err := restClient(cert, clCert)
 	if err != nil {
 		return nil, err
 	}
@@ -60,7 +67,26 @@ func cliDataGet(host, target, jsonPath string, cert []*pem.Block) ([]byte, error
 		}
 		manifestData := gjson.GetBytes(respBody, jsonPath)
 		return []byte(manifestData.String()), nil
+	case http.StatusUnauthorized:
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unable to authorize user: %s", gjson.GetBytes(respBody, "message").String())
 	default:
 		return nil, fmt.Errorf("error connecting to server: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
 	}
 }
+
+// optionalClientCert loads a Marblerun user certificate if one was specified.
+// It is needed if the manifest restricts reading the manifest or the update log.
+func optionalClientCert(certFile, keyFile string) (*tls.Certificate, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	clCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &clCert, nil
+}
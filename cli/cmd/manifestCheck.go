@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// manifestCheckResult is the machine-readable output of the check command
+type manifestCheckResult struct {
+	Valid    bool
+	Error    string `json:",omitempty"`
+	Warnings []manifest.LintWarning
+}
+
+func newManifestCheck() *cobra.Command {
+	var format string
+	var strict bool
+
+	cmd := &cobra.Command{
+		Use:   "check <manifest.json>",
+		Short: "Checks a Marblerun manifest for errors and risky configurations",
+		Long: `
+Checks a Marblerun manifest offline with the same validation the Coordinator performs when the manifest is set.
+Additionally, warnings are reported for configurations which are valid, but likely unintended or risky.`,
+		Example: "manifest check manifest.json [--format=json] [--strict]",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestFile := args[0]
+
+			// Load manifest
+			rawManifest, err := loadManifestFile(manifestFile)
+			if err != nil {
+				return err
+			}
+
+			return cliManifestCheck(rawManifest, format, strict, os.Stdout)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&format, "format", "text", `Output format. One of {"text", "json"}`)
+	cmd.Flags().BoolVar(&strict, "strict", false, "Set to fail if any warnings are reported")
+
+	return cmd
+}
+
+// cliManifestCheck validates and lints a manifest and writes the result to out
+func cliManifestCheck(rawManifest []byte, format string, strict bool, out io.Writer) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported output format %s", format)
+	}
+
+	result := manifestCheckResult{Warnings: []manifest.LintWarning{}}
+	var mnf manifest.Manifest
+	err := json.Unmarshal(rawManifest, &mnf)
+	if err == nil {
+		err = mnf.Check(context.Background(), zap.NewNop())
+	}
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Valid = true
+		result.Warnings = append(result.Warnings, mnf.Lint()...)
+	}
+
+	if format == "json" {
+		if err := json.NewEncoder(out).Encode(result); err != nil {
+			return err
+		}
+	} else {
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(out, "warning: %s: %s [%s]\n", warning.Path, warning.Message, warning.Rule)
+		}
+		if result.Valid {
+			fmt.Fprintf(out, "Manifest is valid, %d warning(s)\n", len(result.Warnings))
+		}
+	}
+
+	if !result.Valid {
+		return fmt.Errorf("manifest is invalid: %s", result.Error)
+	}
+	if strict && len(result.Warnings) > 0 {
+		return errors.New("manifest check reported warnings")
+	}
+	return nil
+}
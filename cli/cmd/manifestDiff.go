@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+// diffExitCodeError is the exit code of the diff command if it fails. Like diff(1), differences exit with 1.
+const diffExitCodeError = 2
+
+// errManifestsDiffer is returned by the diff command if the manifests differ
+var errManifestsDiffer = errors.New("local manifest differs from the manifest of the Coordinator")
+
+// manifestSections are the sections of a manifest in the order they are compared
+var manifestSections = []string{"Packages", "Infrastructures", "Marbles", "Users", "Clients", "Secrets", "RecoveryKeys", "Roles", "TLS", "SecretProviders"}
+
+// manifestEntryDiff describes the difference of a single entry of a manifest section
+type manifestEntryDiff struct {
+	Section string
+	Name    string
+	// Change is either "added", "removed" or "changed"
+	Change string
+	// Fields lists the changed fields of a changed entry
+	Fields []string
+}
+
+func newManifestDiff() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <manifest.json> <IP:PORT>",
+		Short: "Compares a local manifest with the manifest of the Marblerun Coordinator",
+		Long: `
+Compares a local manifest with the active manifest of the Marblerun Coordinator.
+Updates of the SecurityVersion of packages are merged into the active manifest before comparing.
+The differences are printed per section of the manifest.
+The command exits with 0 if the manifests are equal, 1 if they differ and 2 if an error occurred.`,
+		Example: "manifest diff manifest.json example.com:4433 [--era-config=config.json] [--insecure]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			return diffExitError(cobra.ExactArgs(2)(cmd, args))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestFile := args[0]
+			hostName := args[1]
+
+			cert, err := verifyCoordinator(hostName, eraConfig, insecureEra)
+			if err != nil {
+				return diffExitError(err)
+			}
+
+			// Load manifest
+			localManifest, err := loadManifestFile(manifestFile)
+			if err != nil {
+				return diffExitError(err)
+			}
+
+			clCert, err := optionalClientCert(userCertFile, userKeyFile)
+			if err != nil {
+				return diffExitError(err)
+			}
+			response, err := cliDataGet(hostName, "manifest", "data", clCert, cert)
+			if err != nil {
+				return diffExitError(err)
+			}
+			activeManifest, err := decodeManifest(true, gjson.GetBytes(response, "Manifest").String(), hostName, clCert, cert)
+			if err != nil {
+				return diffExitError(err)
+			}
+
+			return diffExitError(cliManifestDiff([]byte(activeManifest), localManifest, os.Stdout))
+		},
+		SilenceUsage: true,
+	}
+	cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return diffExitError(err)
+	})
+
+	cmd.Flags().StringVarP(&userCertFile, "cert", "c", "", "PEM encoded Marblerun user certificate file, needed if reading the manifest is restricted")
+	cmd.Flags().StringVarP(&userKeyFile, "key", "k", "", "PEM encoded Marblerun user key file, needed if reading the manifest is restricted")
+
+	return cmd
+}
+
+// diffExitError sets the exit code of errors of the diff command, except for errManifestsDiffer
+func diffExitError(err error) error {
+	if err == nil || errors.Is(err, errManifestsDiffer) {
+		return err
+	}
+	return &exitError{code: diffExitCodeError, err: err}
+}
+
+// cliManifestDiff prints the differences between the active and a local manifest and returns errManifestsDiffer if they differ
+func cliManifestDiff(activeManifest, localManifest []byte, out io.Writer) error {
+	diffs, err := diffManifests(activeManifest, localManifest)
+	if err != nil {
+		return err
+	}
+	if len(diffs) <= 0 {
+		fmt.Fprintln(out, "No differences")
+		return nil
+	}
+
+	var section string
+	for _, diff := range diffs {
+		if diff.Section != section {
+			section = diff.Section
+			fmt.Fprintf(out, "%s:\n", section)
+		}
+		switch diff.Change {
+		case "added":
+			fmt.Fprintf(out, "  + %s\n", diff.Name)
+		case "removed":
+			fmt.Fprintf(out, "  - %s\n", diff.Name)
+		default:
+			fmt.Fprintf(out, "  ~ %s\n", diff.Name)
+			for _, field := range diff.Fields {
+				fmt.Fprintf(out, "      %s\n", field)
+			}
+		}
+	}
+	return errManifestsDiffer
+}
+
+// diffManifests compares two manifests section by section
+func diffManifests(oldManifest, newManifest []byte) ([]manifestEntryDiff, error) {
+	oldSections, err := normalizeManifest(oldManifest)
+	if err != nil {
+		return nil, err
+	}
+	newSections, err := normalizeManifest(newManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []manifestEntryDiff
+	for _, section := range manifestSections {
+		oldEntries, _ := oldSections[section].(map[string]interface{})
+		newEntries, _ := newSections[section].(map[string]interface{})
+		for _, name := range unionKeys(oldEntries, newEntries) {
+			oldEntry, inOld := oldEntries[name]
+			newEntry, inNew := newEntries[name]
+			switch {
+			case !inOld:
+				diffs = append(diffs, manifestEntryDiff{Section: section, Name: name, Change: "added"})
+			case !inNew:
+				diffs = append(diffs, manifestEntryDiff{Section: section, Name: name, Change: "removed"})
+			default:
+				if fields := diffFields("", oldEntry, newEntry); len(fields) > 0 {
+					diffs = append(diffs, manifestEntryDiff{Section: section, Name: name, Change: "changed", Fields: fields})
+				}
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// normalizeManifest parses a manifest and removes unset values, so manifests can be compared regardless of their formatting
+func normalizeManifest(rawManifest []byte) (map[string]interface{}, error) {
+	var mnf manifest.Manifest
+	if err := json.Unmarshal(rawManifest, &mnf); err != nil {
+		return nil, err
+	}
+	normalized, err := json.Marshal(mnf)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(normalized))
+	decoder.UseNumber()
+	var sections map[string]interface{}
+	if err := decoder.Decode(&sections); err != nil {
+		return nil, err
+	}
+	removeNil(sections)
+	return sections, nil
+}
+
+// diffFields returns the changed fields of an entry in the format "<path>: <old> -> <new>"
+func diffFields(path string, oldValue, newValue interface{}) []string {
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		var fields []string
+		for _, key := range unionKeys(oldMap, newMap) {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			fields = append(fields, diffFields(fieldPath, oldMap[key], newMap[key])...)
+		}
+		return fields
+	}
+
+	if reflect.DeepEqual(oldValue, newValue) {
+		return nil
+	}
+	if path == "" {
+		path = "value"
+	}
+	return []string{fmt.Sprintf("%s: %s -> %s", path, formatDiffValue(oldValue), formatDiffValue(newValue))}
+}
+
+// formatDiffValue formats a value of a manifest for the output of a diff
+func formatDiffValue(value interface{}) string {
+	if value == nil {
+		return "unset"
+	}
+	formatted, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(formatted)
+}
+
+// unionKeys returns the sorted keys of both maps
+func unionKeys(a, b map[string]interface{}) []string {
+	keySet := make(map[string]bool)
+	for key := range a {
+		keySet[key] = true
+	}
+	for key := range b {
+		keySet[key] = true
+	}
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 
@@ -29,12 +31,19 @@ Optionally get the manifests signature or merge updates into the displayed manif
 			if err != nil {
 				return err
 			}
+			clCert, err := optionalClientCert(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
 			fmt.Println("Successfully verified Coordinator, now requesting manifest")
-			response, err := cliDataGet(hostName, "manifest", "data", cert)
+			response, err := cliDataGet(hostName, "manifest", "data", clCert, cert)
+			if err != nil {
+				return err
+			}
+			manifest, err := decodeManifest(displayUpdate, gjson.GetBytes(response, "Manifest").String(), hostName, clCert, cert)
 			if err != nil {
 				return err
 			}
-			manifest, err := decodeManifest(displayUpdate, gjson.GetBytes(response, "Manifest").String(), hostName, cert)
 			if signature {
 				// wrap the signature and manifest into one json object
 				manifest = fmt.Sprintf("{\n\"ManifestSignature\": \"%s\",\n\"Manifest\": %s}", gjson.GetBytes(response, "ManifestSignature"), manifest)
@@ -52,21 +61,26 @@ Optionally get the manifests signature or merge updates into the displayed manif
 	cmd.Flags().BoolVarP(&signature, "signature", "s", false, "Set to additionally display the manifests signature")
 	cmd.Flags().BoolVarP(&displayUpdate, "display-update", "u", false, "Set to merge updates into the displayed manifest")
 	cmd.Flags().StringVarP(&output, "output", "o", "", "Save output to file instead of printing to stdout")
+	cmd.Flags().StringVarP(&userCertFile, "cert", "c", "", "PEM encoded Marblerun user certificate file, needed if reading the manifest is restricted")
+	cmd.Flags().StringVarP(&userKeyFile, "key", "k", "", "PEM encoded Marblerun user key file, needed if reading the manifest is restricted")
 	return cmd
 }
 
 // decodeManifest parses a base64 encoded manifest and optionally merges updates
-func decodeManifest(displayUpdate bool, encodedManifest, hostName string, cert []*pem.Block) (string, error) {
+func decodeManifest(displayUpdate bool, encodedManifest, hostName string, clCert *tls.Certificate, cert []*pem.Block) (string, error) {
 	manifest, err := base64.StdEncoding.DecodeString(encodedManifest)
 	if err != nil {
 		return "", err
 	}
+	if len(manifest) <= 0 {
+		return "", errors.New("the Coordinator did not return a manifest: either none is set or reading it requires a user certificate with the ReadManifest permission")
+	}
 
 	if !displayUpdate {
 		return string(manifest), nil
 	}
 
-	log, err := cliDataGet(hostName, "update", "data", cert)
+	log, err := cliDataGet(hostName, "update", "data", clCert, cert)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newManifestInit() *cobra.Command {
+	var uniqueID bool
+
+	cmd := &cobra.Command{
+		Use:   "init <manifest.json> [<package name>=<enclave artifact> ...]",
+		Short: "Creates a new manifest from enclave artifacts",
+		Long: `
+Creates a new manifest with a package and a Marble for each given enclave artifact.
+Supported artifacts are EGo binaries, signed Open Enclave and SGX SDK enclaves,
+the root directory of an Occlum image, and Gramine/Graphene .sig files.
+The manifest is written in YAML format if the file has a .yaml or .yml extension.`,
+		Example: "manifest init manifest.json backend=./backend frontend=./frontend.sig [--unique-id]",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestFile := args[0]
+
+			if err := cliManifestInit(manifestFile, args[1:], uniqueID); err != nil {
+				return err
+			}
+			fmt.Printf("Manifest written to %s\n", manifestFile)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVar(&uniqueID, "unique-id", false, "Set to identify the packages by their UniqueID instead of SignerID, ProductID and SecurityVersion")
+
+	return cmd
+}
+
+// cliManifestInit writes a new manifest with a package and a marble for each artifact in the format <package name>=<enclave artifact>
+func cliManifestInit(manifestFile string, artifacts []string, uniqueID bool) error {
+	if _, err := os.Stat(manifestFile); err == nil {
+		return fmt.Errorf("%s already exists", manifestFile)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	packages := make(map[string]interface{})
+	marbles := make(map[string]interface{})
+	for _, arg := range artifacts {
+		split := strings.SplitN(arg, "=", 2)
+		if len(split) != 2 || split[0] == "" || split[1] == "" {
+			return fmt.Errorf("invalid argument %s: expected <package name>=<enclave artifact>", arg)
+		}
+		pkg, err := packageEntry(split[1], uniqueID)
+		if err != nil {
+			return fmt.Errorf("package %s: %v", split[0], err)
+		}
+		packages[split[0]] = pkg
+		marbles[split[0]] = map[string]interface{}{"Package": split[0]}
+	}
+
+	return writeManifestFile(manifestFile, map[string]interface{}{
+		"Packages": packages,
+		"Marbles":  marbles,
+	})
+}
@@ -23,8 +23,12 @@ func newManifestLog() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			clCert, err := optionalClientCert(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
 			fmt.Println("Successfully verified Coordinator, now requesting update log")
-			response, err := cliDataGet(hostName, "update", "data", cert)
+			response, err := cliDataGet(hostName, "update", "data", clCert, cert)
 			if err != nil {
 				return err
 			}
@@ -37,5 +41,7 @@ func newManifestLog() *cobra.Command {
 		SilenceUsage: true,
 	}
 	cmd.Flags().StringVarP(&output, "output", "o", "", "Save log to file instead of printing to stdout")
+	cmd.Flags().StringVarP(&userCertFile, "cert", "c", "", "PEM encoded Marblerun user certificate file, needed if reading the update log is restricted")
+	cmd.Flags().StringVarP(&userKeyFile, "key", "k", "", "PEM encoded Marblerun user key file, needed if reading the update log is restricted")
 	return cmd
 }
@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newManifestPackage() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "package",
+		Short: "Manages the packages of a local Marblerun manifest",
+		Long:  "Manages the packages of a local Marblerun manifest",
+		Args:  cobra.NoArgs,
+	}
+	cmd.AddCommand(newManifestPackageAdd())
+
+	return cmd
+}
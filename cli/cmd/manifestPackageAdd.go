@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+func newManifestPackageAdd() *cobra.Command {
+	var uniqueID bool
+
+	cmd := &cobra.Command{
+		Use:   "add <manifest.json> <package name> <enclave artifact>",
+		Short: "Adds or updates a package of a manifest with the properties of an enclave",
+		Long: `
+Adds or updates a package of a manifest with the properties read from an enclave artifact.
+Supported artifacts are EGo binaries, signed Open Enclave and SGX SDK enclaves,
+the root directory of an Occlum image, and Gramine/Graphene .sig files.
+By default, the package is identified by SignerID, ProductID and SecurityVersion.`,
+		Example: "manifest package add manifest.json backend ./backend.sig [--unique-id]",
+		Args:    cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestFile := args[0]
+			packageName := args[1]
+			artifact := args[2]
+
+			if err := cliManifestPackageAdd(manifestFile, packageName, artifact, uniqueID); err != nil {
+				return err
+			}
+			fmt.Printf("Package %s written to %s\n", packageName, manifestFile)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVar(&uniqueID, "unique-id", false, "Set to identify the package by its UniqueID instead of SignerID, ProductID and SecurityVersion")
+
+	return cmd
+}
+
+// cliManifestPackageAdd sets a package of a manifest file to the properties of an enclave artifact
+func cliManifestPackageAdd(manifestFile, packageName, artifact string, uniqueID bool) error {
+	pkg, err := packageEntry(artifact, uniqueID)
+	if err != nil {
+		return err
+	}
+
+	manifestData, err := loadManifestFile(manifestFile)
+	if err != nil {
+		return err
+	}
+	// decode into a map, so the other content of the manifest stays unchanged
+	decoder := json.NewDecoder(bytes.NewReader(manifestData))
+	decoder.UseNumber()
+	var mnf map[string]interface{}
+	if err := decoder.Decode(&mnf); err != nil {
+		return err
+	}
+
+	packages, ok := mnf["Packages"].(map[string]interface{})
+	if !ok {
+		packages = make(map[string]interface{})
+		mnf["Packages"] = packages
+	}
+	packages[packageName] = pkg
+
+	return writeManifestFile(manifestFile, mnf)
+}
+
+// packageEntry returns the package entry of a manifest for an enclave artifact
+func packageEntry(artifact string, uniqueID bool) (map[string]interface{}, error) {
+	properties, err := packagePropertiesFromArtifact(artifact)
+	if err != nil {
+		return nil, err
+	}
+
+	if uniqueID {
+		return map[string]interface{}{
+			"UniqueID": properties.UniqueID,
+			"Debug":    properties.Debug,
+		}, nil
+	}
+	return map[string]interface{}{
+		"SignerID":        properties.SignerID,
+		"ProductID":       *properties.ProductID,
+		"SecurityVersion": *properties.SecurityVersion,
+		"Debug":           properties.Debug,
+	}, nil
+}
+
+// writeManifestFile writes a manifest to a file in YAML format if the file has a .yaml or .yml extension, and in JSON format otherwise
+func writeManifestFile(filename string, mnf map[string]interface{}) error {
+	manifestData, err := json.MarshalIndent(mnf, "", "    ")
+	if err != nil {
+		return err
+	}
+	if ext := filepath.Ext(filename); ext == ".yaml" || ext == ".yml" {
+		if manifestData, err = yaml.JSONToYAML(manifestData); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filename, manifestData, 0644)
+}
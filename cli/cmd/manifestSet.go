@@ -2,12 +2,14 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
 
 	"github.com/spf13/cobra"
 	"github.com/tidwall/gjson"
@@ -16,6 +18,7 @@ import (
 
 func newManifestSet() *cobra.Command {
 	var recoveryFilename string
+	var dryRun bool
 
 	cmd := &cobra.Command{
 		Use:   "set <manifest.json> <IP:PORT>",
@@ -31,14 +34,22 @@ func newManifestSet() *cobra.Command {
 				return err
 			}
 
-			fmt.Println("Successfully verified Coordinator, now uploading manifest")
-
 			// Load manifest
 			manifest, err := loadManifestFile(manifestFile)
 			if err != nil {
 				return err
 			}
-			signature := cliManifestSignature(manifest)
+
+			if dryRun {
+				fmt.Println("Successfully verified Coordinator, now checking manifest")
+				return cliManifestDryRun(manifest, hostName, "manifest", nil, cert)
+			}
+
+			fmt.Println("Successfully verified Coordinator, now uploading manifest")
+			signature, err := cliManifestSignature(manifest)
+			if err != nil {
+				return err
+			}
 			fmt.Printf("Manifest signature: %s\n", signature)
 
 			return cliManifestSet(manifest, hostName, cert, recoveryFilename)
@@ -47,6 +58,7 @@ func newManifestSet() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&recoveryFilename, "recoverydata", "r", "", "File to write recovery data to, print to stdout if non specified")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Check if the manifest would be accepted and print the resulting changes without setting it")
 
 	return cmd
 }
@@ -107,6 +119,65 @@ func cliManifestSet(manifest []byte, host string, cert []*pem.Block, recover str
 	return nil
 }
 
+// cliManifestDryRun checks a manifest or update manifest with the Coordinator and prints the changes it would apply
+func cliManifestDryRun(manifest []byte, host string, path string, clCert *tls.Certificate, caCert []*pem.Block) error {
+	client, err := restClient(caCert, clCert)
+	if err != nil {
+		return err
+	}
+
+	url := url.URL{Scheme: "https", Host: host, Path: path, RawQuery: "dryRun=true"}
+	resp, err := client.Post(url.String(), "application/json", bytes.NewReader(manifest))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var changes struct {
+			Packages    map[string]string
+			Secrets     []string
+			MarbleTypes []string
+		}
+		if err := json.Unmarshal([]byte(gjson.GetBytes(respBody, "data").Raw), &changes); err != nil {
+			return err
+		}
+
+		fmt.Println("Manifest would be accepted with the following changes:")
+		fmt.Println("Packages:")
+		packages := make([]string, 0, len(changes.Packages))
+		for name := range changes.Packages {
+			packages = append(packages, name)
+		}
+		sort.Strings(packages)
+		for _, name := range packages {
+			fmt.Printf("\t%s: %s\n", name, changes.Packages[name])
+		}
+		fmt.Println("Secrets to generate:")
+		for _, name := range changes.Secrets {
+			fmt.Printf("\t%s\n", name)
+		}
+		fmt.Println("Affected Marble types:")
+		for _, name := range changes.MarbleTypes {
+			fmt.Printf("\t%s\n", name)
+		}
+	case http.StatusBadRequest:
+		return fmt.Errorf("manifest would be rejected: %s", gjson.GetBytes(respBody, "message").String())
+	case http.StatusUnauthorized:
+		return fmt.Errorf("unable to authorize user: %s", gjson.GetBytes(respBody, "message").String())
+	default:
+		return fmt.Errorf("error connecting to server: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return nil
+}
+
 // loadManifestFile loads a manifest in either json or yaml format and returns the data as json
 func loadManifestFile(filename string) ([]byte, error) {
 	manifestData, err := ioutil.ReadFile(filename)
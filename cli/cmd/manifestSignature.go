@@ -1,10 +1,10 @@
 package cmd
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
 	"github.com/spf13/cobra"
 )
 
@@ -12,7 +12,7 @@ func newManifestSignature() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "signature <manifest.json>",
 		Short: "Prints the signature of a Marblerun manifest",
-		Long:  "Prints the signature of a Marblerun manifest",
+		Long:  "Prints the signature of a Marblerun manifest in JSON or YAML format. The signature does not depend on the format, formatting or key order of the manifest.",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			manifestFile := args[0]
@@ -23,7 +23,10 @@ func newManifestSignature() *cobra.Command {
 				return err
 			}
 
-			signature := cliManifestSignature(manifest)
+			signature, err := cliManifestSignature(manifest)
+			if err != nil {
+				return err
+			}
 			fmt.Printf("%s\n", signature)
 			return nil
 		},
@@ -33,7 +36,11 @@ func newManifestSignature() *cobra.Command {
 	return cmd
 }
 
-func cliManifestSignature(rawManifest []byte) string {
-	hash := sha256.Sum256(rawManifest)
-	return hex.EncodeToString(hash[:])
+// cliManifestSignature returns the signature of a manifest in JSON or YAML format, which is the hash of its canonical form
+func cliManifestSignature(rawManifest []byte) (string, error) {
+	signature, err := manifest.Signature(rawManifest)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(signature), nil
 }
@@ -16,6 +16,7 @@ import (
 func newManifestUpdate() *cobra.Command {
 	var clientAdminCert string
 	var clientAdminKey string
+	var dryRun bool
 
 	cmd := &cobra.Command{
 		Use:   "update <manifest.json> <IP:PORT>",
@@ -46,6 +47,11 @@ An admin certificate specified in the original manifest is needed to verify the
 				return err
 			}
 
+			if dryRun {
+				fmt.Println("Successfully verified Coordinator, now checking manifest")
+				return cliManifestDryRun(manifest, hostName, "update", &clCert, caCert)
+			}
+
 			fmt.Println("Successfully verified Coordinator, now uploading manifest")
 
 			return cliManifestUpdate(manifest, hostName, clCert, caCert)
@@ -57,6 +63,7 @@ An admin certificate specified in the original manifest is needed to verify the
 	cmd.MarkFlagRequired("cert")
 	cmd.Flags().StringVarP(&clientAdminKey, "key", "k", "", "PEM encoded admin key file (required)")
 	cmd.MarkFlagRequired("key")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Check if the update would be accepted and print the resulting changes without applying it")
 
 	return cmd
 }
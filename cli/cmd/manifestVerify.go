@@ -63,12 +63,12 @@ func getSignatureFromString(manifest string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return cliManifestSignature(rawManifest), nil
+	return cliManifestSignature(rawManifest)
 }
 
 // cliManifestVerify verifies if a signature returned by the Marblerun Coordinator is equal to one locally created
 func cliManifestVerify(localSignature string, host string, cert []*pem.Block) error {
-	remoteSignature, err := cliDataGet(host, "manifest", "data.ManifestSignature", cert)
+	remoteSignature, err := cliDataGet(host, "manifest", "data.ManifestSignature", nil, cert)
 	if err != nil {
 		return err
 	}
@@ -1,17 +1,21 @@
 package cmd
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
 	"github.com/edgelesssys/marblerun/coordinator/server"
 	"github.com/edgelesssys/marblerun/test"
 	"github.com/stretchr/testify/assert"
@@ -42,14 +46,14 @@ func TestCliManifestGet(t *testing.T) {
 	}))
 	defer s.Close()
 
-	resp, err := cliDataGet(host, "manifest", "data.ManifestSignature", []*pem.Block{cert})
+	resp, err := cliDataGet(host, "manifest", "data.ManifestSignature", nil, []*pem.Block{cert})
 	require.NoError(err)
 	assert.Equal("TestSignature", string(resp))
 
 	s.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 	})
-	_, err = cliDataGet(host, "manifest", "data.ManifestSignature", []*pem.Block{cert})
+	_, err = cliDataGet(host, "manifest", "data.ManifestSignature", nil, []*pem.Block{cert})
 	require.Error(err)
 }
 
@@ -77,7 +81,7 @@ func TestDecodeManifest(t *testing.T) {
 	wrapped, err := json.Marshal(responseStruct{[]byte(test.ManifestJSON)})
 	require.NoError(err)
 
-	manifest, err := decodeManifest(false, gjson.GetBytes(wrapped, "Manifest").String(), "", nil)
+	manifest, err := decodeManifest(false, gjson.GetBytes(wrapped, "Manifest").String(), "", nil, nil)
 	assert.NoError(err)
 	assert.Equal(test.ManifestJSON, manifest)
 }
@@ -212,6 +216,221 @@ func TestCliManifestUpdate(t *testing.T) {
 	require.Error(err)
 }
 
+func TestCliManifestDryRun(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	s, host, cert := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/update?dryRun=true", r.RequestURI)
+		assert.Equal(http.MethodPost, r.Method)
+
+		reqData, err := ioutil.ReadAll(r.Body)
+		assert.NoError(err)
+
+		switch string(reqData) {
+		case "00":
+			serverResp := server.GeneralResponse{
+				Status: "success",
+				Data: map[string]interface{}{
+					"Packages":    map[string]string{"frontend": "SecurityVersion 1 -> 2"},
+					"Secrets":     []string{"cert_shared"},
+					"MarbleTypes": []string{"frontend"},
+				},
+			}
+			assert.NoError(json.NewEncoder(w).Encode(serverResp))
+		case "11":
+			w.WriteHeader(http.StatusBadRequest)
+		case "22":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer s.Close()
+
+	clCert := tls.Certificate{}
+
+	err := cliManifestDryRun([]byte("00"), host, "update", &clCert, []*pem.Block{cert})
+	require.NoError(err)
+
+	err = cliManifestDryRun([]byte("11"), host, "update", &clCert, []*pem.Block{cert})
+	require.Error(err)
+
+	err = cliManifestDryRun([]byte("22"), host, "update", &clCert, []*pem.Block{cert})
+	require.Error(err)
+
+	err = cliManifestDryRun([]byte("33"), host, "update", &clCert, []*pem.Block{cert})
+	require.Error(err)
+}
+
+func TestCliManifestCheck(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+	require.NoError(cliManifestCheck([]byte(test.ManifestJSON), "text", false, &out))
+	assert.Contains(out.String(), "warning: Packages.frontend")
+	assert.Contains(out.String(), "Manifest is valid")
+
+	out.Reset()
+	assert.Error(cliManifestCheck([]byte(test.ManifestJSON), "text", true, &out))
+
+	out.Reset()
+	require.NoError(cliManifestCheck([]byte(test.ManifestJSON), "json", false, &out))
+	var result manifestCheckResult
+	require.NoError(json.Unmarshal(out.Bytes(), &result))
+	assert.True(result.Valid)
+	assert.NotEmpty(result.Warnings)
+
+	out.Reset()
+	assert.Error(cliManifestCheck([]byte(`{"Packages":{}}`), "json", false, &out))
+	require.NoError(json.Unmarshal(out.Bytes(), &result))
+	assert.False(result.Valid)
+	assert.NotEmpty(result.Error)
+
+	// users and recovery keys are checked like the Coordinator does
+	var mnf manifest.Manifest
+	require.NoError(json.Unmarshal([]byte(test.ManifestJSONWithRecoveryKey), &mnf))
+	mnf.RecoveryKeys["invalid"] = "invalid"
+	invalidManifest, err := json.Marshal(mnf)
+	require.NoError(err)
+	out.Reset()
+	assert.Error(cliManifestCheck(invalidManifest, "text", false, &out))
+	require.NoError(json.Unmarshal([]byte(test.ManifestJSONWithRecoveryKey), &mnf))
+	admin := mnf.Users["admin"]
+	admin.Certificate = "-----BEGIN CERTIFICATE-----\naW52YWxpZA==\n-----END CERTIFICATE-----\n"
+	mnf.Users["admin"] = admin
+	invalidManifest, err = json.Marshal(mnf)
+	require.NoError(err)
+	out.Reset()
+	assert.Error(cliManifestCheck(invalidManifest, "text", false, &out))
+
+	assert.Error(cliManifestCheck([]byte(test.ManifestJSON), "xml", false, &out))
+}
+
+func TestCliManifestDiff(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+	require.NoError(cliManifestDiff([]byte(test.ManifestJSON), []byte(test.ManifestJSON), &out))
+	assert.Equal("No differences\n", out.String())
+
+	var mnf manifest.Manifest
+	require.NoError(json.Unmarshal([]byte(test.ManifestJSON), &mnf))
+	securityVersion := uint(5)
+	frontend := mnf.Packages["frontend"]
+	frontend.SecurityVersion = &securityVersion
+	frontend.Debug = false
+	mnf.Packages["frontend"] = frontend
+	mnf.Marbles["new_marble"] = manifest.Marble{Package: "frontend"}
+	delete(mnf.Secrets, "cert_private")
+	localManifest, err := json.Marshal(mnf)
+	require.NoError(err)
+
+	diffs, err := diffManifests([]byte(test.ManifestJSON), localManifest)
+	require.NoError(err)
+	assert.Equal([]manifestEntryDiff{
+		{Section: "Packages", Name: "frontend", Change: "changed", Fields: []string{"Debug: true -> false", "SecurityVersion: 3 -> 5"}},
+		{Section: "Marbles", Name: "new_marble", Change: "added"},
+		{Section: "Secrets", Name: "cert_private", Change: "removed"},
+	}, diffs)
+
+	out.Reset()
+	err = diffExitError(cliManifestDiff([]byte(test.ManifestJSON), localManifest, &out))
+	assert.Equal(errManifestsDiffer, err)
+	assert.Equal(1, ExitCode(err))
+	assert.Equal(`Packages:
+  ~ frontend
+      Debug: true -> false
+      SecurityVersion: 3 -> 5
+Marbles:
+  + new_marble
+Secrets:
+  - cert_private
+`, out.String())
+
+	_, err = diffManifests([]byte(test.ManifestJSON), []byte("invalid"))
+	assert.Error(err)
+
+	// errors exit with 2, like diff(1)
+	err = diffExitError(cliManifestDiff([]byte(test.ManifestJSON), []byte("invalid"), &out))
+	assert.Equal(diffExitCodeError, ExitCode(err))
+	cmd := newManifestDiff()
+	cmd.SetArgs([]string{"manifest.json"})
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	assert.Equal(diffExitCodeError, ExitCode(cmd.Execute()))
+	cmd = newManifestDiff()
+	cmd.SetArgs([]string{"--unknown", "manifest.json", "localhost"})
+	assert.Equal(diffExitCodeError, ExitCode(cmd.Execute()))
+	assert.Equal(0, ExitCode(nil))
+	assert.Equal(1, ExitCode(errors.New("failed")))
+}
+
+func TestCliManifestInit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "unittest")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	sigFile := filepath.Join(dir, "backend.sig")
+	require.NoError(ioutil.WriteFile(sigFile, newTestSigStruct(false), 0644))
+
+	manifestFile := filepath.Join(dir, "manifest.yaml")
+	require.NoError(cliManifestInit(manifestFile, []string{"backend=" + sigFile}, false))
+	rawManifest, err := loadManifestFile(manifestFile)
+	require.NoError(err)
+	var mnf manifest.Manifest
+	require.NoError(json.Unmarshal(rawManifest, &mnf))
+	assert.EqualValues(3, *mnf.Packages["backend"].ProductID)
+	assert.EqualValues(7, *mnf.Packages["backend"].SecurityVersion)
+	assert.Empty(mnf.Packages["backend"].UniqueID)
+	assert.False(mnf.Packages["backend"].Debug)
+	assert.Equal("backend", mnf.Marbles["backend"].Package)
+
+	// existing manifests are not overwritten
+	assert.Error(cliManifestInit(manifestFile, nil, false))
+
+	assert.Error(cliManifestInit(filepath.Join(dir, "other.json"), []string{"backend"}, false))
+	assert.Error(cliManifestInit(filepath.Join(dir, "other.json"), []string{"backend=" + filepath.Join(dir, "missing.sig")}, false))
+}
+
+func TestCliManifestPackageAdd(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "unittest")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	sigFile := filepath.Join(dir, "frontend.sig")
+	require.NoError(ioutil.WriteFile(sigFile, newTestSigStruct(true), 0644))
+	manifestFile := filepath.Join(dir, "manifest.json")
+	require.NoError(ioutil.WriteFile(manifestFile, []byte(test.ManifestJSON), 0644))
+
+	require.NoError(cliManifestPackageAdd(manifestFile, "frontend", sigFile, true))
+	require.NoError(cliManifestPackageAdd(manifestFile, "new", sigFile, false))
+
+	rawManifest, err := loadManifestFile(manifestFile)
+	require.NoError(err)
+	var mnf manifest.Manifest
+	require.NoError(json.Unmarshal(rawManifest, &mnf))
+	assert.Equal(strings.Repeat("aa", 32), mnf.Packages["frontend"].UniqueID)
+	assert.Empty(mnf.Packages["frontend"].SignerID)
+	assert.Nil(mnf.Packages["frontend"].ProductID)
+	assert.True(mnf.Packages["frontend"].Debug)
+	assert.EqualValues(7, *mnf.Packages["new"].SecurityVersion)
+
+	// the rest of the manifest is unchanged
+	var expected manifest.Manifest
+	require.NoError(json.Unmarshal([]byte(test.ManifestJSON), &expected))
+	assert.Equal(expected.Packages["backend"], mnf.Packages["backend"])
+	assert.Equal(expected.Marbles, mnf.Marbles)
+	assert.Equal(expected.Secrets, mnf.Secrets)
+
+	assert.Error(cliManifestPackageAdd(filepath.Join(dir, "missing.json"), "frontend", sigFile, false))
+}
+
 func TestLoadJSON(t *testing.T) {
 	require := require.New(t)
 	assert := assert.New(t)
@@ -305,10 +524,38 @@ This should return an error
 func TestCliManifestSignature(t *testing.T) {
 	assert := assert.New(t)
 
-	testValue := []byte("Test")
+	require := require.New(t)
+
+	// signature is the hash of the canonical form
+	testValue := []byte(`{"Packages":{"backend":{"ProductID":1,"SignerID":"<&>"}}}`)
 	hash := sha256.Sum256(testValue)
-	signature := hex.EncodeToString(hash[:])
-	assert.Equal(signature, cliManifestSignature(testValue))
+	signature, err := cliManifestSignature(testValue)
+	require.NoError(err)
+	assert.Equal(hex.EncodeToString(hash[:]), signature)
+
+	// formatting and key order do not change the signature
+	reordered := []byte(`{
+	"Packages": {
+		"backend": {
+			"SignerID": "<&>",
+			"ProductID": 1
+		}
+	}
+}`)
+	yamlValue := []byte(`
+Packages:
+  backend:
+    SignerID: "<&>"
+    ProductID: 1
+`)
+	for _, value := range [][]byte{reordered, yamlValue} {
+		otherSignature, err := cliManifestSignature(value)
+		require.NoError(err)
+		assert.Equal(signature, otherSignature)
+	}
+
+	_, err = cliManifestSignature([]byte("Test"))
+	assert.Error(err)
 }
 
 func TestCliManifestVerify(t *testing.T) {
@@ -349,7 +596,7 @@ func TestGetSignatureFromString(t *testing.T) {
 	require.NoError(err)
 	defer os.Remove(tmpFile.Name())
 
-	testValue := []byte("TestSignature")
+	testValue := []byte(`{"Packages":{}}`)
 	hash := sha256.Sum256(testValue)
 	directSignature := hex.EncodeToString(hash[:])
 
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
@@ -33,22 +34,31 @@ func newRecoverCmd() *cobra.Command {
 				return err
 			}
 
+			clCert, err := optionalClientCert(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
+
 			fmt.Println("Successfully verified Coordinator, now uploading key")
 
-			return cliRecover(hostName, recoveryKey, cert)
+			return cliRecover(hostName, recoveryKey, clCert, cert)
 		},
 		SilenceUsage: true,
 	}
 
 	cmd.Flags().StringVar(&eraConfig, "era-config", "", "Path to remote attestation config file in json format, if none provided the newest configuration will be loaded from github")
 	cmd.Flags().BoolVarP(&insecureEra, "insecure", "i", false, "Set to skip quote verification, needed when running in simulation mode")
+	cmd.Flags().StringVarP(&userCertFile, "cert", "c", "", "PEM encoded Marblerun user certificate file, needed if recovery is restricted")
+	cmd.Flags().StringVarP(&userKeyFile, "key", "k", "", "PEM encoded Marblerun user key file, needed if recovery is restricted")
 
 	return cmd
 }
 
 // cliRecover tries to unseal the Coordinator by uploading the recovery key
-func cliRecover(host string, key []byte, cert []*pem.Block) error {
-	client, err := restClient(cert, nil)
+//
+// clCert is optional and authenticates the request as a Marblerun user.
+func cliRecover(host string, key []byte, clCert *tls.Certificate, cert []*pem.Block) error {
+	client, err := restClient(cert, clCert)
 	if err != nil {
 		return err
 	}
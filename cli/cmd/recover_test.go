@@ -45,9 +45,9 @@ func TestCliRecover(t *testing.T) {
 
 	defer s.Close()
 
-	err := cliRecover(host, []byte{0xAA, 0xAA}, []*pem.Block{cert})
+	err := cliRecover(host, []byte{0xAA, 0xAA}, nil, []*pem.Block{cert})
 	require.NoError(err)
 
-	err = cliRecover(host, []byte("Return Error"), []*pem.Block{cert})
+	err = cliRecover(host, []byte("Return Error"), nil, []*pem.Block{cert})
 	require.Error(err)
 }
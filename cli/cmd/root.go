@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"errors"
+
 	"github.com/spf13/cobra"
 )
 
@@ -23,6 +25,32 @@ func Execute() error {
 	return rootCmd.Execute()
 }
 
+// exitError is returned by commands whose failures need a specific exit code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// ExitCode returns the exit code of the CLI for an error returned by Execute
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return 1
+}
+
 func init() {
 	rootCmd.AddCommand(newCertificateCmd())
 	rootCmd.AddCommand(newCheckCmd())
@@ -33,6 +61,7 @@ func init() {
 	rootCmd.AddCommand(newNamespaceCmd())
 	rootCmd.AddCommand(newPrecheckCmd())
 	rootCmd.AddCommand(newRecoverCmd())
+	rootCmd.AddCommand(newSealKeyCmd())
 	rootCmd.AddCommand(newSecretCmd())
 	rootCmd.AddCommand(newSGXSDKPackageInfoCmd())
 	rootCmd.AddCommand(newStatusCmd())
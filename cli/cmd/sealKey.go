@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newSealKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sealkey",
+		Short: "Manages the seal keys of the Marblerun Coordinator",
+		Long: `
+Manages the master key the Marbles' seal keys are derived from.
+Rotate the master key, or export and import it to restore the seal keys
+of all Marbles on a newly set up Coordinator.`,
+	}
+
+	cmd.PersistentFlags().StringVar(&eraConfig, "era-config", "", "Path to remote attestation config file in json format, if none provided the newest configuration will be loaded from github")
+	cmd.PersistentFlags().StringVarP(&userCertFile, "cert", "c", "", "PEM encoded Marblerun user certificate file (required)")
+	cmd.PersistentFlags().StringVarP(&userKeyFile, "key", "k", "", "PEM encoded Marblerun user key file (required)")
+	cmd.PersistentFlags().BoolVarP(&insecureEra, "insecure", "i", false, "Set to skip quote verification, needed when running in simulation mode")
+	cmd.MarkPersistentFlagRequired("key")
+	cmd.MarkPersistentFlagRequired("cert")
+	cmd.AddCommand(newSealKeyRotate())
+	cmd.AddCommand(newSealKeyExport())
+	cmd.AddCommand(newSealKeyImport())
+
+	return cmd
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+type sealKeyExportOptions struct {
+	host            string
+	recoveryKeyName string
+	recoveryKeyFile string
+	output          string
+	clCert          tls.Certificate
+	caCert          []*pem.Block
+}
+
+func newSealKeyExport() *cobra.Command {
+	options := &sealKeyExportOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "export <IP:PORT>",
+		Short: "Exports the seal master keys of the Marblerun Coordinator",
+		Long: `
+Exports all versions of the seal master key of the Marblerun Coordinator.
+The Coordinator encrypts the keys to the recovery keys of the manifest,
+they are decrypted locally with the private key of the given recovery key.
+The exported keys can be imported to a newly set up Coordinator.
+Users have to authenticate themselves using a certificate and private key,
+and need permissions in the manifest to export the seal keys.
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hostName := args[0]
+			caCert, err := verifyCoordinator(hostName, eraConfig, insecureEra)
+			if err != nil {
+				return err
+			}
+
+			// Load client certificate and key
+			clCert, err := tls.LoadX509KeyPair(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
+
+			options.host = hostName
+			options.caCert = caCert
+			options.clCert = clCert
+
+			return cliSealKeyExport(options)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&options.recoveryKeyName, "recovery-key-name", "", "Name of the recovery key in the manifest (required)")
+	cmd.Flags().StringVar(&options.recoveryKeyFile, "recovery-key", "", "PEM encoded RSA private key of the recovery key (required)")
+	cmd.Flags().StringVarP(&options.output, "output", "o", "", "File to save the decrypted seal keys to (required)")
+	cmd.MarkFlagRequired("recovery-key-name")
+	cmd.MarkFlagRequired("recovery-key")
+	cmd.MarkFlagRequired("output")
+
+	return cmd
+}
+
+// cliSealKeyExport requests the encrypted seal master keys and saves them decrypted to a file
+func cliSealKeyExport(o *sealKeyExportOptions) error {
+	rawRecoveryKey, err := ioutil.ReadFile(o.recoveryKeyFile)
+	if err != nil {
+		return err
+	}
+	recoveryKey, err := parseRSAPrivateKey(rawRecoveryKey)
+	if err != nil {
+		return err
+	}
+
+	client, err := restClient(o.caCert, &o.clCert)
+	if err != nil {
+		return err
+	}
+
+	url := url.URL{Scheme: "https", Host: o.host, Path: "sealkeys"}
+	resp, err := client.Get(url.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var exported map[string]map[string][]byte
+		if err := json.Unmarshal([]byte(gjson.GetBytes(respBody, "data").Raw), &exported); err != nil {
+			return err
+		}
+		sealKeys, ok := exported[o.recoveryKeyName]
+		if !ok {
+			return fmt.Errorf("no seal keys exported for recovery key %s", o.recoveryKeyName)
+		}
+		for version, encryptedKey := range sealKeys {
+			sealKeys[version], err = util.DecryptOAEP(recoveryKey, encryptedKey)
+			if err != nil {
+				return fmt.Errorf("decrypting seal key of version %s: %v", version, err)
+			}
+		}
+		rawSealKeys, err := json.Marshal(sealKeys)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(o.output, rawSealKeys, 0o600); err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d seal key versions to %s\n", len(sealKeys), o.output)
+	case http.StatusBadRequest:
+		// Something went wrong
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to export seal keys: %s", response)
+	case http.StatusUnauthorized:
+		// User was not authorized
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to authorize user: %s", response)
+	default:
+		return fmt.Errorf("error connecting to server: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return nil
+}
+
+// parseRSAPrivateKey parses a PEM encoded RSA private key in PKCS #1 or PKCS #8 format
+func parseRSAPrivateKey(rawKey []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(rawKey)
+	if block == nil {
+		return nil, errors.New("recovery key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("recovery key is not an RSA key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+func newSealKeyImport() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <sealkeys.json> <IP:PORT>",
+		Short: "Imports seal master keys to the Marblerun Coordinator",
+		Long: `
+Imports seal master keys previously exported with "marblerun sealkey export".
+The imported keys replace the seal master keys of the Coordinator,
+so Marbles get the same seal keys as before.
+Seal keys can only be imported before the first Marble is activated.
+Users have to authenticate themselves using a certificate and private key,
+and need permissions in the manifest to import seal keys.
+`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sealKeysFile := args[0]
+			hostName := args[1]
+
+			sealKeys, err := ioutil.ReadFile(sealKeysFile)
+			if err != nil {
+				return err
+			}
+
+			caCert, err := verifyCoordinator(hostName, eraConfig, insecureEra)
+			if err != nil {
+				return err
+			}
+
+			// Load client certificate and key
+			clCert, err := tls.LoadX509KeyPair(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
+
+			return cliSealKeyImport(hostName, sealKeys, clCert, caCert)
+		},
+		SilenceUsage: true,
+	}
+
+	return cmd
+}
+
+// cliSealKeyImport uploads seal master keys to the Marblerun Coordinator
+func cliSealKeyImport(host string, sealKeys []byte, clCert tls.Certificate, caCert []*pem.Block) error {
+	client, err := restClient(caCert, &clCert)
+	if err != nil {
+		return err
+	}
+
+	url := url.URL{Scheme: "https", Host: host, Path: "sealkeys"}
+	resp, err := client.Post(url.String(), "application/json", bytes.NewReader(sealKeys))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		fmt.Println("Seal keys successfully imported")
+	case http.StatusBadRequest:
+		// Something went wrong
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to import seal keys: %s", response)
+	case http.StatusUnauthorized:
+		// User was not authorized
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to authorize user: %s", response)
+	default:
+		return fmt.Errorf("error connecting to server: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+func newSealKeyRotate() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rotate <IP:PORT>",
+		Short: "Rotates the seal master key of the Marblerun Coordinator",
+		Long: `
+Generates a new version of the master key the Marbles' seal keys are derived from.
+Marbles receive the seal key of the new version on their next activation,
+together with the seal keys of all previous versions.
+Users have to authenticate themselves using a certificate and private key,
+and need permissions in the manifest to rotate the seal key.
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hostName := args[0]
+			caCert, err := verifyCoordinator(hostName, eraConfig, insecureEra)
+			if err != nil {
+				return err
+			}
+
+			// Load client certificate and key
+			clCert, err := tls.LoadX509KeyPair(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
+
+			return cliSealKeyRotate(hostName, clCert, caCert)
+		},
+		SilenceUsage: true,
+	}
+
+	return cmd
+}
+
+// cliSealKeyRotate rotates the seal master key of the Marblerun Coordinator
+func cliSealKeyRotate(host string, clCert tls.Certificate, caCert []*pem.Block) error {
+	client, err := restClient(caCert, &clCert)
+	if err != nil {
+		return err
+	}
+
+	url := url.URL{Scheme: "https", Host: host, Path: "sealkeys/rotate"}
+	resp, err := client.Post(url.String(), "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		fmt.Println("Seal key successfully rotated")
+	case http.StatusBadRequest:
+		// Something went wrong
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to rotate seal key: %s", response)
+	case http.StatusUnauthorized:
+		// User was not authorized
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to authorize user: %s", response)
+	default:
+		return fmt.Errorf("error connecting to server: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/edgelesssys/marblerun/coordinator/server"
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealKeyRotate(t *testing.T) {
+	assert := assert.New(t)
+	authorized := true
+	s, host, cert := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodPost, r.Method)
+		assert.Equal("/sealkeys/rotate", r.RequestURI)
+		if !authorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		serverResp := server.GeneralResponse{
+			Status: "success",
+		}
+		assert.NoError(json.NewEncoder(w).Encode(serverResp))
+	}))
+	defer s.Close()
+
+	err := cliSealKeyRotate(host, tls.Certificate{}, []*pem.Block{cert})
+	assert.NoError(err)
+
+	authorized = false
+	err = cliSealKeyRotate(host, tls.Certificate{}, []*pem.Block{cert})
+	assert.Error(err)
+}
+
+func TestSealKeyExport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	recoveryKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(err)
+	sealKey := []byte("0123456789abcdef0123456789abcdef")
+	encryptedKey, err := util.EncryptOAEP(&recoveryKey.PublicKey, sealKey)
+	require.NoError(err)
+
+	s, host, cert := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodGet, r.Method)
+		assert.Equal("/sealkeys", r.RequestURI)
+		serverResp := server.GeneralResponse{
+			Status: "success",
+			Data:   map[string]map[string][]byte{"recoveryKey1": {"1": encryptedKey}},
+		}
+		assert.NoError(json.NewEncoder(w).Encode(serverResp))
+	}))
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	recoveryKeyFile := filepath.Join(dir, "recovery.pem")
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(recoveryKey)
+	require.NoError(err)
+	require.NoError(ioutil.WriteFile(recoveryKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Key}), 0o600))
+
+	options := &sealKeyExportOptions{
+		host:            host,
+		recoveryKeyName: "recoveryKey1",
+		recoveryKeyFile: recoveryKeyFile,
+		output:          filepath.Join(dir, "sealkeys.json"),
+		caCert:          []*pem.Block{cert},
+	}
+	require.NoError(cliSealKeyExport(options))
+	rawSealKeys, err := ioutil.ReadFile(options.output)
+	require.NoError(err)
+	var sealKeys map[string][]byte
+	require.NoError(json.Unmarshal(rawSealKeys, &sealKeys))
+	assert.Equal(map[string][]byte{"1": sealKey}, sealKeys)
+
+	options.recoveryKeyName = "recoveryKey2"
+	assert.Error(cliSealKeyExport(options))
+}
+
+func TestSealKeyImport(t *testing.T) {
+	assert := assert.New(t)
+	s, host, cert := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodPost, r.Method)
+		assert.Equal("/sealkeys", r.RequestURI)
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(err)
+		if string(body) != "keys" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		serverResp := server.GeneralResponse{
+			Status: "success",
+		}
+		assert.NoError(json.NewEncoder(w).Encode(serverResp))
+	}))
+	defer s.Close()
+
+	err := cliSealKeyImport(host, []byte("keys"), tls.Certificate{}, []*pem.Block{cert})
+	assert.NoError(err)
+
+	err = cliSealKeyImport(host, []byte("invalid"), tls.Certificate{}, []*pem.Block{cert})
+	assert.Error(err)
+}
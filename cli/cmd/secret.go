@@ -15,7 +15,8 @@ func newSecretCmd() *cobra.Command {
 		Short: "Manages secrets for the Marblerun Coordinator",
 		Long: `
 Manages secrets for the Marblerun Coordinator.
-Set or retrieve a secret defined in the manifest.`,
+Set, retrieve, delete or rotate a secret defined in the manifest,
+or inspect and roll back its version history.`,
 	}
 
 	cmd.PersistentFlags().StringVar(&eraConfig, "era-config", "", "Path to remote attestation config file in json format, if none provided the newest configuration will be loaded from github")
@@ -26,6 +27,10 @@ Set or retrieve a secret defined in the manifest.`,
 	cmd.MarkPersistentFlagRequired("cert")
 	cmd.AddCommand(newSecretSet())
 	cmd.AddCommand(newSecretGet())
+	cmd.AddCommand(newSecretDelete())
+	cmd.AddCommand(newSecretRotate())
+	cmd.AddCommand(newSecretHistory())
+	cmd.AddCommand(newSecretRollback())
 
 	return cmd
 }
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+func newSecretDelete() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete SECRETNAME ... <IP:PORT>",
+		Short: "Delete user-defined secrets from the Marblerun Coordinator",
+		Long: `
+Delete one or more user-defined secrets from the Marblerun Coordinator.
+The secrets are reset to their uninitialized state and have to be set again
+before Marbles using them can be activated.
+Users have to authenticate themselves using a certificate and private key,
+and need permissions in the manifest to delete the requested secrets.
+`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hostName := args[len(args)-1]
+			caCert, err := verifyCoordinator(hostName, eraConfig, insecureEra)
+			if err != nil {
+				return err
+			}
+
+			// Load client certificate and key
+			clCert, err := tls.LoadX509KeyPair(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
+
+			return cliSecretDelete(hostName, args[0:len(args)-1], clCert, caCert)
+		},
+		SilenceUsage: true,
+	}
+
+	return cmd
+}
+
+// cliSecretDelete resets one or more user-defined secrets
+func cliSecretDelete(host string, secretIDs []string, clCert tls.Certificate, caCert []*pem.Block) error {
+	client, err := restClient(caCert, &clCert)
+	if err != nil {
+		return err
+	}
+
+	secretQuery := url.Values{}
+	for _, secret := range secretIDs {
+		secretQuery.Add("s", secret)
+	}
+	url := url.URL{Scheme: "https", Host: host, Path: "secrets", RawQuery: secretQuery.Encode()}
+	req, err := http.NewRequest(http.MethodDelete, url.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		fmt.Println("Secret successfully deleted")
+	case http.StatusBadRequest:
+		// Something went wrong
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to delete secret: %s", response)
+	case http.StatusUnauthorized:
+		// User was not authorized
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to authorize user: %s", response)
+	default:
+		return fmt.Errorf("error connecting to server: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return nil
+}
@@ -30,6 +30,7 @@ func newSecretGet() *cobra.Command {
 Retrieve one or more secrets from the Marblerun Coordinator.
 Users have to authenticate themselves using a certificate and private key,
 and need permissions in the manifest to read the requested secrets.
+Secrets defined per marble type are retrieved as MARBLETYPE/SECRETNAME.
 `,
 		Args: cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -151,7 +152,16 @@ func printSecrets(response gjson.Result) error {
 			output = prettyFormat(output, "Certificate:", cert.String())
 			output = prettyFormat(output, "Public Key:", public.String())
 			output = prettyFormat(output, "Private Key:", private.String())
-		case "symmetric-key":
+		case "key-rsa", "key-ecdsa", "key-ed25519", "key-x25519", "ssh-rsa", "ssh-ecdsa", "ssh-ed25519":
+			if secretSize.Uint() != 0 {
+				output = prettyFormat(output, "Size:", secretSize.String())
+			}
+			output = prettyFormat(output, "Public Key:", public.String())
+			output = prettyFormat(output, "Private Key:", private.String())
+			if sshCert := singleResponse.Get("SSHCertificate.Raw"); sshCert.Exists() {
+				output = prettyFormat(output, "SSH Cert:", sshCert.String())
+			}
+		case "symmetric-key", "jwt-hmac":
 			output = prettyFormat(output, "UserDefined:", userDefined.String())
 			output = prettyFormat(output, "Size:", secretSize.String())
 			output = prettyFormat(output, "Key:", public.String())
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+func newSecretHistory() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history SECRETNAME <IP:PORT>",
+		Short: "Show the version history of a secret",
+		Long: `
+Show the version history of a secret stored in the Marblerun Coordinator.
+For every version the time of creation, the user who created it and a
+fingerprint of its value are shown. The values themselves are not returned.
+Users have to authenticate themselves using a certificate and private key,
+and need permissions in the manifest to read the requested secret.
+`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			secretName := args[0]
+			hostName := args[1]
+			caCert, err := verifyCoordinator(hostName, eraConfig, insecureEra)
+			if err != nil {
+				return err
+			}
+
+			// Load client certificate and key
+			clCert, err := tls.LoadX509KeyPair(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
+
+			return cliSecretHistory(hostName, secretName, clCert, caCert)
+		},
+		SilenceUsage: true,
+	}
+
+	return cmd
+}
+
+// cliSecretHistory requests and prints the version history of a secret
+func cliSecretHistory(host string, secretName string, clCert tls.Certificate, caCert []*pem.Block) error {
+	client, err := restClient(caCert, &clCert)
+	if err != nil {
+		return err
+	}
+
+	secretQuery := url.Values{}
+	secretQuery.Add("s", secretName)
+	url := url.URL{Scheme: "https", Host: host, Path: "secrets/history", RawQuery: secretQuery.Encode()}
+	resp, err := client.Get(url.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		fmt.Printf("%s:\n", secretName)
+		for _, version := range gjson.GetBytes(respBody, "data").Array() {
+			user := version.Get("User").String()
+			if user == "" {
+				user = "Coordinator"
+			}
+			fingerprint := version.Get("Fingerprint").String()
+			if version.Get("Deleted").Bool() {
+				fingerprint = "(deleted)"
+			}
+			fmt.Printf("\t%-8s %-26s %-20s %s\n", version.Get("Version").String(), version.Get("Created").String(), user, fingerprint)
+		}
+	case http.StatusBadRequest:
+		// Something went wrong
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to retrieve secret history: %s", response)
+	case http.StatusUnauthorized:
+		// User was not authorized
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to authorize user: %s", response)
+	default:
+		return fmt.Errorf("error connecting to server: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return nil
+}
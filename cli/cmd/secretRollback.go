@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+func newSecretRollback() *cobra.Command {
+	var version uint
+
+	cmd := &cobra.Command{
+		Use:   "rollback SECRETNAME <IP:PORT>",
+		Short: "Restore a previous version of a secret",
+		Long: `
+Restore a previous version of a secret stored in the Marblerun Coordinator.
+By default the version before the current one is restored, use [--version]
+to select a specific version from the output of "marblerun secret history".
+Users have to authenticate themselves using a certificate and private key,
+and need permissions in the manifest to write (user-defined secrets) or
+rotate (generated secrets) the requested secret.
+`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			secretName := args[0]
+			hostName := args[1]
+			caCert, err := verifyCoordinator(hostName, eraConfig, insecureEra)
+			if err != nil {
+				return err
+			}
+
+			// Load client certificate and key
+			clCert, err := tls.LoadX509KeyPair(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
+
+			return cliSecretRollback(hostName, secretName, version, clCert, caCert)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().UintVar(&version, "version", 0, "Version of the secret to restore")
+
+	return cmd
+}
+
+// cliSecretRollback restores a previous version of a secret
+func cliSecretRollback(host string, secretName string, version uint, clCert tls.Certificate, caCert []*pem.Block) error {
+	client, err := restClient(caCert, &clCert)
+	if err != nil {
+		return err
+	}
+
+	secretQuery := url.Values{}
+	secretQuery.Add("s", secretName)
+	if version != 0 {
+		secretQuery.Add("version", strconv.FormatUint(uint64(version), 10))
+	}
+	url := url.URL{Scheme: "https", Host: host, Path: "secrets/rollback", RawQuery: secretQuery.Encode()}
+	resp, err := client.Post(url.String(), "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		fmt.Println("Secret successfully rolled back")
+	case http.StatusBadRequest:
+		// Something went wrong
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to roll back secret: %s", response)
+	case http.StatusUnauthorized:
+		// User was not authorized
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to authorize user: %s", response)
+	default:
+		return fmt.Errorf("error connecting to server: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return nil
+}
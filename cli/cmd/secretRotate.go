@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+func newSecretRotate() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rotate SECRETNAME ... <IP:PORT>",
+		Short: "Regenerate shared secrets of the Marblerun Coordinator",
+		Long: `
+Regenerate one or more shared secrets of the Marblerun Coordinator.
+Certificates and symmetric keys are generated anew as defined in the manifest.
+Marbles need to be restarted to receive the new secrets.
+Users have to authenticate themselves using a certificate and private key,
+and need permissions in the manifest to rotate the requested secrets.
+`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hostName := args[len(args)-1]
+			caCert, err := verifyCoordinator(hostName, eraConfig, insecureEra)
+			if err != nil {
+				return err
+			}
+
+			// Load client certificate and key
+			clCert, err := tls.LoadX509KeyPair(userCertFile, userKeyFile)
+			if err != nil {
+				return err
+			}
+
+			return cliSecretRotate(hostName, args[0:len(args)-1], clCert, caCert)
+		},
+		SilenceUsage: true,
+	}
+
+	return cmd
+}
+
+// cliSecretRotate regenerates one or more shared secrets
+func cliSecretRotate(host string, secretIDs []string, clCert tls.Certificate, caCert []*pem.Block) error {
+	client, err := restClient(caCert, &clCert)
+	if err != nil {
+		return err
+	}
+
+	secretQuery := url.Values{}
+	for _, secret := range secretIDs {
+		secretQuery.Add("s", secret)
+	}
+	url := url.URL{Scheme: "https", Host: host, Path: "secrets/rotate", RawQuery: secretQuery.Encode()}
+	resp, err := client.Post(url.String(), "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		fmt.Println("Secret successfully rotated")
+	case http.StatusBadRequest:
+		// Something went wrong
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to rotate secret: %s", response)
+	case http.StatusUnauthorized:
+		// User was not authorized
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		response := gjson.GetBytes(respBody, "message")
+		return fmt.Errorf("unable to authorize user: %s", response)
+	default:
+		return fmt.Errorf("error connecting to server: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return nil
+}
@@ -123,6 +123,130 @@ func TestGetSecrets(t *testing.T) {
 	assert.Error(err)
 }
 
+func TestDeleteSecrets(t *testing.T) {
+	assert := assert.New(t)
+	s, host, cert := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodDelete, r.Method)
+		if "/secrets?s=user_secret" == r.RequestURI {
+			serverResp := server.GeneralResponse{
+				Status: "success",
+			}
+			assert.NoError(json.NewEncoder(w).Encode(serverResp))
+			return
+		}
+		if "/secrets?s=restricted_secret" == r.RequestURI {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer s.Close()
+
+	err := cliSecretDelete(host, []string{"user_secret"}, tls.Certificate{}, []*pem.Block{cert})
+	assert.NoError(err)
+
+	err = cliSecretDelete(host, []string{"restricted_secret"}, tls.Certificate{}, []*pem.Block{cert})
+	assert.Error(err)
+
+	err = cliSecretDelete(host, []string{"generated_secret"}, tls.Certificate{}, []*pem.Block{cert})
+	assert.Error(err)
+}
+
+func TestRotateSecrets(t *testing.T) {
+	assert := assert.New(t)
+	s, host, cert := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodPost, r.Method)
+		if "/secrets/rotate?s=cert_shared&s=symmetric_key_shared" == r.RequestURI {
+			serverResp := server.GeneralResponse{
+				Status: "success",
+			}
+			assert.NoError(json.NewEncoder(w).Encode(serverResp))
+			return
+		}
+		if "/secrets/rotate?s=restricted_secret" == r.RequestURI {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer s.Close()
+
+	err := cliSecretRotate(host, []string{"cert_shared", "symmetric_key_shared"}, tls.Certificate{}, []*pem.Block{cert})
+	assert.NoError(err)
+
+	err = cliSecretRotate(host, []string{"restricted_secret"}, tls.Certificate{}, []*pem.Block{cert})
+	assert.Error(err)
+
+	err = cliSecretRotate(host, []string{"user_secret"}, tls.Certificate{}, []*pem.Block{cert})
+	assert.Error(err)
+}
+
+func TestSecretHistory(t *testing.T) {
+	assert := assert.New(t)
+	s, host, cert := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodGet, r.Method)
+		if "/secrets/history?s=user_secret" == r.RequestURI {
+			serverResp := server.GeneralResponse{
+				Status: "success",
+				Data: []map[string]interface{}{
+					{"Version": 1, "User": "", "Created": "2021-06-23T07:50:11Z", "Fingerprint": "00ff"},
+					{"Version": 2, "User": "admin", "Created": "2021-06-24T07:50:11Z", "Fingerprint": "ff00"},
+					{"Version": 3, "User": "admin", "Created": "2021-06-25T07:50:11Z", "Deleted": true},
+				},
+			}
+			assert.NoError(json.NewEncoder(w).Encode(serverResp))
+			return
+		}
+		if "/secrets/history?s=restricted_secret" == r.RequestURI {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer s.Close()
+
+	err := cliSecretHistory(host, "user_secret", tls.Certificate{}, []*pem.Block{cert})
+	assert.NoError(err)
+
+	err = cliSecretHistory(host, "restricted_secret", tls.Certificate{}, []*pem.Block{cert})
+	assert.Error(err)
+
+	err = cliSecretHistory(host, "unknown_secret", tls.Certificate{}, []*pem.Block{cert})
+	assert.Error(err)
+}
+
+func TestSecretRollback(t *testing.T) {
+	assert := assert.New(t)
+	s, host, cert := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodPost, r.Method)
+		if "/secrets/rollback?s=user_secret" == r.RequestURI || "/secrets/rollback?s=user_secret&version=2" == r.RequestURI {
+			serverResp := server.GeneralResponse{
+				Status: "success",
+			}
+			assert.NoError(json.NewEncoder(w).Encode(serverResp))
+			return
+		}
+		if "/secrets/rollback?s=restricted_secret" == r.RequestURI {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer s.Close()
+
+	err := cliSecretRollback(host, "user_secret", 0, tls.Certificate{}, []*pem.Block{cert})
+	assert.NoError(err)
+
+	err = cliSecretRollback(host, "user_secret", 2, tls.Certificate{}, []*pem.Block{cert})
+	assert.NoError(err)
+
+	err = cliSecretRollback(host, "restricted_secret", 0, tls.Certificate{}, []*pem.Block{cert})
+	assert.Error(err)
+
+	err = cliSecretRollback(host, "user_secret", 42, tls.Certificate{}, []*pem.Block{cert})
+	assert.Error(err)
+}
+
 func TestSecretFromPEM(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
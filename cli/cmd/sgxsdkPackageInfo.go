@@ -8,18 +8,33 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
+	"github.com/edgelesssys/marblerun/coordinator/quote"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
+// sigStructSize is the size of SIGSTRUCT in bytes
+const sigStructSize = 1808
+
+// sgxFlagsDebug is the DEBUG flag in the ATTRIBUTES of an enclave
+const sgxFlagsDebug = 0x02
+
+// types of enclave artifacts SIGSTRUCT can be read from
+const (
+	artifactOcclum  = "Occlum image"
+	artifactELF     = "ELF enclave"
+	artifactSigFile = "SIGSTRUCT file"
+)
+
 func newSGXSDKPackageInfoCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "sgxsdk-package-info",
 		Short: "Prints the package signature properties of an SGX SDK binary",
-		Long:  "Prints the package signature properties of an SGX SDK binary",
+		Long:  "Prints the package signature properties of an SGX SDK binary, an Open Enclave or EGo binary, the root directory of an Occlum image, or a Gramine/Graphene .sig file",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			path := args[0]
@@ -33,61 +48,112 @@ func newSGXSDKPackageInfoCmd() *cobra.Command {
 }
 
 func decodeSigStruct(path string) error {
+	sigStruct, artifact, err := loadSigStruct(path)
+	if err != nil {
+		return err
+	}
+	if artifact == artifactOcclum {
+		color.Green("Detected Occlum image.")
+	}
+
+	// Parse and retrieve values from SIGSTRUCT
+	mrenclave, mrsigner, isvprodid, isvsvn, err := parseSigStruct(sigStruct)
+	if err != nil {
+		return err
+	}
+
+	// Display the determined properties
+	if artifact == artifactOcclum {
+		color.Cyan("PackageProperties for Occlum image at '%s':\n", path)
+	} else {
+		color.Cyan("PackageProperties for '%s':\n", path)
+	}
+	fmt.Printf("UniqueID (MRENCLAVE)      : %s\n", hex.EncodeToString(mrenclave))
+	fmt.Printf("SignerID (MRSIGNER)       : %s\n", hex.EncodeToString(mrsigner[:]))
+	fmt.Printf("ProductID (ISVPRODID)     : %d\n", binary.LittleEndian.Uint16(isvprodid))
+	fmt.Printf("SecurityVersion (ISVSVN)  : %d\n", binary.LittleEndian.Uint16(isvsvn))
+
+	return nil
+}
+
+// loadSigStruct reads the data containing the SIGSTRUCT of an enclave artifact and returns it with the type of the artifact.
+// Supported are the root directory of an Occlum image, ELF enclaves signed by the SGX SDK, Open Enclave or EGo, and Gramine/Graphene .sig files.
+func loadSigStruct(path string) ([]byte, string, error) {
 	// Check if given filename is actually a directory
 	stat, err := os.Stat(path)
 	if err != nil {
-		return err
+		return nil, "", err
+	}
+
+	// Gramine/Graphene store the plain SIGSTRUCT in a separate file
+	if !stat.IsDir() && filepath.Ext(path) == ".sig" {
+		sigStruct, err := ioutil.ReadFile(path)
+		return sigStruct, artifactSigFile, err
 	}
 
 	// If it is, we try to find out if it's an Occlum image directory
+	artifact := artifactELF
 	var elfFile *elf.File
-	var isOcclumInstance bool
 	if isDirectory := stat.IsDir(); isDirectory {
 		if elfFile, err = elf.Open(filepath.Join(path, "build/lib/libocclum-libos.signed.so")); err == nil {
-			color.Green("Detected Occlum image.")
-			isOcclumInstance = true
+			artifact = artifactOcclum
 		} else if os.IsNotExist(err) {
 			color.Red("ERROR: A directory was supplied, but it appears not to be an Occlum instance.")
 			color.Red("Please either specify the SGX enclave binary directly, or the root of an Occlum instance.")
-			return err
+			return nil, "", err
 		}
 	} else {
 		elfFile, err = elf.Open(path)
 	}
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 	defer elfFile.Close()
 
-	// SIGSTRUCT is stored in ELF section '.note.sgxmeta'
+	// The SGX SDK stores SIGSTRUCT in ELF section '.note.sgxmeta', Open Enclave and EGo in section '.oeinfo'
 	sgxMetaSection := elfFile.Section(".note.sgxmeta")
 	if sgxMetaSection == nil {
-		return errors.New("could not find SGX metadata section (.note.sgxmeta) in given file")
+		sgxMetaSection = elfFile.Section(".oeinfo")
+	}
+	if sgxMetaSection == nil {
+		return nil, "", errors.New("could not find SGX metadata section (.note.sgxmeta or .oeinfo) in given file")
 	}
 
 	sgxMetaData, err := sgxMetaSection.Data()
 	if err != nil {
-		return err
+		return nil, "", err
 	}
+	return sgxMetaData, artifact, nil
+}
 
-	// Parse and retrieve values from SIGSTRUCT
-	mrenclave, mrsigner, isvprodid, isvsvn, err := parseSigStruct(sgxMetaData)
+// packagePropertiesFromArtifact reads all package properties from the SIGSTRUCT of an enclave artifact
+//
+// Debug is set if the enclave is signed with the DEBUG flag in its ATTRIBUTES.
+func packagePropertiesFromArtifact(path string) (quote.PackageProperties, error) {
+	sgxMetaData, _, err := loadSigStruct(path)
 	if err != nil {
-		return nil
+		return quote.PackageProperties{}, err
 	}
-
-	// Display the determined properties
-	if isOcclumInstance {
-		color.Cyan("PackageProperties for Occlum image at '%s':\n", path)
-	} else {
-		color.Cyan("PackageProperties for '%s':\n", path)
+	sigStruct, err := findSigStruct(sgxMetaData)
+	if err != nil {
+		return quote.PackageProperties{}, err
+	}
+	mrenclave, mrsigner, isvprodid, isvsvn, err := parseSigStruct(sigStruct)
+	if err != nil {
+		return quote.PackageProperties{}, err
 	}
-	fmt.Printf("UniqueID (MRENCLAVE)      : %s\n", hex.EncodeToString(mrenclave))
-	fmt.Printf("SignerID (MRSIGNER)       : %s\n", hex.EncodeToString(mrsigner[:]))
-	fmt.Printf("ProductID (ISVPRODID)     : %d\n", binary.LittleEndian.Uint16(isvprodid))
-	fmt.Printf("SecurityVersion (ISVSVN)  : %d\n", binary.LittleEndian.Uint16(isvsvn))
 
-	return nil
+	// The DEBUG flag is bit 1 of ATTRIBUTES. ATTRIBUTEMASK is not considered, since SDKs commonly leave the flag unenforced for production enclaves.
+	attributes := binary.LittleEndian.Uint64(sigStruct[928:936])
+	productID := uint64(binary.LittleEndian.Uint16(isvprodid))
+	securityVersion := uint(binary.LittleEndian.Uint16(isvsvn))
+	return quote.PackageProperties{
+		Debug:           attributes&sgxFlagsDebug != 0,
+		UniqueID:        hex.EncodeToString(mrenclave),
+		SignerID:        hex.EncodeToString(mrsigner),
+		ProductID:       &productID,
+		SecurityVersion: &securityVersion,
+	}, nil
 }
 
 func parseSigStruct(sgxMetaData []byte) ([]byte, []byte, []byte, []byte, error) {
@@ -96,38 +162,47 @@ func parseSigStruct(sgxMetaData []byte) ([]byte, []byte, []byte, []byte, error)
 	 * Manual, Volume 3: System Programming Guide", Chapter 38, Section 13,
 	 * Table 38-19 "Layout of Enclave Signature Structure (SIGSTRUCT)"
 	 */
+	sigStruct, err := findSigStruct(sgxMetaData)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	// Get MRENCLAVE (UniqueID), ISVPRODID (ProductID) and ISVSVN (SecurityVersion) directly from SIGSTRUCT
+	// Get Modulus so we can calculate MRSIGNER (= SHA256 hash of modulus)
+	modulus := sigStruct[128:512]
+	mrenclave := sigStruct[960:992]
+	isvprodid := sigStruct[1024:1026]
+	isvsvn := sigStruct[1026:1028]
+
+	// Calculate MRSIGNER, which is the SHA-256 hash of the modulus stored in SIGSTRUCT
+	mrsigner := sha256.Sum256(modulus)
+
+	return mrenclave, mrsigner[:], isvprodid, isvsvn, nil
+}
+
+// findSigStruct returns the SIGSTRUCT contained in the SGX metadata of an enclave
+func findSigStruct(sgxMetaData []byte) ([]byte, error) {
 	sigStructHeader := []byte{0x06, 0x00, 0x00, 0x00, 0xe1, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00}
 
 	sigStructIndex := bytes.Index(sgxMetaData, sigStructHeader)
 	if sigStructIndex == -1 {
-		return nil, nil, nil, nil, errors.New("could not find SIGSTRUCT header in given file")
+		return nil, errors.New("could not find SIGSTRUCT header in given file")
 	}
 
 	// The Intel Software Developer Manual specifies SIGSTRUCT entries up to 1808 bytes.
 	// We use this as a cutoff for our sigStruct slice.
-	if len(sgxMetaData) <= sigStructIndex+1808 {
-		return nil, nil, nil, nil, errors.New("SGX metadata/SIGSTRUCT appears to be too small")
+	if len(sgxMetaData) < sigStructIndex+sigStructSize {
+		return nil, errors.New("SGX metadata/SIGSTRUCT appears to be too small")
 	}
 
-	sigStruct := sgxMetaData[sigStructIndex : sigStructIndex+1808]
+	sigStruct := sgxMetaData[sigStructIndex : sigStructIndex+sigStructSize]
 
 	// SIGSTRUCT has two headers. Let's check against the second one, too.
 	// We only use the second one to verify that we actually work on the correct struct.
 	sigStructHeader2 := []byte{0x01, 0x01, 0x00, 0x00, 0x60, 0x00, 0x00, 0x00, 0x60, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}
 	sigStructHeader2Index := bytes.Index(sigStruct, sigStructHeader2)
 	if sigStructHeader2Index == -1 {
-		return nil, nil, nil, nil, errors.New("found first SIGSTRUCT header, but cannot find second one")
+		return nil, errors.New("found first SIGSTRUCT header, but cannot find second one")
 	}
-
-	// Get MRENCLAVE (UniqueID), ISVPRODID (ProductID) and ISVSVN (SecurityVersion) directly from SIGSTRUCT
-	// Get Modulus so we can calculate MRSIGNER (= SHA256 hash of modulus)
-	modulus := sigStruct[128:512]
-	mrenclave := sigStruct[960:992]
-	isvprodid := sigStruct[1024:1026]
-	isvsvn := sigStruct[1026:1028]
-
-	// Calculate MRSIGNER, which is the SHA-256 hash of the modulus stored in SIGSTRUCT
-	mrsigner := sha256.Sum256(modulus)
-
-	return mrenclave, mrsigner[:], isvprodid, isvsvn, nil
+	return sigStruct, nil
 }
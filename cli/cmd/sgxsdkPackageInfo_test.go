@@ -3,10 +3,14 @@ package cmd
 import (
 	"bytes"
 	"compress/zlib"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -38,3 +42,57 @@ func TestParseSigStruct(t *testing.T) {
 	assert.EqualValues(0, binary.LittleEndian.Uint16(isvprodid))
 	assert.EqualValues(0, binary.LittleEndian.Uint16(isvsvn))
 }
+
+func TestPackagePropertiesFromArtifact(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "unittest")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// Gramine/Graphene .sig files contain the plain SIGSTRUCT
+	// production enclaves are detected although the ATTRIBUTEMASK does not enforce the DEBUG flag to be cleared
+	sigFile := filepath.Join(dir, "enclave.sig")
+	require.NoError(ioutil.WriteFile(sigFile, newTestSigStruct(false), 0644))
+	properties, err := packagePropertiesFromArtifact(sigFile)
+	require.NoError(err)
+	assert.False(properties.Debug)
+	assert.Equal(strings.Repeat("aa", 32), properties.UniqueID)
+	modulusHash := sha256.Sum256(bytes.Repeat([]byte{0x01}, 384))
+	assert.Equal(hex.EncodeToString(modulusHash[:]), properties.SignerID)
+	assert.EqualValues(3, *properties.ProductID)
+	assert.EqualValues(7, *properties.SecurityVersion)
+
+	require.NoError(ioutil.WriteFile(sigFile, newTestSigStruct(true), 0644))
+	properties, err = packagePropertiesFromArtifact(sigFile)
+	require.NoError(err)
+	assert.True(properties.Debug)
+
+	require.NoError(ioutil.WriteFile(sigFile, []byte("invalid"), 0644))
+	_, err = packagePropertiesFromArtifact(sigFile)
+	assert.Error(err)
+
+	// directories must be Occlum images and other files ELF enclaves
+	_, err = packagePropertiesFromArtifact(dir)
+	assert.Error(err)
+	_, err = packagePropertiesFromArtifact(filepath.Join(dir, "missing"))
+	assert.Error(err)
+}
+
+// newTestSigStruct creates a SIGSTRUCT with known values. If debug is set, the enclave is signed with the DEBUG flag.
+// The DEBUG flag is never enforced by the ATTRIBUTEMASK.
+func newTestSigStruct(debug bool) []byte {
+	sigStruct := make([]byte, sigStructSize)
+	copy(sigStruct, []byte{0x06, 0x00, 0x00, 0x00, 0xe1, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00})
+	copy(sigStruct[24:], []byte{0x01, 0x01, 0x00, 0x00, 0x60, 0x00, 0x00, 0x00, 0x60, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00})
+	copy(sigStruct[128:512], bytes.Repeat([]byte{0x01}, 384))
+	if debug {
+		binary.LittleEndian.PutUint64(sigStruct[928:936], sgxFlagsDebug)
+	}
+	binary.LittleEndian.PutUint64(sigStruct[944:952], ^uint64(sgxFlagsDebug))
+	copy(sigStruct[960:992], bytes.Repeat([]byte{0xaa}, 32))
+	binary.LittleEndian.PutUint16(sigStruct[1024:1026], 3)
+	binary.LittleEndian.PutUint16(sigStruct[1026:1028], 7)
+	return sigStruct
+}
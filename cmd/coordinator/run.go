@@ -7,9 +7,13 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/edgelesssys/marblerun/coordinator/config"
 	"github.com/edgelesssys/marblerun/coordinator/core"
@@ -17,6 +21,7 @@ import (
 	"github.com/edgelesssys/marblerun/coordinator/recovery"
 	"github.com/edgelesssys/marblerun/coordinator/seal"
 	"github.com/edgelesssys/marblerun/coordinator/server"
+	"github.com/edgelesssys/marblerun/coordinator/spiffe"
 	"github.com/edgelesssys/marblerun/util"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -54,6 +59,31 @@ func run(validator quote.Validator, issuer quote.Issuer, sealDir string, sealer
 	clientServerAddr := util.Getenv(config.ClientAddr, config.ClientAddrDefault)
 	meshServerAddr := util.Getenv(config.MeshAddr, config.MeshAddrDefault)
 	promServerAddr := os.Getenv(config.PromAddr)
+	rotationInterval, err := time.ParseDuration(util.Getenv(config.SecretRotationInterval, config.SecretRotationIntervalDefault))
+	if err != nil {
+		zapLogger.Fatal("Invalid secret rotation interval.", zap.Error(err))
+	}
+	if rotationInterval <= 0 {
+		zapLogger.Fatal("Invalid secret rotation interval. The interval must be positive.", zap.Duration("interval", rotationInterval))
+	}
+	rotateBefore, err := time.ParseDuration(util.Getenv(config.SecretRotationBefore, config.SecretRotationBeforeDefault))
+	if err != nil {
+		zapLogger.Fatal("Invalid secret rotation time.", zap.Error(err))
+	}
+	if rotateBefore <= 0 {
+		zapLogger.Fatal("Invalid secret rotation time. The time must be positive.", zap.Duration("rotateBefore", rotateBefore))
+	}
+	refreshInterval, err := time.ParseDuration(util.Getenv(config.SecretRefreshInterval, config.SecretRefreshIntervalDefault))
+	if err != nil {
+		zapLogger.Fatal("Invalid secret refresh interval.", zap.Error(err))
+	}
+	if refreshInterval <= 0 {
+		zapLogger.Fatal("Invalid secret refresh interval. The interval must be positive.", zap.Duration("interval", refreshInterval))
+	}
+	caConfig, err := caConfigFromEnv()
+	if err != nil {
+		zapLogger.Fatal("Invalid CA configuration.", zap.Error(err))
+	}
 
 	// Create Prometheus resources and start the Prometheus server.
 	var promRegistry *prometheus.Registry
@@ -79,11 +109,19 @@ func run(validator quote.Validator, issuer quote.Issuer, sealDir string, sealer
 	if err := os.MkdirAll(sealDir, 0700); err != nil {
 		zapLogger.Fatal("Cannot create or access sealdir. Please check the permissions for the specified path.", zap.Error(err))
 	}
-	core, err := core.NewCore(dnsNames, validator, issuer, sealer, recovery, zapLogger, promFactoryPtr)
+	core, err := core.NewCore(dnsNames, caConfig, validator, issuer, sealer, recovery, zapLogger, promFactoryPtr)
 	if err != nil {
 		panic(err)
 	}
 
+	// renew expiring shared certificates in the background
+	zapLogger.Info("starting the secret rotation", zap.Duration("interval", rotationInterval), zap.Duration("rotateBefore", rotateBefore))
+	go core.RunSecretRotation(context.Background(), rotationInterval, rotateBefore)
+
+	// fetch secrets of secret providers again in the background
+	zapLogger.Info("starting the secret refresh", zap.Duration("interval", refreshInterval))
+	go core.RunSecretRefresh(context.Background(), refreshInterval)
+
 	// start client server
 	zapLogger.Info("starting the client server")
 	mux := server.CreateServeMux(core, promFactoryPtr)
@@ -110,3 +148,76 @@ func run(validator quote.Validator, issuer quote.Issuer, sealDir string, sealer
 		}
 	}
 }
+
+// caConfigFromEnv reads the configuration of the Coordinator's CAs from the environment
+func caConfigFromEnv() (core.CAConfig, error) {
+	var caConfig core.CAConfig
+	var err error
+
+	caConfig.RootKeyAlgorithm, err = core.ParseKeyAlgorithm(util.Getenv(config.RootKeyAlgorithm, config.KeyAlgorithmDefault))
+	if err != nil {
+		return core.CAConfig{}, err
+	}
+	caConfig.IntermediateKeyAlgorithm, err = core.ParseKeyAlgorithm(util.Getenv(config.IntermediateKeyAlgorithm, config.KeyAlgorithmDefault))
+	if err != nil {
+		return core.CAConfig{}, err
+	}
+
+	if rootValidity := os.Getenv(config.RootValidity); rootValidity != "" {
+		if caConfig.RootValidity, err = time.ParseDuration(rootValidity); err != nil {
+			return core.CAConfig{}, fmt.Errorf("invalid root validity: %w", err)
+		}
+	}
+	if intermediateValidity := os.Getenv(config.IntermediateValidity); intermediateValidity != "" {
+		if caConfig.IntermediateValidity, err = time.ParseDuration(intermediateValidity); err != nil {
+			return core.CAConfig{}, fmt.Errorf("invalid intermediate validity: %w", err)
+		}
+	}
+
+	if caConfig.RootTransitionPeriod, err = time.ParseDuration(util.Getenv(config.RootTransitionPeriod, config.RootTransitionPeriodDefault)); err != nil {
+		return core.CAConfig{}, fmt.Errorf("invalid root transition period: %w", err)
+	}
+
+	caConfig.Subject, err = core.ParseSubject(os.Getenv(config.CertificateSubject))
+	if err != nil {
+		return core.CAConfig{}, err
+	}
+
+	caConfig.IPAddresses = []net.IP{}
+	for _, ipAddress := range splitList(util.Getenv(config.IPAddresses, config.IPAddressesDefault)) {
+		ip := net.ParseIP(ipAddress)
+		if ip == nil {
+			return core.CAConfig{}, fmt.Errorf("invalid IP address %s", ipAddress)
+		}
+		caConfig.IPAddresses = append(caConfig.IPAddresses, ip)
+	}
+
+	caConfig.PermittedDNSDomains = splitList(os.Getenv(config.PermittedDNSDomains))
+	for _, ipRange := range splitList(os.Getenv(config.PermittedIPRanges)) {
+		_, ipNet, err := net.ParseCIDR(ipRange)
+		if err != nil {
+			return core.CAConfig{}, err
+		}
+		caConfig.PermittedIPRanges = append(caConfig.PermittedIPRanges, ipNet)
+	}
+
+	if trustDomain := os.Getenv(config.SPIFFETrustDomain); trustDomain != "" {
+		if err := spiffe.ValidateTrustDomain(trustDomain); err != nil {
+			return core.CAConfig{}, err
+		}
+		caConfig.SPIFFETrustDomain = trustDomain
+	}
+
+	return caConfig, nil
+}
+
+// splitList splits a comma separated list and drops empty entries
+func splitList(list string) []string {
+	var entries []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -45,3 +45,60 @@ const DevMode = "EDG_COORDINATOR_DEV_MODE"
 
 // DevModeDefault is the default logging mode.
 const DevModeDefault = "0"
+
+// SecretRotationInterval is the interval in which the coordinator checks for expiring shared certificate secrets
+const SecretRotationInterval = "EDG_COORDINATOR_SECRET_ROTATION_INTERVAL"
+
+// SecretRotationIntervalDefault is the default interval in which the coordinator checks for expiring shared certificate secrets
+const SecretRotationIntervalDefault = "1h"
+
+// SecretRefreshInterval is the interval in which the coordinator checks for secrets of secret providers which need to be fetched again
+const SecretRefreshInterval = "EDG_COORDINATOR_SECRET_REFRESH_INTERVAL"
+
+// SecretRefreshIntervalDefault is the default interval in which the coordinator checks for secrets of secret providers which need to be fetched again
+const SecretRefreshIntervalDefault = "1m"
+
+// SecretRotationBefore is the time before expiry at which the coordinator renews shared certificate secrets
+const SecretRotationBefore = "EDG_COORDINATOR_SECRET_ROTATION_BEFORE"
+
+// SecretRotationBeforeDefault is the default time before expiry at which the coordinator renews shared certificate secrets
+const SecretRotationBeforeDefault = "720h"
+
+// RootKeyAlgorithm is the key algorithm of the coordinator's root CA: ecdsa-p256, ecdsa-p384, ed25519, rsa-2048, rsa-3072 or rsa-4096
+const RootKeyAlgorithm = "EDG_COORDINATOR_ROOT_KEY_ALGORITHM"
+
+// IntermediateKeyAlgorithm is the key algorithm of the coordinator's intermediate and marble root CA
+const IntermediateKeyAlgorithm = "EDG_COORDINATOR_INTERMEDIATE_KEY_ALGORITHM"
+
+// KeyAlgorithmDefault is the default key algorithm of the coordinator's CAs
+const KeyAlgorithmDefault = "ecdsa-p256"
+
+// RootValidity is the validity period of the coordinator's root certificate, e.g. "87600h". Certificates do not expire if it is unset
+const RootValidity = "EDG_COORDINATOR_ROOT_VALIDITY"
+
+// IntermediateValidity is the validity period of the coordinator's intermediate and marble root certificates
+const IntermediateValidity = "EDG_COORDINATOR_INTERMEDIATE_VALIDITY"
+
+// CertificateSubject are comma separated subject fields of the coordinator's certificates, e.g. "O=Edgeless Systems,C=DE"
+const CertificateSubject = "EDG_COORDINATOR_CERTIFICATE_SUBJECT"
+
+// IPAddresses are the comma separated IP SANs of the coordinator's certificates
+const IPAddresses = "EDG_COORDINATOR_IP_ADDRESSES"
+
+// IPAddressesDefault are the default IP SANs of the coordinator's certificates
+const IPAddressesDefault = "127.0.0.1,::1"
+
+// PermittedDNSDomains are the comma separated DNS name constraints of the coordinator's marble root CA
+const PermittedDNSDomains = "EDG_COORDINATOR_PERMITTED_DNS_DOMAINS"
+
+// PermittedIPRanges are the comma separated IP ranges in CIDR notation constraining the coordinator's marble root CA
+const PermittedIPRanges = "EDG_COORDINATOR_PERMITTED_IP_RANGES"
+
+// RootTransitionPeriod is the time for which the previous root certificate is served after a rotation of the coordinator's root CA
+const RootTransitionPeriod = "EDG_COORDINATOR_ROOT_TRANSITION_PERIOD"
+
+// RootTransitionPeriodDefault is the default time for which the previous root certificate is served after a rotation
+const RootTransitionPeriodDefault = "720h"
+
+// SPIFFETrustDomain is the trust domain of the SPIFFE IDs of marbles. SPIFFE is disabled if it is unset.
+const SPIFFETrustDomain = "EDG_COORDINATOR_SPIFFE_TRUST_DOMAIN"
@@ -0,0 +1,171 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509/pkix"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/edgelesssys/marblerun/util"
+)
+
+// KeyAlgorithm is the algorithm of a Coordinator CA key
+type KeyAlgorithm string
+
+// The key algorithms supported for the Coordinator CAs
+const (
+	KeyAlgorithmECDSAP256 KeyAlgorithm = "ecdsa-p256"
+	KeyAlgorithmECDSAP384 KeyAlgorithm = "ecdsa-p384"
+	KeyAlgorithmEd25519   KeyAlgorithm = "ed25519"
+	KeyAlgorithmRSA2048   KeyAlgorithm = "rsa-2048"
+	KeyAlgorithmRSA3072   KeyAlgorithm = "rsa-3072"
+	KeyAlgorithmRSA4096   KeyAlgorithm = "rsa-4096"
+)
+
+// CAConfig configures the root and intermediate CA of the Coordinator.
+// The zero value results in ECDSA P-256 keys, certificates without expiry and name constraints, and the default IP addresses.
+type CAConfig struct {
+	// RootKeyAlgorithm is the algorithm of the root CA key
+	RootKeyAlgorithm KeyAlgorithm
+	// IntermediateKeyAlgorithm is the algorithm of the key shared by the intermediate CA and the marble root CA
+	IntermediateKeyAlgorithm KeyAlgorithm
+	// RootValidity is the lifetime of the root certificate
+	RootValidity time.Duration
+	// IntermediateValidity is the lifetime of the intermediate and marble root certificates
+	IntermediateValidity time.Duration
+	// Subject sets the subject fields of all CA certificates, except for the CommonName
+	Subject pkix.Name
+	// IPAddresses are the IP SANs of all CA certificates
+	IPAddresses []net.IP
+	// PermittedDNSDomains constrains the DNS names of certificates issued by the intermediate and marble root CA
+	PermittedDNSDomains []string
+	// PermittedIPRanges constrains the IP addresses of certificates issued by the intermediate and marble root CA
+	PermittedIPRanges []*net.IPNet
+	// RootTransitionPeriod is the time for which the previous root certificate is served after a rotation of the root CA, 30 days if unset
+	RootTransitionPeriod time.Duration
+	// SPIFFETrustDomain enables SPIFFE IDs of the form spiffe://<trust-domain>/<marbletype>/<uuid> for Marbles
+	SPIFFETrustDomain string
+}
+
+// ParseKeyAlgorithm parses the name of a key algorithm. An empty string results in the default algorithm.
+func ParseKeyAlgorithm(name string) (KeyAlgorithm, error) {
+	algorithm := KeyAlgorithm(strings.ToLower(strings.TrimSpace(name)))
+	switch algorithm {
+	case "":
+		return KeyAlgorithmECDSAP256, nil
+	case KeyAlgorithmECDSAP256, KeyAlgorithmECDSAP384, KeyAlgorithmEd25519, KeyAlgorithmRSA2048, KeyAlgorithmRSA3072, KeyAlgorithmRSA4096:
+		return algorithm, nil
+	}
+	return "", fmt.Errorf("unsupported key algorithm %s", name)
+}
+
+// ParseSubject parses comma separated subject fields, e.g. "O=Edgeless Systems,C=DE".
+// The CommonName of the Coordinator certificates is fixed and can not be set.
+func ParseSubject(subject string) (pkix.Name, error) {
+	var name pkix.Name
+	for _, field := range strings.Split(subject, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		keyValue := strings.SplitN(field, "=", 2)
+		if len(keyValue) != 2 {
+			return pkix.Name{}, fmt.Errorf("invalid subject field %s, expected KEY=value", field)
+		}
+		value := strings.TrimSpace(keyValue[1])
+		switch strings.ToUpper(strings.TrimSpace(keyValue[0])) {
+		case "C":
+			name.Country = append(name.Country, value)
+		case "O":
+			name.Organization = append(name.Organization, value)
+		case "OU":
+			name.OrganizationalUnit = append(name.OrganizationalUnit, value)
+		case "L":
+			name.Locality = append(name.Locality, value)
+		case "ST":
+			name.Province = append(name.Province, value)
+		case "STREET":
+			name.StreetAddress = append(name.StreetAddress, value)
+		case "POSTALCODE":
+			name.PostalCode = append(name.PostalCode, value)
+		case "SERIALNUMBER":
+			name.SerialNumber = value
+		default:
+			return pkix.Name{}, fmt.Errorf("unsupported subject field %s", keyValue[0])
+		}
+	}
+	return name, nil
+}
+
+// generateKey generates a new private key of the algorithm
+func (a KeyAlgorithm) generateKey() (crypto.Signer, error) {
+	switch a {
+	case "", KeyAlgorithmECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyAlgorithmECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyAlgorithmEd25519:
+		_, privKey, err := ed25519.GenerateKey(rand.Reader)
+		return privKey, err
+	case KeyAlgorithmRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyAlgorithmRSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case KeyAlgorithmRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	}
+	return nil, fmt.Errorf("unsupported key algorithm %s", a)
+}
+
+// ipAddresses returns the IP SANs of the CA certificates
+func (c CAConfig) ipAddresses() []net.IP {
+	if c.IPAddresses == nil {
+		return util.DefaultCertificateIPAddresses
+	}
+	return c.IPAddresses
+}
+
+// rootTransitionPeriod returns the time for which the previous root certificate is served after a rotation
+func (c CAConfig) rootTransitionPeriod() time.Duration {
+	if c.RootTransitionPeriod <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return c.RootTransitionPeriod
+}
+
+// notAfter returns the expiry date of a certificate with the given validity, or the maximum date if none is set
+func notAfter(notBefore time.Time, validity time.Duration) time.Time {
+	if validity <= 0 {
+		return notBefore.Add(math.MaxInt64)
+	}
+	return notBefore.Add(validity)
+}
+
+// keyDerivationSecretSize is the size of the secret keys are derived from
+const keyDerivationSecretSize = 32
+
+// keyDerivationSecret returns the secret of a root key, which states created by earlier versions of the Coordinator derive keys from
+func keyDerivationSecret(privKey crypto.PrivateKey) ([]byte, error) {
+	switch privKey := privKey.(type) {
+	case *ecdsa.PrivateKey:
+		return privKey.D.Bytes(), nil
+	case ed25519.PrivateKey:
+		return privKey.Seed(), nil
+	case *rsa.PrivateKey:
+		return privKey.D.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", privKey)
+}
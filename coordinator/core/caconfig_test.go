@@ -0,0 +1,156 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/quote"
+	"github.com/edgelesssys/marblerun/coordinator/recovery"
+	"github.com/edgelesssys/marblerun/coordinator/seal"
+	"github.com/edgelesssys/marblerun/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCAConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	zapLogger, err := zap.NewDevelopment()
+	require.NoError(err)
+	defer zapLogger.Sync()
+
+	_, localhostRange, err := net.ParseCIDR("127.0.0.0/8")
+	require.NoError(err)
+	_, loopbackRange, err := net.ParseCIDR("::1/128")
+	require.NoError(err)
+	caConfig := CAConfig{
+		RootKeyAlgorithm:         KeyAlgorithmEd25519,
+		IntermediateKeyAlgorithm: KeyAlgorithmECDSAP384,
+		RootValidity:             10 * 365 * 24 * time.Hour,
+		IntermediateValidity:     365 * 24 * time.Hour,
+		Subject:                  pkix.Name{Organization: []string{"Example Org"}, Country: []string{"DE"}},
+		IPAddresses:              []net.IP{net.ParseIP("192.0.2.1")},
+		PermittedDNSDomains:      []string{"localhost"},
+		PermittedIPRanges:        []*net.IPNet{localhostRange, loopbackRange},
+	}
+
+	c, err := NewCore([]string{"localhost"}, caConfig, quote.NewMockValidator(), quote.NewMockIssuer(), &seal.MockSealer{}, recovery.NewSinglePartyRecovery(), zapLogger, nil)
+	require.NoError(err)
+
+	rootCert, err := c.data.getCertificate(sKCoordinatorRootCert)
+	require.NoError(err)
+	assert.Equal(x509.Ed25519, rootCert.PublicKeyAlgorithm)
+	assert.Equal(coordinatorName, rootCert.Subject.CommonName)
+	assert.Equal([]string{"Example Org"}, rootCert.Subject.Organization)
+	assert.Equal([]string{"DE"}, rootCert.Subject.Country)
+	assert.True(rootCert.NotAfter.Before(time.Now().Add(caConfig.RootValidity + time.Minute)))
+	require.Len(rootCert.IPAddresses, 1)
+	assert.True(rootCert.IPAddresses[0].Equal(caConfig.IPAddresses[0]))
+	assert.Empty(rootCert.PermittedDNSDomains)
+
+	checkIntermediates := func() {
+		intermediateCert, err := c.data.getCertificate(skCoordinatorIntermediateCert)
+		require.NoError(err)
+		marbleRootCert, err := c.data.getCertificate(sKMarbleRootCert)
+		require.NoError(err)
+		intermediatePrivK, err := c.data.getPrivK(sKCoordinatorIntermediateKey)
+		require.NoError(err)
+
+		ecdsaKey, ok := intermediatePrivK.(*ecdsa.PrivateKey)
+		require.True(ok)
+		assert.Equal(elliptic.P384(), ecdsaKey.Curve)
+		for _, cert := range []*x509.Certificate{intermediateCert, marbleRootCert} {
+			assert.Equal([]string{"Example Org"}, cert.Subject.Organization)
+			assert.Equal([]string{"localhost"}, cert.PermittedDNSDomains)
+			assert.Len(cert.PermittedIPRanges, 2)
+			assert.True(cert.NotAfter.Before(time.Now().Add(caConfig.IntermediateValidity + time.Minute)))
+		}
+
+		// the cross-signed intermediate chains to the root
+		roots := x509.NewCertPool()
+		roots.AddCert(rootCert)
+		_, err = intermediateCert.Verify(x509.VerifyOptions{Roots: roots})
+		assert.NoError(err)
+	}
+	checkIntermediates()
+
+	// certificates of secrets are issued within the name constraints
+	_, err = c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	marbleRootCert, err := c.data.getCertificate(sKMarbleRootCert)
+	require.NoError(err)
+	secret, err := c.data.getSecret("cert_shared")
+	require.NoError(err)
+	roots := x509.NewCertPool()
+	roots.AddCert(marbleRootCert)
+	secretCert := x509.Certificate(secret.Cert)
+	_, err = secretCert.Verify(x509.VerifyOptions{Roots: roots})
+	assert.NoError(err)
+
+	// the intermediate CA is regenerated with the same configuration
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+	require.NoError(c.UpdateManifest(context.TODO(), []byte(test.UpdateManifest), admin))
+	checkIntermediates()
+
+	// root keys of all algorithms can be used to derive keys
+	for _, algorithm := range []KeyAlgorithm{KeyAlgorithmECDSAP256, KeyAlgorithmEd25519, KeyAlgorithmRSA2048} {
+		privKey, err := algorithm.generateKey()
+		require.NoError(err)
+		derived, err := keyDerivationSecret(privKey)
+		require.NoError(err)
+		assert.NotEmpty(derived)
+	}
+	_, err = keyDerivationSecret(ed25519.PublicKey{})
+	assert.Error(err)
+}
+
+func TestParseSubject(t *testing.T) {
+	assert := assert.New(t)
+
+	subject, err := ParseSubject("O=Example Org, OU=Unit,C=DE,ST=Berlin,L=Berlin,SERIALNUMBER=42")
+	assert.NoError(err)
+	assert.Equal([]string{"Example Org"}, subject.Organization)
+	assert.Equal([]string{"Unit"}, subject.OrganizationalUnit)
+	assert.Equal([]string{"DE"}, subject.Country)
+	assert.Equal([]string{"Berlin"}, subject.Province)
+	assert.Equal([]string{"Berlin"}, subject.Locality)
+	assert.Equal("42", subject.SerialNumber)
+
+	subject, err = ParseSubject("")
+	assert.NoError(err)
+	assert.Equal(pkix.Name{}, subject)
+
+	_, err = ParseSubject("CN=Coordinator")
+	assert.Error(err)
+	_, err = ParseSubject("Example Org")
+	assert.Error(err)
+}
+
+func TestParseKeyAlgorithm(t *testing.T) {
+	assert := assert.New(t)
+
+	algorithm, err := ParseKeyAlgorithm("")
+	assert.NoError(err)
+	assert.Equal(KeyAlgorithmECDSAP256, algorithm)
+	algorithm, err = ParseKeyAlgorithm("Ed25519")
+	assert.NoError(err)
+	assert.Equal(KeyAlgorithmEd25519, algorithm)
+	_, err = ParseKeyAlgorithm("dsa")
+	assert.Error(err)
+}
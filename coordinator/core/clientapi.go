@@ -14,10 +14,13 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/edgelesssys/marblerun/coordinator/manifest"
 	"github.com/edgelesssys/marblerun/coordinator/quote"
 	"github.com/edgelesssys/marblerun/coordinator/store"
+	"github.com/edgelesssys/marblerun/coordinator/updatelog"
 	"github.com/edgelesssys/marblerun/coordinator/user"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -25,27 +28,48 @@ import (
 
 // ClientCore provides the core functionality for the client. It can be used by e.g. a http server
 type ClientCore interface {
+	GetActivations(ctx context.Context, requestUser *user.User) (map[string]uint, error)
+	AuthorizeRead(ctx context.Context, requestUser *user.User, permission string) error
+	RevokeMarble(ctx context.Context, marbleUUID string, updater *user.User) error
+	SetUserCertificate(ctx context.Context, userName string, rawCert []byte, updater *user.User) error
 	SetManifest(ctx context.Context, rawManifest []byte) (recoverySecretMap map[string][]byte, err error)
+	SetManifestDryRun(ctx context.Context, rawManifest []byte) (ManifestChanges, error)
 	GetCertQuote(ctx context.Context) (cert string, certQuote []byte, err error)
 	GetManifestSignature(ctx context.Context) (manifestSignature []byte, manifest []byte)
 	GetSecrets(ctx context.Context, requestedSecrets []string, requestUser *user.User) (map[string]manifest.Secret, error)
 	GetStatus(ctx context.Context) (statusCode int, status string, err error)
 	GetUpdateLog(ctx context.Context) (updateLog string, err error)
-	Recover(ctx context.Context, encryptionKey []byte) (int, error)
+	Recover(ctx context.Context, encryptionKey []byte, clientCerts []*x509.Certificate) (int, error)
 	VerifyUser(ctx context.Context, clientCerts []*x509.Certificate) (*user.User, error)
 	UpdateManifest(ctx context.Context, rawUpdateManifest []byte, updater *user.User) error
+	UpdateManifestDryRun(ctx context.Context, rawUpdateManifest []byte, updater *user.User) (ManifestChanges, error)
 	WriteSecrets(ctx context.Context, rawSecretManifest []byte, updater *user.User) error
+	GetSecretHistory(ctx context.Context, secretName string, requestUser *user.User) ([]manifest.SecretVersion, error)
+	RollbackSecret(ctx context.Context, secretName string, version uint, updater *user.User) error
+	DeleteSecrets(ctx context.Context, secretNames []string, updater *user.User) error
+	RotateSecrets(ctx context.Context, secretNames []string, updater *user.User) error
+	RotateRootCA(ctx context.Context, updater *user.User) error
+	GetIntermediateCSR(ctx context.Context, updater *user.User) (csr []byte, csrQuote []byte, err error)
+	SetIntermediateCertificate(ctx context.Context, rawCertChain []byte, updater *user.User) error
+	GetSPIFFEBundle(ctx context.Context) (bundle []byte, err error)
+	RotateSealKey(ctx context.Context, updater *user.User) error
+	ExportSealKeys(ctx context.Context, updater *user.User) (map[string]map[string][]byte, error)
+	ImportSealKeys(ctx context.Context, rawSealKeys []byte, updater *user.User) error
 }
 
 // SetManifest sets the manifest, once and for all
 //
-// rawManifest is the manifest of type Manifest in JSON format.
+// rawManifest is the manifest of type Manifest in JSON or YAML format. It is stored in its canonical JSON form.
 func (c *Core) SetManifest(ctx context.Context, rawManifest []byte) (map[string][]byte, error) {
 	defer c.mux.Unlock()
 	if err := c.requireState(stateAcceptingManifest, stateRecovery); err != nil {
 		return nil, err
 	}
 
+	rawManifest, err := manifest.Canonicalize(rawManifest)
+	if err != nil {
+		return nil, err
+	}
 	var manifest manifest.Manifest
 	if err := json.Unmarshal(rawManifest, &manifest); err != nil {
 		return nil, err
@@ -54,25 +78,8 @@ func (c *Core) SetManifest(ctx context.Context, rawManifest []byte) (map[string]
 		return nil, err
 	}
 
-	marbleRootCert, err := c.data.getCertificate(sKMarbleRootCert)
-	if err != nil {
-		return nil, err
-	}
-	intermediatePrivK, err := c.data.getPrivK(sKCoordinatorIntermediateKey)
-	if err != nil {
-		return nil, err
-	}
-
-	// Generate shared secrets specified in manifest
-	secrets, err := c.generateSecrets(ctx, manifest.Secrets, uuid.Nil, marbleRootCert, intermediatePrivK)
-	if err != nil {
-		c.zaplogger.Error("Could not generate specified secrets for the given manifest.", zap.Error(err))
-		return nil, err
-	}
-	// generate placeholders for private secrets specified in manifest
-	privSecrets, err := c.generateSecrets(ctx, manifest.Secrets, uuid.New(), marbleRootCert, intermediatePrivK)
+	generated, err := c.generateManifestSecrets(ctx, manifest)
 	if err != nil {
-		c.zaplogger.Error("Could not generate specified secrets for the given manifest.", zap.Error(err))
 		return nil, err
 	}
 
@@ -89,6 +96,12 @@ func (c *Core) SetManifest(ctx context.Context, rawManifest []byte) (map[string]
 	}
 	c.sealer.SetEncryptionKey(encryptionKey)
 
+	// Generate the master key the marbles' seal keys are derived from
+	initialSealKey, err := newSealKey(1)
+	if err != nil {
+		return nil, err
+	}
+
 	// Parse X.509 user certificates and permissions from manifest
 	users, err := generateUsersFromManifest(manifest.Users, manifest.Roles)
 	if err != nil {
@@ -106,6 +119,9 @@ func (c *Core) SetManifest(ctx context.Context, rawManifest []byte) (map[string]
 	if err := txdata.putRawManifest(rawManifest); err != nil {
 		return nil, err
 	}
+	if err := txdata.putSealKeys([]sealKey{initialSealKey}); err != nil {
+		return nil, err
+	}
 	for k, v := range manifest.Packages {
 		if err := txdata.putPackage(k, v); err != nil {
 			return nil, err
@@ -121,19 +137,34 @@ func (c *Core) SetManifest(ctx context.Context, rawManifest []byte) (map[string]
 			return nil, err
 		}
 	}
-	for k, v := range secrets {
+	for k, v := range generated.shared {
 		if err := txdata.putSecret(k, v); err != nil {
 			return nil, err
 		}
+		if err := txdata.appendSecretHistory(k, v, ""); err != nil {
+			return nil, err
+		}
 	}
-	for k, v := range privSecrets {
+	for k, v := range generated.private {
 		if err := txdata.putSecret(k, v); err != nil {
 			return nil, err
 		}
 	}
-	// save metadata of user-defined secrets
+	for k := range generated.remote {
+		if err := txdata.putRemoteSecretStatus(k, remoteSecretStatus{LastFetched: time.Now()}); err != nil {
+			return nil, err
+		}
+	}
+	for marbleType, marbleTypeSecrets := range generated.marbleType {
+		for k, v := range marbleTypeSecrets {
+			if err := txdata.putMarbleTypeSecret(marbleType, k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// save metadata of user-defined secrets and of shared secrets whose issuer is not uploaded yet
 	for k, v := range manifest.Secrets {
-		if v.UserDefined {
+		if _, ok := generated.shared[k]; !ok && (v.UserDefined || v.Shared) {
 			if err := txdata.putSecret(k, v); err != nil {
 				return nil, err
 			}
@@ -166,6 +197,72 @@ func (c *Core) SetManifest(ctx context.Context, rawManifest []byte) (map[string]
 	return recoverySecretMap, nil
 }
 
+// manifestSecrets are the secrets generated for a new manifest
+type manifestSecrets struct {
+	// shared are the generated shared secrets and the secrets fetched from secret providers
+	shared map[string]manifest.Secret
+	// private are placeholders for the secrets generated for each marble
+	private map[string]manifest.Secret
+	// remote are the secrets fetched from secret providers
+	remote map[string]manifest.Secret
+	// marbleType are the secrets shared by all marbles of a type, by marble type
+	marbleType map[string]map[string]manifest.Secret
+}
+
+// generateManifestSecrets generates the secrets of a new manifest without storing them
+func (c *Core) generateManifestSecrets(ctx context.Context, mnf manifest.Manifest) (manifestSecrets, error) {
+	marbleRootCert, err := c.data.getCertificate(sKMarbleRootCert)
+	if err != nil {
+		return manifestSecrets{}, err
+	}
+	intermediatePrivK, err := c.data.getPrivK(sKCoordinatorIntermediateKey)
+	if err != nil {
+		return manifestSecrets{}, err
+	}
+
+	// Fetch secrets from external secret providers
+	remoteSecrets, err := c.fetchRemoteSecrets(ctx, mnf)
+	if err != nil {
+		c.zaplogger.Error("Could not fetch secrets from secret providers.", zap.Error(err))
+		return manifestSecrets{}, err
+	}
+
+	// Generate shared secrets specified in manifest
+	secrets, err := c.generateSecrets(ctx, mergeSecretMaps(mnf.Secrets, remoteSecrets), uuid.Nil, marbleRootCert, intermediatePrivK)
+	if err != nil {
+		c.zaplogger.Error("Could not generate specified secrets for the given manifest.", zap.Error(err))
+		return manifestSecrets{}, err
+	}
+	for k, v := range remoteSecrets {
+		secrets[k] = v
+	}
+	// private secrets may be signed by shared secrets, so pass the generated values along
+	secretsWithShared := mergeSecretMaps(mnf.Secrets, secrets)
+	// generate placeholders for private secrets specified in manifest
+	privSecrets, err := c.generateSecrets(ctx, secretsWithShared, uuid.New(), marbleRootCert, intermediatePrivK)
+	if err != nil {
+		c.zaplogger.Error("Could not generate specified secrets for the given manifest.", zap.Error(err))
+		return manifestSecrets{}, err
+	}
+
+	// generate secrets shared by all Marbles of the same type
+	marbleTypeSecrets := make(map[string]map[string]manifest.Secret)
+	for marbleType := range mnf.Marbles {
+		marbleTypeSecrets[marbleType], err = c.generateMarbleTypeSecrets(ctx, secretsWithShared, marbleType, marbleRootCert, intermediatePrivK)
+		if err != nil {
+			c.zaplogger.Error("Could not generate specified secrets for the given manifest.", zap.Error(err))
+			return manifestSecrets{}, err
+		}
+	}
+
+	return manifestSecrets{
+		shared:     secrets,
+		private:    privSecrets,
+		remote:     remoteSecrets,
+		marbleType: marbleTypeSecrets,
+	}, nil
+}
+
 // GetCertQuote gets the Coordinators certificate and corresponding quote (containing the cert)
 //
 // Returns the a remote attestation quote of its own certificate alongside this certificate that allows to verify the Coordinator's integrity and authentication for use of the ClientAPI.
@@ -195,24 +292,54 @@ func (c *Core) GetCertQuote(ctx context.Context) (string, []byte, error) {
 		return "", nil, errors.New("pem.EncodeToMemory failed for intermediate certificate")
 	}
 
-	strCert := string(pemCertIntermediate) + string(pemCertRoot)
+	// During a root CA rotation, include the previous root and the cross-signed certificates.
+	// The current root stays last, since the quote is issued for it.
+	transition, err := c.getRootCATransition()
+	if err != nil {
+		return "", nil, err
+	}
+	var pemCertTransition []byte
+	for _, certRaw := range [][]byte{transition.CrossSignedRoot, transition.PreviousRoot, transition.CrossSignedPreviousRoot} {
+		if len(certRaw) > 0 {
+			pemCertTransition = append(pemCertTransition, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certRaw})...)
+		}
+	}
+
+	// If the intermediate CA is issued by an external CA, its certificate and chain come first
+	externalCerts, err := c.externalCACertificates()
+	if err != nil {
+		return "", nil, err
+	}
+	var pemCertExternal []byte
+	for _, certRaw := range externalCerts {
+		pemCertExternal = append(pemCertExternal, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certRaw})...)
+	}
+
+	strCert := string(pemCertExternal) + string(pemCertIntermediate) + string(pemCertTransition) + string(pemCertRoot)
 	return strCert, c.quote, nil
 }
 
 // GetManifestSignature returns the hash of the manifest
 //
-// Returns a SHA256 hash of the active manifest.
+// Returns a SHA256 hash of the canonical form of the active manifest, together with the canonical manifest.
 func (c *Core) GetManifestSignature(ctx context.Context) ([]byte, []byte) {
 	rawManifest, err := c.data.getRawManifest()
 	if err != nil {
 		return nil, nil
 	}
+	// manifests stored by previous versions are not canonicalized yet
+	rawManifest, err = manifest.Canonicalize(rawManifest)
+	if err != nil {
+		return nil, nil
+	}
 	hash := sha256.Sum256(rawManifest)
 	return hash[:], rawManifest
 }
 
 // Recover sets an encryption key (ideally decrypted from the recovery data) and tries to unseal and load a saved state again.
-func (c *Core) Recover(ctx context.Context, secret []byte) (int, error) {
+//
+// If the manifest of the saved state defines a Recovery role, one of the client certificates must belong to a user with the Recover permission.
+func (c *Core) Recover(ctx context.Context, secret []byte, clientCerts []*x509.Certificate) (int, error) {
 	defer c.mux.Unlock()
 	if err := c.requireState(stateRecovery); err != nil {
 		return -1, err
@@ -228,7 +355,7 @@ func (c *Core) Recover(ctx context.Context, secret []byte) (int, error) {
 		return remaining, nil
 	}
 
-	if err := c.performRecovery(secret); err != nil {
+	if err := c.performRecovery(secret, clientCerts); err != nil {
 		return -1, err
 	}
 
@@ -249,110 +376,225 @@ func (c *Core) GetUpdateLog(ctx context.Context) (string, error) {
 	return c.data.getUpdateLog()
 }
 
-// VerifyUser checks if a given client certificate matches the admin certificates specified in the manifest
-func (c *Core) VerifyUser(ctx context.Context, clientCerts []*x509.Certificate) (*user.User, error) {
-	userIter, err := c.data.getIterator(requestUser)
+// GetActivations returns the number of activations of every marble type the user is allowed to inspect
+func (c *Core) GetActivations(ctx context.Context, client *user.User) (map[string]uint, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, err
+	}
+
+	marbleIter, err := c.data.getIterator(requestMarble)
 	if err != nil {
 		return nil, err
 	}
-	// Check if a supplied client cert matches the supplied ones from the manifest stored in the core
-	// NOTE: We do not use the "correct" X.509 verify here since we do not really care about expiration and chain verification here.
-	for _, suppliedCert := range clientCerts {
-		for userIter.HasNext() {
-			name, err := userIter.GetNext()
-			if err != nil {
-				return nil, err
-			}
-			user, err := c.data.getUser(name)
-			if err != nil {
-				return nil, err
-			}
-			if suppliedCert.Equal(user.Certificate()) {
-				return user, nil
-			}
+
+	activations := make(map[string]uint)
+	for marbleIter.HasNext() {
+		marbleType, err := marbleIter.GetNext()
+		if err != nil {
+			return nil, err
+		}
+		if !client.IsGranted(user.NewPermission(user.PermissionReadActivations, []string{marbleType})) {
+			continue
 		}
+		count, err := c.data.getActivations(marbleType)
+		if err != nil && !store.IsStoreValueUnsetError(err) {
+			return nil, err
+		}
+		activations[marbleType] = count
 	}
 
-	return nil, errors.New("client certificate did not match any Marblerun users")
+	if len(activations) <= 0 {
+		return nil, fmt.Errorf("user %s is not allowed to read activations of any marble", client.Name())
+	}
+	return activations, nil
 }
 
-// UpdateManifest allows to update certain package parameters, supplied via a JSON manifest
-func (c *Core) UpdateManifest(ctx context.Context, rawUpdateManifest []byte, updater *user.User) error {
-	defer c.mux.Unlock()
+// AuthorizeRead checks if a user may read the manifest or the update log
+//
+// Reading is only restricted if the manifest defines a role of the corresponding resource type,
+// so deployments without such roles keep their public read access. requestUser is nil for unauthenticated requests.
+func (c *Core) AuthorizeRead(ctx context.Context, requestUser *user.User, permission string) error {
+	var resourceType string
+	switch permission {
+	case user.PermissionReadManifest:
+		resourceType = "Manifest"
+	case user.PermissionReadUpdateLog:
+		resourceType = "UpdateLog"
+	default:
+		return fmt.Errorf("unknown read permission %s", permission)
+	}
+
+	mnf, err := c.data.getManifest()
+	if store.IsStoreValueUnsetError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var restricted bool
+	for _, role := range mnf.Roles {
+		if role.ResourceType == resourceType {
+			restricted = true
+		}
+	}
+	if !restricted {
+		return nil
+	}
 
-	// Only accept update manifest if we already have a manifest
+	if requestUser == nil {
+		return fmt.Errorf("reading the %s requires an authenticated user", resourceType)
+	}
+	if !requestUser.IsGranted(user.NewPermission(permission, nil)) {
+		return fmt.Errorf("user %s is not allowed to read the %s", requestUser.Name(), resourceType)
+	}
+	return nil
+}
+
+// RevokeMarble revokes an activated marble
+//
+// The marble can neither be activated again nor use the Coordinator's marble APIs with its certificate.
+func (c *Core) RevokeMarble(ctx context.Context, marbleUUID string, updater *user.User) error {
+	defer c.mux.Unlock()
 	if err := c.requireState(stateAcceptingMarbles); err != nil {
 		return err
 	}
 
-	// Unmarshal & check update manifest
-	var updateManifest manifest.Manifest
-	if err := json.Unmarshal(rawUpdateManifest, &updateManifest); err != nil {
+	marbleType, err := c.data.getActivatedMarble(marbleUUID)
+	if store.IsStoreValueUnsetError(err) {
+		return fmt.Errorf("marble %s was not activated", marbleUUID)
+	}
+	if err != nil {
 		return err
 	}
-
-	// verify updater is allowed to commit the update
-	var wantedPackages []string
-	for pkg := range updateManifest.Packages {
-		wantedPackages = append(wantedPackages, pkg)
+	if !updater.IsGranted(user.NewPermission(user.PermissionRevokeMarble, []string{marbleType})) {
+		return fmt.Errorf("user %s is not allowed to revoke marbles of type %s", updater.Name(), marbleType)
 	}
-	if !updater.IsGranted(user.NewPermission(user.PermissionUpdatePackage, wantedPackages)) {
-		return fmt.Errorf("user %s is not allowed to update one or more packages of %v", updater.Name(), wantedPackages)
+
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
+	txdata := storeWrapper{tx}
 
-	currentPackages := make(map[string]quote.PackageProperties)
-	for pkgName := range updateManifest.Packages {
-		pkg, err := c.data.getPackage(pkgName)
-		if err != nil {
-			return err
-		}
-		currentPackages[pkgName] = pkg
+	if err := txdata.putRevokedMarble(marbleUUID, marbleType); err != nil {
+		return err
 	}
-	if err := updateManifest.CheckUpdate(ctx, currentPackages); err != nil {
+	c.updateLogger.Reset()
+	c.updateLogger.Info("marble revoked", zap.String("user", updater.Name()), zap.String("marble", marbleUUID), zap.String("type", marbleType))
+	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
 		return err
 	}
+	return tx.Commit()
+}
 
-	// update manifest was valid, increase svn and regenerate secrets
-	for pkgName, pkg := range updateManifest.Packages {
-		*currentPackages[pkgName].SecurityVersion = *pkg.SecurityVersion
+// SetUserCertificate replaces the certificate a user authenticates with. The user keeps its permissions.
+func (c *Core) SetUserCertificate(ctx context.Context, userName string, rawCert []byte, updater *user.User) error {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return err
+	}
+	if !updater.IsGranted(user.NewPermission(user.PermissionManageUsers, []string{userName})) {
+		return fmt.Errorf("user %s is not allowed to manage user %s", updater.Name(), userName)
 	}
 
-	rootCert, err := c.data.getCertificate(sKCoordinatorRootCert)
-	if err != nil {
-		return err
+	block, _ := pem.Decode(rawCert)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return errors.New("received invalid certificate")
 	}
-	rootPrivK, err := c.data.getPrivK(sKCoordinatorRootKey)
+	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
 		return err
 	}
 
-	// Generate new cross-signed intermediate CA for Marble gRPC authentication
-	intermediateCert, intermediatePrivK, err := generateCert(rootCert.DNSNames, coordinatorIntermediateName, nil, rootCert, rootPrivK)
+	oldUser, err := c.data.getUser(userName)
+	if store.IsStoreValueUnsetError(err) {
+		return fmt.Errorf("user %s does not exist", userName)
+	}
 	if err != nil {
-		c.zaplogger.Error("Could not generate a new intermediate CA for Marble authentication.", zap.Error(err))
 		return err
 	}
-	marbleRootCert, _, err := generateCert(rootCert.DNSNames, coordinatorIntermediateName, intermediatePrivK, nil, nil)
+	// certificates must stay unique, otherwise requests could be authenticated as another user
+	userIter, err := c.data.getIterator(requestUser)
 	if err != nil {
 		return err
 	}
+	for userIter.HasNext() {
+		name, err := userIter.GetNext()
+		if err != nil {
+			return err
+		}
+		otherUser, err := c.data.getUser(name)
+		if err != nil {
+			return err
+		}
+		if name != userName && cert.Equal(otherUser.Certificate()) {
+			return fmt.Errorf("certificate is already used by user %s", name)
+		}
+	}
+
+	newUser := user.NewUser(userName, cert)
+	for _, permission := range oldUser.Permissions() {
+		newUser.Assign(permission)
+	}
 
-	// Gather all shared certificate secrets we need to regenerate
-	secretsToRegenerate := make(map[string]manifest.Secret)
-	secrets, err := c.data.getSecretMap()
+	tx, err := c.store.BeginTransaction()
 	if err != nil {
 		return err
 	}
-	for name, secret := range secrets {
-		if secret.Shared && secret.Type != "symmetric-key" {
-			secretsToRegenerate[name] = secret
+	defer tx.Rollback()
+	txdata := storeWrapper{tx}
+
+	if err := txdata.putUser(newUser); err != nil {
+		return err
+	}
+	c.updateLogger.Reset()
+	c.updateLogger.Info("user certificate replaced", zap.String("user", updater.Name()), zap.String("managed user", userName))
+	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// VerifyUser checks if a given client certificate matches the admin certificates specified in the manifest
+func (c *Core) VerifyUser(ctx context.Context, clientCerts []*x509.Certificate) (*user.User, error) {
+	userIter, err := c.data.getIterator(requestUser)
+	if err != nil {
+		return nil, err
+	}
+	// Check if a supplied client cert matches the supplied ones from the manifest stored in the core
+	// NOTE: We do not use the "correct" X.509 verify here since we do not really care about expiration and chain verification here.
+	for _, suppliedCert := range clientCerts {
+		for userIter.HasNext() {
+			name, err := userIter.GetNext()
+			if err != nil {
+				return nil, err
+			}
+			user, err := c.data.getUser(name)
+			if err != nil {
+				return nil, err
+			}
+			if suppliedCert.Equal(user.Certificate()) {
+				return user, nil
+			}
 		}
 	}
 
-	// Regenerate shared secrets specified in manifest
-	regeneratedSecrets, err := c.generateSecrets(ctx, secretsToRegenerate, uuid.Nil, marbleRootCert, intermediatePrivK)
+	return nil, errors.New("client certificate did not match any Marblerun users")
+}
+
+// UpdateManifest allows to update certain package parameters, supplied via a JSON manifest
+func (c *Core) UpdateManifest(ctx context.Context, rawUpdateManifest []byte, updater *user.User) error {
+	defer c.mux.Unlock()
+
+	// Only accept update manifest if we already have a manifest
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return err
+	}
+
+	updateManifest, currentPackages, reissued, err := c.prepareUpdate(ctx, rawUpdateManifest, updater)
 	if err != nil {
-		c.zaplogger.Error("Could not generate specified secrets for the given manifest.", zap.Error(err))
 		return err
 	}
 
@@ -375,13 +617,7 @@ func (c *Core) UpdateManifest(ctx context.Context, rawUpdateManifest []byte, upd
 	defer tx.Rollback()
 	txdata := storeWrapper{tx}
 
-	if err := txdata.putCertificate(skCoordinatorIntermediateCert, intermediateCert); err != nil {
-		return err
-	}
-	if err := txdata.putCertificate(sKMarbleRootCert, marbleRootCert); err != nil {
-		return err
-	}
-	if err := txdata.putPrivK(sKCoordinatorIntermediateKey, intermediatePrivK); err != nil {
+	if err := reissued.put(txdata, updater.Name()); err != nil {
 		return err
 	}
 	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
@@ -394,13 +630,6 @@ func (c *Core) UpdateManifest(ctx context.Context, rawUpdateManifest []byte, upd
 			return err
 		}
 	}
-	// Overwrite regenerated secrets in core
-	for name, secret := range regeneratedSecrets {
-		if err := txdata.putSecret(name, secret); err != nil {
-			return err
-		}
-	}
-
 	c.zaplogger.Info("An update manifest overriding package settings from the original manifest was set.")
 	c.zaplogger.Info("Please restart your Marbles to enforce the update.")
 
@@ -410,23 +639,103 @@ func (c *Core) UpdateManifest(ctx context.Context, rawUpdateManifest []byte, upd
 	return tx.Commit()
 }
 
-// GetSecrets allows a user to read out secrets from the core
-func (c *Core) GetSecrets(ctx context.Context, requestedSecrets []string, client *user.User) (map[string]manifest.Secret, error) {
-	defer c.mux.Unlock()
-
-	// we can only return secrets if a manifest has already been set
-	if err := c.requireState(stateAcceptingMarbles); err != nil {
-		return nil, err
+// prepareUpdate checks an update manifest and regenerates the intermediate CA and the certificates issued by it, without storing anything.
+// It returns the update manifest and the updated packages.
+func (c *Core) prepareUpdate(ctx context.Context, rawUpdateManifest []byte, updater *user.User) (manifest.Manifest, map[string]quote.PackageProperties, reissuedIntermediateCA, error) {
+	// Unmarshal & check update manifest
+	rawUpdateManifest, err := manifest.Canonicalize(rawUpdateManifest)
+	if err != nil {
+		return manifest.Manifest{}, nil, reissuedIntermediateCA{}, err
+	}
+	var updateManifest manifest.Manifest
+	if err := json.Unmarshal(rawUpdateManifest, &updateManifest); err != nil {
+		return manifest.Manifest{}, nil, reissuedIntermediateCA{}, err
 	}
 
-	// verify user is allowed to read the requested secrets
-	if !client.IsGranted(user.NewPermission(user.PermissionReadSecret, requestedSecrets)) {
-		return nil, fmt.Errorf("user %s is not allowed to read one or more secrets of: %v", client.Name(), requestedSecrets)
+	// verify updater is allowed to commit the update
+	var wantedPackages []string
+	for pkg := range updateManifest.Packages {
+		wantedPackages = append(wantedPackages, pkg)
+	}
+	if !updater.IsGranted(user.NewPermission(user.PermissionUpdatePackage, wantedPackages)) {
+		return manifest.Manifest{}, nil, reissuedIntermediateCA{}, fmt.Errorf("user %s is not allowed to update one or more packages of %v", updater.Name(), wantedPackages)
+	}
+
+	currentPackages := make(map[string]quote.PackageProperties)
+	for pkgName := range updateManifest.Packages {
+		pkg, err := c.data.getPackage(pkgName)
+		if err != nil {
+			return manifest.Manifest{}, nil, reissuedIntermediateCA{}, err
+		}
+		currentPackages[pkgName] = pkg
+	}
+	if err := updateManifest.CheckUpdate(ctx, currentPackages); err != nil {
+		return manifest.Manifest{}, nil, reissuedIntermediateCA{}, err
+	}
+
+	// update manifest was valid, increase svn and regenerate secrets
+	for pkgName, pkg := range updateManifest.Packages {
+		*currentPackages[pkgName].SecurityVersion = *pkg.SecurityVersion
+	}
+
+	rootCert, err := c.data.getCertificate(sKCoordinatorRootCert)
+	if err != nil {
+		return manifest.Manifest{}, nil, reissuedIntermediateCA{}, err
+	}
+	rootPrivK, err := c.data.getPrivK(sKCoordinatorRootKey)
+	if err != nil {
+		return manifest.Manifest{}, nil, reissuedIntermediateCA{}, err
+	}
+
+	// Generate new cross-signed intermediate CA for Marble gRPC authentication and regenerate the certificates issued by it
+	reissued, err := c.reissueIntermediateCA(ctx, rootCert, rootPrivK)
+	if err != nil {
+		return manifest.Manifest{}, nil, reissuedIntermediateCA{}, err
+	}
+	return updateManifest, currentPackages, reissued, nil
+}
+
+// GetSecrets allows a user to read out secrets from the core
+func (c *Core) GetSecrets(ctx context.Context, requestedSecrets []string, client *user.User) (map[string]manifest.Secret, error) {
+	defer c.mux.Unlock()
+
+	// we can only return secrets if a manifest has already been set
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, err
+	}
+
+	// verify user is allowed to read the requested secrets
+	// values of per-marble-type secrets are requested as <marbleType>/<secretName>, permissions are granted on the secret itself
+	var secretNames []string
+	for _, requestedSecret := range requestedSecrets {
+		_, secretName := splitMarbleTypeSecretName(requestedSecret)
+		secretNames = append(secretNames, secretName)
+	}
+	if !client.IsGranted(user.NewPermission(user.PermissionReadSecret, secretNames)) {
+		return nil, fmt.Errorf("user %s is not allowed to read one or more secrets of: %v", client.Name(), requestedSecrets)
+	}
+
+	mnf, err := c.data.getManifest()
+	if err != nil {
+		return nil, err
 	}
 
 	secrets := make(map[string]manifest.Secret)
 	for _, requestedSecret := range requestedSecrets {
-		returnedSecret, err := c.data.getSecret(requestedSecret)
+		var returnedSecret manifest.Secret
+		var err error
+		marbleType, secretName := splitMarbleTypeSecretName(requestedSecret)
+		if mnf.Secrets[secretName].TransitOnly {
+			return nil, fmt.Errorf("secret %s can only be used as transit key", secretName)
+		}
+		if definition := mnf.Secrets[secretName]; definition.DerivedFrom != "" {
+			// derived secrets are not stored, but derived from the current value of their master key
+			returnedSecret, err = c.deriveSecret(secretName, definition, marbleType, uuid.Nil)
+		} else if marbleType != "" {
+			returnedSecret, err = c.data.getMarbleTypeSecret(marbleType, secretName)
+		} else {
+			returnedSecret, err = c.data.getSecret(requestedSecret)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -461,6 +770,12 @@ func (c *Core) WriteSecrets(ctx context.Context, rawSecretManifest []byte, updat
 		return err
 	}
 
+	// (re-)issue the certificates signed by the new secrets
+	reissued, err := c.reissueCertificates(ctx, newSecrets, nil)
+	if err != nil {
+		return err
+	}
+
 	tx, err := c.store.BeginTransaction()
 	if err != nil {
 		return err
@@ -477,8 +792,14 @@ func (c *Core) WriteSecrets(ctx context.Context, rawSecretManifest []byte, updat
 		if err := txdata.putSecret(secretName, secret); err != nil {
 			return err
 		}
+		if err := txdata.appendSecretHistory(secretName, secret, updater.Name()); err != nil {
+			return err
+		}
 		c.updateLogger.Info("secret set", zap.String("user", updater.Name()), zap.String("secret", secretName), zap.String("type", secret.Type))
 	}
+	if err := reissued.put(txdata, c.updateLogger, nil); err != nil {
+		return err
+	}
 	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
 		return err
 	}
@@ -486,17 +807,359 @@ func (c *Core) WriteSecrets(ctx context.Context, rawSecretManifest []byte, updat
 	return tx.Commit()
 }
 
-func (c *Core) performRecovery(encryptionKey []byte) error {
-	if err := c.sealer.SetEncryptionKey(encryptionKey); err != nil {
+// reissuedCertificates holds the secrets generated by reissueCertificates
+type reissuedCertificates struct {
+	// shared are the generated shared secrets
+	shared map[string]manifest.Secret
+	// marbleType are the generated per-marble-type secrets by marble type
+	marbleType map[string]map[string]manifest.Secret
+}
+
+// reissueCertificates generates the given secrets, unless they are user-defined or fetched from a secret provider,
+// and the shared and per-marble-type certificates which are signed, directly or through other generated CAs, by one of them.
+// Restored secrets keep their value, only the certificates signed by them are generated.
+func (c *Core) reissueCertificates(ctx context.Context, secrets, restored map[string]manifest.Secret) (reissuedCertificates, error) {
+	mnf, err := c.data.getManifest()
+	if err != nil {
+		return reissuedCertificates{}, err
+	}
+	changedSecrets := mergeSecretMaps(secrets, restored)
+
+	dependents := make(map[string]manifest.Secret)
+	issuedByChanged := func(secret manifest.Secret) bool {
+		_, issuerChanged := changedSecrets[secret.Issuer]
+		_, issuerReissued := dependents[secret.Issuer]
+		return secret.Issuer != "" && (issuerChanged || issuerReissued)
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, secret := range mnf.Secrets {
+			if _, ok := dependents[name]; ok || !secret.Shared || secret.UserDefined {
+				continue
+			}
+			if issuedByChanged(secret) {
+				dependents[name] = secret
+				changed = true
+			}
+		}
+	}
+	marbleTypeDependents := make(map[string]manifest.Secret)
+	for name, secret := range mnf.Secrets {
+		if secret.PerMarbleType && issuedByChanged(secret) {
+			marbleTypeDependents[name] = secret
+		}
+	}
+
+	marbleRootCert, err := c.data.getCertificate(sKMarbleRootCert)
+	if err != nil {
+		return reissuedCertificates{}, err
+	}
+	intermediatePrivK, err := c.data.getPrivK(sKCoordinatorIntermediateKey)
+	if err != nil {
+		return reissuedCertificates{}, err
+	}
+	// user-defined and remote secrets are not generated, but serve as issuers. So do restored secrets.
+	restoredIssuers := make(map[string]manifest.Secret, len(restored))
+	for name, secret := range restored {
+		secret.UserDefined = true
+		restoredIssuers[name] = secret
+	}
+	shared, err := c.generateSecrets(ctx, mergeSecretMaps(dependents, secrets, restoredIssuers), uuid.Nil, marbleRootCert, intermediatePrivK)
+	if err != nil {
+		return reissuedCertificates{}, err
+	}
+
+	marbleTypeSecrets := make(map[string]map[string]manifest.Secret)
+	if len(marbleTypeDependents) > 0 {
+		issuers := mergeSecretMaps(changedSecrets, shared)
+		for marbleType := range mnf.Marbles {
+			marbleTypeSecrets[marbleType], err = c.generateMarbleTypeSecrets(ctx, mergeSecretMaps(marbleTypeDependents, issuers), marbleType, marbleRootCert, intermediatePrivK)
+			if err != nil {
+				return reissuedCertificates{}, err
+			}
+		}
+	}
+	return reissuedCertificates{shared: shared, marbleType: marbleTypeSecrets}, nil
+}
+
+// put saves the reissued certificates to store. Secrets in skip are left to the caller.
+func (r reissuedCertificates) put(txdata storeWrapper, updateLogger *updatelog.Logger, skip map[string]manifest.Secret) error {
+	for name, secret := range r.shared {
+		if _, ok := skip[name]; ok {
+			continue
+		}
+		if err := txdata.putSecret(name, secret); err != nil {
+			return err
+		}
+		if err := txdata.appendSecretHistory(name, secret, ""); err != nil {
+			return err
+		}
+		updateLogger.Info("certificate issued", zap.String("secret", name), zap.String("issuer", secret.Issuer))
+	}
+	for marbleType, secrets := range r.marbleType {
+		for name, secret := range secrets {
+			if err := txdata.putMarbleTypeSecret(marbleType, name, secret); err != nil {
+				return err
+			}
+			updateLogger.Info("certificate issued", zap.String("secret", name), zap.String("marble type", marbleType), zap.String("issuer", secret.Issuer))
+		}
+	}
+	return nil
+}
+
+// DeleteSecrets allows a user to reset user-defined secrets to their uninitialized state
+func (c *Core) DeleteSecrets(ctx context.Context, secretNames []string, updater *user.User) error {
+	defer c.mux.Unlock()
+
+	// Only accept requests if we already have a manifest
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
 		return err
 	}
 
-	// load state
+	// verify user is allowed to reset the secrets
+	if !updater.IsGranted(user.NewPermission(user.PermissionDeleteSecret, secretNames)) {
+		return fmt.Errorf("user %s is not allowed to delete one or more secrets of: %v", updater.Name(), secretNames)
+	}
+
+	mnf, err := c.data.getManifest()
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	txdata := storeWrapper{tx}
+
+	c.updateLogger.Reset()
+	for _, secretName := range secretNames {
+		// restore the metadata of the secret as defined in the manifest
+		secret, ok := mnf.Secrets[secretName]
+		if !ok {
+			return fmt.Errorf("secret %s is not defined in the manifest", secretName)
+		}
+		if !secret.UserDefined {
+			return fmt.Errorf("secret %s is not user-defined and can not be deleted", secretName)
+		}
+		if err := txdata.putSecret(secretName, secret); err != nil {
+			return err
+		}
+		if err := txdata.appendSecretDeletion(secretName, updater.Name()); err != nil {
+			return err
+		}
+		c.updateLogger.Info("secret deleted", zap.String("user", updater.Name()), zap.String("secret", secretName), zap.String("type", secret.Type))
+	}
+	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RotateSecrets allows a user to regenerate shared secrets
+func (c *Core) RotateSecrets(ctx context.Context, secretNames []string, updater *user.User) error {
+	defer c.mux.Unlock()
+
+	// Only accept requests if we already have a manifest
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return err
+	}
+
+	// verify user is allowed to rotate the secrets
+	if !updater.IsGranted(user.NewPermission(user.PermissionRotateSecret, secretNames)) {
+		return fmt.Errorf("user %s is not allowed to rotate one or more secrets of: %v", updater.Name(), secretNames)
+	}
+
+	mnf, err := c.data.getManifest()
+	if err != nil {
+		return err
+	}
+
+	// regenerate from the manifest definition to get a fresh validity period for certificates
+	secretsToRotate := make(map[string]manifest.Secret)
+	for _, secretName := range secretNames {
+		secret, ok := mnf.Secrets[secretName]
+		if !ok {
+			return fmt.Errorf("secret %s is not defined in the manifest", secretName)
+		}
+		if !secret.Shared || secret.UserDefined || secret.Source != nil || secret.DerivedFrom != "" {
+			return fmt.Errorf("secret %s is not a shared generated secret and can not be rotated", secretName)
+		}
+		secretsToRotate[secretName] = secret
+	}
+
+	// certificates issued by rotated CAs are issued again
+	reissued, err := c.reissueCertificates(ctx, secretsToRotate, nil)
+	if err != nil {
+		c.zaplogger.Error("Could not rotate the requested secrets.", zap.Error(err))
+		return err
+	}
+
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	txdata := storeWrapper{tx}
+
+	c.updateLogger.Reset()
+	for secretName := range secretsToRotate {
+		secret, ok := reissued.shared[secretName]
+		if !ok {
+			continue
+		}
+		if err := txdata.putSecret(secretName, secret); err != nil {
+			return err
+		}
+		if err := txdata.appendSecretHistory(secretName, secret, updater.Name()); err != nil {
+			return err
+		}
+		c.updateLogger.Info("secret rotated", zap.String("user", updater.Name()), zap.String("secret", secretName), zap.String("type", secret.Type))
+	}
+	if err := reissued.put(txdata, c.updateLogger, secretsToRotate); err != nil {
+		return err
+	}
+	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
+		return err
+	}
+
+	c.zaplogger.Info("Shared secrets were rotated. Please restart your Marbles to use the new secrets.")
+	return tx.Commit()
+}
+
+// GetSecretHistory returns the metadata of all stored versions of a secret
+func (c *Core) GetSecretHistory(ctx context.Context, secretName string, client *user.User) ([]manifest.SecretVersion, error) {
+	defer c.mux.Unlock()
+
+	// we can only return secrets if a manifest has already been set
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, err
+	}
+
+	// verify user is allowed to read the requested secret
+	if !client.IsGranted(user.NewPermission(user.PermissionReadSecret, []string{secretName})) {
+		return nil, fmt.Errorf("user %s is not allowed to read secret: %s", client.Name(), secretName)
+	}
+
+	history, err := c.data.getSecretHistory(secretName)
+	if store.IsStoreValueUnsetError(err) {
+		return []manifest.SecretVersion{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// only return metadata, the values are retrieved with GetSecrets
+	for idx := range history {
+		history[idx].Secret = nil
+	}
+	return history, nil
+}
+
+// RollbackSecret allows a user to restore a previous version of a secret
+//
+// If version is 0, the secret is restored to the last value before the current version, skipping deletions.
+// The restored value is added to the history as a new version.
+func (c *Core) RollbackSecret(ctx context.Context, secretName string, version uint, updater *user.User) error {
+	defer c.mux.Unlock()
+
+	// Only accept requests if we already have a manifest
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return err
+	}
+
+	current, err := c.data.getSecret(secretName)
+	if err != nil {
+		return err
+	}
+
+	// restoring a user-defined secret is equal to writing it, restoring a generated one is equal to rotating it
+	permission := user.PermissionRotateSecret
+	if current.UserDefined {
+		permission = user.PermissionWriteSecret
+	}
+	if !updater.IsGranted(user.NewPermission(permission, []string{secretName})) {
+		return fmt.Errorf("user %s is not allowed to roll back secret: %s", updater.Name(), secretName)
+	}
+
+	history, err := c.data.getSecretHistory(secretName)
+	if err != nil && !store.IsStoreValueUnsetError(err) {
+		return err
+	}
+
+	var restored *manifest.SecretVersion
+	if version == 0 {
+		// skip the current version, deleted versions have no value to restore
+		for idx := len(history) - 2; idx >= 0; idx-- {
+			if !history[idx].Deleted {
+				restored = &history[idx]
+				break
+			}
+		}
+		if restored == nil {
+			return fmt.Errorf("secret %s has no previous version", secretName)
+		}
+	} else {
+		for idx := range history {
+			if history[idx].Version == version {
+				restored = &history[idx]
+				break
+			}
+		}
+		if restored == nil {
+			return fmt.Errorf("version %d of secret %s does not exist", version, secretName)
+		}
+		if restored.Deleted {
+			return fmt.Errorf("version %d of secret %s is a deletion and has no value to restore", version, secretName)
+		}
+	}
+
+	// certificates issued by the restored secret are issued again, so they chain up to it
+	reissued, err := c.reissueCertificates(ctx, nil, map[string]manifest.Secret{secretName: *restored.Secret})
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	txdata := storeWrapper{tx}
+
+	if err := txdata.putSecret(secretName, *restored.Secret); err != nil {
+		return err
+	}
+	if err := txdata.appendSecretHistory(secretName, *restored.Secret, updater.Name()); err != nil {
+		return err
+	}
+
+	c.updateLogger.Reset()
+	c.updateLogger.Info("secret rolled back", zap.String("user", updater.Name()), zap.String("secret", secretName), zap.Uint("version", restored.Version))
+	if err := reissued.put(txdata, c.updateLogger, nil); err != nil {
+		return err
+	}
+	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (c *Core) performRecovery(encryptionKey []byte, clientCerts []*x509.Certificate) error {
+	// load state, the recovered key is only kept if the client is allowed to recover it
 	store := store.NewStdStore(c.sealer)
-	recoveryData, err := store.LoadState()
+	recoveryData, err := store.LoadStateWithKey(encryptionKey)
 	if err != nil {
 		return err
 	}
+	if err := authorizeRecovery(storeWrapper{store}, clientCerts); err != nil {
+		return err
+	}
+	if err := c.sealer.SetEncryptionKey(encryptionKey); err != nil {
+		return err
+	}
 	c.store = store
 	c.data = storeWrapper{store}
 	if err := c.recovery.SetRecoveryData(recoveryData); err != nil {
@@ -511,3 +1174,66 @@ func (c *Core) performRecovery(encryptionKey []byte) error {
 
 	return nil
 }
+
+// authorizeRecovery checks if one of the client certificates belongs to a user of the recovered state with the Recover permission.
+// If the manifest of the recovered state has no Recovery role, everyone holding the recovery secret may recover the state.
+func authorizeRecovery(data storeWrapper, clientCerts []*x509.Certificate) error {
+	mnf, err := data.getManifest()
+	if err != nil {
+		return err
+	}
+	var restricted bool
+	for _, role := range mnf.Roles {
+		if role.ResourceType == "Recovery" {
+			restricted = true
+		}
+	}
+	if !restricted {
+		return nil
+	}
+
+	userIter, err := data.getIterator(requestUser)
+	if err != nil {
+		return err
+	}
+	for userIter.HasNext() {
+		name, err := userIter.GetNext()
+		if err != nil {
+			return err
+		}
+		recoveryUser, err := data.getUser(name)
+		if err != nil {
+			return err
+		}
+		if !recoveryUser.IsGranted(user.NewPermission(user.PermissionRecover, nil)) {
+			continue
+		}
+		for _, cert := range clientCerts {
+			if cert.Equal(recoveryUser.Certificate()) {
+				return nil
+			}
+		}
+	}
+	return errors.New("recovering the state requires a user with the Recover permission")
+}
+
+// splitMarbleTypeSecretName splits a requested secret of the form <marbleType>/<secretName> into its parts.
+// The marble type is empty if the request does not refer to the value of a per-marble-type secret.
+func splitMarbleTypeSecretName(requestedSecret string) (string, string) {
+	sep := strings.LastIndex(requestedSecret, "/")
+	if sep < 0 {
+		return "", requestedSecret
+	}
+	return requestedSecret[:sep], requestedSecret[sep+1:]
+}
+
+// mergeSecretMaps returns a new map containing the secrets of all given maps. Later maps take precedence.
+func mergeSecretMaps(secretMaps ...map[string]manifest.Secret) map[string]manifest.Secret {
+	merged := make(map[string]manifest.Secret)
+	for _, secrets := range secretMaps {
+		for name, secret := range secrets {
+			merged[name] = secret
+		}
+	}
+	return merged
+}
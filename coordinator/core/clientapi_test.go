@@ -8,11 +8,17 @@ package core
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/edgelesssys/marblerun/coordinator/manifest"
 	"github.com/edgelesssys/marblerun/coordinator/quote"
@@ -21,8 +27,28 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
 )
 
+// mustAddAdminRoles adds the given roles to a JSON manifest and assigns them to the admin user.
+func mustAddAdminRoles(rawManifest string, roles map[string]manifest.Role) []byte {
+	var mnf manifest.Manifest
+	if err := json.Unmarshal([]byte(rawManifest), &mnf); err != nil {
+		panic(err)
+	}
+	admin := mnf.Users["admin"]
+	for name, role := range roles {
+		mnf.Roles[name] = role
+		admin.Roles = append(admin.Roles, name)
+	}
+	mnf.Users["admin"] = admin
+	modRawManifest, err := json.Marshal(mnf)
+	if err != nil {
+		panic(err)
+	}
+	return modRawManifest
+}
+
 func mustSetup() (*Core, *manifest.Manifest) {
 	var manifest manifest.Manifest
 	if err := json.Unmarshal([]byte(test.ManifestJSON), &manifest); err != nil {
@@ -31,6 +57,32 @@ func mustSetup() (*Core, *manifest.Manifest) {
 	return NewCoreWithMocks(), &manifest
 }
 
+// mustAddSecrets adds the given JSON secret definitions to a JSON manifest.
+// The manifest.Certificate type only marshals raw certificates, so templates can not be set on a parsed manifest.
+func mustAddSecrets(rawManifest string, secrets map[string]string) []byte {
+	var mnf map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(rawManifest), &mnf); err != nil {
+		panic(err)
+	}
+	var mnfSecrets map[string]json.RawMessage
+	if err := json.Unmarshal(mnf["Secrets"], &mnfSecrets); err != nil {
+		panic(err)
+	}
+	for name, secret := range secrets {
+		mnfSecrets[name] = json.RawMessage(secret)
+	}
+	rawSecrets, err := json.Marshal(mnfSecrets)
+	if err != nil {
+		panic(err)
+	}
+	mnf["Secrets"] = rawSecrets
+	modRawManifest, err := json.Marshal(mnf)
+	if err != nil {
+		panic(err)
+	}
+	return modRawManifest
+}
+
 func TestGetManifestSignature(t *testing.T) {
 	assert := assert.New(t)
 
@@ -40,10 +92,44 @@ func TestGetManifestSignature(t *testing.T) {
 
 	assert.NoError(err)
 
-	sig, manifest := c.GetManifestSignature(context.TODO())
-	expectedHash := sha256.Sum256([]byte(test.ManifestJSON))
+	sig, rawManifest := c.GetManifestSignature(context.TODO())
+	expectedManifest, err := manifest.Canonicalize([]byte(test.ManifestJSON))
+	require.NoError(t, err)
+	expectedHash := sha256.Sum256(expectedManifest)
 	assert.Equal(expectedHash[:], sig)
-	assert.Equal([]byte(test.ManifestJSON), manifest)
+	assert.Equal(expectedManifest, rawManifest)
+	assert.JSONEq(test.ManifestJSON, string(rawManifest))
+}
+
+func TestSetManifestYAML(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c, _ := mustSetup()
+	yamlManifest, err := yaml.JSONToYAML([]byte(test.ManifestJSON))
+	require.NoError(err)
+	_, err = c.SetManifest(context.TODO(), yamlManifest)
+	require.NoError(err)
+
+	// the signature is the same as for the JSON manifest
+	expectedHash, err := manifest.Signature([]byte(test.ManifestJSON))
+	require.NoError(err)
+	sig, rawManifest := c.GetManifestSignature(context.TODO())
+	assert.Equal(expectedHash, sig)
+	assert.JSONEq(test.ManifestJSON, string(rawManifest))
+
+	// update manifests can be YAML, too
+	c, _ = mustSetup()
+	_, err = c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+	yamlUpdate, err := yaml.JSONToYAML([]byte(test.UpdateManifest))
+	require.NoError(err)
+	require.NoError(c.UpdateManifest(context.TODO(), yamlUpdate, admin))
+	pkg, err := c.data.getPackage("frontend")
+	require.NoError(err)
+	assert.EqualValues(5, *pkg.SecurityVersion)
 }
 
 func TestSetManifest(t *testing.T) {
@@ -169,6 +255,197 @@ func TestSetManifestInvalid(t *testing.T) {
 
 	// Enable debug mode, should work now
 	_ = testManifestInvalidDebugCase(c, manifest, backendPackage, assert, require)
+
+	// Per-marble-type secrets can not be shared at the same time
+	c, manifest = mustSetup()
+	marbleTypeSecret := manifest.Secrets["symmetric_key_marble_type"]
+	marbleTypeSecret.Shared = true
+	manifest.Secrets["symmetric_key_marble_type"] = marbleTypeSecret
+	modRawManifest, err = json.Marshal(manifest)
+	require.NoError(err)
+	_, err = c.SetManifest(context.TODO(), modRawManifest)
+	assert.Equal("secret symmetric_key_marble_type is defined per marble type and can not be shared or user-defined", err.Error())
+
+	// Marbles may only reference the secrets they are allowed to access
+	c, manifest = mustSetup()
+	backendOther := manifest.Marbles["backend_other"]
+	backendOther.Secrets = []string{"cert_shared", "cert_private", "undefined_secret"}
+	manifest.Marbles["backend_other"] = backendOther
+	modRawManifest, err = json.Marshal(manifest)
+	require.NoError(err)
+	_, err = c.SetManifest(context.TODO(), modRawManifest)
+	assert.Equal("marble backend_other references undefined secret undefined_secret", err.Error())
+
+	backendOther.Secrets = []string{"cert_shared", "cert_private"}
+	manifest.Marbles["backend_other"] = backendOther
+	modRawManifest, err = json.Marshal(manifest)
+	require.NoError(err)
+	_, err = c.SetManifest(context.TODO(), modRawManifest)
+	assert.Equal("marble backend_other references secret symmetric_key_marble_type, which is not in its list of secrets", err.Error())
+
+	backendOther.Secrets = []string{"cert_private", "symmetric_key_marble_type"}
+	manifest.Marbles["backend_other"] = backendOther
+	modRawManifest, err = json.Marshal(manifest)
+	require.NoError(err)
+	_, err = c.SetManifest(context.TODO(), modRawManifest)
+	assert.Error(err)
+}
+
+func TestSetManifestKeySecrets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Bare key pairs can not be uploaded by users
+	c, mnf := mustSetup()
+	mnf.Secrets["user_key"] = manifest.Secret{Type: "key-ed25519", UserDefined: true}
+	modRawManifest, err := json.Marshal(mnf)
+	require.NoError(err)
+	_, err = c.SetManifest(context.TODO(), modRawManifest)
+	assert.Equal("secret user_key of type key-ed25519 can not be user-defined", err.Error())
+
+	// JWT HMAC keys only support the sizes of HS256, HS384 and HS512
+	c, mnf = mustSetup()
+	mnf.Secrets["jwt_key"] = manifest.Secret{Type: "jwt-hmac", Size: 128, Shared: true}
+	modRawManifest, err = json.Marshal(mnf)
+	require.NoError(err)
+	_, err = c.SetManifest(context.TODO(), modRawManifest)
+	assert.Equal("invalid size 128 for secret: jwt_key, only 256, 384 and 512 are supported", err.Error())
+
+	// SSH certificates must be signed by a shared Ed25519 or ECDSA SSH key
+	c, mnf = mustSetup()
+	mnf.Secrets["ssh_ca"] = manifest.Secret{Type: "ssh-rsa", Size: 2048, Shared: true}
+	mnf.Secrets["ssh_host"] = manifest.Secret{Type: "ssh-ed25519", SSHCertificate: &manifest.SSHCertificate{Issuer: "ssh_ca", Principals: []string{"localhost"}}}
+	modRawManifest, err = json.Marshal(mnf)
+	require.NoError(err)
+	_, err = c.SetManifest(context.TODO(), modRawManifest)
+	assert.Equal("issuer ssh_ca of SSH certificate for secret ssh_host must be of type ssh-ed25519 or ssh-ecdsa", err.Error())
+
+	// Private SSH host keys can be signed by a shared CA
+	c, mnf = mustSetup()
+	mnf.Secrets["ssh_ca"] = manifest.Secret{Type: "ssh-ed25519", Shared: true}
+	mnf.Secrets["ssh_host"] = manifest.Secret{Type: "ssh-ed25519", SSHCertificate: &manifest.SSHCertificate{Issuer: "ssh_ca", Principals: []string{"localhost"}}}
+	modRawManifest, err = json.Marshal(mnf)
+	require.NoError(err)
+	_, err = c.SetManifest(context.TODO(), modRawManifest)
+	assert.NoError(err)
+}
+
+func TestSetManifestIssuer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The issuer of a certificate must be a CA
+	c, _ := mustSetup()
+	_, err := c.SetManifest(context.TODO(), mustAddSecrets(test.ManifestJSON, map[string]string{
+		"ca":   `{"Type": "cert-ecdsa", "Size": 256, "Shared": true}`,
+		"leaf": `{"Type": "cert-ecdsa", "Size": 256, "Issuer": "ca"}`,
+	}))
+	assert.Equal("issuer ca of secret leaf is not a CA", err.Error())
+
+	// The issuer must be defined
+	c, _ = mustSetup()
+	_, err = c.SetManifest(context.TODO(), mustAddSecrets(test.ManifestJSON, map[string]string{
+		"leaf": `{"Type": "cert-ecdsa", "Size": 256, "Issuer": "ca"}`,
+	}))
+	assert.Equal("secret leaf references undefined issuer ca", err.Error())
+
+	// Issuer chains must not contain cycles
+	c, _ = mustSetup()
+	_, err = c.SetManifest(context.TODO(), mustAddSecrets(test.ManifestJSON, map[string]string{
+		"ca_a": `{"Type": "cert-ecdsa", "Size": 256, "Shared": true, "Issuer": "ca_b", "Cert": {"IsCA": true}}`,
+		"ca_b": `{"Type": "cert-ecdsa", "Size": 256, "Shared": true, "Issuer": "ca_a", "Cert": {"IsCA": true}}`,
+	}))
+	assert.Error(err)
+
+	// The path length constraint of a CA is enforced
+	c, _ = mustSetup()
+	_, err = c.SetManifest(context.TODO(), mustAddSecrets(test.ManifestJSON, map[string]string{
+		"ca":           `{"Type": "cert-ecdsa", "Size": 256, "Shared": true, "Cert": {"IsCA": true, "MaxPathLenZero": true}}`,
+		"intermediate": `{"Type": "cert-ecdsa", "Size": 256, "Shared": true, "Issuer": "ca", "Cert": {"IsCA": true}}`,
+		"leaf":         `{"Type": "cert-ecdsa", "Size": 256, "Issuer": "intermediate"}`,
+	}))
+	assert.Equal("issuer chain of secret leaf exceeds the path length constraint of ca", err.Error())
+
+	// A chain within the path length constraint is accepted
+	c, _ = mustSetup()
+	_, err = c.SetManifest(context.TODO(), mustAddSecrets(test.ManifestJSON, map[string]string{
+		"ca":           `{"Type": "cert-ecdsa", "Size": 256, "Shared": true, "Cert": {"IsCA": true, "MaxPathLen": 1}}`,
+		"intermediate": `{"Type": "cert-ecdsa", "Size": 256, "Shared": true, "Issuer": "ca", "Cert": {"IsCA": true}}`,
+		"leaf":         `{"Type": "cert-ecdsa", "Size": 256, "Issuer": "intermediate"}`,
+	}))
+	assert.NoError(err)
+
+	// Shared certificates issued by a user-defined CA are generated once the CA is uploaded
+	c, _ = mustSetup()
+	_, err = c.SetManifest(context.TODO(), mustAddSecrets(test.ManifestJSONWithRecoveryKey, map[string]string{
+		"cert_issued":      `{"Type": "cert-ecdsa", "Size": 256, "Shared": true, "Issuer": "cert_unset"}`,
+		"cert_type_issued": `{"Type": "cert-ecdsa", "Size": 256, "PerMarbleType": true, "Issuer": "cert_unset"}`,
+	}))
+	require.NoError(err)
+	issued, err := c.data.getSecret("cert_issued")
+	require.NoError(err)
+	assert.Empty(issued.Cert.Raw)
+	_, err = c.data.getMarbleTypeSecret("frontend", "cert_type_issued")
+	assert.Error(err)
+
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+
+	// the test certificate is not a CA
+	assert.Error(c.WriteSecrets(context.TODO(), []byte(test.UserSecrets), admin))
+
+	caPub, caPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "User CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caCertRaw, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caPub, caPriv)
+	require.NoError(err)
+	caPrivRaw, err := x509.MarshalPKCS8PrivateKey(caPriv)
+	require.NoError(err)
+
+	// the private key must belong to the certificate
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(err)
+	otherPrivRaw, err := x509.MarshalPKCS8PrivateKey(otherPriv)
+	require.NoError(err)
+	assert.Error(c.WriteSecrets(context.TODO(), []byte(`{
+		"cert_unset": {
+			"Cert": "`+base64.StdEncoding.EncodeToString(caCertRaw)+`",
+			"Private": "`+base64.StdEncoding.EncodeToString(otherPrivRaw)+`"
+		}
+	}`), admin))
+
+	userSecrets := []byte(`{
+		"cert_unset": {
+			"Cert": "` + base64.StdEncoding.EncodeToString(caCertRaw) + `",
+			"Private": "` + base64.StdEncoding.EncodeToString(caPrivRaw) + `"
+		}
+	}`)
+	require.NoError(c.WriteSecrets(context.TODO(), userSecrets, admin))
+
+	issued, err = c.data.getSecret("cert_issued")
+	require.NoError(err)
+	caCert, err := x509.ParseCertificate(caCertRaw)
+	require.NoError(err)
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	issuedCert := x509.Certificate(issued.Cert)
+	_, err = issuedCert.Verify(x509.VerifyOptions{Roots: roots})
+	assert.NoError(err)
+
+	// per-marble-type certificates are generated on upload as well
+	typeIssued, err := c.data.getMarbleTypeSecret("frontend", "cert_type_issued")
+	require.NoError(err)
+	typeIssuedCert := x509.Certificate(typeIssued.Cert)
+	_, err = typeIssuedCert.Verify(x509.VerifyOptions{Roots: roots})
+	assert.NoError(err)
 }
 
 func TestGetCertQuote(t *testing.T) {
@@ -235,6 +512,172 @@ func TestVerifyUser(t *testing.T) {
 	assert.Error(err)
 }
 
+func TestGetActivations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	c, _ := mustSetup()
+
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+
+	activations, err := c.GetActivations(context.TODO(), admin)
+	require.NoError(err)
+	assert.Equal(map[string]uint{"frontend": 0}, activations)
+
+	require.NoError(c.data.incrementActivations("frontend"))
+	activations, err = c.GetActivations(context.TODO(), admin)
+	require.NoError(err)
+	assert.EqualValues(1, activations["frontend"])
+
+	// users without the ReadActivations permission must not see the inventory
+	someUser := user.NewUser("invalid", nil)
+	_, err = c.GetActivations(context.TODO(), someUser)
+	assert.Error(err)
+}
+
+func TestAuthorizeRead(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// without Manifest or UpdateLog roles, everyone may read
+	c, _ := mustSetup()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	assert.NoError(c.AuthorizeRead(context.TODO(), nil, user.PermissionReadManifest))
+	assert.NoError(c.AuthorizeRead(context.TODO(), nil, user.PermissionReadUpdateLog))
+
+	// a Manifest role restricts reading the manifest, but not the update log
+	c, _ = mustSetup()
+	_, err = c.SetManifest(context.TODO(), mustAddAdminRoles(test.ManifestJSONWithRecoveryKey, map[string]manifest.Role{
+		"manifest_reader": {ResourceType: "Manifest", Actions: []string{"ReadManifest"}},
+	}))
+	require.NoError(err)
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+
+	assert.Error(c.AuthorizeRead(context.TODO(), nil, user.PermissionReadManifest))
+	assert.Error(c.AuthorizeRead(context.TODO(), user.NewUser("invalid", nil), user.PermissionReadManifest))
+	assert.NoError(c.AuthorizeRead(context.TODO(), admin, user.PermissionReadManifest))
+	assert.NoError(c.AuthorizeRead(context.TODO(), nil, user.PermissionReadUpdateLog))
+	assert.Error(c.AuthorizeRead(context.TODO(), admin, user.PermissionReadSecret))
+}
+
+func TestSetUserCertificate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c, _ := mustSetup()
+	_, err := c.SetManifest(context.TODO(), mustAddAdminRoles(test.ManifestJSONWithRecoveryKey, map[string]manifest.Role{
+		"user_manager": {ResourceType: "Users", ResourceNames: []string{"admin"}, Actions: []string{"ManageUsers"}},
+	}))
+	require.NoError(err)
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+
+	adminTestCert, otherTestCert := test.MustSetupTestCerts(test.RecoveryPrivateKey)
+	otherTestCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherTestCert.Raw})
+
+	// users without the ManageUsers permission must not replace certificates
+	assert.Error(c.SetUserCertificate(context.TODO(), "admin", otherTestCertPEM, user.NewUser("invalid", nil)))
+	assert.Error(c.SetUserCertificate(context.TODO(), "admin", []byte("invalid"), admin))
+	assert.Error(c.SetUserCertificate(context.TODO(), "unknown", otherTestCertPEM, admin))
+
+	require.NoError(c.SetUserCertificate(context.TODO(), "admin", otherTestCertPEM, admin))
+
+	// the user authenticates with the new certificate and keeps its permissions
+	_, err = c.VerifyUser(context.TODO(), []*x509.Certificate{adminTestCert})
+	assert.Error(err)
+	newAdmin, err := c.VerifyUser(context.TODO(), []*x509.Certificate{otherTestCert})
+	require.NoError(err)
+	assert.Equal("admin", newAdmin.Name())
+	assert.Equal(admin.Permissions(), newAdmin.Permissions())
+}
+
+func TestSetManifestRoles(t *testing.T) {
+	testCases := map[string]struct {
+		role    manifest.Role
+		wantErr bool
+	}{
+		"read manifest": {
+			role: manifest.Role{ResourceType: "Manifest", Actions: []string{"ReadManifest"}},
+		},
+		"read update log": {
+			role: manifest.Role{ResourceType: "UpdateLog", Actions: []string{"readupdatelog"}},
+		},
+		"recovery": {
+			role: manifest.Role{ResourceType: "Recovery", Actions: []string{"Recover"}},
+		},
+		"recovery with resource names": {
+			role:    manifest.Role{ResourceType: "Recovery", ResourceNames: []string{"admin"}, Actions: []string{"Recover"}},
+			wantErr: true,
+		},
+		"read activations": {
+			role: manifest.Role{ResourceType: "Activations", ResourceNames: []string{"frontend"}, Actions: []string{"ReadActivations"}},
+		},
+		"revoke marbles": {
+			role: manifest.Role{ResourceType: "Marbles", ResourceNames: []string{"frontend"}, Actions: []string{"RevokeMarble"}},
+		},
+		"manage users": {
+			role: manifest.Role{ResourceType: "Users", ResourceNames: []string{"admin"}, Actions: []string{"ManageUsers"}},
+		},
+		"manifest with resource names": {
+			role:    manifest.Role{ResourceType: "Manifest", ResourceNames: []string{"frontend"}, Actions: []string{"ReadManifest"}},
+			wantErr: true,
+		},
+		"activations of unknown marble": {
+			role:    manifest.Role{ResourceType: "Activations", ResourceNames: []string{"unknown"}, Actions: []string{"ReadActivations"}},
+			wantErr: true,
+		},
+		"unknown user": {
+			role:    manifest.Role{ResourceType: "Users", ResourceNames: []string{"unknown"}, Actions: []string{"ManageUsers"}},
+			wantErr: true,
+		},
+		"wrong action": {
+			role:    manifest.Role{ResourceType: "Marbles", ResourceNames: []string{"frontend"}, Actions: []string{"ReadActivations"}},
+			wantErr: true,
+		},
+		"delete generated secret": {
+			role:    manifest.Role{ResourceType: "Secrets", ResourceNames: []string{"symmetric_key_shared"}, Actions: []string{"DeleteSecret"}},
+			wantErr: true,
+		},
+		"rotate user-defined secret": {
+			role:    manifest.Role{ResourceType: "Secrets", ResourceNames: []string{"cert_unset"}, Actions: []string{"RotateSecret"}},
+			wantErr: true,
+		},
+		"rotate private secret": {
+			role:    manifest.Role{ResourceType: "Secrets", ResourceNames: []string{"cert_private"}, Actions: []string{"RotateSecret"}},
+			wantErr: true,
+		},
+		"unknown resource type": {
+			role:    manifest.Role{ResourceType: "Coordinator", Actions: []string{"ReadManifest"}},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			c, _ := mustSetup()
+			var mnf manifest.Manifest
+			require.NoError(json.Unmarshal([]byte(test.ManifestJSONWithRecoveryKey), &mnf))
+			mnf.Roles["test_role"] = tc.role
+
+			rawManifest, err := json.Marshal(mnf)
+			require.NoError(err)
+			_, err = c.SetManifest(context.TODO(), rawManifest)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+		})
+	}
+}
+
 func TestUpdateManifest(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -256,6 +699,8 @@ func TestUpdateManifest(t *testing.T) {
 	assert.NoError(err)
 	secretsBeforeUpdate, err := c.data.getSecretMap()
 	assert.NoError(err)
+	marbleTypeSecretBeforeUpdate, err := c.data.getMarbleTypeSecret("frontend", "cert_marble_type")
+	assert.NoError(err)
 
 	// Update manifest
 	err = c.UpdateManifest(context.TODO(), []byte(test.UpdateManifest), admin)
@@ -270,6 +715,8 @@ func TestUpdateManifest(t *testing.T) {
 	assert.NoError(err)
 	secretsAfterUpdate, err := c.data.getSecretMap()
 	assert.NoError(err)
+	marbleTypeSecretAfterUpdate, err := c.data.getMarbleTypeSecret("frontend", "cert_marble_type")
+	assert.NoError(err)
 
 	// Check if root certificate stayed the same, but intermediate CAs changed
 	assert.Equal(rootCABeforeUpdate, rootCAAfterUpdate)
@@ -279,6 +726,7 @@ func TestUpdateManifest(t *testing.T) {
 	// Secrets: symmetric keys should remain the same, certificates should be regenerated based on the new intermediate ca
 	assert.Equal(secretsBeforeUpdate["symmetric_key_shared"], secretsAfterUpdate["symmetric_key_shared"])
 	assert.NotEqual(secretsBeforeUpdate["cert_shared"], secretsAfterUpdate["cert_shared"])
+	assert.NotEqual(marbleTypeSecretBeforeUpdate, marbleTypeSecretAfterUpdate)
 
 	// Verify if the old secret certificate is not correctly verified anymore by the new intermediate certificate
 	roots := x509.NewCertPool()
@@ -444,6 +892,17 @@ func TestGetSecret(t *testing.T) {
 	assert.NoError(err)
 	assert.Empty(sec["symmetric_key_unset"].Public)
 	assert.Empty(sec["symmetric_key_unset"].Private)
+
+	// per-marble-type secrets are requested for a specific marble type
+	marbleTypeSecret, err := c.data.getMarbleTypeSecret("frontend", "cert_marble_type")
+	require.NoError(err)
+	sec, err = c.GetSecrets(context.TODO(), []string{"frontend/cert_marble_type"}, admin)
+	assert.NoError(err)
+	assert.Equal(marbleTypeSecret, sec["frontend/cert_marble_type"])
+	_, err = c.GetSecrets(context.TODO(), []string{"cert_marble_type"}, admin)
+	assert.Error(err)
+	_, err = c.GetSecrets(context.TODO(), []string{"backend/cert_marble_type"}, admin)
+	assert.Error(err)
 }
 
 func TestWriteSecret(t *testing.T) {
@@ -516,6 +975,222 @@ func TestWriteSecret(t *testing.T) {
 	assert.Equal("Marblerun Unit Test Private", priv["cert_private"].Cert.Subject.CommonName)
 }
 
+func TestDeleteSecret(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	c, _ := mustSetup()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+	require.NoError(c.WriteSecrets(context.TODO(), []byte(test.UserSecrets), admin))
+	secret, err := c.data.getSecret("symmetric_key_unset")
+	require.NoError(err)
+	require.NotEmpty(secret.Private)
+
+	// reset the secret, only the metadata from the manifest should remain
+	require.NoError(c.DeleteSecrets(context.TODO(), []string{"symmetric_key_unset"}, admin))
+	secret, err = c.data.getSecret("symmetric_key_unset")
+	require.NoError(err)
+	assert.Empty(secret.Private)
+	assert.Empty(secret.Public)
+	assert.Equal("symmetric-key", secret.Type)
+	assert.EqualValues(128, secret.Size)
+
+	// the other secret set by the user should be unaffected
+	secret, err = c.data.getSecret("cert_unset")
+	require.NoError(err)
+	assert.NotEmpty(secret.Private)
+
+	// secrets which are not user-defined can not be deleted
+	assert.Error(c.DeleteSecrets(context.TODO(), []string{"symmetric_key_shared"}, admin))
+
+	updateLog, err := c.GetUpdateLog(context.TODO())
+	require.NoError(err)
+	assert.Contains(updateLog, `"update":"secret deleted"`)
+}
+
+func TestRotateSecret(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	c, _ := mustSetup()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+	secretsBefore, err := c.data.getSecretMap()
+	require.NoError(err)
+
+	require.NoError(c.RotateSecrets(context.TODO(), []string{"symmetric_key_shared", "cert_shared"}, admin))
+	secretsAfter, err := c.data.getSecretMap()
+	require.NoError(err)
+
+	assert.NotEqual(secretsBefore["symmetric_key_shared"].Private, secretsAfter["symmetric_key_shared"].Private)
+	assert.Len(secretsAfter["symmetric_key_shared"].Private, 16)
+	assert.NotEqual(secretsBefore["cert_shared"].Cert.Raw, secretsAfter["cert_shared"].Cert.Raw)
+	assert.Equal("Marblerun Unit Test Shared", secretsAfter["cert_shared"].Cert.Subject.CommonName)
+	// secrets which were not requested stay the same
+	assert.Equal(secretsBefore["restricted_secret"], secretsAfter["restricted_secret"])
+
+	// the user lacks permission to rotate this secret
+	assert.Error(c.RotateSecrets(context.TODO(), []string{"restricted_secret"}, admin))
+
+	updateLog, err := c.GetUpdateLog(context.TODO())
+	require.NoError(err)
+	assert.Contains(updateLog, `"secret":"cert_shared"`)
+}
+
+func TestRotateSecretReissuesCertificates(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c, _ := mustSetup()
+	// roles are added first, since certificate templates do not survive unmarshaling the manifest
+	rawManifest := mustAddAdminRoles(test.ManifestJSONWithRecoveryKey, map[string]manifest.Role{
+		"ca_rotator": {ResourceType: "Secrets", ResourceNames: []string{"ca"}, Actions: []string{"RotateSecret"}},
+	})
+	_, err := c.SetManifest(context.TODO(), mustAddSecrets(string(rawManifest), map[string]string{
+		"ca":        `{"Type": "cert-ecdsa", "Size": 256, "Shared": true, "Cert": {"IsCA": true}}`,
+		"leaf":      `{"Type": "cert-ecdsa", "Size": 256, "Shared": true, "Issuer": "ca"}`,
+		"type_leaf": `{"Type": "cert-ecdsa", "Size": 256, "PerMarbleType": true, "Issuer": "ca"}`,
+	}))
+	require.NoError(err)
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+	previousLeaf, err := c.data.getSecret("leaf")
+	require.NoError(err)
+
+	require.NoError(c.RotateSecrets(context.TODO(), []string{"ca"}, admin))
+
+	// the certificates issued by the CA are issued by the rotated CA
+	ca, err := c.data.getSecret("ca")
+	require.NoError(err)
+	roots := x509.NewCertPool()
+	caCert := x509.Certificate(ca.Cert)
+	roots.AddCert(&caCert)
+
+	leaf, err := c.data.getSecret("leaf")
+	require.NoError(err)
+	assert.NotEqual(previousLeaf.Cert.Raw, leaf.Cert.Raw)
+	leafCert := x509.Certificate(leaf.Cert)
+	_, err = leafCert.Verify(x509.VerifyOptions{Roots: roots})
+	assert.NoError(err)
+
+	typeLeaf, err := c.data.getMarbleTypeSecret("frontend", "type_leaf")
+	require.NoError(err)
+	typeLeafCert := x509.Certificate(typeLeaf.Cert)
+	_, err = typeLeafCert.Verify(x509.VerifyOptions{Roots: roots})
+	assert.NoError(err)
+
+	// rolling back the CA issues its certificates again, so they chain up to the restored CA
+	require.NoError(c.RollbackSecret(context.TODO(), "ca", 1, admin))
+	restoredCA, err := c.data.getSecret("ca")
+	require.NoError(err)
+	assert.NotEqual(ca.Cert.Raw, restoredCA.Cert.Raw)
+	roots = x509.NewCertPool()
+	restoredCACert := x509.Certificate(restoredCA.Cert)
+	roots.AddCert(&restoredCACert)
+
+	leaf, err = c.data.getSecret("leaf")
+	require.NoError(err)
+	leafCert = x509.Certificate(leaf.Cert)
+	_, err = leafCert.Verify(x509.VerifyOptions{Roots: roots})
+	assert.NoError(err)
+
+	typeLeaf, err = c.data.getMarbleTypeSecret("frontend", "type_leaf")
+	require.NoError(err)
+	typeLeafCert = x509.Certificate(typeLeaf.Cert)
+	_, err = typeLeafCert.Verify(x509.VerifyOptions{Roots: roots})
+	assert.NoError(err)
+}
+
+func TestSecretHistory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	c, _ := mustSetup()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+
+	// shared secrets generated with the manifest start with one version
+	history, err := c.GetSecretHistory(context.TODO(), "cert_shared", admin)
+	require.NoError(err)
+	require.Len(history, 1)
+	assert.EqualValues(1, history[0].Version)
+	assert.Empty(history[0].User)
+	assert.Nil(history[0].Secret, "values must not be returned with the history")
+
+	// set a user-defined secret twice
+	firstValue := []byte(`{"generic_secret": {"Key": "Zmlyc3Q="}}`)
+	secondValue := []byte(`{"generic_secret": {"Key": "c2Vjb25k"}}`)
+	require.NoError(c.WriteSecrets(context.TODO(), firstValue, admin))
+	require.NoError(c.WriteSecrets(context.TODO(), secondValue, admin))
+
+	history, err = c.GetSecretHistory(context.TODO(), "generic_secret", admin)
+	require.NoError(err)
+	require.Len(history, 2)
+	assert.Equal("admin", history[1].User)
+	assert.NotEqual(history[0].Fingerprint, history[1].Fingerprint)
+
+	// roll back to the previous version
+	require.NoError(c.RollbackSecret(context.TODO(), "generic_secret", 0, admin))
+	secret, err := c.data.getSecret("generic_secret")
+	require.NoError(err)
+	assert.Equal("first", string(secret.Public))
+
+	history, err = c.GetSecretHistory(context.TODO(), "generic_secret", admin)
+	require.NoError(err)
+	require.Len(history, 3)
+	assert.EqualValues(3, history[2].Version)
+	assert.Equal(history[0].Fingerprint, history[2].Fingerprint)
+
+	// roll back to a specific version
+	require.NoError(c.RollbackSecret(context.TODO(), "generic_secret", 2, admin))
+	secret, err = c.data.getSecret("generic_secret")
+	require.NoError(err)
+	assert.Equal("second", string(secret.Public))
+	assert.Error(c.RollbackSecret(context.TODO(), "generic_secret", 42, admin))
+
+	// the user is not allowed to rotate the secret and thus may not roll it back
+	assert.Error(c.RollbackSecret(context.TODO(), "restricted_secret", 0, admin))
+
+	// deleting the secret is recorded in the history
+	require.NoError(c.DeleteSecrets(context.TODO(), []string{"generic_secret"}, admin))
+	history, err = c.GetSecretHistory(context.TODO(), "generic_secret", admin)
+	require.NoError(err)
+	require.Len(history, 5)
+	assert.True(history[4].Deleted)
+	assert.Equal("admin", history[4].User)
+	assert.Error(c.RollbackSecret(context.TODO(), "generic_secret", 5, admin))
+
+	// rolling back after the deletion restores the value before it
+	require.NoError(c.RollbackSecret(context.TODO(), "generic_secret", 0, admin))
+	secret, err = c.data.getSecret("generic_secret")
+	require.NoError(err)
+	assert.Equal("second", string(secret.Public))
+	history, err = c.GetSecretHistory(context.TODO(), "generic_secret", admin)
+	require.NoError(err)
+	require.Len(history, 6)
+	assert.False(history[5].Deleted)
+	assert.Equal(history[3].Fingerprint, history[5].Fingerprint)
+
+	// the history is bounded
+	for i := 0; i < maxSecretVersions; i++ {
+		require.NoError(c.WriteSecrets(context.TODO(), firstValue, admin))
+	}
+	history, err = c.GetSecretHistory(context.TODO(), "generic_secret", admin)
+	require.NoError(err)
+	assert.Len(history, maxSecretVersions)
+
+	updateLog, err := c.GetUpdateLog(context.TODO())
+	require.NoError(err)
+	assert.Contains(updateLog, `"update":"secret rolled back"`)
+}
+
 func testManifestInvalidDebugCase(c *Core, manifest *manifest.Manifest, marblePackage quote.PackageProperties, assert *assert.Assertions, require *require.Assertions) *Core {
 	marblePackage.Debug = true
 	manifest.Packages["backend"] = marblePackage
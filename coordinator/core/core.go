@@ -17,11 +17,8 @@ import (
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
 	"errors"
 	"fmt"
-	"math"
 	"strings"
 	"sync"
 	"time"
@@ -37,6 +34,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/curve25519"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/peer"
 )
@@ -49,11 +47,14 @@ type Core struct {
 	store        store.Store
 	data         storeWrapper
 	sealer       seal.Sealer
+	caConfig     CAConfig
 	qv           quote.Validator
 	qi           quote.Issuer
 	updateLogger *updatelog.Logger
 	zaplogger    *zap.Logger
 	metrics      *coreMetrics
+
+	transitLimiter rateLimiter
 }
 
 // The sequence of states a Coordinator may be in
@@ -80,6 +81,7 @@ const (
 	skCoordinatorIntermediateCert string = "coordinatorIntermediateCert"
 	sKMarbleRootCert              string = "marbleRootCert"
 	sKCoordinatorIntermediateKey  string = "coordinatorIntermediateKey"
+	sKSPIFFEJWTKey                string = "spiffeJWTKey"
 )
 
 // Needs to be paired with `defer c.mux.Unlock()`
@@ -110,7 +112,7 @@ func (c *Core) advanceState(newState state, tx store.Transaction) error {
 }
 
 // NewCore creates and initializes a new Core object
-func NewCore(dnsNames []string, qv quote.Validator, qi quote.Issuer, sealer seal.Sealer, recovery recovery.Recovery, zapLogger *zap.Logger, promFactory *promauto.Factory) (*Core, error) {
+func NewCore(dnsNames []string, caConfig CAConfig, qv quote.Validator, qi quote.Issuer, sealer seal.Sealer, recovery recovery.Recovery, zapLogger *zap.Logger, promFactory *promauto.Factory) (*Core, error) {
 	stor := store.NewStdStore(sealer)
 	c := &Core{
 		qv:        qv,
@@ -119,6 +121,7 @@ func NewCore(dnsNames []string, qv quote.Validator, qi quote.Issuer, sealer seal
 		store:     stor,
 		data:      storeWrapper{store: stor},
 		sealer:    sealer,
+		caConfig:  caConfig,
 		zaplogger: zapLogger,
 	}
 	c.metrics = newCoreMetrics(promFactory, c, "coordinator")
@@ -205,7 +208,7 @@ func NewCoreWithMocks() *Core {
 	issuer := quote.NewMockIssuer()
 	sealer := &seal.MockSealer{}
 	recovery := recovery.NewSinglePartyRecovery()
-	core, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, nil)
+	core, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -269,11 +272,22 @@ func (c *Core) GetTLSMarbleRootCertificate(clientHello *tls.ClientHelloInfo) (*t
 	return util.TLSCertFromDER(marbleRootCert.Raw, intermediatePrivK), nil
 }
 
-func generateCert(dnsNames []string, commonName string, privk *ecdsa.PrivateKey, parentCertificate *x509.Certificate, parentPrivateKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+// generateCert creates a CA certificate as configured by caConfig.
+// Without a parent certificate and key, the certificate is self-signed. Without a given key, a new one is generated.
+// The root CA is the only certificate created with neither, all others use the settings of the intermediate CA.
+func generateCert(dnsNames []string, commonName string, caConfig CAConfig, privk crypto.Signer, parentCertificate *x509.Certificate, parentPrivateKey crypto.PrivateKey) (*x509.Certificate, crypto.Signer, error) {
+	isRoot := privk == nil && parentCertificate == nil
+	keyAlgorithm := caConfig.IntermediateKeyAlgorithm
+	validity := caConfig.IntermediateValidity
+	if isRoot {
+		keyAlgorithm = caConfig.RootKeyAlgorithm
+		validity = caConfig.RootValidity
+	}
+
 	// Generate private key
 	var err error
 	if privk == nil {
-		privk, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		privk, err = keyAlgorithm.generateKey()
 		if err != nil {
 			return nil, nil, err
 		}
@@ -281,36 +295,41 @@ func generateCert(dnsNames []string, commonName string, privk *ecdsa.PrivateKey,
 
 	// Certifcate parameter
 	notBefore := time.Now()
-	notAfter := notBefore.Add(math.MaxInt64)
 
 	serialNumber, err := util.GenerateCertificateSerialNumber()
 	if err != nil {
 		return nil, nil, err
 	}
 
+	subject := caConfig.Subject
+	subject.CommonName = commonName
+
 	// TODO: what else do we need to set here?
 	// Do we need x509.KeyUsageKeyEncipherment?
 	template := x509.Certificate{
 		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			CommonName: commonName,
-		},
-		DNSNames:    dnsNames,
-		IPAddresses: util.DefaultCertificateIPAddresses,
-		NotBefore:   notBefore,
-		NotAfter:    notAfter,
+		Subject:      subject,
+		DNSNames:     dnsNames,
+		IPAddresses:  caConfig.ipAddresses(),
+		NotBefore:    notBefore,
+		NotAfter:     notAfter(notBefore, validity),
 
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
 		BasicConstraintsValid: true,
 		IsCA:                  true,
 	}
+	// the name constraints restrict the certificates issued for Marbles and secrets
+	if !isRoot {
+		template.PermittedDNSDomains = caConfig.PermittedDNSDomains
+		template.PermittedIPRanges = caConfig.PermittedIPRanges
+	}
 
 	if parentCertificate == nil {
 		parentCertificate = &template
 		parentPrivateKey = privk
 	}
-	certRaw, err := x509.CreateCertificate(rand.Reader, &template, parentCertificate, &privk.PublicKey, parentPrivateKey)
+	certRaw, err := x509.CreateCertificate(rand.Reader, &template, parentCertificate, privk.Public(), parentPrivateKey)
 
 	if err != nil {
 		return nil, nil, err
@@ -371,131 +390,233 @@ func (c *Core) getStatus(ctx context.Context) (int, string, error) {
 	return int(curState), status, nil
 }
 
-func (c *Core) generateSecrets(ctx context.Context, secrets map[string]manifest.Secret, id uuid.UUID, parentCertificate *x509.Certificate, parentPrivKey *ecdsa.PrivateKey) (map[string]manifest.Secret, error) {
+func (c *Core) generateSecrets(ctx context.Context, secrets map[string]manifest.Secret, id uuid.UUID, parentCertificate *x509.Certificate, parentPrivKey crypto.PrivateKey) (map[string]manifest.Secret, error) {
 	// Create a new map so we do not overwrite the entries in the manifest
 	newSecrets := make(map[string]manifest.Secret)
 
-	rootPrivK, err := c.data.getPrivK(sKCoordinatorRootKey)
+	derivationSecret, err := c.getKeyDerivationSecret()
 	if err != nil {
 		return nil, err
 	}
 
-	// Generate secrets
-	for name, secret := range secrets {
-		// Skip user defined secrets, these will be uploaded by a user
-		if secret.UserDefined {
+	// Generate secrets, issuers before the certificates they sign
+	for _, name := range sortSecretsByIssuer(secrets) {
+		secret := secrets[name]
+
+		// Skip user defined, remote and derived secrets, these will be uploaded by a user, fetched from their provider or derived on activation
+		if secret.UserDefined || secret.Source != nil || secret.DerivedFrom != "" {
 			continue
 		}
 
 		// Skip secrets from wrong context
-		if secret.Shared != (id == uuid.Nil) {
+		if secret.PerMarbleType || secret.Shared != (id == uuid.Nil) {
 			continue
 		}
 
-		c.zaplogger.Info("generating secret", zap.String("name", name), zap.String("type", secret.Type), zap.Uint("size", secret.Size))
-		switch secret.Type {
-		// Raw = Symmetric Key
-		case "symmetric-key":
-			// Check secret size
-			if secret.Size == 0 || secret.Size%8 != 0 {
-				return nil, fmt.Errorf("invalid secret size: %v", name)
+		issuerCertificate, issuerPrivKey, err := c.certificateIssuer(secret, newSecrets, secrets, parentCertificate, parentPrivKey)
+		if err != nil {
+			// shared certificates are generated once their user-defined issuer is uploaded
+			if errors.Is(err, errIssuerNotSet) && secret.Shared {
+				c.zaplogger.Info("Skipping generation of secret, since its issuer is not set yet.", zap.String("name", name), zap.String("issuer", secret.Issuer))
+				continue
 			}
+			return nil, err
+		}
 
-			var generatedValue []byte
-			// If a secret is shared, we generate a completely random key. If a secret is constrained to a marble, we derive a key from the core's private key.
-			if secret.Shared {
-				generatedValue = make([]byte, secret.Size/8)
-				_, err := rand.Read(generatedValue)
-				if err != nil {
-					return nil, err
-				}
-			} else {
-				salt := id.String() + name
-				secretKeyDerive := rootPrivK.D.Bytes()
-				var err error
-				generatedValue, err = util.DeriveKey(secretKeyDerive, []byte(salt), secret.Size/8)
-				if err != nil {
-					return nil, err
-				}
-			}
+		// If a secret is shared, we generate a completely random key. If a secret is constrained to a marble, we derive a key from the core's private key.
+		var salt string
+		if !secret.Shared {
+			salt = id.String() + name
+		}
+		newSecrets[name], err = c.generateSecret(name, secret, salt, derivationSecret, issuerCertificate, issuerPrivKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyIssuedCertificate(name, newSecrets[name], issuerCertificate); err != nil {
+			return nil, err
+		}
+	}
 
-			// Get secret object from manifest, create a copy, modify it and put in in the new map so we do not overwrite the manifest entries
-			secret.Private = generatedValue
-			secret.Public = generatedValue
+	if err := c.signSSHCertificates(newSecrets, secrets); err != nil {
+		return nil, err
+	}
+	return newSecrets, nil
+}
 
-			newSecrets[name] = secret
+// generateMarbleTypeSecrets generates the secrets which are defined per marble type for the given marble type
+func (c *Core) generateMarbleTypeSecrets(ctx context.Context, secrets map[string]manifest.Secret, marbleType string, parentCertificate *x509.Certificate, parentPrivKey crypto.PrivateKey) (map[string]manifest.Secret, error) {
+	newSecrets := make(map[string]manifest.Secret)
 
-		case "cert-rsa":
-			// Generate keys
-			privKey, err := rsa.GenerateKey(rand.Reader, int(secret.Size))
-			if err != nil {
-				c.zaplogger.Error("Failed to generate RSA key", zap.Error(err))
-				return nil, err
-			}
+	derivationSecret, err := c.getKeyDerivationSecret()
+	if err != nil {
+		return nil, err
+	}
 
-			// Generate certificate
-			newSecrets[name], err = c.generateCertificateForSecret(secret, parentCertificate, parentPrivKey, privKey, &privKey.PublicKey)
-			if err != nil {
-				return nil, err
+	for name, secret := range secrets {
+		if !secret.PerMarbleType || secret.DerivedFrom != "" {
+			continue
+		}
+		issuerCertificate, issuerPrivKey, err := c.certificateIssuer(secret, newSecrets, secrets, parentCertificate, parentPrivKey)
+		if err != nil {
+			// like shared certificates, they are generated once their user-defined issuer is uploaded
+			if errors.Is(err, errIssuerNotSet) {
+				c.zaplogger.Info("Skipping generation of secret, since its issuer is not set yet.", zap.String("name", name), zap.String("marbleType", marbleType), zap.String("issuer", secret.Issuer))
+				continue
 			}
+			return nil, err
+		}
+		// symmetric keys are derived from the core's key derivation secret, so all Marbles of a type get the same key
+		newSecrets[name], err = c.generateSecret(name, secret, marbleType+"/"+name, derivationSecret, issuerCertificate, issuerPrivKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyIssuedCertificate(name, newSecrets[name], issuerCertificate); err != nil {
+			return nil, err
+		}
+	}
 
-		case "cert-ed25519":
-			if secret.Size != 0 {
-				return nil, fmt.Errorf("invalid secret size for cert-ed25519, none is expected. given: %v", name)
-			}
+	if err := c.signSSHCertificates(newSecrets, secrets); err != nil {
+		return nil, err
+	}
+	return newSecrets, nil
+}
+
+// generateSecret generates a single secret. Symmetric keys are derived from the core's key derivation secret using salt, or generated randomly if salt is empty.
+func (c *Core) generateSecret(name string, secret manifest.Secret, salt string, derivationSecret []byte, parentCertificate *x509.Certificate, parentPrivKey crypto.PrivateKey) (manifest.Secret, error) {
+	c.zaplogger.Info("generating secret", zap.String("name", name), zap.String("type", secret.Type), zap.Uint("size", secret.Size))
+	switch secret.Type {
+	// Raw = Symmetric Key
+	case "symmetric-key", "jwt-hmac":
+		// Check secret size
+		if secret.Size == 0 || secret.Size%8 != 0 {
+			return manifest.Secret{}, fmt.Errorf("invalid secret size: %v", name)
+		}
 
-			// Generate keys
-			pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+		var generatedValue []byte
+		if salt == "" {
+			generatedValue = make([]byte, secret.Size/8)
+			_, err := rand.Read(generatedValue)
 			if err != nil {
-				c.zaplogger.Error("Failed to generate ed25519 key", zap.Error(err))
-				return nil, err
+				return manifest.Secret{}, err
 			}
-
-			// Generate certificate
-			newSecrets[name], err = c.generateCertificateForSecret(secret, parentCertificate, parentPrivKey, privKey, pubKey)
+		} else {
+			var err error
+			generatedValue, err = util.DeriveKey(derivationSecret, []byte(salt), secret.Size/8)
 			if err != nil {
-				return nil, err
+				return manifest.Secret{}, err
 			}
+		}
 
-		case "cert-ecdsa":
-			var curve elliptic.Curve
-
-			switch secret.Size {
-			case 224:
-				curve = elliptic.P224()
-			case 256:
-				curve = elliptic.P256()
-			case 384:
-				curve = elliptic.P384()
-			case 521:
-				curve = elliptic.P521()
-			default:
-				c.zaplogger.Error("ECDSA secrets only support P224, P256, P384 and P521 as curve. Check the supplied size.", zap.String("name", name), zap.String("type", secret.Type), zap.Uint("size", secret.Size))
-				return nil, fmt.Errorf("unsupported size %d: does not map to a supported curve", secret.Size)
-			}
+		// Modify the copy of the secret object from the manifest so we do not overwrite the manifest entries
+		secret.Private = generatedValue
+		secret.Public = generatedValue
 
-			// Generate keys
-			privKey, err := ecdsa.GenerateKey(curve, rand.Reader)
-			if err != nil {
-				c.zaplogger.Error("Failed to generate ECSDA key", zap.Error(err))
-				return nil, err
-			}
+		return secret, nil
 
-			// Generate certificate
-			newSecrets[name], err = c.generateCertificateForSecret(secret, parentCertificate, parentPrivKey, privKey, &privKey.PublicKey)
-			if err != nil {
-				return nil, err
-			}
+	case "cert-rsa", "key-rsa", "ssh-rsa":
+		// Generate keys
+		privKey, err := rsa.GenerateKey(rand.Reader, int(secret.Size))
+		if err != nil {
+			c.zaplogger.Error("Failed to generate RSA key", zap.Error(err))
+			return manifest.Secret{}, err
+		}
 
+		if secret.Type != "cert-rsa" {
+			return c.setKeyPairForSecret(secret, privKey, &privKey.PublicKey)
+		}
+		// Generate certificate
+		return c.generateCertificateForSecret(secret, parentCertificate, parentPrivKey, privKey, &privKey.PublicKey)
+
+	case "cert-ed25519", "key-ed25519", "ssh-ed25519":
+		if secret.Size != 0 {
+			return manifest.Secret{}, fmt.Errorf("invalid secret size for %s, none is expected. given: %v", secret.Type, name)
+		}
+
+		// Generate keys
+		pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			c.zaplogger.Error("Failed to generate ed25519 key", zap.Error(err))
+			return manifest.Secret{}, err
+		}
+
+		if secret.Type != "cert-ed25519" {
+			return c.setKeyPairForSecret(secret, privKey, pubKey)
+		}
+		// Generate certificate
+		return c.generateCertificateForSecret(secret, parentCertificate, parentPrivKey, privKey, pubKey)
+
+	case "cert-ecdsa", "key-ecdsa", "ssh-ecdsa":
+		var curve elliptic.Curve
+
+		switch secret.Size {
+		case 224:
+			curve = elliptic.P224()
+		case 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
 		default:
-			return nil, fmt.Errorf("unsupported secret of type %s", secret.Type)
+			c.zaplogger.Error("ECDSA secrets only support P224, P256, P384 and P521 as curve. Check the supplied size.", zap.String("name", name), zap.String("type", secret.Type), zap.Uint("size", secret.Size))
+			return manifest.Secret{}, fmt.Errorf("unsupported size %d: does not map to a supported curve", secret.Size)
+		}
+
+		// Generate keys
+		privKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			c.zaplogger.Error("Failed to generate ECSDA key", zap.Error(err))
+			return manifest.Secret{}, err
+		}
+
+		if secret.Type != "cert-ecdsa" {
+			return c.setKeyPairForSecret(secret, privKey, &privKey.PublicKey)
+		}
+		// Generate certificate
+		return c.generateCertificateForSecret(secret, parentCertificate, parentPrivKey, privKey, &privKey.PublicKey)
+
+	// Raw = X25519 scalar and point, since X25519 keys can not be PKCS #8 encoded
+	case "key-x25519":
+		if secret.Size != 0 {
+			return manifest.Secret{}, fmt.Errorf("invalid secret size for key-x25519, none is expected. given: %v", name)
+		}
+
+		privKey := make([]byte, curve25519.ScalarSize)
+		if _, err := rand.Read(privKey); err != nil {
+			return manifest.Secret{}, err
+		}
+		pubKey, err := curve25519.X25519(privKey, curve25519.Basepoint)
+		if err != nil {
+			c.zaplogger.Error("Failed to generate X25519 key", zap.Error(err))
+			return manifest.Secret{}, err
 		}
+
+		secret.Private = privKey
+		secret.Public = pubKey
+		return secret, nil
+
+	default:
+		return manifest.Secret{}, fmt.Errorf("unsupported secret of type %s", secret.Type)
 	}
+}
 
-	return newSecrets, nil
+// setKeyPairForSecret stores a generated key pair without certificate in the secret
+func (c *Core) setKeyPairForSecret(secret manifest.Secret, privKey crypto.PrivateKey, pubKey crypto.PublicKey) (manifest.Secret, error) {
+	var err error
+	secret.Private, err = x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		c.zaplogger.Error("Failed to marshal private key to secret object", zap.Error(err))
+		return manifest.Secret{}, err
+	}
+	secret.Public, err = x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		c.zaplogger.Error("Failed to marshal public key to secret object", zap.Error(err))
+		return manifest.Secret{}, err
+	}
+	return secret, nil
 }
 
-func (c *Core) generateCertificateForSecret(secret manifest.Secret, parentCertificate *x509.Certificate, parentPrivKey *ecdsa.PrivateKey, privKey crypto.PrivateKey, pubKey crypto.PublicKey) (manifest.Secret, error) {
+func (c *Core) generateCertificateForSecret(secret manifest.Secret, parentCertificate *x509.Certificate, parentPrivKey crypto.PrivateKey, privKey crypto.PrivateKey, pubKey crypto.PublicKey) (manifest.Secret, error) {
 	// Load given information from manifest as template
 	template := x509.Certificate(secret.Cert)
 
@@ -579,13 +700,9 @@ func generateUsersFromManifest(rawUsers map[string]manifest.User, roles map[stri
 	// Parse & write X.509 user data from manifest
 	users := make([]*user.User, 0, len(rawUsers))
 	for name, userData := range rawUsers {
-		block, _ := pem.Decode([]byte(userData.Certificate))
-		if block == nil {
-			return nil, fmt.Errorf("received invalid certificate for user %s", name)
-		}
-		cert, err := x509.ParseCertificate(block.Bytes)
+		cert, err := userData.ParseCertificate()
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("received invalid certificate for user %s: %v", name, err)
 		}
 		newUser := user.NewUser(name, cert)
 		for _, assignedRole := range userData.Roles {
@@ -600,16 +717,16 @@ func generateUsersFromManifest(rawUsers map[string]manifest.User, roles map[stri
 }
 
 func (c *Core) setCAData(dnsNames []string, tx store.Transaction) error {
-	rootCert, rootPrivK, err := generateCert(dnsNames, coordinatorName, nil, nil, nil)
+	rootCert, rootPrivK, err := generateCert(dnsNames, coordinatorName, c.caConfig, nil, nil, nil)
 	if err != nil {
 		return err
 	}
 	// Creating a cross-signed intermediate cert. See https://github.com/edgelesssys/marblerun/issues/175
-	intermediateCert, intermediatePrivK, err := generateCert(dnsNames, coordinatorIntermediateName, nil, rootCert, rootPrivK)
+	intermediateCert, intermediatePrivK, err := generateCert(dnsNames, coordinatorIntermediateName, c.caConfig, nil, rootCert, rootPrivK)
 	if err != nil {
 		return err
 	}
-	marbleRootCert, _, err := generateCert(dnsNames, coordinatorIntermediateName, intermediatePrivK, nil, nil)
+	marbleRootCert, _, err := generateCert(dnsNames, coordinatorIntermediateName, c.caConfig, intermediatePrivK, nil, nil)
 	if err != nil {
 		return err
 	}
@@ -631,5 +748,14 @@ func (c *Core) setCAData(dnsNames []string, tx store.Transaction) error {
 		return err
 	}
 
+	// keys are derived from a dedicated secret, so they are independent of the root CA
+	derivationSecret := make([]byte, keyDerivationSecretSize)
+	if _, err := rand.Read(derivationSecret); err != nil {
+		return err
+	}
+	if err := txdata.putKeyDerivationSecret(derivationSecret); err != nil {
+		return err
+	}
+
 	return nil
 }
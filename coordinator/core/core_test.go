@@ -7,12 +7,14 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"math/big"
+	"net"
 	"testing"
 	"time"
 
@@ -26,6 +28,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestCore(t *testing.T) {
@@ -73,7 +77,7 @@ func TestSeal(t *testing.T) {
 	sealer := &seal.MockSealer{}
 	recovery := recovery.NewSinglePartyRecovery()
 
-	c, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, nil)
+	c, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
 	require.NoError(err)
 
 	// Set manifest. This will seal the state.
@@ -90,7 +94,7 @@ func TestSeal(t *testing.T) {
 	assert.NoError(err)
 
 	// Check sealing with a new core initialized with the sealed state.
-	c2, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, nil)
+	c2, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
 	require.NoError(err)
 	c2State, err := c2.data.getState()
 	assert.NoError(err)
@@ -126,12 +130,12 @@ func TestRecover(t *testing.T) {
 	sealer := &seal.MockSealer{}
 	recovery := recovery.NewSinglePartyRecovery()
 
-	c, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, nil)
+	c, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
 	require.NoError(err)
 
 	// new core does not allow recover
 	key := make([]byte, 16)
-	_, err = c.Recover(context.TODO(), key)
+	_, err = c.Recover(context.TODO(), key, nil)
 	assert.Error(err)
 
 	// Set manifest. This will seal the state.
@@ -139,12 +143,12 @@ func TestRecover(t *testing.T) {
 	require.NoError(err)
 
 	// core does not allow recover after manifest has been set
-	_, err = c.Recover(context.TODO(), key)
+	_, err = c.Recover(context.TODO(), key, nil)
 	assert.Error(err)
 
 	// Initialize new core and let unseal fail
 	sealer.UnsealError = seal.ErrEncryptionKey
-	c2, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, nil)
+	c2, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
 	sealer.UnsealError = nil
 	require.NoError(err)
 	c2State, err := c2.data.getState()
@@ -152,7 +156,50 @@ func TestRecover(t *testing.T) {
 	require.Equal(stateRecovery, c2State)
 
 	// recover
-	_, err = c2.Recover(context.TODO(), key)
+	_, err = c2.Recover(context.TODO(), key, nil)
+	assert.NoError(err)
+	c2State, err = c2.data.getState()
+	assert.NoError(err)
+	assert.Equal(stateAcceptingMarbles, c2State)
+}
+
+func TestRecoverRestricted(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	zapLogger, err := zap.NewDevelopment()
+	require.NoError(err)
+	defer zapLogger.Sync()
+
+	validator := quote.NewMockValidator()
+	issuer := quote.NewMockIssuer()
+	sealer := &seal.MockSealer{}
+	recovery := recovery.NewSinglePartyRecovery()
+
+	c, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
+	require.NoError(err)
+	_, err = c.SetManifest(context.TODO(), mustAddAdminRoles(test.ManifestJSONWithRecoveryKey, map[string]manifest.Role{
+		"recoverer": {ResourceType: "Recovery", Actions: []string{"Recover"}},
+	}))
+	require.NoError(err)
+
+	sealer.UnsealError = seal.ErrEncryptionKey
+	c2, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
+	sealer.UnsealError = nil
+	require.NoError(err)
+
+	// the recovery secret alone does not suffice if the manifest defines a Recovery role
+	adminTestCert, otherTestCert := test.MustSetupTestCerts(test.RecoveryPrivateKey)
+	key := make([]byte, 16)
+	_, err = c2.Recover(context.TODO(), key, nil)
+	assert.Error(err)
+	_, err = c2.Recover(context.TODO(), key, []*x509.Certificate{otherTestCert})
+	assert.Error(err)
+	c2State, err := c2.data.getState()
+	assert.NoError(err)
+	assert.Equal(stateRecovery, c2State)
+
+	_, err = c2.Recover(context.TODO(), key, []*x509.Certificate{adminTestCert})
 	assert.NoError(err)
 	c2State, err = c2.data.getState()
 	assert.NoError(err)
@@ -353,6 +400,185 @@ func TestGenerateSecrets(t *testing.T) {
 	assert.Error(err)
 }
 
+func TestGenerateKeySecrets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	secretsToGenerate := map[string]manifest.Secret{
+		"key-rsa":     {Type: "key-rsa", Size: 2048, Shared: true},
+		"key-ecdsa":   {Type: "key-ecdsa", Size: 384, Shared: true},
+		"key-ed25519": {Type: "key-ed25519", Shared: true},
+		"key-x25519":  {Type: "key-x25519", Shared: true},
+		"jwt-hmac":    {Type: "jwt-hmac", Size: 512, Shared: true},
+		"ssh-ca":      {Type: "ssh-ed25519", Shared: true},
+		"ssh-host": {
+			Type:           "ssh-ecdsa",
+			Size:           256,
+			Shared:         true,
+			ValidFor:       7,
+			SSHCertificate: &manifest.SSHCertificate{Issuer: "ssh-ca", Principals: []string{"host.example.com"}, KeyID: "host"},
+		},
+		"ssh-user-private": {
+			Type:           "ssh-rsa",
+			Size:           2048,
+			SSHCertificate: &manifest.SSHCertificate{Issuer: "ssh-ca", CertType: "user", Principals: []string{"marble"}},
+		},
+	}
+
+	c := NewCoreWithMocks()
+	rootCert, err := c.data.getCertificate(sKCoordinatorRootCert)
+	require.NoError(err)
+	rootPrivK, err := c.data.getPrivK(sKCoordinatorRootKey)
+	require.NoError(err)
+
+	generatedSecrets, err := c.generateSecrets(context.TODO(), secretsToGenerate, uuid.Nil, rootCert, rootPrivK)
+	require.NoError(err)
+
+	// bare key pairs have no certificate
+	for _, name := range []string{"key-rsa", "key-ecdsa", "key-ed25519"} {
+		secret := generatedSecrets[name]
+		assert.Empty(secret.Cert.Raw)
+		_, err := x509.ParsePKCS8PrivateKey(secret.Private)
+		assert.NoError(err)
+		_, err = x509.ParsePKIXPublicKey(secret.Public)
+		assert.NoError(err)
+	}
+	x25519Public, err := curve25519.X25519(generatedSecrets["key-x25519"].Private, curve25519.Basepoint)
+	require.NoError(err)
+	assert.Equal([]byte(generatedSecrets["key-x25519"].Public), x25519Public)
+	assert.Len(generatedSecrets["jwt-hmac"].Private, 64)
+
+	// the host certificate is signed by the SSH CA secret
+	caPub, err := x509.ParsePKIXPublicKey(generatedSecrets["ssh-ca"].Public)
+	require.NoError(err)
+	sshCAPub, err := ssh.NewPublicKey(caPub)
+	require.NoError(err)
+	certChecker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+			return bytes.Equal(auth.Marshal(), sshCAPub.Marshal())
+		},
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), sshCAPub.Marshal())
+		},
+	}
+	hostCert, err := ssh.ParsePublicKey(generatedSecrets["ssh-host"].SSHCertificate.Raw)
+	require.NoError(err)
+	assert.NoError(certChecker.CheckHostKey("host.example.com:22", nil, hostCert))
+	assert.Error(certChecker.CheckHostKey("other.example.com:22", nil, hostCert))
+	assert.Equal("host", hostCert.(*ssh.Certificate).KeyId)
+	assert.Nil(secretsToGenerate["ssh-host"].SSHCertificate.Raw, "the manifest definition must not be modified")
+
+	// private secrets are signed with the issuer from the given (already generated) secrets
+	privateSecrets, err := c.generateSecrets(context.TODO(), mergeSecretMaps(secretsToGenerate, generatedSecrets), uuid.New(), rootCert, rootPrivK)
+	require.NoError(err)
+	userCert, err := ssh.ParsePublicKey(privateSecrets["ssh-user-private"].SSHCertificate.Raw)
+	require.NoError(err)
+	assert.EqualValues(ssh.UserCert, userCert.(*ssh.Certificate).CertType)
+	_, err = certChecker.Authenticate(mockConnMetadata("marble"), userCert)
+	assert.NoError(err)
+
+	// the issuer must be available
+	_, err = c.generateSecrets(context.TODO(), map[string]manifest.Secret{"ssh-host": secretsToGenerate["ssh-host"]}, uuid.Nil, rootCert, rootPrivK)
+	assert.Error(err)
+}
+
+func TestGenerateSecretsWithIssuer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	secretsToGenerate := map[string]manifest.Secret{
+		"ca": {
+			Type:   "cert-ecdsa",
+			Size:   256,
+			Shared: true,
+			Cert:   manifest.Certificate{IsCA: true, Subject: pkix.Name{CommonName: "Test CA"}},
+		},
+		"intermediate": {
+			Type:   "cert-ecdsa",
+			Size:   256,
+			Shared: true,
+			Issuer: "ca",
+			Cert:   manifest.Certificate{IsCA: true, MaxPathLenZero: true, Subject: pkix.Name{CommonName: "Test Intermediate CA"}},
+		},
+		"leaf": {
+			Type:   "cert-ed25519",
+			Shared: true,
+			Issuer: "intermediate",
+		},
+		"leaf-private": {
+			Type:   "cert-rsa",
+			Size:   2048,
+			Issuer: "ca",
+		},
+	}
+
+	c := NewCoreWithMocks()
+	rootCert, err := c.data.getCertificate(sKCoordinatorRootCert)
+	require.NoError(err)
+	rootPrivK, err := c.data.getPrivK(sKCoordinatorRootKey)
+	require.NoError(err)
+
+	generatedSecrets, err := c.generateSecrets(context.TODO(), secretsToGenerate, uuid.Nil, rootCert, rootPrivK)
+	require.NoError(err)
+	require.Len(generatedSecrets, 3)
+
+	caCert := x509.Certificate(generatedSecrets["ca"].Cert)
+	intermediateCert := x509.Certificate(generatedSecrets["intermediate"].Cert)
+	roots := x509.NewCertPool()
+	roots.AddCert(&caCert)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(&intermediateCert)
+	opts := x509.VerifyOptions{Roots: roots, Intermediates: intermediates}
+
+	leafCert := x509.Certificate(generatedSecrets["leaf"].Cert)
+	_, err = leafCert.Verify(opts)
+	assert.NoError(err)
+	assert.Equal("Test Intermediate CA", leafCert.Issuer.CommonName)
+
+	// private secrets are signed by the shared CA
+	privateSecrets, err := c.generateSecrets(context.TODO(), mergeSecretMaps(secretsToGenerate, generatedSecrets), uuid.New(), rootCert, rootPrivK)
+	require.NoError(err)
+	privateCert := x509.Certificate(privateSecrets["leaf-private"].Cert)
+	_, err = privateCert.Verify(opts)
+	assert.NoError(err)
+	assert.Equal("Test CA", privateCert.Issuer.CommonName)
+
+	// the issuer must be a CA
+	_, err = c.generateSecrets(context.TODO(), map[string]manifest.Secret{
+		"leaf":         {Type: "cert-ed25519", Shared: true, Issuer: "intermediate"},
+		"intermediate": {Type: "cert-ed25519", Shared: true},
+	}, uuid.Nil, rootCert, rootPrivK)
+	assert.Error(err)
+
+	// the path length of the issuer is enforced
+	_, err = c.generateSecrets(context.TODO(), map[string]manifest.Secret{
+		"sub-ca":       {Type: "cert-ed25519", Shared: true, Issuer: "intermediate", Cert: manifest.Certificate{IsCA: true}},
+		"intermediate": generatedSecrets["intermediate"],
+	}, uuid.Nil, rootCert, rootPrivK)
+	assert.Error(err)
+
+	// shared secrets whose user-defined issuer is not uploaded yet are skipped, private ones fail
+	unsetIssuer := map[string]manifest.Secret{
+		"user-ca": {Type: "cert-ed25519", UserDefined: true},
+		"leaf":    {Type: "cert-ed25519", Shared: true, Issuer: "user-ca"},
+	}
+	generatedSecrets, err = c.generateSecrets(context.TODO(), unsetIssuer, uuid.Nil, rootCert, rootPrivK)
+	require.NoError(err)
+	assert.Empty(generatedSecrets)
+	unsetIssuer["leaf"] = manifest.Secret{Type: "cert-ed25519", Issuer: "user-ca"}
+	_, err = c.generateSecrets(context.TODO(), unsetIssuer, uuid.New(), rootCert, rootPrivK)
+	assert.Error(err)
+}
+
+type mockConnMetadata string
+
+func (m mockConnMetadata) User() string          { return string(m) }
+func (m mockConnMetadata) SessionID() []byte     { return nil }
+func (m mockConnMetadata) ClientVersion() []byte { return nil }
+func (m mockConnMetadata) ServerVersion() []byte { return nil }
+func (m mockConnMetadata) RemoteAddr() net.Addr  { return nil }
+func (m mockConnMetadata) LocalAddr() net.Addr   { return nil }
+
 func TestUnsetRestart(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -366,7 +592,7 @@ func TestUnsetRestart(t *testing.T) {
 	recovery := recovery.NewSinglePartyRecovery()
 
 	// create a new core, this seals the state with only certificate and keys
-	c1, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, nil)
+	c1, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
 	require.NoError(err)
 	c1State, err := c1.data.getState()
 	assert.NoError(err)
@@ -375,7 +601,7 @@ func TestUnsetRestart(t *testing.T) {
 	assert.NoError(err)
 
 	// create a second core, this should overwrite the previously sealed certificate and keys since no manifest was set
-	c2, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, nil)
+	c2, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
 	require.NoError(err)
 	c2State, err := c2.data.getState()
 	assert.NoError(err)
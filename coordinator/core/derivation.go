@@ -0,0 +1,79 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/google/uuid"
+)
+
+// errMasterKeyNotSet is returned if the master key of a derived secret has not been uploaded yet
+var errMasterKeyNotSet = errors.New("master key is not set")
+
+// deriveSecret derives the value of a secret from the current value of its user-defined master key.
+// marbleType and marbleUUID identify the marble the key is derived for. They are only used for secrets that are not shared.
+func (c *Core) deriveSecret(name string, definition manifest.Secret, marbleType string, marbleUUID uuid.UUID) (manifest.Secret, error) {
+	master, err := c.data.getSecret(definition.DerivedFrom)
+	if err != nil {
+		return manifest.Secret{}, err
+	}
+	if len(master.Private) <= 0 {
+		return manifest.Secret{}, fmt.Errorf("%w: %s", errMasterKeyNotSet, definition.DerivedFrom)
+	}
+	if definition.Size == 0 || definition.Size%8 != 0 {
+		return manifest.Secret{}, fmt.Errorf("invalid secret size: %v", name)
+	}
+
+	key, err := util.DeriveKey(master.Private, []byte(derivationContext(name, definition, marbleType, marbleUUID)), definition.Size/8)
+	if err != nil {
+		return manifest.Secret{}, err
+	}
+	definition.Private = key
+	definition.Public = key
+	return definition, nil
+}
+
+// deriveSecrets derives all secrets of the manifest with a master key for an activating marble.
+// Secrets whose master key has not been uploaded yet are skipped, like unset user-defined secrets.
+func (c *Core) deriveSecrets(definitions map[string]manifest.Secret, marbleType string, marbleUUID uuid.UUID) (map[string]manifest.Secret, error) {
+	derivedSecrets := make(map[string]manifest.Secret)
+	for name, definition := range definitions {
+		if definition.DerivedFrom == "" {
+			continue
+		}
+		secret, err := c.deriveSecret(name, definition, marbleType, marbleUUID)
+		if errors.Is(err, errMasterKeyNotSet) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		derivedSecrets[name] = secret
+	}
+	return derivedSecrets, nil
+}
+
+// derivationContext returns the context a secret is derived with.
+// It only depends on values that survive a rebuild of the Coordinator: the scope of the secret, the marble type or UUID, and the label.
+func derivationContext(name string, definition manifest.Secret, marbleType string, marbleUUID uuid.UUID) string {
+	label := definition.Label
+	if label == "" {
+		label = name
+	}
+	switch {
+	case definition.Shared:
+		return "shared/" + label
+	case definition.PerMarbleType:
+		return "type/" + marbleType + "/" + label
+	default:
+		return "marble/" + marbleUUID.String() + "/" + label
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/quote"
+	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/edgelesssys/marblerun/test"
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDerivedSecrets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rawManifest := strings.Replace(test.ManifestJSONWithRecoveryKey, `"Secrets": {
+		"restricted_secret"`, `"Secrets": {
+		"derived_shared": {
+			"Size": 256,
+			"Shared": true,
+			"Type": "symmetric-key",
+			"DerivedFrom": "symmetric_key_unset"
+		},
+		"derived_type": {
+			"Size": 256,
+			"PerMarbleType": true,
+			"Type": "symmetric-key",
+			"DerivedFrom": "symmetric_key_unset",
+			"Label": "db"
+		},
+		"derived_private": {
+			"Size": 128,
+			"Type": "symmetric-key",
+			"DerivedFrom": "symmetric_key_unset"
+		},
+		"restricted_secret"`, 1)
+	rawManifest = strings.Replace(rawManifest, `"SEAL_KEY": "{{ hex .Marblerun.SealKey }}"`, `"SEAL_KEY": "{{ hex .Marblerun.SealKey }}",
+					"DERIVED_SHARED": "{{ hex .Secrets.derived_shared }}",
+					"DERIVED_TYPE": "{{ hex .Secrets.derived_type }}",
+					"DERIVED_PRIVATE": "{{ hex .Secrets.derived_private }}"`, 1)
+	var mnf manifest.Manifest
+	require.NoError(json.Unmarshal([]byte(rawManifest), &mnf))
+
+	marbleUUID := uuid.New()
+	setup := func() *Core {
+		c, _ := mustSetup()
+		_, err := c.SetManifest(context.TODO(), []byte(rawManifest))
+		require.NoError(err)
+		return c
+	}
+	activate := func(c *Core) (*rpc.ActivationResp, error) {
+		cert, csr, _ := util.MustGenerateTestMarbleCredentials()
+		marbleQuote, err := c.qi.Issue(cert.Raw)
+		require.NoError(err)
+		c.qv.(*quote.MockValidator).AddValidQuote(marbleQuote, cert.Raw, mnf.Packages["frontend"], mnf.Infrastructures["Azure"])
+		return c.Activate(peerContext(cert), &rpc.ActivationReq{
+			CSR:        csr,
+			MarbleType: "frontend",
+			Quote:      marbleQuote,
+			UUID:       marbleUUID.String(),
+		})
+	}
+
+	c := setup()
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+
+	// derived secrets are not set as long as the master key is missing
+	_, err = activate(c)
+	assert.Error(err)
+
+	require.NoError(c.WriteSecrets(context.TODO(), []byte(test.UserSecrets), admin))
+	resp, err := activate(c)
+	require.NoError(err)
+	env := resp.Parameters.Env
+	assert.Len(env["DERIVED_SHARED"], 64)
+	assert.Len(env["DERIVED_TYPE"], 64)
+	assert.Len(env["DERIVED_PRIVATE"], 32)
+	assert.NotEqual(env["DERIVED_SHARED"], env["DERIVED_TYPE"])
+
+	// a Coordinator set up from scratch derives the same keys from the same master key
+	c = setup()
+	admin, err = c.data.getUser("admin")
+	require.NoError(err)
+	require.NoError(c.WriteSecrets(context.TODO(), []byte(test.UserSecrets), admin))
+	resp, err = activate(c)
+	require.NoError(err)
+	for _, name := range []string{"DERIVED_SHARED", "DERIVED_TYPE", "DERIVED_PRIVATE"} {
+		assert.Equal(env[name], resp.Parameters.Env[name], name)
+	}
+
+	// the keys depend on the scope and label
+	shared, err := c.deriveSecret("derived_shared", mnf.Secrets["derived_shared"], "frontend", marbleUUID)
+	require.NoError(err)
+	relabeled := mnf.Secrets["derived_shared"]
+	relabeled.Label = "other"
+	other, err := c.deriveSecret("derived_shared", relabeled, "frontend", marbleUUID)
+	require.NoError(err)
+	assert.NotEqual(shared.Private, other.Private)
+	backend, err := c.deriveSecret("derived_type", mnf.Secrets["derived_type"], "backend", marbleUUID)
+	require.NoError(err)
+	frontend, err := c.deriveSecret("derived_type", mnf.Secrets["derived_type"], "frontend", marbleUUID)
+	require.NoError(err)
+	assert.NotEqual(backend.Private, frontend.Private)
+	private, err := c.deriveSecret("derived_private", mnf.Secrets["derived_private"], "frontend", uuid.New())
+	require.NoError(err)
+	assert.NotEqual(env["DERIVED_PRIVATE"], hex.EncodeToString(private.Private))
+
+	// derived secrets can not be rotated
+	assert.Error(c.RotateSecrets(context.TODO(), []string{"derived_shared"}, admin))
+}
@@ -0,0 +1,125 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/user"
+)
+
+// ManifestChanges describes what setting a manifest or an update manifest would change
+type ManifestChanges struct {
+	// Packages describes the change of each added or updated package
+	Packages map[string]string
+	// Secrets are the names of the secrets which would be generated or regenerated.
+	// Per-marble-type secrets are named <marbleType>/<secretName>, secrets generated for each marble are named by the secret.
+	Secrets []string
+	// MarbleTypes are the marble types which are affected by the change. Marbles of these types need to be (re)started.
+	MarbleTypes []string
+}
+
+// SetManifestDryRun checks if a manifest would be accepted by SetManifest and returns the resulting changes, without setting the manifest
+func (c *Core) SetManifestDryRun(ctx context.Context, rawManifest []byte) (ManifestChanges, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingManifest, stateRecovery); err != nil {
+		return ManifestChanges{}, err
+	}
+
+	rawManifest, err := manifest.Canonicalize(rawManifest)
+	if err != nil {
+		return ManifestChanges{}, err
+	}
+	var mnf manifest.Manifest
+	if err := json.Unmarshal(rawManifest, &mnf); err != nil {
+		return ManifestChanges{}, err
+	}
+	if err := mnf.Check(ctx, c.zaplogger); err != nil {
+		return ManifestChanges{}, err
+	}
+	generated, err := c.generateManifestSecrets(ctx, mnf)
+	if err != nil {
+		return ManifestChanges{}, err
+	}
+
+	changes := ManifestChanges{Packages: make(map[string]string)}
+	for name := range mnf.Packages {
+		changes.Packages[name] = "added"
+	}
+	for name := range generated.shared {
+		changes.Secrets = append(changes.Secrets, name)
+	}
+	for name := range generated.private {
+		changes.Secrets = append(changes.Secrets, name)
+	}
+	for marbleType, secrets := range generated.marbleType {
+		for name := range secrets {
+			changes.Secrets = append(changes.Secrets, marbleType+"/"+name)
+		}
+	}
+	for marbleType := range mnf.Marbles {
+		changes.MarbleTypes = append(changes.MarbleTypes, marbleType)
+	}
+	changes.sort()
+	return changes, nil
+}
+
+// UpdateManifestDryRun checks if an update manifest would be accepted by UpdateManifest and returns the resulting changes, without applying the update
+func (c *Core) UpdateManifestDryRun(ctx context.Context, rawUpdateManifest []byte, updater *user.User) (ManifestChanges, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return ManifestChanges{}, err
+	}
+
+	updateManifest, _, reissued, err := c.prepareUpdate(ctx, rawUpdateManifest, updater)
+	if err != nil {
+		return ManifestChanges{}, err
+	}
+	mnf, err := c.data.getManifest()
+	if err != nil {
+		return ManifestChanges{}, err
+	}
+
+	changes := ManifestChanges{Packages: make(map[string]string)}
+	for name, pkg := range updateManifest.Packages {
+		// the store still holds the current package, since prepareUpdate does not write
+		currentPkg, err := c.data.getPackage(name)
+		if err != nil {
+			return ManifestChanges{}, err
+		}
+		previousVersion := "unset"
+		if currentPkg.SecurityVersion != nil {
+			previousVersion = fmt.Sprint(*currentPkg.SecurityVersion)
+		}
+		changes.Packages[name] = fmt.Sprintf("SecurityVersion %s -> %d", previousVersion, *pkg.SecurityVersion)
+	}
+	for name := range reissued.secrets {
+		changes.Secrets = append(changes.Secrets, name)
+	}
+	for marbleType, secrets := range reissued.marbleTypeSecrets {
+		for name := range secrets {
+			changes.Secrets = append(changes.Secrets, marbleType+"/"+name)
+		}
+	}
+	for marbleType, marble := range mnf.Marbles {
+		if _, ok := updateManifest.Packages[marble.Package]; ok {
+			changes.MarbleTypes = append(changes.MarbleTypes, marbleType)
+		}
+	}
+	changes.sort()
+	return changes, nil
+}
+
+// sort sorts the secrets and marble types, so the changes are reported deterministically
+func (m *ManifestChanges) sort() {
+	sort.Strings(m.Secrets)
+	sort.Strings(m.MarbleTypes)
+}
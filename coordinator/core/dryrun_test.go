@@ -0,0 +1,81 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/edgelesssys/marblerun/coordinator/store"
+	"github.com/edgelesssys/marblerun/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetManifestDryRun(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	c, _ := mustSetup()
+
+	_, err := c.SetManifestDryRun(context.TODO(), []byte(test.ManifestJSON[:len(test.ManifestJSON)-1]))
+	assert.Error(err)
+
+	changes, err := c.SetManifestDryRun(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	assert.Equal("added", changes.Packages["frontend"])
+	assert.Contains(changes.Secrets, "cert_shared")
+	assert.Contains(changes.Secrets, "frontend/cert_marble_type")
+	assert.Contains(changes.MarbleTypes, "frontend")
+
+	// nothing is stored
+	state, err := c.data.getState()
+	require.NoError(err)
+	assert.Equal(stateAcceptingManifest, state)
+	_, err = c.data.getManifest()
+	assert.True(store.IsStoreValueUnsetError(err))
+
+	_, err = c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	_, err = c.SetManifestDryRun(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	assert.Error(err)
+}
+
+func TestUpdateManifestDryRun(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	c, _ := mustSetup()
+
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+	secretsBefore, err := c.data.getSecretMap()
+	require.NoError(err)
+
+	changes, err := c.UpdateManifestDryRun(context.TODO(), []byte(test.UpdateManifest), admin)
+	require.NoError(err)
+	assert.Equal(map[string]string{"frontend": "SecurityVersion 3 -> 5"}, changes.Packages)
+	assert.Contains(changes.Secrets, "cert_shared")
+	assert.NotContains(changes.Secrets, "symmetric_key_shared")
+	assert.Contains(changes.Secrets, "frontend/cert_marble_type")
+	assert.Contains(changes.MarbleTypes, "frontend")
+
+	// nothing is changed
+	pkg, err := c.data.getPackage("frontend")
+	require.NoError(err)
+	assert.EqualValues(3, *pkg.SecurityVersion)
+	secretsAfter, err := c.data.getSecretMap()
+	require.NoError(err)
+	assert.Equal(secretsBefore, secretsAfter)
+
+	// update is still possible with the same manifest
+	assert.NoError(c.UpdateManifest(context.TODO(), []byte(test.UpdateManifest), admin))
+
+	// a downgrade would be rejected
+	_, err = c.UpdateManifestDryRun(context.TODO(), []byte(`{"Packages":{"frontend":{"SecurityVersion":4}}}`), admin)
+	assert.Error(err)
+}
@@ -0,0 +1,249 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/edgelesssys/marblerun/coordinator/user"
+	"go.uber.org/zap"
+)
+
+// externalCA holds the state of an external CA issuing the intermediate CA of the Coordinator
+type externalCA struct {
+	// PendingKey is the PKCS #8 encoded intermediate key of the last exported CSR, until its certificate is set
+	PendingKey []byte
+	// Chain are the certificates of the external CA issuing the intermediate certificate, up to its root
+	Chain [][]byte
+}
+
+// GetIntermediateCSR generates a new intermediate key and returns a certificate signing request for it
+//
+// The CSR is returned in PEM format, together with a quote for the raw CSR.
+// The key stays pending until the certificate issued for it is set with SetIntermediateCertificate.
+func (c *Core) GetIntermediateCSR(ctx context.Context, updater *user.User) ([]byte, []byte, error) {
+	defer c.mux.Unlock()
+
+	// Only accept requests if we already have a manifest
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, nil, err
+	}
+
+	// verify user is allowed to set the external CA
+	if !updater.IsGranted(user.NewPermission(user.PermissionSetExternalCA, nil)) {
+		return nil, nil, fmt.Errorf("user %s is not allowed to set an external CA", updater.Name())
+	}
+
+	rootCert, err := c.data.getCertificate(sKCoordinatorRootCert)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privK, err := c.caConfig.IntermediateKeyAlgorithm.generateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	subject := c.caConfig.Subject
+	subject.CommonName = coordinatorIntermediateName
+	template := x509.CertificateRequest{
+		Subject:     subject,
+		DNSNames:    rootCert.DNSNames,
+		IPAddresses: c.caConfig.ipAddresses(),
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &template, privK)
+	if err != nil {
+		return nil, nil, err
+	}
+	pendingKey, err := x509.MarshalPKCS8PrivateKey(privK)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	txdata := storeWrapper{tx}
+
+	extCA, err := txdata.getExternalCA()
+	if err != nil {
+		return nil, nil, err
+	}
+	extCA.PendingKey = pendingKey
+	if err := txdata.putExternalCA(extCA); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}), c.generateQuote(csr), nil
+}
+
+// SetIntermediateCertificate sets the certificate issued by an external CA for the pending intermediate key
+//
+// rawCertChain contains the PEM encoded intermediate certificate, followed by the certificates of the external CA up to its root.
+// Afterwards, the certificates of Marbles and secrets chain up to the root of the external CA.
+// The intermediate CA is additionally cross-signed by the root CA of the Coordinator.
+func (c *Core) SetIntermediateCertificate(ctx context.Context, rawCertChain []byte, updater *user.User) error {
+	defer c.mux.Unlock()
+
+	// Only accept requests if we already have a manifest
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return err
+	}
+
+	// verify user is allowed to set the external CA
+	if !updater.IsGranted(user.NewPermission(user.PermissionSetExternalCA, nil)) {
+		return fmt.Errorf("user %s is not allowed to set an external CA", updater.Name())
+	}
+
+	extCA, err := c.data.getExternalCA()
+	if err != nil {
+		return err
+	}
+	if len(extCA.PendingKey) == 0 {
+		return errors.New("no certificate signing request is pending")
+	}
+	privK, err := x509.ParsePKCS8PrivateKey(extCA.PendingKey)
+	if err != nil {
+		return err
+	}
+	intermediatePrivK, ok := privK.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported key type %T", privK)
+	}
+
+	certChain, err := parseExternalCAChain(rawCertChain, intermediatePrivK.Public())
+	if err != nil {
+		return err
+	}
+	marbleRootCert := certChain[0]
+
+	rootCert, err := c.data.getCertificate(sKCoordinatorRootCert)
+	if err != nil {
+		return err
+	}
+	rootPrivK, err := c.data.getPrivK(sKCoordinatorRootKey)
+	if err != nil {
+		return err
+	}
+	// Clients trusting the Coordinator root can still verify the Marbles
+	intermediateCert, err := crossSignCertificate(marbleRootCert, rootCert, rootPrivK)
+	if err != nil {
+		return err
+	}
+
+	reissued, err := c.regenerateCertificates(ctx, intermediateCert, marbleRootCert, intermediatePrivK)
+	if err != nil {
+		return err
+	}
+	for _, cert := range certChain[1:] {
+		reissued.externalChain = append(reissued.externalChain, cert.Raw)
+	}
+
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	txdata := storeWrapper{tx}
+
+	c.updateLogger.Reset()
+	c.updateLogger.Info("external CA set", zap.String("user", updater.Name()), zap.String("issuer", marbleRootCert.Issuer.String()))
+
+	if err := reissued.put(txdata, updater.Name()); err != nil {
+		return err
+	}
+	extCA, err = txdata.getExternalCA()
+	if err != nil {
+		return err
+	}
+	extCA.PendingKey = nil
+	if err := txdata.putExternalCA(extCA); err != nil {
+		return err
+	}
+	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	c.zaplogger.Info("The intermediate CA is now issued by an external CA. Please restart your Marbles.", zap.String("issuer", marbleRootCert.Issuer.String()))
+	return nil
+}
+
+// parseExternalCAChain parses a PEM encoded certificate chain issued for pubKey and verifies it up to its last certificate
+func parseExternalCAChain(rawCertChain []byte, pubKey crypto.PublicKey) ([]*x509.Certificate, error) {
+	var certChain []*x509.Certificate
+	for rest := bytes.TrimSpace(rawCertChain); len(rest) > 0; rest = bytes.TrimSpace(rest) {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil || block.Type != "CERTIFICATE" {
+			return nil, errors.New("certificate chain contains invalid PEM data")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certChain = append(certChain, cert)
+	}
+	if len(certChain) < 2 {
+		return nil, errors.New("certificate chain must contain the intermediate certificate and the root certificate of the external CA")
+	}
+
+	cert := certChain[0]
+	if !cert.IsCA {
+		return nil, errors.New("intermediate certificate is not a CA certificate")
+	}
+	if !publicKeyEqual(cert.PublicKey, pubKey) {
+		return nil, errors.New("intermediate certificate was not issued for the pending certificate signing request")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certChain[len(certChain)-1])
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range certChain[1 : len(certChain)-1] {
+		intermediates.AddCert(intermediate)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return nil, fmt.Errorf("verifying certificate chain: %w", err)
+	}
+	return certChain, nil
+}
+
+// publicKeyEqual returns true if both public keys are equal
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	rawA, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	rawB, err := x509.MarshalPKIXPublicKey(b)
+	return err == nil && bytes.Equal(rawA, rawB)
+}
+
+// externalCACertificates returns the intermediate certificate and the chain of the external CA, if it is set
+func (c *Core) externalCACertificates() ([][]byte, error) {
+	extCA, err := c.data.getExternalCA()
+	if err != nil || len(extCA.Chain) == 0 {
+		return nil, err
+	}
+	marbleRootCert, err := c.data.getCertificate(sKMarbleRootCert)
+	if err != nil {
+		return nil, err
+	}
+	return append([][]byte{marbleRootCert.Raw}, extCA.Chain...), nil
+}
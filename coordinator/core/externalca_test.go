@@ -0,0 +1,157 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/user"
+	"github.com/edgelesssys/marblerun/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExternalCA(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+	coordinatorRoot, err := c.data.getCertificate(sKCoordinatorRootCert)
+	require.NoError(err)
+
+	// the corporate root CA of the user
+	extRootPrivK, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	extRootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Corporate Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	extRootRaw, err := x509.CreateCertificate(rand.Reader, extRootTemplate, extRootTemplate, &extRootPrivK.PublicKey, extRootPrivK)
+	require.NoError(err)
+	extRoot, err := x509.ParseCertificate(extRootRaw)
+	require.NoError(err)
+
+	signCSR := func(rawCSR []byte) []byte {
+		block, _ := pem.Decode(rawCSR)
+		require.NotNil(block)
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		require.NoError(err)
+		require.NoError(csr.CheckSignature())
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(2),
+			Subject:               csr.Subject,
+			DNSNames:              csr.DNSNames,
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		certRaw, err := x509.CreateCertificate(rand.Reader, template, extRoot, csr.PublicKey, extRootPrivK)
+		require.NoError(err)
+		return append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certRaw}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: extRoot.Raw})...)
+	}
+
+	// users need the permission to set an external CA
+	_, _, err = c.GetIntermediateCSR(context.TODO(), user.NewUser("other", nil))
+	assert.Error(err)
+	// a certificate can only be set for a pending CSR
+	assert.Error(c.SetIntermediateCertificate(context.TODO(), nil, admin))
+
+	csr, csrQuote, err := c.GetIntermediateCSR(context.TODO(), admin)
+	require.NoError(err)
+	assert.NotEmpty(csrQuote)
+	certChain := signCSR(csr)
+
+	// a chain issued for another key is rejected
+	otherCSR, _, err := c.GetIntermediateCSR(context.TODO(), admin)
+	require.NoError(err)
+	assert.Error(c.SetIntermediateCertificate(context.TODO(), certChain, admin))
+	// the chain must contain the root of the external CA
+	certChain = signCSR(otherCSR)
+	block, _ := pem.Decode(certChain)
+	assert.Error(c.SetIntermediateCertificate(context.TODO(), pem.EncodeToMemory(block), admin))
+	assert.Error(c.SetIntermediateCertificate(context.TODO(), certChain, user.NewUser("other", nil)))
+	require.NoError(c.SetIntermediateCertificate(context.TODO(), certChain, admin))
+	// the CSR is not pending anymore
+	assert.Error(c.SetIntermediateCertificate(context.TODO(), certChain, admin))
+
+	// the chain starts with the externally issued intermediate and ends with the Coordinator root
+	chain, _, err := c.GetCertQuote(context.TODO())
+	require.NoError(err)
+	certs := mustParsePEMChain(t, chain)
+	require.Len(certs, 4)
+	assert.Equal(block.Bytes, certs[0].Raw)
+	assert.Equal(extRoot.Raw, certs[1].Raw)
+	assert.Equal(coordinatorRoot.Raw, certs[3].Raw)
+
+	// certificates of secrets chain to both the external root and the Coordinator root
+	secret, err := c.data.getSecret("cert_shared")
+	require.NoError(err)
+	secretCert := x509.Certificate(secret.Cert)
+	for _, root := range []*x509.Certificate{extRoot, coordinatorRoot} {
+		roots := x509.NewCertPool()
+		roots.AddCert(root)
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(certs[0])
+		intermediates.AddCert(certs[2])
+		_, err = secretCert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		assert.NoError(err)
+	}
+	marbleRootCert, err := c.data.getCertificate(sKMarbleRootCert)
+	require.NoError(err)
+	assert.Equal(certs[0].Raw, marbleRootCert.Raw)
+
+	// the intermediate CA issued by the external CA is kept across updates and root CA rotations
+	require.NoError(c.UpdateManifest(context.TODO(), []byte(test.UpdateManifest), admin))
+	chain, _, err = c.GetCertQuote(context.TODO())
+	require.NoError(err)
+	certs = mustParsePEMChain(t, chain)
+	require.Len(certs, 4)
+	assert.Equal(block.Bytes, certs[0].Raw)
+	assert.Equal(extRoot.Raw, certs[1].Raw)
+
+	require.NoError(c.RotateRootCA(context.TODO(), admin))
+	chain, _, err = c.GetCertQuote(context.TODO())
+	require.NoError(err)
+	certs = mustParsePEMChain(t, chain)
+	require.True(len(certs) >= 4)
+	assert.Equal(block.Bytes, certs[0].Raw)
+	assert.Equal(extRoot.Raw, certs[1].Raw)
+	newCoordinatorRoot, err := c.data.getCertificate(sKCoordinatorRootCert)
+	require.NoError(err)
+	assert.NoError(certs[2].CheckSignatureFrom(newCoordinatorRoot))
+
+	// regenerated certificates of secrets still chain to the external root
+	secret, err = c.data.getSecret("cert_shared")
+	require.NoError(err)
+	secretCert = x509.Certificate(secret.Cert)
+	roots := x509.NewCertPool()
+	roots.AddCert(extRoot)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(certs[0])
+	_, err = secretCert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	assert.NoError(err)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/store"
+)
+
+// errIssuerNotSet is returned if the issuer of a secret has not been generated or uploaded yet
+var errIssuerNotSet = errors.New("issuer is not set")
+
+// lookupIssuer returns the secret used to sign another secret's certificate.
+// It is looked up in the newly generated secrets, then in the given secrets and finally in the store.
+func (c *Core) lookupIssuer(issuerName string, newSecrets, secrets map[string]manifest.Secret) (manifest.Secret, error) {
+	if issuer, ok := newSecrets[issuerName]; ok && len(issuer.Private) > 0 {
+		return issuer, nil
+	}
+	if issuer, ok := secrets[issuerName]; ok && len(issuer.Private) > 0 {
+		return issuer, nil
+	}
+	issuer, err := c.data.getSecret(issuerName)
+	if err != nil && !store.IsStoreValueUnsetError(err) {
+		return manifest.Secret{}, err
+	}
+	if err != nil || len(issuer.Private) <= 0 {
+		return manifest.Secret{}, fmt.Errorf("%w: %s", errIssuerNotSet, issuerName)
+	}
+	return issuer, nil
+}
+
+// certificateIssuer returns the certificate and private key used to sign the certificate of a secret.
+// These are the given parent certificate and key, unless the secret specifies an issuer.
+func (c *Core) certificateIssuer(secret manifest.Secret, newSecrets, secrets map[string]manifest.Secret, parentCertificate *x509.Certificate, parentPrivKey crypto.PrivateKey) (*x509.Certificate, crypto.PrivateKey, error) {
+	if secret.Issuer == "" || !strings.HasPrefix(secret.Type, "cert-") {
+		return parentCertificate, parentPrivKey, nil
+	}
+
+	issuer, err := c.lookupIssuer(secret.Issuer, newSecrets, secrets)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(issuer.Cert.Raw) <= 0 {
+		return nil, nil, fmt.Errorf("%w: %s has no certificate", errIssuerNotSet, secret.Issuer)
+	}
+
+	// the certificates of user-defined issuers can only be checked now
+	issuerCert := x509.Certificate(issuer.Cert)
+	if !issuerCert.BasicConstraintsValid || !issuerCert.IsCA {
+		return nil, nil, fmt.Errorf("issuer %s is not a CA", secret.Issuer)
+	}
+	if issuerCert.KeyUsage != 0 && issuerCert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, nil, fmt.Errorf("issuer %s is not allowed to sign certificates", secret.Issuer)
+	}
+	if secret.Cert.IsCA && issuerCert.MaxPathLen == 0 && issuerCert.MaxPathLenZero {
+		return nil, nil, fmt.Errorf("issuer %s does not allow intermediate CAs", secret.Issuer)
+	}
+
+	issuerPrivKey, err := issuer.ParsePrivateKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing private key of issuer %s: %w", secret.Issuer, err)
+	}
+	return &issuerCert, issuerPrivKey, nil
+}
+
+// verifyIssuedCertificate verifies that the certificate generated for a secret chains up to the certificate of its issuer
+func verifyIssuedCertificate(name string, secret manifest.Secret, issuerCertificate *x509.Certificate) error {
+	if secret.Issuer == "" || len(secret.Cert.Raw) <= 0 {
+		return nil
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(issuerCertificate)
+	cert := x509.Certificate(secret.Cert)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return fmt.Errorf("verifying certificate of secret %s issued by %s: %w", name, secret.Issuer, err)
+	}
+	return nil
+}
+
+// sortSecretsByIssuer returns the names of the secrets ordered so that issuers come before the secrets they sign
+func sortSecretsByIssuer(secrets map[string]manifest.Secret) []string {
+	depths := make(map[string]int)
+	var names []string
+	for name := range secrets {
+		depth := 0
+		// the manifest check rejects cycles, but do not rely on it here
+		for issuer := secrets[name].Issuer; issuer != "" && depth <= len(secrets); depth++ {
+			issuer = secrets[issuer].Issuer
+		}
+		depths[name] = depth
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if depths[names[i]] != depths[names[j]] {
+			return depths[names[i]] < depths[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
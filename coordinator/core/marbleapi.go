@@ -13,10 +13,13 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"math"
+	"net/url"
 	"text/template"
 	"time"
 
@@ -24,6 +27,7 @@ import (
 	"github.com/edgelesssys/marblerun/coordinator/manifest"
 	"github.com/edgelesssys/marblerun/coordinator/quote"
 	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/edgelesssys/marblerun/coordinator/spiffe"
 	"github.com/edgelesssys/marblerun/coordinator/store"
 	"github.com/edgelesssys/marblerun/util"
 	"github.com/google/uuid"
@@ -32,18 +36,6 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-type reservedSecrets struct {
-	RootCA     manifest.Secret
-	MarbleCert manifest.Secret
-	SealKey    manifest.Secret
-}
-
-// Defines the "Marblerun" prefix when mentioned in a manifest
-type secretsWrapper struct {
-	Marblerun reservedSecrets
-	Secrets   map[string]manifest.Secret
-}
-
 // Activate implements the MarbleAPI function to authenticate a marble (implements the MarbleServer interface)
 //
 // Verifies the marble's integrity and subsequently provides the marble with a certificate for authentication and application-specific parameters as defined in the Coordinator's manifest.
@@ -74,6 +66,11 @@ func (c *Core) Activate(ctx context.Context, req *rpc.ActivationReq) (*rpc.Activ
 	if err != nil {
 		return nil, err
 	}
+	if _, err := c.data.getRevokedMarble(marbleUUID.String()); err == nil {
+		return nil, status.Error(codes.PermissionDenied, "marble was revoked")
+	} else if !store.IsStoreValueUnsetError(err) {
+		return nil, err
+	}
 
 	// Generate marble authentication secrets
 	authSecrets, err := c.generateMarbleAuthSecrets(req, marbleUUID)
@@ -91,6 +88,15 @@ func (c *Core) Activate(ctx context.Context, req *rpc.ActivationReq) (*rpc.Activ
 		c.zaplogger.Error("Could not retrieve marbleRootCert private key.", zap.Error(err))
 	}
 
+	// Secrets of external secret providers are refreshed in the background, reject the activation if a required refresh failed
+	mnf, err := c.data.getManifest()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkRemoteSecrets(mnf); err != nil {
+		return nil, err
+	}
+
 	secrets, err := c.data.getSecretMap()
 	if err != nil {
 		return nil, err
@@ -108,6 +114,29 @@ func (c *Core) Activate(ctx context.Context, req *rpc.ActivationReq) (*rpc.Activ
 		secrets[k] = v
 	}
 
+	// Union secrets shared by all Marbles of this type
+	marbleTypeSecrets, err := c.data.getMarbleTypeSecretMap(req.MarbleType)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range marbleTypeSecrets {
+		secrets[k] = v
+	}
+
+	// Union secrets derived from user-defined master keys
+	derivedSecrets, err := c.deriveSecrets(mnf.Secrets, req.MarbleType, marbleUUID)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range derivedSecrets {
+		secrets[k] = v
+	}
+
+	// Make the previous version of shared and user-defined secrets available during rotation overlaps
+	if err := c.setPreviousSecrets(secrets); err != nil {
+		return nil, err
+	}
+
 	marble, err := c.data.getMarble(req.MarbleType)
 	if err != nil {
 		return nil, err
@@ -116,17 +145,44 @@ func (c *Core) Activate(ctx context.Context, req *rpc.ActivationReq) (*rpc.Activ
 		marble.Parameters = &rpc.Parameters{}
 	}
 
+	// only expose the secrets the marble is allowed to access
+	if marble.Secrets != nil {
+		permittedSecrets := make(map[string]manifest.Secret)
+		for _, name := range marble.Secrets {
+			if secret, ok := secrets[name]; ok {
+				permittedSecrets[name] = secret
+			}
+		}
+		secrets = permittedSecrets
+	}
+	// transit-only secrets never leave the Coordinator
+	for name := range secrets {
+		if mnf.Secrets[name].TransitOnly {
+			delete(secrets, name)
+		}
+	}
+
 	// add TTLS config to Env
 	if err := c.setTTLSConfig(marble, authSecrets, secrets); err != nil {
 		c.zaplogger.Error("Could not create TTLS config.", zap.Error(err))
 		return nil, err
 	}
 
-	params, err := customizeParameters(marble.Parameters, authSecrets, secrets)
+	marbleMetadata, err := c.generateMarbleMetadata(req, marbleUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := customizeParameters(marble.Parameters, authSecrets, secrets, marbleMetadata)
 	if err != nil {
 		c.zaplogger.Error("Could not customize parameters.", zap.Error(err))
 		return nil, err
 	}
+	if c.caConfig.SPIFFETrustDomain != "" {
+		if err := c.setSPIFFEEnvironment(params, authSecrets.MarbleCert.Cert); err != nil {
+			return nil, err
+		}
+	}
 
 	// write response
 	resp := &rpc.ActivationResp{
@@ -143,6 +199,12 @@ func (c *Core) Activate(ctx context.Context, req *rpc.ActivationReq) (*rpc.Activ
 		c.zaplogger.Error("Could not increment activations.", zap.Error(err))
 		return nil, err
 	}
+	if err := (storeWrapper{tx}).putActivatedMarble(marbleUUID.String(), req.GetMarbleType()); err != nil {
+		return nil, err
+	}
+	if err := (storeWrapper{tx}).putActivationKey(marbleUUID.String(), authSecrets.MarbleCert.Cert.RawSubjectPublicKeyInfo); err != nil {
+		return nil, err
+	}
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
@@ -152,6 +214,224 @@ func (c *Core) Activate(ctx context.Context, req *rpc.ActivationReq) (*rpc.Activ
 	return resp, nil
 }
 
+// IssueCertificate implements the MarbleAPI function to issue additional certificates for activated marbles (implements the MarbleServer interface)
+//
+// The marble authenticates with the certificate it received on activation.
+// The requested certificate is checked against the certificate policy of the marble's type in the manifest.
+func (c *Core) IssueCertificate(ctx context.Context, req *rpc.IssueCertificateReq) (*rpc.IssueCertificateResp, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "cannot accept marbles in current state")
+	}
+
+	marbleUUID, marbleType, err := c.verifyActivatedMarble(getClientTLSCert(ctx))
+	if err != nil {
+		return nil, err
+	}
+	marble, err := c.data.getMarble(marbleType)
+	if err != nil {
+		return nil, err
+	}
+	if marble.CertificatePolicy == nil {
+		return nil, status.Errorf(codes.PermissionDenied, "marble type %s is not allowed to request certificates", marbleType)
+	}
+	policy := *marble.CertificatePolicy
+
+	template, pubKey, err := certificateTemplateFromRequest(req, policy)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	marbleRootCert, err := c.data.getCertificate(sKMarbleRootCert)
+	if err != nil {
+		return nil, err
+	}
+	intermediatePrivK, err := c.data.getPrivK(sKCoordinatorIntermediateKey)
+	if err != nil {
+		return nil, err
+	}
+	certRaw, err := x509.CreateCertificate(rand.Reader, template, marbleRootCert, pubKey, intermediatePrivK)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to issue certificate")
+	}
+
+	c.zaplogger.Info("Issued certificate for Marble", zap.String("MarbleType", marbleType), zap.String("UUID", marbleUUID), zap.Strings("DNSNames", template.DNSNames), zap.Time("NotAfter", template.NotAfter))
+	return &rpc.IssueCertificateResp{Certificate: certRaw}, nil
+}
+
+// verifyActivatedMarble verifies the certificate of an activated marble and returns its UUID and type
+func (c *Core) verifyActivatedMarble(tlsCert *x509.Certificate) (string, string, error) {
+	if tlsCert == nil {
+		return "", "", status.Error(codes.Unauthenticated, "couldn't get marble TLS certificate")
+	}
+	marbleRootCert, err := c.data.getCertificate(sKMarbleRootCert)
+	if err != nil {
+		return "", "", err
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(marbleRootCert)
+	if _, err := tlsCert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		return "", "", status.Error(codes.Unauthenticated, "marble certificate was not issued by the Coordinator")
+	}
+
+	marbleUUID := tlsCert.Subject.CommonName
+	marbleType, err := c.data.getActivatedMarble(marbleUUID)
+	if store.IsStoreValueUnsetError(err) {
+		return "", "", status.Error(codes.Unauthenticated, "marble was not activated")
+	}
+	if err != nil {
+		return "", "", err
+	}
+	// certificates issued at runtime chain to the same root, only the activation certificate authenticates the marble
+	activationKey, err := c.data.getActivationKey(marbleUUID)
+	if err != nil && !store.IsStoreValueUnsetError(err) {
+		return "", "", err
+	}
+	if !bytes.Equal(activationKey, tlsCert.RawSubjectPublicKeyInfo) {
+		return "", "", status.Error(codes.Unauthenticated, "marble certificate is not the certificate issued on activation")
+	}
+	if _, err := c.data.getRevokedMarble(marbleUUID); err == nil {
+		return "", "", status.Error(codes.PermissionDenied, "marble was revoked")
+	} else if !store.IsStoreValueUnsetError(err) {
+		return "", "", err
+	}
+	return marbleUUID, marbleType, nil
+}
+
+// certificateTemplateFromRequest creates the template for a certificate requested by a marble, if its certificate policy permits it
+func certificateTemplateFromRequest(req *rpc.IssueCertificateReq, policy manifest.CertificatePolicy) (*x509.Certificate, interface{}, error) {
+	csr, err := x509.ParseCertificateRequest(req.GetCSR())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CSR: %v", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, errors.New("signature over CSR is invalid")
+	}
+	if len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return nil, nil, errors.New("only DNS names and IP addresses can be requested")
+	}
+	if csr.Subject.CommonName != "" && (isUUID(csr.Subject.CommonName) || !policy.PermitsDNSName(csr.Subject.CommonName)) {
+		return nil, nil, fmt.Errorf("common name %s is not permitted", csr.Subject.CommonName)
+	}
+	for _, name := range csr.DNSNames {
+		if isUUID(name) || !policy.PermitsDNSName(name) {
+			return nil, nil, fmt.Errorf("DNS name %s is not permitted", name)
+		}
+	}
+	for _, ip := range csr.IPAddresses {
+		if !policy.PermitsIPAddress(ip) {
+			return nil, nil, fmt.Errorf("IP address %s is not permitted", ip)
+		}
+	}
+
+	keyUsageNames := req.GetKeyUsages()
+	if len(keyUsageNames) == 0 {
+		keyUsageNames = policy.AllowedKeyUsages()
+	}
+	keyUsage, err := manifest.ParseKeyUsages(keyUsageNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	allowedKeyUsage, err := manifest.ParseKeyUsages(policy.AllowedKeyUsages())
+	if err != nil {
+		return nil, nil, err
+	}
+	if keyUsage&^allowedKeyUsage != 0 {
+		return nil, nil, fmt.Errorf("key usages %v are not permitted", req.GetKeyUsages())
+	}
+
+	extKeyUsageNames := req.GetExtKeyUsages()
+	if len(extKeyUsageNames) == 0 {
+		extKeyUsageNames = policy.AllowedExtKeyUsages()
+	}
+	extKeyUsage, err := manifest.ParseExtKeyUsages(extKeyUsageNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	allowedExtKeyUsage, err := manifest.ParseExtKeyUsages(policy.AllowedExtKeyUsages())
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, usage := range extKeyUsage {
+		if !containsExtKeyUsage(allowedExtKeyUsage, usage) {
+			return nil, nil, fmt.Errorf("extended key usages %v are not permitted", req.GetExtKeyUsages())
+		}
+	}
+
+	validFor := uint(req.GetValidForHours())
+	if validFor == 0 {
+		validFor = policy.MaxValidFor()
+	}
+	if validFor > policy.MaxValidFor() {
+		return nil, nil, fmt.Errorf("lifetime of %d hours exceeds the maximum of %d hours", validFor, policy.MaxValidFor())
+	}
+
+	serialNumber, err := util.GenerateCertificateSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	notBefore := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: csr.Subject.CommonName},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(time.Duration(validFor) * time.Hour),
+
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           extKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		DNSNames:              csr.DNSNames,
+		IPAddresses:           csr.IPAddresses,
+	}
+	return template, csr.PublicKey, nil
+}
+
+// isUUID returns true if name has the shape of a UUID, which identifies marbles and can therefore not be requested
+func isUUID(name string) bool {
+	_, err := uuid.Parse(name)
+	return err == nil
+}
+
+// containsExtKeyUsage returns true if usage is one of usages
+func containsExtKeyUsage(usages []x509.ExtKeyUsage, usage x509.ExtKeyUsage) bool {
+	for _, u := range usages {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
+
+// setPreviousSecrets sets the Previous field of every secret to the version before the current one.
+// Secrets without an earlier version refer to their current value, so templates using Previous work right from the start.
+func (c *Core) setPreviousSecrets(secrets map[string]manifest.Secret) error {
+	for name, secret := range secrets {
+		current := secret
+		secret.Previous = &current
+
+		history, err := c.data.getSecretHistory(name)
+		if err != nil && !store.IsStoreValueUnsetError(err) {
+			return err
+		}
+		// deletions have no value and are skipped
+		var values []manifest.SecretVersion
+		for _, version := range history {
+			if !version.Deleted {
+				values = append(values, version)
+			}
+		}
+		// the latest value of the history is the current value, unless the secret was deleted afterwards
+		if len(values) > 0 && values[len(values)-1].Fingerprint != secret.Fingerprint() {
+			secret.Previous = values[len(values)-1].Secret
+		} else if len(values) >= 2 {
+			secret.Previous = values[len(values)-2].Secret
+		}
+		secrets[name] = secret
+	}
+	return nil
+}
+
 // verifyManifestRequirement verifies marble attempting to register with respect to manifest
 func (c *Core) verifyManifestRequirement(tlsCert *x509.Certificate, certQuote []byte, marbleType string) error {
 	marble, err := c.data.getMarble(marbleType)
@@ -259,6 +539,10 @@ func (c *Core) generateCertFromCSR(csrReq []byte, pubk ecdsa.PublicKey, marbleTy
 		DNSNames:              csr.DNSNames,
 		IPAddresses:           csr.IPAddresses,
 	}
+	// the marble certificate is an X509-SVID if SPIFFE is enabled
+	if c.caConfig.SPIFFETrustDomain != "" {
+		template.URIs = []*url.URL{spiffe.ID(c.caConfig.SPIFFETrustDomain, marbleType, marbleUUID)}
+	}
 
 	certRaw, err := x509.CreateCertificate(rand.Reader, &template, marbleRootCert, &pubk, intermediatePrivK)
 	if err != nil {
@@ -268,18 +552,38 @@ func (c *Core) generateCertFromCSR(csrReq []byte, pubk ecdsa.PublicKey, marbleTy
 	return certRaw, nil
 }
 
+// generateMarbleMetadata collects the information about a marble's activation which can be used in the manifest's parameters
+func (c *Core) generateMarbleMetadata(req *rpc.ActivationReq, marbleUUID uuid.UUID) (manifest.MarbleMetadata, error) {
+	csr, err := x509.ParseCertificateRequest(req.GetCSR())
+	if err != nil {
+		return manifest.MarbleMetadata{}, status.Error(codes.InvalidArgument, "failed to parse CSR")
+	}
+	rootCert, err := c.data.getCertificate(sKCoordinatorRootCert)
+	if err != nil {
+		return manifest.MarbleMetadata{}, err
+	}
+
+	return manifest.MarbleMetadata{
+		Type:                req.GetMarbleType(),
+		UUID:                marbleUUID.String(),
+		DNSNames:            csr.DNSNames,
+		CoordinatorDNSNames: rootCert.DNSNames,
+		ActivationTime:      time.Now(),
+	}, nil
+}
+
 // customizeParameters replaces the placeholders in the manifest's parameters with the actual values
-func customizeParameters(params *rpc.Parameters, specialSecrets reservedSecrets, userSecrets map[string]manifest.Secret) (*rpc.Parameters, error) {
+func customizeParameters(params *rpc.Parameters, specialSecrets manifest.ReservedSecrets, userSecrets map[string]manifest.Secret, marbleMetadata manifest.MarbleMetadata) (*rpc.Parameters, error) {
 	customParams := rpc.Parameters{
-		Argv:  params.Argv,
 		Files: make(map[string]string),
 		Env:   make(map[string]string),
 	}
 
 	// Wrap the authentication secrets to have the "Marblerun" prefix in front of them when mentioned in a manifest
-	secretsWrapped := secretsWrapper{
+	secretsWrapped := manifest.SecretsWrapper{
 		Marblerun: specialSecrets,
 		Secrets:   userSecrets,
+		Marble:    marbleMetadata,
 	}
 
 	// replace placeholders in files
@@ -301,6 +605,18 @@ func customizeParameters(params *rpc.Parameters, specialSecrets reservedSecrets,
 		customParams.Env[name] = newValue
 	}
 
+	if params.Argv != nil {
+		customParams.Argv = make([]string, len(params.Argv))
+	}
+	for i, data := range params.Argv {
+		newValue, err := parseSecrets(data, secretsWrapped)
+		if err != nil {
+			return nil, err
+		}
+
+		customParams.Argv[i] = newValue
+	}
+
 	// Set as environment variables
 	rootCaPem, err := manifest.EncodeSecretDataToPem(specialSecrets.RootCA.Cert)
 	if err != nil {
@@ -322,7 +638,7 @@ func customizeParameters(params *rpc.Parameters, specialSecrets reservedSecrets,
 	return &customParams, nil
 }
 
-func parseSecrets(data string, secretsWrapped secretsWrapper) (string, error) {
+func parseSecrets(data string, secretsWrapped manifest.SecretsWrapper) (string, error) {
 	var templateResult bytes.Buffer
 
 	tpl, err := template.New("data").Funcs(manifest.ManifestTemplateFuncMap).Parse(data)
@@ -337,60 +653,54 @@ func parseSecrets(data string, secretsWrapped secretsWrapper) (string, error) {
 	return templateResult.String(), nil
 }
 
-func (c *Core) generateMarbleAuthSecrets(req *rpc.ActivationReq, marbleUUID uuid.UUID) (reservedSecrets, error) {
+func (c *Core) generateMarbleAuthSecrets(req *rpc.ActivationReq, marbleUUID uuid.UUID) (manifest.ReservedSecrets, error) {
 	// generate key-pair for marble
 	privk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		return reservedSecrets{}, err
+		return manifest.ReservedSecrets{}, err
 	}
 	encodedPrivKey, err := x509.MarshalPKCS8PrivateKey(privk)
 	if err != nil {
-		return reservedSecrets{}, err
+		return manifest.ReservedSecrets{}, err
 	}
 	encodedPubKey, err := x509.MarshalPKIXPublicKey(&privk.PublicKey)
 	if err != nil {
-		return reservedSecrets{}, err
+		return manifest.ReservedSecrets{}, err
 	}
 
-	// Derive sealing key for marble
-	uuidBytes, err := marbleUUID.MarshalBinary()
-	if err != nil {
-		return reservedSecrets{}, err
-	}
-	rootPrivK, err := c.data.getPrivK(sKCoordinatorRootKey)
-	if err != nil {
-		return reservedSecrets{}, err
-	}
-	sealKey, err := util.DeriveKey(rootPrivK.D.Bytes(), uuidBytes, 32)
+	// Derive sealing keys for marble from all versions of the seal master key
+	sealKeyID, sealKeys, err := c.deriveSealKeys(marbleUUID)
 	if err != nil {
-		return reservedSecrets{}, err
+		return manifest.ReservedSecrets{}, err
 	}
 
 	certRaw, err := c.generateCertFromCSR(req.GetCSR(), privk.PublicKey, req.GetMarbleType(), marbleUUID.String())
 	if err != nil {
-		return reservedSecrets{}, err
+		return manifest.ReservedSecrets{}, err
 	}
 
 	marbleCert, err := x509.ParseCertificate(certRaw)
 	if err != nil {
-		return reservedSecrets{}, err
+		return manifest.ReservedSecrets{}, err
 	}
 
 	marbleRootCert, err := c.data.getCertificate(sKMarbleRootCert)
 	if err != nil {
-		return reservedSecrets{}, err
+		return manifest.ReservedSecrets{}, err
 	}
 	// customize marble's parameters
-	authSecrets := reservedSecrets{
+	authSecrets := manifest.ReservedSecrets{
 		RootCA:     manifest.Secret{Cert: manifest.Certificate(*marbleRootCert)},
 		MarbleCert: manifest.Secret{Cert: manifest.Certificate(*marbleCert), Public: encodedPubKey, Private: encodedPrivKey},
-		SealKey:    manifest.Secret{Public: sealKey, Private: sealKey},
+		SealKey:    sealKeys[sealKeyID],
+		SealKeyID:  sealKeyID,
+		SealKeys:   sealKeys,
 	}
 
 	return authSecrets, nil
 }
 
-func (c *Core) setTTLSConfig(marble manifest.Marble, specialSecrets reservedSecrets, userSecrets map[string]manifest.Secret) error {
+func (c *Core) setTTLSConfig(marble manifest.Marble, specialSecrets manifest.ReservedSecrets, userSecrets map[string]manifest.Secret) error {
 	if len(marble.TLS) == 0 {
 		return nil
 	}
@@ -8,14 +8,20 @@ package core
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"math/big"
+	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -26,6 +32,7 @@ import (
 	"github.com/edgelesssys/marblerun/coordinator/recovery"
 	"github.com/edgelesssys/marblerun/coordinator/rpc"
 	"github.com/edgelesssys/marblerun/coordinator/seal"
+	"github.com/edgelesssys/marblerun/coordinator/user"
 	"github.com/edgelesssys/marblerun/test"
 	"github.com/edgelesssys/marblerun/util"
 	"github.com/google/uuid"
@@ -54,7 +61,7 @@ func TestActivate(t *testing.T) {
 	issuer := quote.NewMockIssuer()
 	sealer := &seal.MockSealer{}
 	recovery := recovery.NewSinglePartyRecovery()
-	coreServer, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, nil)
+	coreServer, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
 	require.NoError(err)
 	require.NotNil(coreServer)
 
@@ -101,6 +108,14 @@ func TestActivate(t *testing.T) {
 	// Check if non-shared secret with the same name is indeed not the same in different marbles
 	assert.EqualValues(spawner.backendFirstSharedCert, spawner.backendOtherSharedCert, "Shared secrets were different across different marbles, but were supposed to be the same.")
 	assert.NotEqualValues(spawner.backendFirstUniqueCert, spawner.backendOtherUniqueCert, "Non-shared secrets were the same across different marbles, but were supposed to be unique.")
+
+	// Check if per-marble-type secrets are the same for all marbles of a type, but differ across types
+	require.Len(spawner.marbleTypeKeys["backend_first"], 1)
+	require.Len(spawner.marbleTypeKeys["backend_other"], 10)
+	for _, key := range spawner.marbleTypeKeys["backend_other"] {
+		assert.Equal(spawner.marbleTypeKeys["backend_other"][0], key, "Per-marble-type secrets were different across marbles of the same type.")
+	}
+	assert.NotEqual(spawner.marbleTypeKeys["backend_first"][0], spawner.marbleTypeKeys["backend_other"][0], "Per-marble-type secrets were the same across different marble types.")
 }
 
 type marbleSpawner struct {
@@ -116,6 +131,7 @@ type marbleSpawner struct {
 	backendFirstUniqueCert x509.Certificate
 	backendOtherSharedCert x509.Certificate
 	backendOtherUniqueCert x509.Certificate
+	marbleTypeKeys         map[string][]string
 }
 
 func (ms *marbleSpawner) newMarble(marbleType string, infraName string, shouldSucceed bool) string {
@@ -166,7 +182,10 @@ func (ms *marbleSpawner) newMarble(marbleType string, infraName string, shouldSu
 		ms.assert.Equal(marble.Parameters.Files, params.Files)
 	}
 	// Validate Argv
-	if marble.Parameters.Argv != nil {
+	if marbleType == "backend_other" {
+		ms.assert.Equal([]string{"serve", "--node-id=" + uuidStr}, params.Argv)
+		ms.assert.Equal(marbleType, params.Env["TEST_MARBLE_TYPE"])
+	} else if marble.Parameters.Argv != nil {
 		ms.assert.Equal(marble.Parameters.Argv, params.Argv)
 	}
 
@@ -235,6 +254,17 @@ func (ms *marbleSpawner) newMarble(marbleType string, infraName string, shouldSu
 	_, err = newLeafCert.Verify(opts)
 	ms.assert.NoError(err, "failed to verify new certificate: %v", err)
 
+	// Per-marble-type secret checks
+	if marbleType == "backend_first" || marbleType == "backend_other" {
+		ms.assert.Len(params.Env["TEST_SECRET_MARBLE_TYPE_KEY"], 32)
+		ms.mutex.Lock()
+		if ms.marbleTypeKeys == nil {
+			ms.marbleTypeKeys = make(map[string][]string)
+		}
+		ms.marbleTypeKeys[marbleType] = append(ms.marbleTypeKeys[marbleType], params.Env["TEST_SECRET_MARBLE_TYPE_KEY"])
+		ms.mutex.Unlock()
+	}
+
 	// Shared & non-shared secret checks
 	if marbleType == "backend_first" {
 		// Validate generated shared secret certificate
@@ -361,13 +391,13 @@ func TestParseSecrets(t *testing.T) {
 		"emptysecret":       {},
 	}
 
-	testReservedSecrets := reservedSecrets{
+	testReservedSecrets := manifest.ReservedSecrets{
 		RootCA:     manifest.Secret{Public: []byte{0, 0, 42}, Private: []byte{0, 0, 7}},
 		MarbleCert: manifest.Secret{Public: []byte{42, 0, 0}, Private: []byte{7, 0, 0}},
 		SealKey:    manifest.Secret{Public: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, Private: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
 	}
 
-	testWrappedSecrets := secretsWrapper{
+	testWrappedSecrets := manifest.SecretsWrapper{
 		Marblerun: testReservedSecrets,
 		Secrets:   testSecrets,
 	}
@@ -441,6 +471,78 @@ func TestParseSecrets(t *testing.T) {
 	assert.Error(err)
 }
 
+func TestCustomizeParameters(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	activationTime := time.Date(2021, time.June, 23, 7, 50, 11, 0, time.UTC)
+	metadata := manifest.MarbleMetadata{
+		Type:                "backend",
+		UUID:                "bba2e9a6-fb1b-4a49-9ba4-77a3ddbf6d15",
+		DNSNames:            []string{"backend.local", "localhost"},
+		CoordinatorDNSNames: []string{"coordinator.local"},
+		ActivationTime:      activationTime,
+	}
+	reserved := manifest.ReservedSecrets{
+		RootCA:     manifest.Secret{Cert: manifest.Certificate{Raw: []byte{1}}},
+		MarbleCert: manifest.Secret{Cert: manifest.Certificate{Raw: []byte{2}}, Private: []byte{3}},
+	}
+	secrets := map[string]manifest.Secret{
+		"foo": {Public: []byte("bar")},
+	}
+	params := &rpc.Parameters{
+		Env: map[string]string{
+			"TYPE":        "{{ .Marble.Type }}",
+			"DNS":         "{{ range .Marble.DNSNames }}{{ . }} {{ end }}",
+			"COORDINATOR": "{{ index .Marble.CoordinatorDNSNames 0 }}",
+			"TIME":        "{{ .Marble.ActivationTime.Unix }}",
+		},
+		Argv: []string{"serve", "--node-id={{ .Marble.UUID }}", "--key={{ raw .Secrets.foo }}"},
+	}
+
+	customParams, err := customizeParameters(params, reserved, secrets, metadata)
+	require.NoError(err)
+	assert.Equal([]string{"serve", "--node-id=bba2e9a6-fb1b-4a49-9ba4-77a3ddbf6d15", "--key=bar"}, customParams.Argv)
+	assert.Equal("backend", customParams.Env["TYPE"])
+	assert.Equal("backend.local localhost ", customParams.Env["DNS"])
+	assert.Equal("coordinator.local", customParams.Env["COORDINATOR"])
+	assert.Equal(strconv.FormatInt(activationTime.Unix(), 10), customParams.Env["TIME"])
+}
+
+func TestSetPreviousSecrets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+
+	// without a previous version, Previous refers to the current value
+	secrets, err := c.data.getSecretMap()
+	require.NoError(err)
+	require.NoError(c.setPreviousSecrets(secrets))
+	assert.Equal(secrets["cert_shared"].Cert.Raw, secrets["cert_shared"].Previous.Cert.Raw)
+
+	// after a rotation, Previous refers to the old value
+	require.NoError(c.RotateSecrets(context.TODO(), []string{"cert_shared"}, admin))
+	rotated, err := c.data.getSecretMap()
+	require.NoError(err)
+	require.NoError(c.setPreviousSecrets(rotated))
+	assert.NotEqual(rotated["cert_shared"].Cert.Raw, rotated["cert_shared"].Previous.Cert.Raw)
+	assert.Equal(secrets["cert_shared"].Cert.Raw, rotated["cert_shared"].Previous.Cert.Raw)
+
+	wrapped := manifest.SecretsWrapper{Secrets: rotated}
+	previousPem, err := parseSecrets("{{ pem .Secrets.cert_shared.Previous.Cert }}", wrapped)
+	require.NoError(err)
+	currentPem, err := parseSecrets("{{ pem .Secrets.cert_shared.Cert }}", wrapped)
+	require.NoError(err)
+	assert.NotEqual(currentPem, previousPem)
+	_, err = parseSecrets("{{ raw .Secrets.symmetric_key_shared.Previous }}", wrapped)
+	assert.NoError(err)
+}
+
 func TestSecurityLevelUpdate(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -459,7 +561,7 @@ func TestSecurityLevelUpdate(t *testing.T) {
 	issuer := quote.NewMockIssuer()
 	sealer := &seal.MockSealer{}
 	recovery := recovery.NewSinglePartyRecovery()
-	coreServer, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, nil)
+	coreServer, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
 	require.NoError(err)
 	require.NotNil(coreServer)
 
@@ -489,7 +591,7 @@ func TestSecurityLevelUpdate(t *testing.T) {
 	spawner.newMarble("frontend", "Azure", false)
 
 	// Use a new core and test if updated manifest persisted after restart
-	coreServer2, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, nil)
+	coreServer2, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
 	require.NoError(err)
 	coreServer2State, err := coreServer2.data.getState()
 	assert.NoError(err)
@@ -574,7 +676,7 @@ func TestActivateWithMissingParameters(t *testing.T) {
 	issuer := quote.NewMockIssuer()
 	sealer := &seal.MockSealer{}
 	recovery := recovery.NewSinglePartyRecovery()
-	coreServer, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, nil)
+	coreServer, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
 	require.NoError(err)
 	require.NotNil(coreServer)
 
@@ -592,3 +694,192 @@ func TestActivateWithMissingParameters(t *testing.T) {
 
 	spawner.shortMarbleActivation("frontend", "Azure", true)
 }
+
+func TestIssueCertificate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rawManifest := strings.Replace(test.ManifestJSONMissingParameters, `"Package": "frontend"`, `"Package": "frontend",
+			"CertificatePolicy": {
+				"DNSNames": ["*.tenants.example.com"],
+				"IPRanges": ["10.0.0.0/8"],
+				"KeyUsages": ["DigitalSignature", "KeyEncipherment"],
+				"ExtKeyUsages": ["ServerAuth"],
+				"MaxValidForHours": 48
+			}`, 1)
+	var mnf manifest.Manifest
+	require.NoError(json.Unmarshal([]byte(rawManifest), &mnf))
+
+	validator := quote.NewMockValidator()
+	issuer := quote.NewMockIssuer()
+	zapLogger, err := zap.NewDevelopment()
+	require.NoError(err)
+	defer zapLogger.Sync()
+	coreServer, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, &seal.MockSealer{}, recovery.NewSinglePartyRecovery(), zapLogger, nil)
+	require.NoError(err)
+	_, err = coreServer.SetManifest(context.TODO(), []byte(rawManifest))
+	require.NoError(err)
+
+	// activate a marble
+	cert, csr, _ := util.MustGenerateTestMarbleCredentials()
+	quote, err := issuer.Issue(cert.Raw)
+	require.NoError(err)
+	validator.AddValidQuote(quote, cert.Raw, mnf.Packages["frontend"], mnf.Infrastructures["Azure"])
+	resp, err := coreServer.Activate(peerContext(cert), &rpc.ActivationReq{
+		CSR:        csr,
+		MarbleType: "frontend",
+		Quote:      quote,
+		UUID:       uuid.New().String(),
+	})
+	require.NoError(err)
+	pMarbleCert, _ := pem.Decode([]byte(resp.GetParameters().Env[libMarble.MarbleEnvironmentCertificateChain]))
+	require.NotNil(pMarbleCert)
+	marbleCert, err := x509.ParseCertificate(pMarbleCert.Bytes)
+	require.NoError(err)
+
+	privK, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	newCSR := func(template x509.CertificateRequest) []byte {
+		csr, err := x509.CreateCertificateRequest(rand.Reader, &template, privK)
+		require.NoError(err)
+		return csr
+	}
+	validCSR := newCSR(x509.CertificateRequest{
+		DNSNames:    []string{"a.tenants.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.1.2.3")},
+	})
+
+	// the marble authenticates with its activation certificate
+	_, err = coreServer.IssueCertificate(context.TODO(), &rpc.IssueCertificateReq{CSR: validCSR})
+	assert.Error(err)
+	_, err = coreServer.IssueCertificate(peerContext(cert), &rpc.IssueCertificateReq{CSR: validCSR})
+	assert.Error(err)
+
+	certResp, err := coreServer.IssueCertificate(peerContext(marbleCert), &rpc.IssueCertificateReq{CSR: validCSR})
+	require.NoError(err)
+	issuedCert, err := x509.ParseCertificate(certResp.GetCertificate())
+	require.NoError(err)
+	assert.Equal([]string{"a.tenants.example.com"}, issuedCert.DNSNames)
+	assert.Equal(x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment, issuedCert.KeyUsage)
+	assert.Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, issuedCert.ExtKeyUsage)
+	assert.True(issuedCert.NotAfter.Before(time.Now().Add(48*time.Hour + time.Minute)))
+	marbleRootCert, err := coreServer.data.getCertificate(sKMarbleRootCert)
+	require.NoError(err)
+	roots := x509.NewCertPool()
+	roots.AddCert(marbleRootCert)
+	_, err = issuedCert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "a.tenants.example.com"})
+	assert.NoError(err)
+
+	// requests exceeding the policy are rejected
+	invalidRequests := []*rpc.IssueCertificateReq{
+		{CSR: newCSR(x509.CertificateRequest{DNSNames: []string{"tenants.example.com"}})},
+		{CSR: newCSR(x509.CertificateRequest{IPAddresses: []net.IP{net.ParseIP("192.168.0.1")}})},
+		{CSR: newCSR(x509.CertificateRequest{Subject: pkix.Name{CommonName: "example.com"}})},
+		{CSR: newCSR(x509.CertificateRequest{EmailAddresses: []string{"admin@example.com"}})},
+		{CSR: validCSR, KeyUsages: []string{"KeyAgreement"}},
+		{CSR: validCSR, ExtKeyUsages: []string{"ClientAuth"}},
+		{CSR: validCSR, ValidForHours: 49},
+		{CSR: []byte("invalid")},
+	}
+	for _, req := range invalidRequests {
+		_, err = coreServer.IssueCertificate(peerContext(marbleCert), req)
+		assert.Error(err)
+	}
+
+	// names of the shape of a marble UUID are never issued, even if the policy permits them
+	wildcardPolicy := manifest.CertificatePolicy{DNSNames: []string{"*"}}
+	_, _, err = certificateTemplateFromRequest(&rpc.IssueCertificateReq{CSR: newCSR(x509.CertificateRequest{DNSNames: []string{"www"}})}, wildcardPolicy)
+	assert.NoError(err)
+	_, _, err = certificateTemplateFromRequest(&rpc.IssueCertificateReq{CSR: newCSR(x509.CertificateRequest{Subject: pkix.Name{CommonName: marbleCert.Subject.CommonName}})}, wildcardPolicy)
+	assert.Error(err)
+	_, _, err = certificateTemplateFromRequest(&rpc.IssueCertificateReq{CSR: newCSR(x509.CertificateRequest{DNSNames: []string{marbleCert.Subject.CommonName}})}, wildcardPolicy)
+	assert.Error(err)
+
+	// client certificates must be permitted explicitly
+	_, _, err = certificateTemplateFromRequest(&rpc.IssueCertificateReq{CSR: validCSR, ExtKeyUsages: []string{"ClientAuth"}}, wildcardPolicy)
+	assert.Error(err)
+
+	// only the activation certificate authenticates the marble, not other certificates for its UUID chaining to the same root
+	intermediatePrivK, err := coreServer.data.getPrivK(sKCoordinatorIntermediateKey)
+	require.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: marbleCert.Subject.CommonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	rawImpostorCert, err := x509.CreateCertificate(rand.Reader, template, marbleRootCert, &privK.PublicKey, intermediatePrivK)
+	require.NoError(err)
+	impostorCert, err := x509.ParseCertificate(rawImpostorCert)
+	require.NoError(err)
+	_, _, err = coreServer.verifyActivatedMarble(impostorCert)
+	assert.Error(err)
+	_, err = coreServer.IssueCertificate(peerContext(impostorCert), &rpc.IssueCertificateReq{CSR: validCSR})
+	assert.Error(err)
+}
+
+func TestRevokeMarble(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rawManifest := mustAddAdminRoles(test.ManifestJSONWithRecoveryKey, map[string]manifest.Role{
+		"marble_revoker": {ResourceType: "Marbles", ResourceNames: []string{"frontend"}, Actions: []string{"RevokeMarble"}},
+	})
+	var mnf manifest.Manifest
+	require.NoError(json.Unmarshal(rawManifest, &mnf))
+
+	validator := quote.NewMockValidator()
+	issuer := quote.NewMockIssuer()
+	zapLogger, err := zap.NewDevelopment()
+	require.NoError(err)
+	defer zapLogger.Sync()
+	coreServer, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, &seal.MockSealer{}, recovery.NewSinglePartyRecovery(), zapLogger, nil)
+	require.NoError(err)
+	_, err = coreServer.SetManifest(context.TODO(), rawManifest)
+	require.NoError(err)
+	admin, err := coreServer.data.getUser("admin")
+	require.NoError(err)
+
+	// activate a marble
+	cert, csr, _ := util.MustGenerateTestMarbleCredentials()
+	quote, err := issuer.Issue(cert.Raw)
+	require.NoError(err)
+	validator.AddValidQuote(quote, cert.Raw, mnf.Packages["frontend"], mnf.Infrastructures["Azure"])
+	activationReq := &rpc.ActivationReq{
+		CSR:        csr,
+		MarbleType: "frontend",
+		Quote:      quote,
+		UUID:       uuid.New().String(),
+	}
+	resp, err := coreServer.Activate(peerContext(cert), activationReq)
+	require.NoError(err)
+	pMarbleCert, _ := pem.Decode([]byte(resp.GetParameters().Env[libMarble.MarbleEnvironmentCertificateChain]))
+	require.NotNil(pMarbleCert)
+	marbleCert, err := x509.ParseCertificate(pMarbleCert.Bytes)
+	require.NoError(err)
+
+	_, _, err = coreServer.verifyActivatedMarble(marbleCert)
+	require.NoError(err)
+
+	// only users with the RevokeMarble permission may revoke activated marbles
+	assert.Error(coreServer.RevokeMarble(context.TODO(), activationReq.UUID, user.NewUser("invalid", nil)))
+	assert.Error(coreServer.RevokeMarble(context.TODO(), uuid.New().String(), admin))
+	require.NoError(coreServer.RevokeMarble(context.TODO(), activationReq.UUID, admin))
+
+	// a revoked marble can neither use its certificate nor be activated again
+	_, _, err = coreServer.verifyActivatedMarble(marbleCert)
+	assert.Error(err)
+	_, err = coreServer.Activate(peerContext(cert), activationReq)
+	assert.Error(err)
+}
+
+func peerContext(cert *x509.Certificate) context.Context {
+	return peer.NewContext(context.TODO(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+			},
+		},
+	})
+}
@@ -16,6 +16,7 @@ import (
 type coreMetrics struct {
 	coordinatorState prometheus.GaugeFunc
 	marbleAPI        *marbleAPIMetrics
+	secretRotation   *secretRotationMetrics
 }
 
 func newCoreMetrics(factory *promauto.Factory, core *Core, namespace string) *coreMetrics {
@@ -23,6 +24,7 @@ func newCoreMetrics(factory *promauto.Factory, core *Core, namespace string) *co
 		return &coreMetrics{
 			coordinatorState: nil,
 			marbleAPI:        newNullMarbleAPIMetrics(),
+			secretRotation:   newNullSecretRotationMetrics(),
 		}
 	}
 	return &coreMetrics{
@@ -39,7 +41,8 @@ func newCoreMetrics(factory *promauto.Factory, core *Core, namespace string) *co
 				}
 				return float64(state)
 			}),
-		marbleAPI: newMarbleAPIMetrics(factory, namespace),
+		marbleAPI:      newMarbleAPIMetrics(factory, namespace),
+		secretRotation: newSecretRotationMetrics(factory, namespace),
 	}
 }
 
@@ -76,6 +79,39 @@ func newNullMarbleAPIMetrics() *marbleAPIMetrics {
 	}
 }
 
+type secretRotationMetrics struct {
+	expiry    GaugeVec
+	rotations CounterVec
+}
+
+func newSecretRotationMetrics(factory *promauto.Factory, namespace string) *secretRotationMetrics {
+	return &secretRotationMetrics{
+		expiry: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "secret_expiry_timestamp_seconds",
+				Help:      "Expiry date of shared certificate secrets as Unix timestamp.",
+			},
+			[]string{"name"},
+		),
+		rotations: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "secret_rotations_total",
+				Help:      "Number of automatic rotations of shared certificate secrets.",
+			},
+			[]string{"name"},
+		),
+	}
+}
+
+func newNullSecretRotationMetrics() *secretRotationMetrics {
+	return &secretRotationMetrics{
+		expiry:    NullGaugeVec{},
+		rotations: NullCounterVec{},
+	}
+}
+
 type NullCollector struct{}
 
 func (NullCollector) Describe(chan<- *prometheus.Desc) {}
@@ -94,6 +130,18 @@ type NullCounter struct {
 func (NullCounter) Inc()        {}
 func (NullCounter) Add(float64) {}
 
+type NullGauge struct {
+	NullMetric
+	NullCollector
+}
+
+func (NullGauge) Set(float64)       {}
+func (NullGauge) Inc()              {}
+func (NullGauge) Dec()              {}
+func (NullGauge) Add(float64)       {}
+func (NullGauge) Sub(float64)       {}
+func (NullGauge) SetToCurrentTime() {}
+
 type BaseVec interface {
 	prometheus.Collector
 
@@ -129,3 +177,25 @@ func (NullCounterVec) GetMetricWithLabelValues(lvs ...string) (prometheus.Counte
 }
 func (NullCounterVec) With(labels prometheus.Labels) prometheus.Counter { return NullCounter{} }
 func (NullCounterVec) WithLabelValues(lvs ...string) prometheus.Counter { return NullCounter{} }
+
+type GaugeVec interface {
+	BaseVec
+
+	GetMetricWith(labels prometheus.Labels) (prometheus.Gauge, error)
+	GetMetricWithLabelValues(lvs ...string) (prometheus.Gauge, error)
+	With(labels prometheus.Labels) prometheus.Gauge
+	WithLabelValues(lvs ...string) prometheus.Gauge
+}
+
+type NullGaugeVec struct {
+	NullBaseVec
+}
+
+func (NullGaugeVec) GetMetricWith(labels prometheus.Labels) (prometheus.Gauge, error) {
+	return NullGauge{}, nil
+}
+func (NullGaugeVec) GetMetricWithLabelValues(lvs ...string) (prometheus.Gauge, error) {
+	return NullGauge{}, nil
+}
+func (NullGaugeVec) With(labels prometheus.Labels) prometheus.Gauge { return NullGauge{} }
+func (NullGaugeVec) WithLabelValues(lvs ...string) prometheus.Gauge { return NullGauge{} }
@@ -35,7 +35,7 @@ func TestStoreWrapperMetrics(t *testing.T) {
 	//
 	reg := prometheus.NewRegistry()
 	fac := promauto.With(reg)
-	c, _ := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, &fac)
+	c, _ := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, &fac)
 	assert.Equal(1, promtest.CollectAndCount(c.metrics.coordinatorState))
 	assert.Equal(float64(stateAcceptingManifest), promtest.ToFloat64(c.metrics.coordinatorState))
 
@@ -49,14 +49,14 @@ func TestStoreWrapperMetrics(t *testing.T) {
 	reg = prometheus.NewRegistry()
 	fac = promauto.With(reg)
 	sealer.UnsealError = seal.ErrEncryptionKey
-	c, err = NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, &fac)
+	c, err = NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, &fac)
 	sealer.UnsealError = nil
 	require.NoError(err)
 	assert.Equal(1, promtest.CollectAndCount(c.metrics.coordinatorState))
 	assert.Equal(float64(stateRecovery), promtest.ToFloat64(c.metrics.coordinatorState))
 
 	key := make([]byte, 16)
-	_, err = c.Recover(context.TODO(), key)
+	_, err = c.Recover(context.TODO(), key, nil)
 	require.NoError(err)
 	state, err := c.data.getState()
 	require.NoError(err)
@@ -84,7 +84,7 @@ func TestMarbleAPIMetrics(t *testing.T) {
 	recovery := recovery.NewSinglePartyRecovery()
 	promRegistry := prometheus.NewRegistry()
 	promFactory := promauto.With(promRegistry)
-	c, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, &promFactory)
+	c, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, &promFactory)
 	require.NoError(err)
 	require.NotNil(c)
 
@@ -52,7 +52,7 @@ func TestOpenSSLVerify(t *testing.T) {
 	issuer := quote.NewMockIssuer()
 	sealer := &seal.MockSealer{}
 	recovery := recovery.NewSinglePartyRecovery()
-	coreServer, err := NewCore([]string{"localhost"}, validator, issuer, sealer, recovery, zapLogger, nil)
+	coreServer, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
 	require.NoError(err)
 	require.NotNil(coreServer)
 
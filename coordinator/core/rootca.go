@@ -0,0 +1,345 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/store"
+	"github.com/edgelesssys/marblerun/coordinator/user"
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// rootCATransition holds the certificates served during the transition period after a rotation of the root CA
+type rootCATransition struct {
+	// PreviousRoot is the self-signed certificate of the previous root CA
+	PreviousRoot []byte
+	// CrossSignedRoot is the certificate of the current root CA issued by the previous one
+	CrossSignedRoot []byte
+	// CrossSignedPreviousRoot is the certificate of the previous root CA issued by the current one
+	CrossSignedPreviousRoot []byte
+	// NotAfter is the end of the transition period
+	NotAfter time.Time
+}
+
+// reissuedIntermediateCA holds a new intermediate CA and the certificates regenerated with it
+type reissuedIntermediateCA struct {
+	intermediateCert  *x509.Certificate
+	marbleRootCert    *x509.Certificate
+	intermediatePrivK crypto.Signer
+	secrets           map[string]manifest.Secret
+	marbleTypeSecrets map[string]map[string]manifest.Secret
+	// externalChain are the certificates of the external CA, if it issued marbleRootCert
+	externalChain [][]byte
+}
+
+// RotateRootCA replaces the root CA of the Coordinator
+//
+// The previous and new root certificate are cross-signed and both served during a transition period.
+// The intermediate CA and all certificates issued by it are regenerated.
+func (c *Core) RotateRootCA(ctx context.Context, updater *user.User) error {
+	defer c.mux.Unlock()
+
+	// Only accept requests if we already have a manifest
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return err
+	}
+
+	// verify user is allowed to rotate the root CA
+	if !updater.IsGranted(user.NewPermission(user.PermissionRotateRootCA, nil)) {
+		return fmt.Errorf("user %s is not allowed to rotate the root CA", updater.Name())
+	}
+
+	previousRootCert, err := c.data.getCertificate(sKCoordinatorRootCert)
+	if err != nil {
+		return err
+	}
+	previousRootPrivK, err := c.data.getPrivK(sKCoordinatorRootKey)
+	if err != nil {
+		return err
+	}
+	// keys must not change with the root CA
+	derivationSecret, err := c.getKeyDerivationSecret()
+	if err != nil {
+		return err
+	}
+
+	rootCert, rootPrivK, err := generateCert(previousRootCert.DNSNames, coordinatorName, c.caConfig, nil, nil, nil)
+	if err != nil {
+		c.zaplogger.Error("Could not generate a new root CA.", zap.Error(err))
+		return err
+	}
+	// Cross-sign both roots, so clients trusting either of them can verify the chains of the other
+	crossSignedRoot, err := crossSignCertificate(rootCert, previousRootCert, previousRootPrivK)
+	if err != nil {
+		return err
+	}
+	crossSignedPreviousRoot, err := crossSignCertificate(previousRootCert, rootCert, rootPrivK)
+	if err != nil {
+		return err
+	}
+
+	reissued, err := c.reissueIntermediateCA(ctx, rootCert, rootPrivK)
+	if err != nil {
+		return err
+	}
+
+	transition := rootCATransition{
+		PreviousRoot:            previousRootCert.Raw,
+		CrossSignedRoot:         crossSignedRoot.Raw,
+		CrossSignedPreviousRoot: crossSignedPreviousRoot.Raw,
+		NotAfter:                time.Now().Add(c.caConfig.rootTransitionPeriod()),
+	}
+
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	txdata := storeWrapper{tx}
+
+	c.updateLogger.Reset()
+	c.updateLogger.Info("root CA rotated", zap.String("user", updater.Name()), zap.Time("transition end", transition.NotAfter))
+
+	if err := txdata.putKeyDerivationSecret(derivationSecret); err != nil {
+		return err
+	}
+	if err := txdata.putCertificate(sKCoordinatorRootCert, rootCert); err != nil {
+		return err
+	}
+	if err := txdata.putPrivK(sKCoordinatorRootKey, rootPrivK); err != nil {
+		return err
+	}
+	if err := txdata.putRootCATransition(transition); err != nil {
+		return err
+	}
+	if err := reissued.put(txdata, updater.Name()); err != nil {
+		return err
+	}
+	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	c.quote = c.generateQuote(rootCert.Raw)
+	c.zaplogger.Info("The root CA was rotated. Please restart your Marbles and update the root certificate of your clients.", zap.Time("transitionEnd", transition.NotAfter))
+	return nil
+}
+
+// getRootCATransition returns the certificates of the last root CA rotation while its transition period lasts
+func (c *Core) getRootCATransition() (rootCATransition, error) {
+	transition, err := c.data.getRootCATransition()
+	if store.IsStoreValueUnsetError(err) || (err == nil && time.Now().After(transition.NotAfter)) {
+		return rootCATransition{}, nil
+	}
+	return transition, err
+}
+
+// getKeyDerivationSecret returns the secret that secrets and seal keys are derived from.
+//
+// States created by earlier versions of the Coordinator have no dedicated secret and derive keys from the root key.
+// To keep their keys, the first rotation of the root CA stores the secret of the previous root key as the derivation secret.
+// The previous root key itself is not kept, so it cannot sign anymore, but its secret still needs to be protected like the root key.
+func (c *Core) getKeyDerivationSecret() ([]byte, error) {
+	derivationSecret, err := c.data.getKeyDerivationSecret()
+	if err != nil && !store.IsStoreValueUnsetError(err) {
+		return nil, err
+	}
+	if len(derivationSecret) > 0 {
+		return derivationSecret, nil
+	}
+	rootPrivK, err := c.data.getPrivK(sKCoordinatorRootKey)
+	if err != nil {
+		return nil, err
+	}
+	return keyDerivationSecret(rootPrivK)
+}
+
+// reissueIntermediateCA generates a new intermediate and marble root CA signed by the given root,
+// and regenerates the shared and per-marble-type certificates issued by them.
+// If an external CA issued the intermediate CA, its key and certificate are kept and only cross-signed by the given root again.
+func (c *Core) reissueIntermediateCA(ctx context.Context, rootCert *x509.Certificate, rootPrivK crypto.PrivateKey) (reissuedIntermediateCA, error) {
+	extCA, err := c.data.getExternalCA()
+	if err != nil {
+		return reissuedIntermediateCA{}, err
+	}
+	if len(extCA.Chain) > 0 {
+		return c.reissueExternalIntermediateCA(ctx, extCA, rootCert, rootPrivK)
+	}
+
+	// Generate new cross-signed intermediate CA for Marble gRPC authentication
+	intermediateCert, intermediatePrivK, err := generateCert(rootCert.DNSNames, coordinatorIntermediateName, c.caConfig, nil, rootCert, rootPrivK)
+	if err != nil {
+		c.zaplogger.Error("Could not generate a new intermediate CA for Marble authentication.", zap.Error(err))
+		return reissuedIntermediateCA{}, err
+	}
+	marbleRootCert, _, err := generateCert(rootCert.DNSNames, coordinatorIntermediateName, c.caConfig, intermediatePrivK, nil, nil)
+	if err != nil {
+		return reissuedIntermediateCA{}, err
+	}
+
+	return c.regenerateCertificates(ctx, intermediateCert, marbleRootCert, intermediatePrivK)
+}
+
+// reissueExternalIntermediateCA cross-signs the intermediate CA issued by an external CA with the given root,
+// and regenerates the shared and per-marble-type certificates issued by it.
+// The Coordinator cannot obtain a new certificate from the external CA on its own, so the intermediate key is kept.
+func (c *Core) reissueExternalIntermediateCA(ctx context.Context, extCA externalCA, rootCert *x509.Certificate, rootPrivK crypto.PrivateKey) (reissuedIntermediateCA, error) {
+	marbleRootCert, err := c.data.getCertificate(sKMarbleRootCert)
+	if err != nil {
+		return reissuedIntermediateCA{}, err
+	}
+	intermediatePrivK, err := c.data.getPrivK(sKCoordinatorIntermediateKey)
+	if err != nil {
+		return reissuedIntermediateCA{}, err
+	}
+	intermediateCert, err := crossSignCertificate(marbleRootCert, rootCert, rootPrivK)
+	if err != nil {
+		return reissuedIntermediateCA{}, err
+	}
+
+	reissued, err := c.regenerateCertificates(ctx, intermediateCert, marbleRootCert, intermediatePrivK)
+	if err != nil {
+		return reissuedIntermediateCA{}, err
+	}
+	reissued.externalChain = extCA.Chain
+	return reissued, nil
+}
+
+// regenerateCertificates regenerates the shared and per-marble-type certificates with the given marble root CA
+func (c *Core) regenerateCertificates(ctx context.Context, intermediateCert, marbleRootCert *x509.Certificate, intermediatePrivK crypto.Signer) (reissuedIntermediateCA, error) {
+	// Gather all shared certificate secrets we need to regenerate
+	secretsToRegenerate := make(map[string]manifest.Secret)
+	secrets, err := c.data.getSecretMap()
+	if err != nil {
+		return reissuedIntermediateCA{}, err
+	}
+	for name, secret := range secrets {
+		if secret.Shared && strings.HasPrefix(secret.Type, "cert-") {
+			secretsToRegenerate[name] = secret
+		}
+	}
+
+	// Regenerate shared secrets specified in manifest
+	regeneratedSecrets, err := c.generateSecrets(ctx, secretsToRegenerate, uuid.Nil, marbleRootCert, intermediatePrivK)
+	if err != nil {
+		c.zaplogger.Error("Could not generate specified secrets for the given manifest.", zap.Error(err))
+		return reissuedIntermediateCA{}, err
+	}
+
+	// Regenerate the certificates of per-marble-type secrets for all marble types
+	mnf, err := c.data.getManifest()
+	if err != nil {
+		return reissuedIntermediateCA{}, err
+	}
+	marbleTypeSecretsToRegenerate := make(map[string]manifest.Secret)
+	for name, secret := range mnf.Secrets {
+		if secret.PerMarbleType && strings.HasPrefix(secret.Type, "cert-") {
+			marbleTypeSecretsToRegenerate[name] = secret
+		}
+	}
+	regeneratedMarbleTypeSecrets := make(map[string]map[string]manifest.Secret)
+	for marbleType := range mnf.Marbles {
+		regeneratedMarbleTypeSecrets[marbleType], err = c.generateMarbleTypeSecrets(ctx, marbleTypeSecretsToRegenerate, marbleType, marbleRootCert, intermediatePrivK)
+		if err != nil {
+			c.zaplogger.Error("Could not generate specified secrets for the given manifest.", zap.Error(err))
+			return reissuedIntermediateCA{}, err
+		}
+	}
+
+	return reissuedIntermediateCA{
+		intermediateCert:  intermediateCert,
+		marbleRootCert:    marbleRootCert,
+		intermediatePrivK: intermediatePrivK,
+		secrets:           regeneratedSecrets,
+		marbleTypeSecrets: regeneratedMarbleTypeSecrets,
+	}, nil
+}
+
+// put saves the new intermediate CA and the regenerated certificates to store
+func (r reissuedIntermediateCA) put(txdata storeWrapper, updater string) error {
+	if err := txdata.putCertificate(skCoordinatorIntermediateCert, r.intermediateCert); err != nil {
+		return err
+	}
+	if err := txdata.putCertificate(sKMarbleRootCert, r.marbleRootCert); err != nil {
+		return err
+	}
+	if err := txdata.putPrivK(sKCoordinatorIntermediateKey, r.intermediatePrivK); err != nil {
+		return err
+	}
+	extCA, err := txdata.getExternalCA()
+	if err != nil {
+		return err
+	}
+	extCA.Chain = r.externalChain
+	if err := txdata.putExternalCA(extCA); err != nil {
+		return err
+	}
+
+	// Overwrite regenerated secrets in core
+	for name, secret := range r.secrets {
+		if err := txdata.putSecret(name, secret); err != nil {
+			return err
+		}
+		if err := txdata.appendSecretHistory(name, secret, updater); err != nil {
+			return err
+		}
+	}
+	for marbleType, secrets := range r.marbleTypeSecrets {
+		for name, secret := range secrets {
+			if err := txdata.putMarbleTypeSecret(marbleType, name, secret); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// crossSignCertificate issues a certificate for the subject and public key of cert, signed by the given issuer
+func crossSignCertificate(cert *x509.Certificate, issuerCert *x509.Certificate, issuerPrivK crypto.PrivateKey) (*x509.Certificate, error) {
+	serialNumber, err := util.GenerateCertificateSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		RawSubject:   cert.RawSubject,
+		SubjectKeyId: cert.SubjectKeyId,
+		// the previous and new root share their subject, so the issuer is only identified by its key ID
+		AuthorityKeyId: issuerCert.SubjectKeyId,
+		DNSNames:       cert.DNSNames,
+		IPAddresses:    cert.IPAddresses,
+		NotBefore:      cert.NotBefore,
+		NotAfter:       cert.NotAfter,
+
+		KeyUsage:              cert.KeyUsage,
+		ExtKeyUsage:           cert.ExtKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+
+		PermittedDNSDomains: cert.PermittedDNSDomains,
+		PermittedIPRanges:   cert.PermittedIPRanges,
+	}
+
+	certRaw, err := x509.CreateCertificate(rand.Reader, &template, issuerCert, cert.PublicKey, issuerPrivK)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(certRaw)
+}
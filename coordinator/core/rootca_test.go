@@ -0,0 +1,174 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/quote"
+	"github.com/edgelesssys/marblerun/coordinator/recovery"
+	"github.com/edgelesssys/marblerun/coordinator/seal"
+	"github.com/edgelesssys/marblerun/coordinator/user"
+	"github.com/edgelesssys/marblerun/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRotateRootCA(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	zapLogger, err := zap.NewDevelopment()
+	require.NoError(err)
+	defer zapLogger.Sync()
+	validator := quote.NewMockValidator()
+	issuer := quote.NewMockIssuer()
+	sealer := &seal.MockSealer{}
+	recovery := recovery.NewSinglePartyRecovery()
+
+	c, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
+	require.NoError(err)
+	_, err = c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+
+	previousRoot, err := c.data.getCertificate(sKCoordinatorRootCert)
+	require.NoError(err)
+	previousRootPrivK, err := c.data.getPrivK(sKCoordinatorRootKey)
+	require.NoError(err)
+	previousIntermediate, err := c.data.getCertificate(skCoordinatorIntermediateCert)
+	require.NoError(err)
+	previousSecret, err := c.data.getSecret("cert_shared")
+	require.NoError(err)
+	derivationSecret, err := c.getKeyDerivationSecret()
+	require.NoError(err)
+	// keys are not derived from the root key
+	rootKeyDerive, err := keyDerivationSecret(previousRootPrivK)
+	require.NoError(err)
+	assert.NotEqual(rootKeyDerive, derivationSecret)
+
+	// users need the permission to rotate the root CA
+	assert.Error(c.RotateRootCA(context.TODO(), user.NewUser("other", nil)))
+	require.NoError(c.RotateRootCA(context.TODO(), admin))
+
+	root, err := c.data.getCertificate(sKCoordinatorRootCert)
+	require.NoError(err)
+	intermediate, err := c.data.getCertificate(skCoordinatorIntermediateCert)
+	require.NoError(err)
+	secret, err := c.data.getSecret("cert_shared")
+	require.NoError(err)
+	assert.NotEqual(previousRoot.Raw, root.Raw)
+	assert.NotEqual(previousIntermediate.Raw, intermediate.Raw)
+	assert.NotEqual(previousSecret.Cert.Raw, secret.Cert.Raw)
+
+	// keys are still derived from the same secret
+	newDerivationSecret, err := c.getKeyDerivationSecret()
+	require.NoError(err)
+	assert.Equal(derivationSecret, newDerivationSecret)
+
+	// the quote is issued for the new root, which stays the last certificate of the chain
+	certChain, quote, err := c.GetCertQuote(context.TODO())
+	require.NoError(err)
+	certs := mustParsePEMChain(t, certChain)
+	require.Len(certs, 5)
+	assert.Equal(intermediate.Raw, certs[0].Raw)
+	assert.Equal(previousRoot.Raw, certs[2].Raw)
+	assert.Equal(root.Raw, certs[4].Raw)
+	assert.NotEmpty(quote)
+
+	// the intermediate can be verified by clients trusting either root
+	chainIntermediates := x509.NewCertPool()
+	for _, cert := range certs[1:4] {
+		chainIntermediates.AddCert(cert)
+	}
+	for _, trustedRoot := range []*x509.Certificate{previousRoot, root} {
+		roots := x509.NewCertPool()
+		roots.AddCert(trustedRoot)
+		_, err = intermediate.Verify(x509.VerifyOptions{Roots: roots, Intermediates: chainIntermediates})
+		assert.NoError(err)
+	}
+
+	// the cross-signed previous root can be verified by clients trusting the new root
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	_, err = certs[3].Verify(x509.VerifyOptions{Roots: roots})
+	assert.NoError(err)
+
+	// the transition survives a restart
+	c2, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, sealer, recovery, zapLogger, nil)
+	require.NoError(err)
+	certChain2, _, err := c2.GetCertQuote(context.TODO())
+	require.NoError(err)
+	assert.Equal(certChain, certChain2)
+
+	// after the transition period, only the new chain is served
+	transition, err := c.data.getRootCATransition()
+	require.NoError(err)
+	transition.NotAfter = time.Now().Add(-time.Minute)
+	tx, err := c.store.BeginTransaction()
+	require.NoError(err)
+	require.NoError(storeWrapper{tx}.putRootCATransition(transition))
+	require.NoError(tx.Commit())
+	certChain, _, err = c.GetCertQuote(context.TODO())
+	require.NoError(err)
+	assert.Len(mustParsePEMChain(t, certChain), 2)
+
+	// a second rotation keeps the key derivation secret
+	require.NoError(c.RotateRootCA(context.TODO(), admin))
+	newDerivationSecret, err = c.getKeyDerivationSecret()
+	require.NoError(err)
+	assert.Equal(derivationSecret, newDerivationSecret)
+}
+
+func TestRotateRootCALegacyKeyDerivation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// states created by earlier versions derive keys from the root key
+	c := NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+	previousRootPrivK, err := c.data.getPrivK(sKCoordinatorRootKey)
+	require.NoError(err)
+	rootKeyDerive, err := keyDerivationSecret(previousRootPrivK)
+	require.NoError(err)
+	require.NoError(c.data.putKeyDerivationSecret(nil))
+
+	derivationSecret, err := c.getKeyDerivationSecret()
+	require.NoError(err)
+	assert.Equal(rootKeyDerive, derivationSecret)
+
+	// the rotation keeps the derived keys, but not the previous root key
+	require.NoError(c.RotateRootCA(context.TODO(), admin))
+	derivationSecret, err = c.getKeyDerivationSecret()
+	require.NoError(err)
+	assert.Equal(rootKeyDerive, derivationSecret)
+	rootPrivK, err := c.data.getPrivK(sKCoordinatorRootKey)
+	require.NoError(err)
+	assert.NotEqual(previousRootPrivK, rootPrivK)
+}
+
+func mustParsePEMChain(t *testing.T, chain string) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for rest := []byte(chain); len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		require.NotNil(t, block)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		certs = append(certs, cert)
+	}
+	return certs
+}
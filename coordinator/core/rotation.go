@@ -0,0 +1,138 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"go.uber.org/zap"
+)
+
+// RunSecretRotation checks for expiring shared certificate secrets every interval and renews
+// all certificates expiring within rotateBefore. It blocks until ctx is done.
+// interval must be positive.
+func (c *Core) RunSecretRotation(ctx context.Context, interval, rotateBefore time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.RotateExpiringSecrets(ctx, rotateBefore); err != nil {
+			c.zaplogger.Error("Automatic rotation of expiring secrets failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RotateExpiringSecrets renews all shared certificate secrets expiring within rotateBefore and returns their names.
+// The replaced certificates stay available to the Marbles as the previous version of the secret.
+func (c *Core) RotateExpiringSecrets(ctx context.Context, rotateBefore time.Duration) ([]string, error) {
+	defer c.mux.Unlock()
+
+	// there is nothing to rotate as long as no manifest is set
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, nil
+	}
+
+	mnf, err := c.data.getManifest()
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := c.data.getSecretMap()
+	if err != nil {
+		return nil, err
+	}
+
+	expiringSecrets := make(map[string]manifest.Secret)
+	for secretName, definition := range mnf.Secrets {
+		if !definition.Shared || definition.UserDefined || definition.Source != nil || !strings.HasPrefix(definition.Type, "cert-") {
+			continue
+		}
+		current, ok := secrets[secretName]
+		if !ok || len(current.Cert.Raw) <= 0 {
+			continue
+		}
+		c.metrics.secretRotation.expiry.WithLabelValues(secretName).Set(float64(current.Cert.NotAfter.Unix()))
+
+		if time.Until(current.Cert.NotAfter) > rotationWindow(x509.Certificate(current.Cert), rotateBefore) {
+			continue
+		}
+		// a fixed expiry date would be copied to the new certificate, so renewing it would not help
+		if !definition.Cert.NotAfter.IsZero() {
+			c.zaplogger.Warn("Shared certificate secret is about to expire, but cannot be renewed since its NotAfter date is fixed in the manifest.", zap.String("name", secretName), zap.Time("notAfter", current.Cert.NotAfter))
+			continue
+		}
+		expiringSecrets[secretName] = definition
+	}
+	if len(expiringSecrets) <= 0 {
+		return nil, nil
+	}
+
+	// certificates issued by renewed CAs are issued again
+	reissued, err := c.reissueCertificates(ctx, expiringSecrets, nil)
+	if err != nil {
+		return nil, err
+	}
+	renewedSecrets := make(map[string]manifest.Secret)
+	for secretName := range expiringSecrets {
+		if secret, ok := reissued.shared[secretName]; ok {
+			renewedSecrets[secretName] = secret
+		}
+	}
+
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	txdata := storeWrapper{tx}
+
+	var rotated []string
+	c.updateLogger.Reset()
+	for secretName, secret := range renewedSecrets {
+		if err := txdata.putSecret(secretName, secret); err != nil {
+			return nil, err
+		}
+		if err := txdata.appendSecretHistory(secretName, secret, ""); err != nil {
+			return nil, err
+		}
+		c.updateLogger.Info("secret rotated automatically", zap.String("secret", secretName), zap.String("type", secret.Type), zap.Time("previousNotAfter", secrets[secretName].Cert.NotAfter), zap.Time("notAfter", secret.Cert.NotAfter))
+		rotated = append(rotated, secretName)
+	}
+	if err := reissued.put(txdata, c.updateLogger, expiringSecrets); err != nil {
+		return nil, err
+	}
+	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, secretName := range rotated {
+		c.metrics.secretRotation.rotations.WithLabelValues(secretName).Inc()
+		c.metrics.secretRotation.expiry.WithLabelValues(secretName).Set(float64(renewedSecrets[secretName].Cert.NotAfter.Unix()))
+	}
+	c.zaplogger.Info("Expiring shared certificate secrets were renewed. Please restart your Marbles to use the new certificates.", zap.Strings("secrets", rotated))
+	return rotated, nil
+}
+
+// rotationWindow returns the time before the expiry of cert in which it is renewed.
+// The window is capped at a third of the certificate's lifetime, so certificates valid for less than rotateBefore are not renewed on every check.
+func rotationWindow(cert x509.Certificate, rotateBefore time.Duration) time.Duration {
+	if lifetime := cert.NotAfter.Sub(cert.NotBefore); lifetime/3 < rotateBefore {
+		return lifetime / 3
+	}
+	return rotateBefore
+}
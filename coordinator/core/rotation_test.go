@@ -0,0 +1,126 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/quote"
+	"github.com/edgelesssys/marblerun/coordinator/recovery"
+	"github.com/edgelesssys/marblerun/coordinator/seal"
+	"github.com/edgelesssys/marblerun/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRotateExpiringSecrets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	zapLogger, err := zap.NewDevelopment()
+	require.NoError(err)
+	defer zapLogger.Sync()
+	reg := prometheus.NewRegistry()
+	fac := promauto.With(reg)
+	c, err := NewCore([]string{"localhost"}, CAConfig{}, quote.NewMockValidator(), quote.NewMockIssuer(), &seal.MockSealer{}, recovery.NewSinglePartyRecovery(), zapLogger, &fac)
+	require.NoError(err)
+
+	// nothing to do without a manifest
+	rotated, err := c.RotateExpiringSecrets(context.TODO(), time.Hour)
+	require.NoError(err)
+	assert.Empty(rotated)
+
+	_, err = c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	before, err := c.data.getSecret("cert_shared")
+	require.NoError(err)
+
+	// the certificate is valid for a week, so it is not renewed yet
+	rotated, err = c.RotateExpiringSecrets(context.TODO(), 24*time.Hour)
+	require.NoError(err)
+	assert.Empty(rotated)
+	assert.Equal(float64(before.Cert.NotAfter.Unix()), promtest.ToFloat64(c.metrics.secretRotation.expiry.WithLabelValues("cert_shared")))
+
+	// the window is capped at a third of the lifetime, so certificates valid for less than rotateBefore are not renewed on every check
+	rotated, err = c.RotateExpiringSecrets(context.TODO(), 30*24*time.Hour)
+	require.NoError(err)
+	assert.Empty(rotated)
+
+	// renew all certificates expiring within 30 days
+	before = mustPutExpiringCert(t, c, "cert_shared", time.Hour)
+	rotated, err = c.RotateExpiringSecrets(context.TODO(), 30*24*time.Hour)
+	require.NoError(err)
+	assert.Equal([]string{"cert_shared"}, rotated)
+
+	after, err := c.data.getSecret("cert_shared")
+	require.NoError(err)
+	assert.NotEqual(before.Cert.Raw, after.Cert.Raw)
+	assert.False(after.Cert.NotAfter.Before(before.Cert.NotAfter))
+	assert.Equal(float64(1), promtest.ToFloat64(c.metrics.secretRotation.rotations.WithLabelValues("cert_shared")))
+	assert.Equal(float64(after.Cert.NotAfter.Unix()), promtest.ToFloat64(c.metrics.secretRotation.expiry.WithLabelValues("cert_shared")))
+
+	// the old certificate stays available as previous version
+	history, err := c.data.getSecretHistory("cert_shared")
+	require.NoError(err)
+	require.Len(history, 3)
+	assert.Equal(before.Fingerprint(), history[1].Fingerprint)
+
+	updateLog, err := c.GetUpdateLog(context.TODO())
+	require.NoError(err)
+	assert.Contains(updateLog, `"update":"secret rotated automatically"`)
+	assert.Contains(updateLog, `"secret":"cert_shared"`)
+}
+
+func TestRotationWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	week := x509.Certificate{NotBefore: now, NotAfter: now.Add(7 * 24 * time.Hour)}
+	hour := x509.Certificate{NotBefore: now, NotAfter: now.Add(3 * time.Hour)}
+
+	assert.Equal(24*time.Hour, rotationWindow(week, 24*time.Hour))
+	assert.Equal(56*time.Hour, rotationWindow(week, 30*24*time.Hour))
+	assert.Equal(time.Hour, rotationWindow(hour, 24*time.Hour))
+}
+
+// mustPutExpiringCert replaces the certificate of a shared secret with one which expires in remaining
+func mustPutExpiringCert(t *testing.T, c *Core, secretName string, remaining time.Duration) manifest.Secret {
+	require := require.New(t)
+
+	secret, err := c.data.getSecret(secretName)
+	require.NoError(err)
+	marbleRootCert, err := c.data.getCertificate(sKMarbleRootCert)
+	require.NoError(err)
+	intermediatePrivK, err := c.data.getPrivK(sKCoordinatorIntermediateKey)
+	require.NoError(err)
+
+	template := x509.Certificate(secret.Cert)
+	template.NotBefore = time.Now().Add(-7 * 24 * time.Hour)
+	template.NotAfter = time.Now().Add(remaining)
+	certRaw, err := x509.CreateCertificate(rand.Reader, &template, marbleRootCert, secret.Cert.PublicKey, intermediatePrivK)
+	require.NoError(err)
+	cert, err := x509.ParseCertificate(certRaw)
+	require.NoError(err)
+	secret.Cert = manifest.Certificate(*cert)
+
+	tx, err := c.store.BeginTransaction()
+	require.NoError(err)
+	txdata := storeWrapper{tx}
+	require.NoError(txdata.putSecret(secretName, secret))
+	require.NoError(txdata.appendSecretHistory(secretName, secret, ""))
+	require.NoError(tx.Commit())
+	return secret
+}
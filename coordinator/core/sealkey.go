@@ -0,0 +1,246 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/store"
+	"github.com/edgelesssys/marblerun/coordinator/user"
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// sealKeySize is the size of the seal master keys and of the seal keys derived for marbles in bytes
+const sealKeySize = 32
+
+// sealKey is a version of the master key the seal keys of marbles are derived from
+type sealKey struct {
+	Version uint
+	// Key is the master key. It is empty for version 0, which is derived from the Coordinator's private key
+	// for states created before seal master keys were introduced, and can not be exported.
+	Key     []byte `json:",omitempty"`
+	Created time.Time
+}
+
+// newSealKey generates a random seal master key
+func newSealKey(version uint) (sealKey, error) {
+	key := make([]byte, sealKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return sealKey{}, err
+	}
+	return sealKey{Version: version, Key: key, Created: time.Now()}, nil
+}
+
+// getSealKeys returns the versions of the seal master key, oldest first
+func (c *Core) getSealKeys() ([]sealKey, error) {
+	keys, err := c.data.getSealKeys()
+	if store.IsStoreValueUnsetError(err) {
+		return []sealKey{{Version: 0}}, nil
+	}
+	return keys, err
+}
+
+// deriveSealKeys derives the seal keys of a marble from all versions of the seal master key.
+// It returns the ID of the current version and the keys by their ID.
+func (c *Core) deriveSealKeys(marbleUUID uuid.UUID) (string, map[string]manifest.Secret, error) {
+	uuidBytes, err := marbleUUID.MarshalBinary()
+	if err != nil {
+		return "", nil, err
+	}
+	keys, err := c.getSealKeys()
+	if err != nil {
+		return "", nil, err
+	}
+
+	sealKeys := make(map[string]manifest.Secret)
+	var currentID string
+	for _, key := range keys {
+		master := key.Key
+		if len(master) <= 0 {
+			master, err = c.getKeyDerivationSecret()
+			if err != nil {
+				return "", nil, err
+			}
+		}
+		derivedKey, err := util.DeriveKey(master, uuidBytes, sealKeySize)
+		if err != nil {
+			return "", nil, err
+		}
+		currentID = strconv.FormatUint(uint64(key.Version), 10)
+		sealKeys[currentID] = manifest.Secret{Public: derivedKey, Private: derivedKey}
+	}
+	return currentID, sealKeys, nil
+}
+
+// RotateSealKey generates a new version of the seal master key
+//
+// Marbles receive the seal key of the new version on their next activation, together with the keys of all previous versions.
+func (c *Core) RotateSealKey(ctx context.Context, updater *user.User) error {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return err
+	}
+	if !updater.IsGranted(user.NewPermission(user.PermissionRotateSealKey, nil)) {
+		return fmt.Errorf("user %s is not allowed to rotate the seal key", updater.Name())
+	}
+
+	keys, err := c.getSealKeys()
+	if err != nil {
+		return err
+	}
+	newKey, err := newSealKey(keys[len(keys)-1].Version + 1)
+	if err != nil {
+		return err
+	}
+	keys = append(keys, newKey)
+
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	txdata := storeWrapper{tx}
+
+	if err := txdata.putSealKeys(keys); err != nil {
+		return err
+	}
+	c.updateLogger.Reset()
+	c.updateLogger.Info("seal key rotated", zap.String("user", updater.Name()), zap.Uint("version", newKey.Version))
+	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ExportSealKeys returns the versions of the seal master key, each encrypted with RSA-OAEP (SHA-256) to each recovery key of the manifest
+//
+// The result maps the names of the recovery keys to the encrypted master keys by their version.
+// Version 0, which is derived from the Coordinator's private key, is not exported.
+func (c *Core) ExportSealKeys(ctx context.Context, updater *user.User) (map[string]map[string][]byte, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, err
+	}
+	if !updater.IsGranted(user.NewPermission(user.PermissionExportSealKeys, nil)) {
+		return nil, fmt.Errorf("user %s is not allowed to export the seal keys", updater.Name())
+	}
+
+	mnf, err := c.data.getManifest()
+	if err != nil {
+		return nil, err
+	}
+	if len(mnf.RecoveryKeys) <= 0 {
+		return nil, errors.New("seal keys can only be exported to the recovery keys of the manifest, but none are defined")
+	}
+	keys, err := c.getSealKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	exported := make(map[string]map[string][]byte)
+	for name, rawKey := range mnf.RecoveryKeys {
+		recoveryKey, err := manifest.ParseRecoveryKey(rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("recovery key %s: %v", name, err)
+		}
+		exported[name] = make(map[string][]byte)
+		for _, key := range keys {
+			if len(key.Key) <= 0 {
+				continue
+			}
+			encryptedKey, err := util.EncryptOAEP(recoveryKey, key.Key)
+			if err != nil {
+				return nil, err
+			}
+			exported[name][strconv.FormatUint(uint64(key.Version), 10)] = encryptedKey
+		}
+	}
+
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	c.updateLogger.Reset()
+	c.updateLogger.Info("seal keys exported", zap.String("user", updater.Name()))
+	if err := (storeWrapper{tx}).appendUpdateLog(c.updateLogger.String()); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return exported, nil
+}
+
+// ImportSealKeys replaces the seal master keys with previously exported ones
+//
+// rawSealKeys maps the versions to the decrypted master keys in JSON format.
+// Importing is only possible before the first marble is activated, so no data is sealed with the replaced keys.
+func (c *Core) ImportSealKeys(ctx context.Context, rawSealKeys []byte, updater *user.User) error {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return err
+	}
+	if !updater.IsGranted(user.NewPermission(user.PermissionImportSealKeys, nil)) {
+		return fmt.Errorf("user %s is not allowed to import seal keys", updater.Name())
+	}
+
+	var importedKeys map[string][]byte
+	if err := json.Unmarshal(rawSealKeys, &importedKeys); err != nil {
+		return err
+	}
+	if len(importedKeys) <= 0 {
+		return errors.New("no seal keys defined")
+	}
+	var keys []sealKey
+	for rawVersion, key := range importedKeys {
+		version, err := strconv.ParseUint(rawVersion, 10, 32)
+		if err != nil || version == 0 {
+			return fmt.Errorf("invalid seal key version %s", rawVersion)
+		}
+		if len(key) != sealKeySize {
+			return fmt.Errorf("seal key of version %s must have %d bytes", rawVersion, sealKeySize)
+		}
+		keys = append(keys, sealKey{Version: uint(version), Key: key, Created: time.Now()})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Version < keys[j].Version })
+
+	iter, err := c.data.getIterator(requestActivatedMarble)
+	if err != nil {
+		return err
+	}
+	if iter.HasNext() {
+		return errors.New("seal keys can not be imported after marbles have been activated")
+	}
+
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	txdata := storeWrapper{tx}
+
+	if err := txdata.putSealKeys(keys); err != nil {
+		return err
+	}
+	c.updateLogger.Reset()
+	c.updateLogger.Info("seal keys imported", zap.String("user", updater.Name()), zap.Uint("version", keys[len(keys)-1].Version))
+	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,120 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/quote"
+	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/edgelesssys/marblerun/coordinator/user"
+	"github.com/edgelesssys/marblerun/test"
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealKeys(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rawManifest := strings.Replace(test.ManifestJSONWithRecoveryKey, `"SEAL_KEY": "{{ hex .Marblerun.SealKey }}"`, `"SEAL_KEY": "{{ hex .Marblerun.SealKey }}",
+					"SEAL_KEY_ID": "{{ .Marblerun.SealKeyID }}",
+					"SEAL_KEY_1": "{{ hex (index .Marblerun.SealKeys \"1\") }}"`, 1)
+	var mnf manifest.Manifest
+	require.NoError(json.Unmarshal([]byte(rawManifest), &mnf))
+
+	setup := func() *Core {
+		c, _ := mustSetup()
+		_, err := c.SetManifest(context.TODO(), []byte(rawManifest))
+		require.NoError(err)
+		return c
+	}
+	marbleUUID := uuid.New()
+	activate := func(c *Core) (*rpc.ActivationResp, error) {
+		cert, csr, _ := util.MustGenerateTestMarbleCredentials()
+		marbleQuote, err := c.qi.Issue(cert.Raw)
+		require.NoError(err)
+		c.qv.(*quote.MockValidator).AddValidQuote(marbleQuote, cert.Raw, mnf.Packages["frontend"], mnf.Infrastructures["Azure"])
+		return c.Activate(peerContext(cert), &rpc.ActivationReq{
+			CSR:        csr,
+			MarbleType: "frontend",
+			Quote:      marbleQuote,
+			UUID:       marbleUUID.String(),
+		})
+	}
+
+	admin := user.NewUser("admin", nil)
+	admin.Assign(user.NewPermission(user.PermissionRotateSealKey, nil))
+	admin.Assign(user.NewPermission(user.PermissionExportSealKeys, nil))
+	admin.Assign(user.NewPermission(user.PermissionImportSealKeys, nil))
+	other := user.NewUser("other", nil)
+
+	c := setup()
+	sealKeyID, sealKeys, err := c.deriveSealKeys(marbleUUID)
+	require.NoError(err)
+	assert.Equal("1", sealKeyID)
+	assert.Len(sealKeys, 1)
+
+	// rotation adds a version and keeps the previous ones
+	assert.Error(c.RotateSealKey(context.TODO(), other))
+	require.NoError(c.RotateSealKey(context.TODO(), admin))
+	resp, err := activate(c)
+	require.NoError(err)
+	assert.Equal("2", resp.Parameters.Env["SEAL_KEY_ID"])
+	assert.Equal(hex.EncodeToString(sealKeys["1"].Private), resp.Parameters.Env["SEAL_KEY_1"])
+	assert.NotEqual(resp.Parameters.Env["SEAL_KEY_1"], resp.Parameters.Env["SEAL_KEY"])
+	sealKeyID, sealKeys, err = c.deriveSealKeys(marbleUUID)
+	require.NoError(err)
+	assert.Equal(hex.EncodeToString(sealKeys[sealKeyID].Private), resp.Parameters.Env["SEAL_KEY"])
+
+	// the master keys are exported encrypted to the recovery keys
+	_, err = c.ExportSealKeys(context.TODO(), other)
+	assert.Error(err)
+	exported, err := c.ExportSealKeys(context.TODO(), admin)
+	require.NoError(err)
+	require.Len(exported["testRecKey1"], 2)
+	decrypted := make(map[string][]byte)
+	for version, encryptedKey := range exported["testRecKey1"] {
+		decrypted[version], err = util.DecryptOAEP(test.RecoveryPrivateKey, encryptedKey)
+		require.NoError(err)
+	}
+	rawSealKeys, err := json.Marshal(decrypted)
+	require.NoError(err)
+
+	// keys can not be imported once marbles have been activated
+	assert.Error(c.ImportSealKeys(context.TODO(), rawSealKeys, admin))
+
+	// a Coordinator set up from scratch derives the same seal keys from the imported master keys
+	c = setup()
+	assert.Error(c.ImportSealKeys(context.TODO(), rawSealKeys, other))
+	assert.Error(c.ImportSealKeys(context.TODO(), []byte(`{"1": "AAAA"}`), admin))
+	require.NoError(c.ImportSealKeys(context.TODO(), rawSealKeys, admin))
+	importedID, importedKeys, err := c.deriveSealKeys(marbleUUID)
+	require.NoError(err)
+	assert.Equal(sealKeyID, importedID)
+	assert.Equal(sealKeys, importedKeys)
+
+	// states without seal master keys keep deriving seal keys from the Coordinator's key derivation secret
+	c, _ = mustSetup()
+	sealKeyID, sealKeys, err = c.deriveSealKeys(marbleUUID)
+	require.NoError(err)
+	assert.Equal("0", sealKeyID)
+	rootKeyDerive, err := c.getKeyDerivationSecret()
+	require.NoError(err)
+	uuidBytes, err := marbleUUID.MarshalBinary()
+	require.NoError(err)
+	legacyKey, err := util.DeriveKey(rootKeyDerive, uuidBytes, 32)
+	require.NoError(err)
+	assert.Equal(legacyKey, []byte(sealKeys["0"].Private))
+}
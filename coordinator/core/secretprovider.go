@@ -0,0 +1,264 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/secretprovider"
+	"github.com/edgelesssys/marblerun/coordinator/store"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// remoteSecretStatus holds the state of a secret fetched from a secret provider
+type remoteSecretStatus struct {
+	// LastFetched is the time the secret was last fetched successfully
+	LastFetched time.Time
+	// LastAttempt is the time of the last failed attempt to fetch the secret
+	LastAttempt time.Time
+	// Failures is the number of failed attempts since the secret was last fetched successfully
+	Failures uint
+	// LastError describes why the last attempt failed
+	LastError string
+}
+
+// remoteSecretRetryDelay is the delay before a failed fetch is retried. It doubles with every further failure up to the refresh interval.
+const remoteSecretRetryDelay = 30 * time.Second
+
+// due returns true if the secret should be fetched again
+func (s remoteSecretStatus) due(refresh time.Duration, now time.Time) bool {
+	if now.Sub(s.LastFetched) < refresh {
+		return false
+	}
+	if s.Failures == 0 {
+		return true
+	}
+	delay := remoteSecretRetryDelay
+	for i := uint(1); i < s.Failures && delay < refresh; i++ {
+		delay *= 2
+	}
+	if delay > refresh {
+		delay = refresh
+	}
+	return now.Sub(s.LastAttempt) >= delay
+}
+
+// fetchRemoteSecrets fetches all secrets of the manifest which have a source
+func (c *Core) fetchRemoteSecrets(ctx context.Context, mnf manifest.Manifest) (map[string]manifest.Secret, error) {
+	remoteSecrets := make(map[string]manifest.Secret)
+	for name, definition := range mnf.Secrets {
+		if definition.Source == nil {
+			continue
+		}
+		secret, err := c.fetchRemoteSecret(ctx, mnf, name)
+		if err != nil {
+			return nil, err
+		}
+		remoteSecrets[name] = secret
+	}
+	return remoteSecrets, nil
+}
+
+// fetchRemoteSecret fetches a secret from its provider. The Coordinator authenticates with its root certificate.
+func (c *Core) fetchRemoteSecret(ctx context.Context, mnf manifest.Manifest, name string) (manifest.Secret, error) {
+	definition := mnf.Secrets[name]
+	clientCert, err := c.GetTLSRootCertificate(nil)
+	if err != nil {
+		return manifest.Secret{}, err
+	}
+	provider, err := secretprovider.New(mnf.SecretProviders[definition.Source.Provider], *clientCert)
+	if err != nil {
+		return manifest.Secret{}, err
+	}
+	userSecret, err := provider.GetSecret(ctx, definition.Source.Path)
+	if err != nil {
+		return manifest.Secret{}, fmt.Errorf("fetching secret %s from %s: %w", name, definition.Source.Provider, err)
+	}
+	return manifest.ParseUserSecret(name, userSecret, definition)
+}
+
+// RunSecretRefresh fetches the secrets of secret providers whose refresh interval has elapsed in the given interval until ctx is done.
+// The interval must be positive.
+func (c *Core) RunSecretRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.refreshRemoteSecrets(ctx); err != nil {
+			c.zaplogger.Error("Refreshing remote secrets failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshRemoteSecrets fetches the secrets whose refresh interval has elapsed since they were last fetched
+//
+// The secrets are fetched without holding the lock of the Core, so slow secret providers do not block activations.
+// If a refresh fails, the cached value is kept and the failure is recorded. The fetch is retried with an increasing delay.
+func (c *Core) refreshRemoteSecrets(ctx context.Context) error {
+	mnf, due, err := c.dueRemoteSecrets(time.Now())
+	if err != nil || len(due) <= 0 {
+		return err
+	}
+
+	fetched := make(map[string]manifest.Secret)
+	failed := make(map[string]error)
+	for _, name := range due {
+		secret, err := c.fetchRemoteSecret(ctx, mnf, name)
+		if err != nil {
+			c.zaplogger.Warn("Refreshing remote secret failed", zap.String("secret", name), zap.Error(err))
+			failed[name] = err
+			continue
+		}
+		fetched[name] = secret
+	}
+
+	return c.storeRemoteSecrets(ctx, fetched, failed, time.Now())
+}
+
+// dueRemoteSecrets returns the manifest and the names of the secrets which should be fetched again
+func (c *Core) dueRemoteSecrets(now time.Time) (manifest.Manifest, []string, error) {
+	defer c.mux.Unlock()
+
+	// there is nothing to refresh as long as no manifest is set
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return manifest.Manifest{}, nil, nil
+	}
+
+	mnf, err := c.data.getManifest()
+	if err != nil {
+		return manifest.Manifest{}, nil, err
+	}
+
+	var due []string
+	for name, definition := range mnf.Secrets {
+		if definition.Source == nil || definition.Source.Refresh() == 0 {
+			continue
+		}
+		remoteStatus, err := c.data.getRemoteSecretStatus(name)
+		if err != nil && !store.IsStoreValueUnsetError(err) {
+			return manifest.Manifest{}, nil, err
+		}
+		if remoteStatus.due(definition.Source.Refresh(), now) {
+			due = append(due, name)
+		}
+	}
+	return mnf, due, nil
+}
+
+// storeRemoteSecrets saves the fetched secrets and the failed attempts, and (re-)issues the certificates signed by changed secrets
+func (c *Core) storeRemoteSecrets(ctx context.Context, fetched map[string]manifest.Secret, failed map[string]error, now time.Time) error {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return err
+	}
+
+	mnf, err := c.data.getManifest()
+	if err != nil {
+		return err
+	}
+
+	refreshed := make(map[string]manifest.Secret)
+	for name, secret := range fetched {
+		// the manifest may have been updated while fetching
+		if mnf.Secrets[name].Source == nil {
+			delete(fetched, name)
+			continue
+		}
+		current, err := c.data.getSecret(name)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(current.Private, secret.Private) || !bytes.Equal(current.Cert.Raw, secret.Cert.Raw) {
+			refreshed[name] = secret
+		}
+	}
+
+	var reissued reissuedCertificates
+	if len(refreshed) > 0 {
+		reissued, err = c.reissueCertificates(ctx, refreshed, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	txdata := storeWrapper{tx}
+
+	for name := range fetched {
+		if err := txdata.putRemoteSecretStatus(name, remoteSecretStatus{LastFetched: now}); err != nil {
+			return err
+		}
+	}
+	c.updateLogger.Reset()
+	for name, fetchErr := range failed {
+		if mnf.Secrets[name].Source == nil {
+			continue
+		}
+		remoteStatus, err := txdata.getRemoteSecretStatus(name)
+		if err != nil && !store.IsStoreValueUnsetError(err) {
+			return err
+		}
+		remoteStatus.LastAttempt = now
+		remoteStatus.Failures++
+		remoteStatus.LastError = fetchErr.Error()
+		if err := txdata.putRemoteSecretStatus(name, remoteStatus); err != nil {
+			return err
+		}
+		c.updateLogger.Info("fetching secret failed", zap.String("secret", name), zap.String("provider", mnf.Secrets[name].Source.Provider), zap.Uint("failures", remoteStatus.Failures))
+	}
+	for name, secret := range refreshed {
+		if err := txdata.putSecret(name, secret); err != nil {
+			return err
+		}
+		if err := txdata.appendSecretHistory(name, secret, ""); err != nil {
+			return err
+		}
+		c.updateLogger.Info("secret fetched", zap.String("secret", name), zap.String("provider", secret.Source.Provider))
+	}
+	if err := reissued.put(txdata, c.updateLogger, nil); err != nil {
+		return err
+	}
+	if err := txdata.appendUpdateLog(c.updateLogger.String()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkRemoteSecrets rejects the activation of marbles if the last refresh of a secret failed which requires it
+func (c *Core) checkRemoteSecrets(mnf manifest.Manifest) error {
+	for name, definition := range mnf.Secrets {
+		if definition.Source == nil || definition.Source.OnFailure != manifest.OnFailureFail {
+			continue
+		}
+		remoteStatus, err := c.data.getRemoteSecretStatus(name)
+		if store.IsStoreValueUnsetError(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if remoteStatus.Failures > 0 {
+			c.zaplogger.Error("Rejecting activation, refreshing remote secret failed", zap.String("secret", name), zap.String("error", remoteStatus.LastError))
+			return status.Errorf(codes.Unavailable, "refreshing secret %s failed", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/quote"
+	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/edgelesssys/marblerun/coordinator/store"
+	"github.com/edgelesssys/marblerun/test"
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubSecretProvider is a local stand-in for a secret provider
+type stubSecretProvider struct {
+	mux         sync.Mutex
+	key         []byte
+	unavailable bool
+	clientCerts [][]byte
+}
+
+func (p *stubSecretProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if len(r.TLS.PeerCertificates) > 0 {
+		p.clientCerts = append(p.clientCerts, r.TLS.PeerCertificates[0].Raw)
+	}
+	if p.unavailable || r.URL.Path != "/secrets/db-key" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	json.NewEncoder(w).Encode(manifest.UserSecret{Key: p.key})
+}
+
+func (p *stubSecretProvider) set(key []byte, unavailable bool) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.key = key
+	p.unavailable = unavailable
+}
+
+func TestRemoteSecrets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	provider := &stubSecretProvider{key: []byte("0123456789abcdef")}
+	server := httptest.NewUnstartedServer(provider)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	rootCA, err := json.Marshal(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+	require.NoError(err)
+	newManifest := func(onFailure string) string {
+		rawManifest := strings.Replace(test.ManifestJSON, `"Secrets": {
+		"symmetric_key_shared"`, `"Secrets": {
+		"remote_key": {
+			"Size": 128,
+			"Shared": true,
+			"Type": "symmetric-key",
+			"Source": {
+				"Provider": "vault",
+				"Path": "db-key",
+				"RefreshInterval": "1h",
+				"OnFailure": "`+onFailure+`"
+			}
+		},
+		"symmetric_key_shared"`, 1)
+		rawManifest = strings.Replace(rawManifest, `"SEAL_KEY": "{{ hex .Marblerun.SealKey }}"
+				}
+			}
+		}`, `"SEAL_KEY": "{{ hex .Marblerun.SealKey }}",
+					"REMOTE_KEY": "{{ raw .Secrets.remote_key }}"
+				}
+			}
+		}`, 1)
+		return strings.TrimSuffix(strings.TrimSpace(rawManifest), "}") + fmt.Sprintf(`,
+	"SecretProviders": {
+		"vault": {
+			"Type": "http",
+			"URL": "%s/secrets",
+			"RootCA": %s
+		}
+	}
+}`, server.URL, rootCA)
+	}
+
+	c := NewCoreWithMocks()
+	_, err = c.SetManifest(context.TODO(), []byte(newManifest(manifest.OnFailureFail)))
+	require.NoError(err)
+
+	// the secret is fetched when the manifest is set
+	secret, err := c.data.getSecret("remote_key")
+	require.NoError(err)
+	assert.Equal([]byte("0123456789abcdef"), []byte(secret.Private))
+
+	// the Coordinator authenticated with its root certificate
+	rootCert, err := c.data.getCertificate(sKCoordinatorRootCert)
+	require.NoError(err)
+	require.NotEmpty(provider.clientCerts)
+	assert.Equal(rootCert.Raw, provider.clientCerts[0])
+
+	var mnf manifest.Manifest
+	require.NoError(json.Unmarshal([]byte(test.ManifestJSON), &mnf))
+	activate := func() (*rpc.ActivationResp, error) {
+		cert, csr, _ := util.MustGenerateTestMarbleCredentials()
+		marbleQuote, err := c.qi.Issue(cert.Raw)
+		require.NoError(err)
+		c.qv.(*quote.MockValidator).AddValidQuote(marbleQuote, cert.Raw, mnf.Packages["frontend"], mnf.Infrastructures["Azure"])
+		return c.Activate(peerContext(cert), &rpc.ActivationReq{
+			CSR:        csr,
+			MarbleType: "frontend",
+			Quote:      marbleQuote,
+			UUID:       uuid.New().String(),
+		})
+	}
+	expireRefreshInterval := func() {
+		tx, err := c.store.BeginTransaction()
+		require.NoError(err)
+		require.NoError(storeWrapper{tx}.putRemoteSecretStatus("remote_key", remoteSecretStatus{LastFetched: time.Now().Add(-2 * time.Hour)}))
+		require.NoError(tx.Commit())
+	}
+
+	requests := func() int {
+		provider.mux.Lock()
+		defer provider.mux.Unlock()
+		return len(provider.clientCerts)
+	}
+
+	// the cached value is used within the refresh interval
+	provider.set([]byte("fedcba9876543210"), false)
+	require.NoError(c.refreshRemoteSecrets(context.TODO()))
+	resp, err := activate()
+	require.NoError(err)
+	assert.Equal("0123456789abcdef", resp.Parameters.Env["REMOTE_KEY"])
+
+	// the secret is fetched again after the refresh interval
+	expireRefreshInterval()
+	require.NoError(c.refreshRemoteSecrets(context.TODO()))
+	resp, err = activate()
+	require.NoError(err)
+	assert.Equal("fedcba9876543210", resp.Parameters.Env["REMOTE_KEY"])
+	history, err := c.data.getSecretHistory("remote_key")
+	require.NoError(err)
+	assert.Len(history, 2)
+
+	// failed refreshes are recorded and activations fail
+	provider.set(nil, true)
+	expireRefreshInterval()
+	require.NoError(c.refreshRemoteSecrets(context.TODO()))
+	remoteStatus, err := c.data.getRemoteSecretStatus("remote_key")
+	require.NoError(err)
+	assert.EqualValues(1, remoteStatus.Failures)
+	assert.NotEmpty(remoteStatus.LastError)
+	updateLog, err := c.data.getUpdateLog()
+	require.NoError(err)
+	assert.Contains(updateLog, "fetching secret failed")
+	_, err = activate()
+	assert.Error(err)
+
+	// the fetch is not retried before the retry delay elapsed
+	count := requests()
+	require.NoError(c.refreshRemoteSecrets(context.TODO()))
+	assert.Equal(count, requests())
+
+	// a successful retry allows activations again
+	provider.set([]byte("fedcba9876543210"), false)
+	remoteStatus.LastAttempt = time.Now().Add(-remoteSecretRetryDelay)
+	tx, err := c.store.BeginTransaction()
+	require.NoError(err)
+	require.NoError(storeWrapper{tx}.putRemoteSecretStatus("remote_key", remoteStatus))
+	require.NoError(tx.Commit())
+	require.NoError(c.refreshRemoteSecrets(context.TODO()))
+	remoteStatus, err = c.data.getRemoteSecretStatus("remote_key")
+	require.NoError(err)
+	assert.Zero(remoteStatus.Failures)
+	_, err = activate()
+	assert.NoError(err)
+
+	// the manifest can not be set if the secret provider is unavailable
+	provider.set(nil, true)
+	c2 := NewCoreWithMocks()
+	_, err = c2.SetManifest(context.TODO(), []byte(newManifest(manifest.OnFailureCached)))
+	assert.Error(err)
+
+	// with cached failure behavior, activations continue with the last value
+	provider.set([]byte("0123456789abcdef"), false)
+	_, err = c2.SetManifest(context.TODO(), []byte(newManifest(manifest.OnFailureCached)))
+	require.NoError(err)
+	c = c2
+	provider.set(nil, true)
+	expireRefreshInterval()
+	require.NoError(c.refreshRemoteSecrets(context.TODO()))
+	resp, err = activate()
+	require.NoError(err)
+	assert.Equal("0123456789abcdef", resp.Parameters.Env["REMOTE_KEY"])
+	_, err = c.data.getRemoteSecretStatus("other")
+	assert.True(store.IsStoreValueUnsetError(err))
+}
+
+func TestRemoteSecretStatusDue(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	refresh := time.Hour
+
+	assert.True(remoteSecretStatus{}.due(refresh, now))
+	assert.False(remoteSecretStatus{LastFetched: now.Add(-time.Minute)}.due(refresh, now))
+	assert.True(remoteSecretStatus{LastFetched: now.Add(-refresh)}.due(refresh, now))
+
+	// failed attempts are retried with an increasing delay
+	failed := remoteSecretStatus{LastFetched: now.Add(-2 * refresh), LastAttempt: now.Add(-45 * time.Second), Failures: 1}
+	assert.True(failed.due(refresh, now))
+	failed.Failures = 2
+	assert.False(failed.due(refresh, now))
+	failed.LastAttempt = now.Add(-remoteSecretRetryDelay * 2)
+	assert.True(failed.due(refresh, now))
+
+	// the delay does not exceed the refresh interval
+	failed.Failures = 100
+	failed.LastAttempt = now.Add(-refresh + time.Second)
+	assert.False(failed.due(refresh, now))
+	failed.LastAttempt = now.Add(-refresh)
+	assert.True(failed.due(refresh, now))
+}
@@ -0,0 +1,192 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/edgelesssys/marblerun/coordinator/spiffe"
+	"github.com/edgelesssys/marblerun/coordinator/store"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetJWTSVID implements the MarbleAPI function to issue SPIFFE JWT-SVIDs for activated marbles (implements the MarbleServer interface)
+func (c *Core) GetJWTSVID(ctx context.Context, req *rpc.JWTSVIDReq) (*rpc.JWTSVIDResp, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "cannot accept marbles in current state")
+	}
+	if c.caConfig.SPIFFETrustDomain == "" {
+		return nil, status.Error(codes.FailedPrecondition, "SPIFFE is not enabled")
+	}
+	if len(req.GetAudience()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "JWT-SVIDs require an audience")
+	}
+
+	marbleUUID, marbleType, err := c.verifyActivatedMarble(getClientTLSCert(ctx))
+	if err != nil {
+		return nil, err
+	}
+	privK, err := c.getSPIFFEJWTKey()
+	if err != nil {
+		return nil, err
+	}
+	spiffeID := spiffe.ID(c.caConfig.SPIFFETrustDomain, marbleType, marbleUUID).String()
+	svid, err := spiffe.SignJWTSVID(privK, spiffeID, req.GetAudience(), time.Now().Add(spiffe.JWTSVIDValidity))
+	if err != nil {
+		return nil, err
+	}
+
+	c.zaplogger.Info("Issued JWT-SVID for Marble", zap.String("SPIFFEID", spiffeID), zap.Strings("Audience", req.GetAudience()))
+	return &rpc.JWTSVIDResp{SVID: svid}, nil
+}
+
+// GetJWTBundle implements the MarbleAPI function to get the keys JWT-SVIDs are signed with (implements the MarbleServer interface)
+func (c *Core) GetJWTBundle(ctx context.Context, req *rpc.JWTBundleReq) (*rpc.JWTBundleResp, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "cannot accept marbles in current state")
+	}
+	if c.caConfig.SPIFFETrustDomain == "" {
+		return nil, status.Error(codes.FailedPrecondition, "SPIFFE is not enabled")
+	}
+	if _, _, err := c.verifyActivatedMarble(getClientTLSCert(ctx)); err != nil {
+		return nil, err
+	}
+
+	privK, err := c.getSPIFFEJWTKey()
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := spiffe.NewBundle(nil, []crypto.PublicKey{privK.Public()})
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.JWTBundleResp{Bundle: bundle}, nil
+}
+
+// GetSPIFFEBundle returns the SPIFFE trust bundle of the Marbles, containing the X.509 and JWT authorities
+func (c *Core) GetSPIFFEBundle(ctx context.Context) ([]byte, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, err
+	}
+	if c.caConfig.SPIFFETrustDomain == "" {
+		return nil, errors.New("SPIFFE is not enabled")
+	}
+
+	authorities, _, err := c.spiffeX509Authorities()
+	if err != nil {
+		return nil, err
+	}
+	privK, err := c.getSPIFFEJWTKey()
+	if err != nil {
+		return nil, err
+	}
+	return spiffe.NewBundle(authorities, []crypto.PublicKey{privK.Public()})
+}
+
+// spiffeX509Authorities returns the X.509 authorities of the trust domain and the intermediate CAs which chain X509-SVIDs to them
+//
+// The authority is the root certificate of the Coordinator, which, unlike the Marble root certificate, is kept on manifest updates.
+// During a rotation of the root CA, the previous root is trusted as well and the cross-signed root chains new X509-SVIDs to it.
+func (c *Core) spiffeX509Authorities() ([]*x509.Certificate, []*x509.Certificate, error) {
+	rootCert, err := c.data.getCertificate(sKCoordinatorRootCert)
+	if err != nil {
+		return nil, nil, err
+	}
+	intermediateCert, err := c.data.getCertificate(skCoordinatorIntermediateCert)
+	if err != nil {
+		return nil, nil, err
+	}
+	authorities := []*x509.Certificate{rootCert}
+	intermediates := []*x509.Certificate{intermediateCert}
+
+	transition, err := c.getRootCATransition()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(transition.PreviousRoot) > 0 {
+		previousRoot, err := x509.ParseCertificate(transition.PreviousRoot)
+		if err != nil {
+			return nil, nil, err
+		}
+		crossSignedRoot, err := x509.ParseCertificate(transition.CrossSignedRoot)
+		if err != nil {
+			return nil, nil, err
+		}
+		authorities = append(authorities, previousRoot)
+		intermediates = append(intermediates, crossSignedRoot)
+	}
+	return authorities, intermediates, nil
+}
+
+// setSPIFFEEnvironment passes the X509-SVID of a marble with its intermediate CAs and the X.509 authorities to the marble
+func (c *Core) setSPIFFEEnvironment(params *rpc.Parameters, marbleCert manifest.Certificate) error {
+	authorities, intermediates, err := c.spiffeX509Authorities()
+	if err != nil {
+		return err
+	}
+	svid := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: marbleCert.Raw})
+	for _, cert := range intermediates {
+		svid = append(svid, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	var bundle []byte
+	for _, cert := range authorities {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	if params.Env == nil {
+		params.Env = make(map[string]string)
+	}
+	params.Env[spiffe.EnvironmentX509SVID] = string(svid)
+	params.Env[spiffe.EnvironmentX509Bundle] = string(bundle)
+	return nil
+}
+
+// getSPIFFEJWTKey returns the key JWT-SVIDs are signed with. It is generated on first use.
+func (c *Core) getSPIFFEJWTKey() (*ecdsa.PrivateKey, error) {
+	privK, err := c.data.getPrivK(sKSPIFFEJWTKey)
+	if err == nil {
+		ecdsaKey, ok := privK.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("invalid SPIFFE JWT signing key")
+		}
+		return ecdsaKey, nil
+	}
+	if !store.IsStoreValueUnsetError(err) {
+		return nil, err
+	}
+
+	newPrivK, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := c.store.BeginTransaction()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := (storeWrapper{tx}).putPrivK(sKSPIFFEJWTKey, newPrivK); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return newPrivK, nil
+}
@@ -0,0 +1,191 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	libMarble "github.com/edgelesssys/ego/marble"
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/quote"
+	"github.com/edgelesssys/marblerun/coordinator/recovery"
+	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/edgelesssys/marblerun/coordinator/seal"
+	"github.com/edgelesssys/marblerun/coordinator/spiffe"
+	"github.com/edgelesssys/marblerun/test"
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSPIFFE(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var mnf manifest.Manifest
+	require.NoError(json.Unmarshal([]byte(test.ManifestJSON), &mnf))
+
+	validator := quote.NewMockValidator()
+	issuer := quote.NewMockIssuer()
+	zapLogger, err := zap.NewDevelopment()
+	require.NoError(err)
+	defer zapLogger.Sync()
+	coreServer, err := NewCore([]string{"localhost"}, CAConfig{SPIFFETrustDomain: "example.org"}, validator, issuer, &seal.MockSealer{}, recovery.NewSinglePartyRecovery(), zapLogger, nil)
+	require.NoError(err)
+	_, err = coreServer.SetManifest(context.TODO(), []byte(test.ManifestJSON))
+	require.NoError(err)
+
+	// activate a marble
+	cert, csr, _ := util.MustGenerateTestMarbleCredentials()
+	quote, err := issuer.Issue(cert.Raw)
+	require.NoError(err)
+	validator.AddValidQuote(quote, cert.Raw, mnf.Packages["frontend"], mnf.Infrastructures["Azure"])
+	marbleUUID := uuid.New().String()
+	resp, err := coreServer.Activate(peerContext(cert), &rpc.ActivationReq{
+		CSR:        csr,
+		MarbleType: "frontend",
+		Quote:      quote,
+		UUID:       marbleUUID,
+	})
+	require.NoError(err)
+	pMarbleCert, _ := pem.Decode([]byte(resp.GetParameters().Env[libMarble.MarbleEnvironmentCertificateChain]))
+	require.NotNil(pMarbleCert)
+	marbleCert, err := x509.ParseCertificate(pMarbleCert.Bytes)
+	require.NoError(err)
+
+	// the marble certificate is an X509-SVID
+	spiffeID, err := spiffe.IDFromCertificate(marbleCert)
+	require.NoError(err)
+	assert.Equal("spiffe://example.org/frontend/"+marbleUUID, spiffeID.String())
+
+	// JWT-SVIDs are only issued to activated marbles and require an audience
+	_, err = coreServer.GetJWTSVID(peerContext(cert), &rpc.JWTSVIDReq{Audience: []string{"backend"}})
+	assert.Error(err)
+	_, err = coreServer.GetJWTSVID(peerContext(marbleCert), &rpc.JWTSVIDReq{})
+	assert.Error(err)
+	svidResp, err := coreServer.GetJWTSVID(peerContext(marbleCert), &rpc.JWTSVIDReq{Audience: []string{"backend"}})
+	require.NoError(err)
+
+	bundleResp, err := coreServer.GetJWTBundle(peerContext(marbleCert), &rpc.JWTBundleReq{})
+	require.NoError(err)
+	subject, _, err := spiffe.ValidateJWTSVID(svidResp.GetSVID(), bundleResp.GetBundle(), "backend")
+	require.NoError(err)
+	assert.Equal(spiffeID.String(), subject)
+
+	// the trust bundle contains both the X.509 and the JWT authority
+	bundle, err := coreServer.GetSPIFFEBundle(context.TODO())
+	require.NoError(err)
+	_, _, err = spiffe.ValidateJWTSVID(svidResp.GetSVID(), bundle, "backend")
+	assert.NoError(err)
+	var jwks struct{ Keys []map[string]interface{} }
+	require.NoError(json.Unmarshal(bundle, &jwks))
+	require.Len(jwks.Keys, 2)
+	assert.Equal("x509-svid", jwks.Keys[0]["use"])
+	assert.Equal("jwt-svid", jwks.Keys[1]["use"])
+}
+
+func TestSPIFFEDisabled(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSON))
+	require.NoError(err)
+
+	_, err = c.GetSPIFFEBundle(context.TODO())
+	assert.Error(err)
+	_, err = c.GetJWTBundle(context.TODO(), &rpc.JWTBundleReq{})
+	assert.Error(err)
+}
+
+func TestSPIFFETrustAnchor(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var mnf manifest.Manifest
+	require.NoError(json.Unmarshal([]byte(test.ManifestJSONWithRecoveryKey), &mnf))
+
+	validator := quote.NewMockValidator()
+	issuer := quote.NewMockIssuer()
+	zapLogger, err := zap.NewDevelopment()
+	require.NoError(err)
+	defer zapLogger.Sync()
+	c, err := NewCore([]string{"localhost"}, CAConfig{SPIFFETrustDomain: "example.org"}, validator, issuer, &seal.MockSealer{}, recovery.NewSinglePartyRecovery(), zapLogger, nil)
+	require.NoError(err)
+	_, err = c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+
+	activate := func() map[string]string {
+		cert, csr, _ := util.MustGenerateTestMarbleCredentials()
+		quote, err := issuer.Issue(cert.Raw)
+		require.NoError(err)
+		validator.AddValidQuote(quote, cert.Raw, mnf.Packages["frontend"], mnf.Infrastructures["Azure"])
+		resp, err := c.Activate(peerContext(cert), &rpc.ActivationReq{
+			CSR:        csr,
+			MarbleType: "frontend",
+			Quote:      quote,
+			UUID:       uuid.New().String(),
+		})
+		require.NoError(err)
+		return resp.GetParameters().Env
+	}
+	parseCerts := func(data string) []*x509.Certificate {
+		var certs []*x509.Certificate
+		for rest := []byte(data); ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				return certs
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			require.NoError(err)
+			certs = append(certs, cert)
+		}
+	}
+	verify := func(svidPEM, bundlePEM string) error {
+		svid := parseCerts(svidPEM)
+		require.NotEmpty(svid)
+		opts := x509.VerifyOptions{Roots: x509.NewCertPool(), Intermediates: x509.NewCertPool()}
+		for _, cert := range parseCerts(bundlePEM) {
+			opts.Roots.AddCert(cert)
+		}
+		for _, cert := range svid[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := svid[0].Verify(opts)
+		return err
+	}
+
+	// the X.509 authority is the root certificate of the Coordinator
+	env := activate()
+	rootCert, err := c.data.getCertificate(sKCoordinatorRootCert)
+	require.NoError(err)
+	bundleCerts := parseCerts(env[spiffe.EnvironmentX509Bundle])
+	require.Len(bundleCerts, 1)
+	assert.Equal(rootCert.Raw, bundleCerts[0].Raw)
+	assert.NoError(verify(env[spiffe.EnvironmentX509SVID], env[spiffe.EnvironmentX509Bundle]))
+	authorities, _, err := c.spiffeX509Authorities()
+	require.NoError(err)
+	require.Len(authorities, 1)
+	assert.Equal(rootCert.Raw, authorities[0].Raw)
+
+	// the previous and the new root are trusted during a rotation of the root CA
+	admin, err := c.data.getUser("admin")
+	require.NoError(err)
+	require.NoError(c.RotateRootCA(context.TODO(), admin))
+	rotatedEnv := activate()
+	assert.Len(parseCerts(rotatedEnv[spiffe.EnvironmentX509Bundle]), 2)
+	assert.NoError(verify(rotatedEnv[spiffe.EnvironmentX509SVID], env[spiffe.EnvironmentX509Bundle]))
+	assert.NoError(verify(rotatedEnv[spiffe.EnvironmentX509SVID], rotatedEnv[spiffe.EnvironmentX509Bundle]))
+	assert.NoError(verify(env[spiffe.EnvironmentX509SVID], rotatedEnv[spiffe.EnvironmentX509Bundle]))
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// signSSHCertificates signs the OpenSSH certificates of all newly generated secrets which request one.
+func (c *Core) signSSHCertificates(newSecrets map[string]manifest.Secret, secrets map[string]manifest.Secret) error {
+	for name, secret := range newSecrets {
+		if secret.SSHCertificate == nil {
+			continue
+		}
+
+		issuerName := secret.SSHCertificate.Issuer
+		issuer, err := c.lookupIssuer(issuerName, newSecrets, secrets)
+		if err != nil {
+			return fmt.Errorf("signing SSH certificate for secret %s: %w", name, err)
+		}
+
+		signedSecret, err := signSSHCertificate(secret, issuer)
+		if err != nil {
+			c.zaplogger.Error("Failed to sign SSH certificate", zap.String("name", name), zap.String("issuer", issuerName), zap.Error(err))
+			return err
+		}
+		newSecrets[name] = signedSecret
+	}
+	return nil
+}
+
+// signSSHCertificate creates the OpenSSH certificate of secret signed by issuer
+func signSSHCertificate(secret manifest.Secret, issuer manifest.Secret) (manifest.Secret, error) {
+	pubKey, err := x509.ParsePKIXPublicKey(secret.Public)
+	if err != nil {
+		return manifest.Secret{}, err
+	}
+	sshPubKey, err := ssh.NewPublicKey(pubKey)
+	if err != nil {
+		return manifest.Secret{}, err
+	}
+	issuerKey, err := x509.ParsePKCS8PrivateKey(issuer.Private)
+	if err != nil {
+		return manifest.Secret{}, err
+	}
+	signer, err := ssh.NewSignerFromKey(issuerKey)
+	if err != nil {
+		return manifest.Secret{}, err
+	}
+
+	serial := make([]byte, 8)
+	if _, err := rand.Read(serial); err != nil {
+		return manifest.Secret{}, err
+	}
+	validFor := secret.ValidFor
+	if validFor == 0 {
+		validFor = 365
+	}
+	now := time.Now()
+
+	cert := &ssh.Certificate{
+		Key:             sshPubKey,
+		Serial:          binary.BigEndian.Uint64(serial),
+		CertType:        ssh.HostCert,
+		KeyId:           secret.SSHCertificate.KeyID,
+		ValidPrincipals: secret.SSHCertificate.Principals,
+		ValidAfter:      uint64(now.Unix()),
+		ValidBefore:     uint64(now.AddDate(0, 0, int(validFor)).Unix()),
+	}
+	if secret.SSHCertificate.CertType == "user" {
+		cert.CertType = ssh.UserCert
+		// the default extensions of ssh-keygen
+		cert.Extensions = map[string]string{
+			"permit-X11-forwarding":   "",
+			"permit-agent-forwarding": "",
+			"permit-port-forwarding":  "",
+			"permit-pty":              "",
+			"permit-user-rc":          "",
+		}
+	}
+	if err := cert.SignCert(rand.Reader, signer); err != nil {
+		return manifest.Secret{}, err
+	}
+
+	// Modify a copy of the certificate definition so we do not overwrite the manifest entries
+	sshCertificate := *secret.SSHCertificate
+	sshCertificate.Raw = cert.Marshal()
+	secret.SSHCertificate = &sshCertificate
+	return secret, nil
+}
@@ -7,11 +7,13 @@
 package core
 
 import (
-	"crypto/ecdsa"
+	"crypto"
 	"crypto/x509"
 	"encoding/json"
+	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/edgelesssys/marblerun/coordinator/manifest"
 	"github.com/edgelesssys/marblerun/coordinator/quote"
@@ -20,20 +22,33 @@ import (
 )
 
 const (
-	requestActivations    = "activations"
-	requestCert           = "certificate"
-	requestInfrastructure = "infrastructure"
-	requestManifest       = "manifest"
-	requestMarble         = "marble"
-	requestPackage        = "package"
-	requestPrivKey        = "privateKey"
-	requestSecret         = "secret"
-	requestState          = "state"
-	requestTLS            = "TLS"
-	requestUser           = "user"
-	requestUpdateLog      = "updateLog"
+	requestActivatedMarble  = "activatedMarble"
+	requestActivationKey    = "activationKey"
+	requestActivations      = "activations"
+	requestCert             = "certificate"
+	requestExternalCA       = "externalCA"
+	requestInfrastructure   = "infrastructure"
+	requestKeyDerivation    = "keyDerivationSecret"
+	requestManifest         = "manifest"
+	requestMarble           = "marble"
+	requestMarbleTypeSecret = "marbleTypeSecret"
+	requestPackage          = "package"
+	requestPrivKey          = "privateKey"
+	requestRemoteSecret     = "remoteSecret"
+	requestRevokedMarble    = "revokedMarble"
+	requestRootCATransition = "rootCATransition"
+	requestSealKeys         = "sealKeys"
+	requestSecret           = "secret"
+	requestSecretHistory    = "secretHistory"
+	requestState            = "state"
+	requestTLS              = "TLS"
+	requestUser             = "user"
+	requestUpdateLog        = "updateLog"
 )
 
+// maxSecretVersions is the number of versions kept in the history of a secret
+const maxSecretVersions = 10
+
 // storeWrapper is a wrapper for the store interface
 type storeWrapper struct {
 	store interface {
@@ -60,10 +75,46 @@ func (i iteratorWrapper) HasNext() bool {
 
 // getIterator returns a wrapped iterator from store
 func (s storeWrapper) getIterator(prefix string) (iteratorWrapper, error) {
-	iter, err := s.store.Iterator(prefix)
+	iter, err := s.store.Iterator(prefix + ":")
 	return iteratorWrapper{iter, prefix}, err
 }
 
+// getActivatedMarble returns the type of an activated Marble from store
+func (s storeWrapper) getActivatedMarble(marbleUUID string) (string, error) {
+	var marbleType string
+	err := s._get(requestActivatedMarble, marbleUUID, &marbleType)
+	return marbleType, err
+}
+
+// putActivatedMarble saves the type of an activated Marble to store
+func (s storeWrapper) putActivatedMarble(marbleUUID string, marbleType string) error {
+	return s._put(requestActivatedMarble, marbleUUID, marbleType)
+}
+
+// getActivationKey returns the public key of the certificate a Marble received on activation from store
+func (s storeWrapper) getActivationKey(marbleUUID string) ([]byte, error) {
+	var publicKey []byte
+	err := s._get(requestActivationKey, marbleUUID, &publicKey)
+	return publicKey, err
+}
+
+// putActivationKey saves the public key of the certificate a Marble received on activation to store
+func (s storeWrapper) putActivationKey(marbleUUID string, publicKey []byte) error {
+	return s._put(requestActivationKey, marbleUUID, publicKey)
+}
+
+// getRevokedMarble returns the type of a revoked Marble from store
+func (s storeWrapper) getRevokedMarble(marbleUUID string) (string, error) {
+	var marbleType string
+	err := s._get(requestRevokedMarble, marbleUUID, &marbleType)
+	return marbleType, err
+}
+
+// putRevokedMarble saves the type of a revoked Marble to store
+func (s storeWrapper) putRevokedMarble(marbleUUID string, marbleType string) error {
+	return s._put(requestRevokedMarble, marbleUUID, marbleType)
+}
+
 // getActivations returns activations for a given Marble from store
 func (s storeWrapper) getActivations(marbleType string) (uint, error) {
 	request := strings.Join([]string{requestActivations, marbleType}, ":")
@@ -148,19 +199,28 @@ func (s storeWrapper) putPackage(pkgName string, pkg quote.PackageProperties) er
 }
 
 // getPrivK returns a private key from store
-func (s storeWrapper) getPrivK(keyType string) (*ecdsa.PrivateKey, error) {
+func (s storeWrapper) getPrivK(keyType string) (crypto.Signer, error) {
 	request := strings.Join([]string{requestPrivKey, keyType}, ":")
 	rawKey, err := s.store.Get(request)
 	if err != nil {
 		return nil, err
 	}
 
-	return x509.ParseECPrivateKey(rawKey)
+	privK, err := x509.ParsePKCS8PrivateKey(rawKey)
+	if err != nil {
+		// states of older versions store ECDSA keys in SEC 1 form
+		return x509.ParseECPrivateKey(rawKey)
+	}
+	signer, ok := privK.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", privK)
+	}
+	return signer, nil
 }
 
 // putPrivK saves a private key to store
-func (s storeWrapper) putPrivK(keyType string, privK *ecdsa.PrivateKey) error {
-	rawKey, err := x509.MarshalECPrivateKey(privK)
+func (s storeWrapper) putPrivK(keyType string, privK crypto.Signer) error {
+	rawKey, err := x509.MarshalPKCS8PrivateKey(privK)
 	if err != nil {
 		return err
 	}
@@ -226,6 +286,100 @@ func (s storeWrapper) getSecretMap() (map[string]manifest.Secret, error) {
 	return secretMap, nil
 }
 
+// getMarbleTypeSecret returns the value of a per-marble-type secret for the given marble type from store
+func (s storeWrapper) getMarbleTypeSecret(marbleType, secretName string) (manifest.Secret, error) {
+	var loadedSecret manifest.Secret
+	err := s._get(requestMarbleTypeSecret, strings.Join([]string{marbleType, secretName}, ":"), &loadedSecret)
+	return loadedSecret, err
+}
+
+// putMarbleTypeSecret saves the value of a per-marble-type secret for the given marble type to store
+func (s storeWrapper) putMarbleTypeSecret(marbleType, secretName string, secret manifest.Secret) error {
+	return s._put(requestMarbleTypeSecret, strings.Join([]string{marbleType, secretName}, ":"), secret)
+}
+
+// getMarbleTypeSecretMap returns a map of all per-marble-type secrets of the given marble type
+func (s storeWrapper) getMarbleTypeSecretMap(marbleType string) (map[string]manifest.Secret, error) {
+	iter, err := s.getIterator(strings.Join([]string{requestMarbleTypeSecret, marbleType}, ":"))
+	if err != nil {
+		return nil, err
+	}
+
+	secretMap := map[string]manifest.Secret{}
+	for iter.HasNext() {
+		name, err := iter.GetNext()
+		if err != nil {
+			return nil, err
+		}
+		secretMap[name], err = s.getMarbleTypeSecret(marbleType, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return secretMap, nil
+}
+
+// getSecretHistory returns the stored versions of a secret, oldest first
+func (s storeWrapper) getSecretHistory(secretName string) ([]manifest.SecretVersion, error) {
+	var history []manifest.SecretVersion
+	err := s._get(requestSecretHistory, secretName, &history)
+	return history, err
+}
+
+// putSecretHistory saves the versions of a secret to store
+func (s storeWrapper) putSecretHistory(secretName string, history []manifest.SecretVersion) error {
+	return s._put(requestSecretHistory, secretName, history)
+}
+
+// appendSecretHistory adds a new version of a secret to its history
+func (s storeWrapper) appendSecretHistory(secretName string, secret manifest.Secret, userName string) error {
+	secret.Previous = nil
+	return s.appendSecretVersion(secretName, manifest.SecretVersion{
+		User:        userName,
+		Fingerprint: secret.Fingerprint(),
+		Secret:      &secret,
+	})
+}
+
+// appendSecretDeletion adds a version without value to the history of a secret, recording that the secret was deleted
+func (s storeWrapper) appendSecretDeletion(secretName string, userName string) error {
+	return s.appendSecretVersion(secretName, manifest.SecretVersion{
+		User:    userName,
+		Deleted: true,
+	})
+}
+
+// appendSecretVersion adds a version to the history of a secret and drops the oldest versions exceeding maxSecretVersions
+func (s storeWrapper) appendSecretVersion(secretName string, secretVersion manifest.SecretVersion) error {
+	history, err := s.getSecretHistory(secretName)
+	if err != nil && !store.IsStoreValueUnsetError(err) {
+		return err
+	}
+
+	secretVersion.Version = 1
+	if len(history) > 0 {
+		secretVersion.Version = history[len(history)-1].Version + 1
+	}
+	secretVersion.Created = time.Now()
+	history = append(history, secretVersion)
+	if len(history) > maxSecretVersions {
+		history = history[len(history)-maxSecretVersions:]
+	}
+	return s.putSecretHistory(secretName, history)
+}
+
+// getRemoteSecretStatus returns the state of a secret fetched from a secret provider from store
+func (s storeWrapper) getRemoteSecretStatus(secretName string) (remoteSecretStatus, error) {
+	var remoteStatus remoteSecretStatus
+	err := s._get(requestRemoteSecret, secretName, &remoteStatus)
+	return remoteStatus, err
+}
+
+// putRemoteSecretStatus saves the state of a secret fetched from a secret provider to store
+func (s storeWrapper) putRemoteSecretStatus(secretName string, remoteStatus remoteSecretStatus) error {
+	return s._put(requestRemoteSecret, secretName, remoteStatus)
+}
+
 // getState returns the state from store
 func (s storeWrapper) getState() (state, error) {
 	rawState, err := s.store.Get("state")
@@ -270,6 +424,79 @@ func (s storeWrapper) putUpdateLog(updateLog string) error {
 	return s.store.Put(requestUpdateLog, []byte(updateLog))
 }
 
+// getRootCATransition returns the certificates of the last root CA rotation from store
+func (s storeWrapper) getRootCATransition() (rootCATransition, error) {
+	var transition rootCATransition
+	rawTransition, err := s.store.Get(requestRootCATransition)
+	if err != nil {
+		return transition, err
+	}
+	err = json.Unmarshal(rawTransition, &transition)
+	return transition, err
+}
+
+// putRootCATransition saves the certificates of a root CA rotation to store
+func (s storeWrapper) putRootCATransition(transition rootCATransition) error {
+	rawTransition, err := json.Marshal(transition)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(requestRootCATransition, rawTransition)
+}
+
+// getKeyDerivationSecret returns the key derivation secret from store
+func (s storeWrapper) getKeyDerivationSecret() ([]byte, error) {
+	return s.store.Get(requestKeyDerivation)
+}
+
+// putKeyDerivationSecret saves the key derivation secret to store
+func (s storeWrapper) putKeyDerivationSecret(derivationSecret []byte) error {
+	return s.store.Put(requestKeyDerivation, derivationSecret)
+}
+
+// getSealKeys returns the versions of the seal master key from store, oldest first
+func (s storeWrapper) getSealKeys() ([]sealKey, error) {
+	var keys []sealKey
+	rawKeys, err := s.store.Get(requestSealKeys)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(rawKeys, &keys)
+	return keys, err
+}
+
+// putSealKeys saves the versions of the seal master key to store
+func (s storeWrapper) putSealKeys(keys []sealKey) error {
+	rawKeys, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(requestSealKeys, rawKeys)
+}
+
+// getExternalCA returns the state of the external CA issuing the intermediate CA from store
+func (s storeWrapper) getExternalCA() (externalCA, error) {
+	var extCA externalCA
+	rawExtCA, err := s.store.Get(requestExternalCA)
+	if store.IsStoreValueUnsetError(err) {
+		return extCA, nil
+	}
+	if err != nil {
+		return extCA, err
+	}
+	err = json.Unmarshal(rawExtCA, &extCA)
+	return extCA, err
+}
+
+// putExternalCA saves the state of the external CA issuing the intermediate CA to store
+func (s storeWrapper) putExternalCA(extCA externalCA) error {
+	rawExtCA, err := json.Marshal(extCA)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(requestExternalCA, rawExtCA)
+}
+
 // appendUpdateLog appends new entries to the log and saves it to store
 func (s storeWrapper) appendUpdateLog(updateLog string) error {
 	oldLog, err := s.getUpdateLog()
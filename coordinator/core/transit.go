@@ -0,0 +1,376 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxDerivedKeySize is the maximum size in bits of keys derived from transit keys
+const maxDerivedKeySize = 4096
+
+// Encrypt implements the MarbleAPI function to encrypt data with a transit key (implements the MarbleServer interface)
+//
+// Symmetric keys use AES-GCM and prepend the nonce to the ciphertext. RSA keys use OAEP with SHA-256.
+func (c *Core) Encrypt(ctx context.Context, req *rpc.EncryptReq) (*rpc.EncryptResp, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "cannot accept marbles in current state")
+	}
+	secret, err := c.useTransitKey(ctx, req.GetSecret(), manifest.TransitOperationEncrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	var ciphertext []byte
+	if secret.Type == "symmetric-key" {
+		aead, err := newAEAD(secret.Private)
+		if err != nil {
+			return nil, err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		ciphertext = aead.Seal(nonce, nonce, req.GetPlaintext(), req.GetAdditionalData())
+	} else {
+		if len(req.GetAdditionalData()) > 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "additional data is not supported for secrets of type %s", secret.Type)
+		}
+		privK, err := parseTransitPrivateKey(secret)
+		if err != nil {
+			return nil, err
+		}
+		rsaPrivK, ok := privK.(*rsa.PrivateKey)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "secret %s does not support encryption", req.GetSecret())
+		}
+		ciphertext, err = util.EncryptOAEP(&rsaPrivK.PublicKey, req.GetPlaintext())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	return &rpc.EncryptResp{Ciphertext: ciphertext}, nil
+}
+
+// Decrypt implements the MarbleAPI function to decrypt data with a transit key (implements the MarbleServer interface)
+func (c *Core) Decrypt(ctx context.Context, req *rpc.DecryptReq) (*rpc.DecryptResp, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "cannot accept marbles in current state")
+	}
+	secret, err := c.useTransitKey(ctx, req.GetSecret(), manifest.TransitOperationDecrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	var plaintext []byte
+	if secret.Type == "symmetric-key" {
+		aead, err := newAEAD(secret.Private)
+		if err != nil {
+			return nil, err
+		}
+		ciphertext := req.GetCiphertext()
+		if len(ciphertext) < aead.NonceSize() {
+			return nil, status.Error(codes.InvalidArgument, "ciphertext is too short")
+		}
+		plaintext, err = aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], req.GetAdditionalData())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "decryption failed")
+		}
+	} else {
+		privK, err := parseTransitPrivateKey(secret)
+		if err != nil {
+			return nil, err
+		}
+		rsaPrivK, ok := privK.(*rsa.PrivateKey)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "secret %s does not support decryption", req.GetSecret())
+		}
+		plaintext, err = util.DecryptOAEP(rsaPrivK, req.GetCiphertext())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "decryption failed")
+		}
+	}
+	return &rpc.DecryptResp{Plaintext: plaintext}, nil
+}
+
+// Sign implements the MarbleAPI function to sign data with a transit key (implements the MarbleServer interface)
+//
+// Symmetric keys compute an HMAC-SHA256, RSA keys sign with PKCS #1 v1.5 and ECDSA keys sign in ASN.1 format, both over a SHA-256 digest.
+// Ed25519 keys sign the data itself.
+func (c *Core) Sign(ctx context.Context, req *rpc.SignReq) (*rpc.SignResp, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "cannot accept marbles in current state")
+	}
+	secret, err := c.useTransitKey(ctx, req.GetSecret(), manifest.TransitOperationSign)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret.Type == "symmetric-key" || secret.Type == "jwt-hmac" {
+		mac := hmac.New(sha256.New, secret.Private)
+		mac.Write(req.GetData())
+		return &rpc.SignResp{Signature: mac.Sum(nil)}, nil
+	}
+
+	privK, err := parseTransitPrivateKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privK.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", privK)
+	}
+	digest := req.GetData()
+	var opts crypto.SignerOpts = crypto.Hash(0)
+	if _, ok := signer.(ed25519.PrivateKey); !ok {
+		hash := sha256.Sum256(req.GetData())
+		digest = hash[:]
+		opts = crypto.SHA256
+	}
+	signature, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.SignResp{Signature: signature}, nil
+}
+
+// Verify implements the MarbleAPI function to verify a signature with a transit key (implements the MarbleServer interface)
+func (c *Core) Verify(ctx context.Context, req *rpc.VerifyReq) (*rpc.VerifyResp, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "cannot accept marbles in current state")
+	}
+	secret, err := c.useTransitKey(ctx, req.GetSecret(), manifest.TransitOperationVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret.Type == "symmetric-key" || secret.Type == "jwt-hmac" {
+		mac := hmac.New(sha256.New, secret.Private)
+		mac.Write(req.GetData())
+		return &rpc.VerifyResp{Valid: hmac.Equal(mac.Sum(nil), req.GetSignature())}, nil
+	}
+
+	privK, err := parseTransitPrivateKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(req.GetData())
+	var valid bool
+	switch privK := privK.(type) {
+	case *rsa.PrivateKey:
+		valid = rsa.VerifyPKCS1v15(&privK.PublicKey, crypto.SHA256, digest[:], req.GetSignature()) == nil
+	case *ecdsa.PrivateKey:
+		var signature struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(req.GetSignature(), &signature); err == nil && len(rest) == 0 {
+			valid = ecdsa.Verify(&privK.PublicKey, digest[:], signature.R, signature.S)
+		}
+	case ed25519.PrivateKey:
+		valid = ed25519.Verify(privK.Public().(ed25519.PublicKey), req.GetData(), req.GetSignature())
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", privK)
+	}
+	return &rpc.VerifyResp{Valid: valid}, nil
+}
+
+// DeriveKey implements the MarbleAPI function to derive a key from a transit key with HKDF-SHA256 (implements the MarbleServer interface)
+func (c *Core) DeriveKey(ctx context.Context, req *rpc.DeriveKeyReq) (*rpc.DeriveKeyResp, error) {
+	defer c.mux.Unlock()
+	if err := c.requireState(stateAcceptingMarbles); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "cannot accept marbles in current state")
+	}
+	if req.GetSize() == 0 || req.GetSize()%8 != 0 || req.GetSize() > maxDerivedKeySize {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid key size %d: must be a multiple of 8 up to %d", req.GetSize(), maxDerivedKeySize)
+	}
+	secret, err := c.useTransitKey(ctx, req.GetSecret(), manifest.TransitOperationDerive)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := util.DeriveKey(secret.Private, req.GetContext(), uint(req.GetSize()/8))
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.DeriveKeyResp{Key: key}, nil
+}
+
+// useTransitKey authenticates the marble, checks that its transit key policy permits the operation and
+// returns the secret. Every use of a transit key is recorded in the Coordinator's log.
+// Only the first request of a marble exceeding the rate limit of a window is recorded in the update log.
+func (c *Core) useTransitKey(ctx context.Context, secretName, operation string) (manifest.Secret, error) {
+	marbleUUID, marbleType, err := c.verifyActivatedMarble(getClientTLSCert(ctx))
+	if err != nil {
+		return manifest.Secret{}, err
+	}
+	marble, err := c.data.getMarble(marbleType)
+	if err != nil {
+		return manifest.Secret{}, err
+	}
+	policy, ok := marble.TransitKeys[secretName]
+	if !ok || !policy.Permits(operation) {
+		c.zaplogger.Warn("Marble is not allowed to use transit key", zap.String("MarbleType", marbleType), zap.String("UUID", marbleUUID), zap.String("secret", secretName), zap.String("operation", operation))
+		return manifest.Secret{}, status.Errorf(codes.PermissionDenied, "marble type %s is not allowed to %s with secret %s", marbleType, operation, secretName)
+	}
+	logFields := []zap.Field{zap.String("MarbleType", marbleType), zap.String("UUID", marbleUUID), zap.String("secret", secretName), zap.String("operation", operation)}
+
+	if allowed, firstRejection := c.transitLimiter.allow(marbleUUID+"/"+secretName, policy.RequestsPerMinute, time.Now()); !allowed {
+		c.zaplogger.Warn("Marble exceeded the rate limit of transit key", logFields...)
+		if firstRejection {
+			c.updateLogger.Reset()
+			c.updateLogger.Info("transit key rate limit exceeded", zap.String("marbleType", marbleType), zap.String("uuid", marbleUUID), zap.String("secret", secretName), zap.Uint("requests per minute", policy.RequestsPerMinute))
+			tx, err := c.store.BeginTransaction()
+			if err != nil {
+				return manifest.Secret{}, err
+			}
+			defer tx.Rollback()
+			if err := (storeWrapper{tx}).appendUpdateLog(c.updateLogger.String()); err != nil {
+				return manifest.Secret{}, err
+			}
+			if err := tx.Commit(); err != nil {
+				return manifest.Secret{}, err
+			}
+		}
+		return manifest.Secret{}, status.Errorf(codes.ResourceExhausted, "rate limit for secret %s exceeded", secretName)
+	}
+
+	secret, err := c.getTransitKey(secretName, marbleType)
+	if err != nil {
+		c.zaplogger.Warn("Marble failed to use transit key", append(logFields, zap.Error(err))...)
+		return manifest.Secret{}, err
+	}
+	c.zaplogger.Info("Marble used transit key", logFields...)
+	return secret, nil
+}
+
+// getTransitKey returns the value of a transit key for a marble type
+func (c *Core) getTransitKey(secretName, marbleType string) (manifest.Secret, error) {
+	mnf, err := c.data.getManifest()
+	if err != nil {
+		return manifest.Secret{}, err
+	}
+	var secret manifest.Secret
+	if definition := mnf.Secrets[secretName]; definition.DerivedFrom != "" {
+		secret, err = c.deriveSecret(secretName, definition, marbleType, uuid.Nil)
+		if errors.Is(err, errMasterKeyNotSet) {
+			return manifest.Secret{}, status.Errorf(codes.FailedPrecondition, "secret %s is not set", secretName)
+		}
+	} else if definition.PerMarbleType {
+		secret, err = c.data.getMarbleTypeSecret(marbleType, secretName)
+	} else {
+		secret, err = c.data.getSecret(secretName)
+	}
+	if err != nil {
+		return manifest.Secret{}, err
+	}
+	if len(secret.Private) == 0 {
+		return manifest.Secret{}, status.Errorf(codes.FailedPrecondition, "secret %s is not set", secretName)
+	}
+	return secret, nil
+}
+
+// newAEAD returns AES-GCM for a symmetric key of 128, 192 or 256 bits
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "symmetric key must have a size of 128, 192 or 256 bits for encryption")
+	}
+	return cipher.NewGCM(block)
+}
+
+// parseTransitPrivateKey parses the PKCS #8 encoded private key of a key-* or cert-* secret
+func parseTransitPrivateKey(secret manifest.Secret) (crypto.PrivateKey, error) {
+	privK, err := x509.ParsePKCS8PrivateKey(secret.Private)
+	if err != nil {
+		return nil, errors.New("failed to parse private key of transit key")
+	}
+	return privK, nil
+}
+
+// rateLimiterPruneThreshold is the number of windows from which on expired windows are removed
+const rateLimiterPruneThreshold = 1024
+
+// rateLimiter counts requests per key in fixed windows of one minute
+type rateLimiter struct {
+	mux     sync.Mutex
+	windows map[string]rateWindow
+	pruneAt int
+}
+
+type rateWindow struct {
+	start    time.Time
+	count    uint
+	rejected bool
+}
+
+// allow records a request for the key and returns false if the key already reached the limit in the current window.
+// firstRejection is true for the first rejected request of a window.
+func (r *rateLimiter) allow(key string, limit uint, now time.Time) (allowed bool, firstRejection bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.windows == nil {
+		r.windows = make(map[string]rateWindow)
+	}
+	r.prune(now)
+
+	window := r.windows[key]
+	if now.Sub(window.start) >= time.Minute {
+		window = rateWindow{start: now}
+	}
+	if window.count >= limit {
+		firstRejection = !window.rejected
+		window.rejected = true
+		r.windows[key] = window
+		return false, firstRejection
+	}
+	window.count++
+	r.windows[key] = window
+	return true, false
+}
+
+// prune removes expired windows once the number of windows reaches the threshold.
+// The threshold grows with the number of active windows, so the sweeps stay amortized.
+func (r *rateLimiter) prune(now time.Time) {
+	if r.pruneAt < rateLimiterPruneThreshold {
+		r.pruneAt = rateLimiterPruneThreshold
+	}
+	if len(r.windows) < r.pruneAt {
+		return
+	}
+	for key, window := range r.windows {
+		if now.Sub(window.start) >= time.Minute {
+			delete(r.windows, key)
+		}
+	}
+	r.pruneAt = 2 * len(r.windows)
+}
@@ -0,0 +1,193 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	libMarble "github.com/edgelesssys/ego/marble"
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/coordinator/quote"
+	"github.com/edgelesssys/marblerun/coordinator/recovery"
+	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/edgelesssys/marblerun/coordinator/seal"
+	"github.com/edgelesssys/marblerun/coordinator/user"
+	"github.com/edgelesssys/marblerun/test"
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTransit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rawManifest := strings.Replace(test.ManifestJSON, `"Package": "frontend",`, `"Package": "frontend",
+			"TransitKeys": {
+				"symmetric_key_shared": {"Operations": ["encrypt", "decrypt", "derive"], "RequestsPerMinute": 100},
+				"symmetric_key_marble_type": {"Operations": ["sign", "verify"], "RequestsPerMinute": 100},
+				"rsa_shared": {"Operations": ["encrypt", "decrypt", "sign", "verify"], "RequestsPerMinute": 100},
+				"cert_shared": {"Operations": ["sign", "verify"], "RequestsPerMinute": 3}
+			},`, 1)
+	rawManifest = strings.Replace(rawManifest, `"Secrets": {
+		"symmetric_key_shared"`, `"Secrets": {
+		"rsa_shared": {
+			"Size": 2048,
+			"Shared": true,
+			"Type": "key-rsa",
+			"TransitOnly": true
+		},
+		"symmetric_key_shared"`, 1)
+	var mnf manifest.Manifest
+	require.NoError(json.Unmarshal([]byte(rawManifest), &mnf))
+
+	validator := quote.NewMockValidator()
+	issuer := quote.NewMockIssuer()
+	observedCore, logs := observer.New(zap.InfoLevel)
+	zapLogger := zap.New(observedCore)
+	defer zapLogger.Sync()
+	coreServer, err := NewCore([]string{"localhost"}, CAConfig{}, validator, issuer, &seal.MockSealer{}, recovery.NewSinglePartyRecovery(), zapLogger, nil)
+	require.NoError(err)
+	_, err = coreServer.SetManifest(context.TODO(), []byte(rawManifest))
+	require.NoError(err)
+
+	// activate a marble
+	cert, csr, _ := util.MustGenerateTestMarbleCredentials()
+	quote, err := issuer.Issue(cert.Raw)
+	require.NoError(err)
+	validator.AddValidQuote(quote, cert.Raw, mnf.Packages["frontend"], mnf.Infrastructures["Azure"])
+	marbleUUID := uuid.New().String()
+	resp, err := coreServer.Activate(peerContext(cert), &rpc.ActivationReq{
+		CSR:        csr,
+		MarbleType: "frontend",
+		Quote:      quote,
+		UUID:       marbleUUID,
+	})
+	require.NoError(err)
+	pMarbleCert, _ := pem.Decode([]byte(resp.GetParameters().Env[libMarble.MarbleEnvironmentCertificateChain]))
+	require.NotNil(pMarbleCert)
+	marbleCert, err := x509.ParseCertificate(pMarbleCert.Bytes)
+	require.NoError(err)
+	ctx := peerContext(marbleCert)
+
+	// only activated marbles can use transit keys
+	_, err = coreServer.Encrypt(context.TODO(), &rpc.EncryptReq{Secret: "symmetric_key_shared"})
+	assert.Error(err)
+	_, err = coreServer.Encrypt(peerContext(cert), &rpc.EncryptReq{Secret: "symmetric_key_shared"})
+	assert.Error(err)
+
+	// symmetric encryption with additional data
+	encResp, err := coreServer.Encrypt(ctx, &rpc.EncryptReq{Secret: "symmetric_key_shared", Plaintext: []byte("secret"), AdditionalData: []byte("context")})
+	require.NoError(err)
+	assert.NotContains(string(encResp.Ciphertext), "secret")
+	decResp, err := coreServer.Decrypt(ctx, &rpc.DecryptReq{Secret: "symmetric_key_shared", Ciphertext: encResp.Ciphertext, AdditionalData: []byte("context")})
+	require.NoError(err)
+	assert.Equal([]byte("secret"), decResp.Plaintext)
+	_, err = coreServer.Decrypt(ctx, &rpc.DecryptReq{Secret: "symmetric_key_shared", Ciphertext: encResp.Ciphertext, AdditionalData: []byte("other")})
+	assert.Error(err)
+
+	// operations must be permitted by the policy
+	_, err = coreServer.Sign(ctx, &rpc.SignReq{Secret: "symmetric_key_shared", Data: []byte("data")})
+	assert.Error(err)
+	_, err = coreServer.Encrypt(ctx, &rpc.EncryptReq{Secret: "symmetric_key_private", Plaintext: []byte("secret")})
+	assert.Error(err)
+
+	// derived keys depend on the context
+	deriveResp, err := coreServer.DeriveKey(ctx, &rpc.DeriveKeyReq{Secret: "symmetric_key_shared", Context: []byte("a"), Size: 256})
+	require.NoError(err)
+	assert.Len(deriveResp.Key, 32)
+	otherDeriveResp, err := coreServer.DeriveKey(ctx, &rpc.DeriveKeyReq{Secret: "symmetric_key_shared", Context: []byte("b"), Size: 256})
+	require.NoError(err)
+	assert.NotEqual(deriveResp.Key, otherDeriveResp.Key)
+	_, err = coreServer.DeriveKey(ctx, &rpc.DeriveKeyReq{Secret: "symmetric_key_shared", Size: 12})
+	assert.Error(err)
+
+	// signatures with all kinds of keys
+	for _, secretName := range []string{"symmetric_key_marble_type", "rsa_shared", "cert_shared"} {
+		signResp, err := coreServer.Sign(ctx, &rpc.SignReq{Secret: secretName, Data: []byte("data")})
+		require.NoError(err, secretName)
+		verifyResp, err := coreServer.Verify(ctx, &rpc.VerifyReq{Secret: secretName, Data: []byte("data"), Signature: signResp.Signature})
+		require.NoError(err, secretName)
+		assert.True(verifyResp.Valid, secretName)
+		verifyResp, err = coreServer.Verify(ctx, &rpc.VerifyReq{Secret: secretName, Data: []byte("other"), Signature: signResp.Signature})
+		require.NoError(err, secretName)
+		assert.False(verifyResp.Valid, secretName)
+	}
+
+	// RSA encryption does not support additional data
+	encResp, err = coreServer.Encrypt(ctx, &rpc.EncryptReq{Secret: "rsa_shared", Plaintext: []byte("secret")})
+	require.NoError(err)
+	decResp, err = coreServer.Decrypt(ctx, &rpc.DecryptReq{Secret: "rsa_shared", Ciphertext: encResp.Ciphertext})
+	require.NoError(err)
+	assert.Equal([]byte("secret"), decResp.Plaintext)
+	_, err = coreServer.Encrypt(ctx, &rpc.EncryptReq{Secret: "rsa_shared", Plaintext: []byte("secret"), AdditionalData: []byte("context")})
+	assert.Error(err)
+
+	// the rate limit of cert_shared is exhausted after sign, verify and verify
+	_, err = coreServer.Sign(ctx, &rpc.SignReq{Secret: "cert_shared", Data: []byte("data")})
+	assert.Error(err)
+
+	_, err = coreServer.Sign(ctx, &rpc.SignReq{Secret: "cert_shared", Data: []byte("data")})
+	assert.Error(err)
+
+	// uses of transit keys are logged, only the first rejection of a window is recorded in the update log
+	used := logs.FilterMessage("Marble used transit key").FilterField(zap.String("secret", "rsa_shared")).FilterField(zap.String("operation", "decrypt"))
+	assert.Equal(1, used.Len())
+	assert.Equal(2, logs.FilterMessage("Marble exceeded the rate limit of transit key").Len())
+	updateLog, err := coreServer.data.getUpdateLog()
+	require.NoError(err)
+	assert.NotContains(updateLog, `"rsa_shared"`)
+	assert.Contains(updateLog, marbleUUID)
+	assert.Equal(1, strings.Count(updateLog, "transit key rate limit exceeded"))
+
+	// transit-only secrets can not be read by users
+	admin := user.NewUser("admin", nil)
+	admin.Assign(user.NewPermission(user.PermissionReadSecret, []string{"rsa_shared"}))
+	_, err = coreServer.GetSecrets(context.TODO(), []string{"rsa_shared"}, admin)
+	assert.Error(err)
+}
+
+func TestRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	var limiter rateLimiter
+	now := time.Now()
+	allow := func(key string, now time.Time) bool {
+		allowed, _ := limiter.allow(key, 2, now)
+		return allowed
+	}
+	assert.True(allow("a", now))
+	assert.True(allow("a", now))
+	allowed, firstRejection := limiter.allow("a", 2, now.Add(30*time.Second))
+	assert.False(allowed)
+	assert.True(firstRejection)
+	allowed, firstRejection = limiter.allow("a", 2, now.Add(40*time.Second))
+	assert.False(allowed)
+	assert.False(firstRejection)
+	assert.True(allow("b", now))
+	assert.True(allow("a", now.Add(time.Minute)))
+
+	// expired windows are removed once there are many of them
+	limiter = rateLimiter{}
+	for i := 0; i < rateLimiterPruneThreshold-1; i++ {
+		assert.True(allow(strconv.Itoa(i), now))
+	}
+	assert.True(allow("a", now.Add(time.Minute)))
+	assert.Len(limiter.windows, rateLimiterPruneThreshold)
+	assert.True(allow("b", now.Add(time.Minute)))
+	assert.Len(limiter.windows, 2)
+}
@@ -0,0 +1,111 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// EncodeSecretDataToAge encodes an X25519 key to the format of the age file encryption tool.
+// A key-x25519 Secret or PrivateKey results in an identity ("AGE-SECRET-KEY-1..."), a PublicKey in a recipient ("age1...").
+func EncodeSecretDataToAge(data interface{}) (string, error) {
+	var key []byte
+	hrp := "age-secret-key-"
+
+	switch secret := data.(type) {
+	case Secret:
+		key = secret.Private
+	case *Secret:
+		if secret != nil {
+			key = secret.Private
+		}
+	case PrivateKey:
+		key = secret
+	case PublicKey:
+		key = secret
+		hrp = "age"
+	default:
+		return "", errors.New("invalid secret type")
+	}
+	if len(key) != curve25519.ScalarSize {
+		return "", errors.New("age encoding requires an X25519 key")
+	}
+
+	encoded := bech32Encode(hrp, convertBits8To5(key))
+	if hrp != "age" {
+		encoded = strings.ToUpper(encoded)
+	}
+	return encoded, nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32Encode encodes 5-bit values with a human readable prefix as defined in BIP 173
+func bech32Encode(hrp string, values []byte) string {
+	checksumInput := append(bech32HRPExpand(hrp), values...)
+	polymod := bech32Polymod(append(checksumInput, 0, 0, 0, 0, 0, 0)) ^ 1
+
+	var encoded strings.Builder
+	encoded.WriteString(hrp)
+	encoded.WriteByte('1')
+	for _, v := range values {
+		encoded.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		encoded.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return encoded.String()
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// convertBits8To5 regroups bytes to 5-bit values, padding the last value with zeros
+func convertBits8To5(data []byte) []byte {
+	var values []byte
+	var acc uint32
+	var bits uint
+	for _, b := range data {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			values = append(values, byte(acc>>bits)&31)
+		}
+	}
+	if bits > 0 {
+		values = append(values, byte(acc<<(5-bits))&31)
+	}
+	return values
+}
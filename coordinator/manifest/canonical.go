@@ -0,0 +1,58 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Canonicalize converts a manifest in JSON or YAML format into its canonical JSON form.
+// The canonical form has sorted object keys and no insignificant whitespace,
+// so the signature of a manifest does not depend on its format, formatting or key order.
+func Canonicalize(rawManifest []byte) ([]byte, error) {
+	jsonManifest := rawManifest
+	if !json.Valid(rawManifest) {
+		var err error
+		if jsonManifest, err = yaml.YAMLToJSON(rawManifest); err != nil {
+			return nil, err
+		}
+	}
+
+	// decode numbers as json.Number to keep them unchanged
+	decoder := json.NewDecoder(bytes.NewReader(jsonManifest))
+	decoder.UseNumber()
+	var manifest interface{}
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, err
+	}
+	if _, ok := manifest.(map[string]interface{}); !ok {
+		return nil, errors.New("manifest must be an object")
+	}
+
+	var canonical bytes.Buffer
+	encoder := json.NewEncoder(&canonical)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(canonical.Bytes(), []byte("\n")), nil
+}
+
+// Signature returns the SHA-256 hash of the canonical form of a manifest
+func Signature(rawManifest []byte) ([]byte, error) {
+	canonical, err := Canonicalize(rawManifest)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(canonical)
+	return hash[:], nil
+}
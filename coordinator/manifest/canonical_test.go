@@ -0,0 +1,46 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	expected := `{"Marbles":{"backend":{"Parameters":{"Env":{"A":"<{{ raw .Secrets.key }}>"}}}},"Packages":{"backend":{"ProductID":18446744073709551615}}}`
+
+	canonical, err := Canonicalize([]byte(`{
+		"Packages": {"backend": {"ProductID": 18446744073709551615}},
+		"Marbles": {"backend": {"Parameters": {"Env": {"A": "<{{ raw .Secrets.key }}>"}}}}
+	}`))
+	require.NoError(err)
+	assert.Equal(expected, string(canonical))
+
+	canonical, err = Canonicalize([]byte(`
+Packages:
+  backend:
+    ProductID: 18446744073709551615
+Marbles:
+  backend:
+    Parameters:
+      Env:
+        A: "<{{ raw .Secrets.key }}>"
+`))
+	require.NoError(err)
+	assert.Equal(expected, string(canonical))
+
+	_, err = Canonicalize([]byte(`["Packages"]`))
+	assert.Error(err)
+	_, err = Canonicalize([]byte("Packages: {"))
+	assert.Error(err)
+}
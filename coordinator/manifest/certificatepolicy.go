@@ -0,0 +1,137 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+// CertificatePolicy defines the certificates an activated marble may request from the Coordinator at runtime
+type CertificatePolicy struct {
+	// DNSNames are the patterns the DNS names of requested certificates must match, using the syntax of Go's path.Match, e.g. "*.tenants.example.com"
+	DNSNames []string
+	// IPRanges are the CIDR ranges the IP addresses of requested certificates must be in
+	IPRanges []string
+	// KeyUsages are the allowed key usages, e.g. "DigitalSignature" or "KeyEncipherment". Defaults to "DigitalSignature".
+	KeyUsages []string
+	// ExtKeyUsages are the allowed extended key usages, e.g. "ServerAuth" or "ClientAuth". Defaults to "ServerAuth".
+	ExtKeyUsages []string
+	// MaxValidForHours is the maximum lifetime of requested certificates. Defaults to 24 hours.
+	MaxValidForHours uint
+}
+
+var keyUsages = map[string]x509.KeyUsage{
+	"digitalsignature":  x509.KeyUsageDigitalSignature,
+	"contentcommitment": x509.KeyUsageContentCommitment,
+	"keyencipherment":   x509.KeyUsageKeyEncipherment,
+	"dataencipherment":  x509.KeyUsageDataEncipherment,
+	"keyagreement":      x509.KeyUsageKeyAgreement,
+}
+
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"serverauth":      x509.ExtKeyUsageServerAuth,
+	"clientauth":      x509.ExtKeyUsageClientAuth,
+	"codesigning":     x509.ExtKeyUsageCodeSigning,
+	"emailprotection": x509.ExtKeyUsageEmailProtection,
+	"timestamping":    x509.ExtKeyUsageTimeStamping,
+	"ocspsigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// AllowedKeyUsages returns the key usages permitted by the policy
+func (p CertificatePolicy) AllowedKeyUsages() []string {
+	if len(p.KeyUsages) == 0 {
+		return []string{"DigitalSignature"}
+	}
+	return p.KeyUsages
+}
+
+// AllowedExtKeyUsages returns the extended key usages permitted by the policy
+func (p CertificatePolicy) AllowedExtKeyUsages() []string {
+	if len(p.ExtKeyUsages) == 0 {
+		return []string{"ServerAuth"}
+	}
+	return p.ExtKeyUsages
+}
+
+// MaxValidFor returns the maximum lifetime of requested certificates in hours
+func (p CertificatePolicy) MaxValidFor() uint {
+	if p.MaxValidForHours == 0 {
+		return 24
+	}
+	return p.MaxValidForHours
+}
+
+// PermitsDNSName returns true if the DNS name matches one of the patterns of the policy
+func (p CertificatePolicy) PermitsDNSName(name string) bool {
+	for _, pattern := range p.DNSNames {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PermitsIPAddress returns true if the IP address is in one of the ranges of the policy
+func (p CertificatePolicy) PermitsIPAddress(ip net.IP) bool {
+	for _, ipRange := range p.IPRanges {
+		if _, ipNet, err := net.ParseCIDR(ipRange); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseKeyUsages parses the names of key usages, e.g. "DigitalSignature"
+func ParseKeyUsages(names []string) (x509.KeyUsage, error) {
+	var usage x509.KeyUsage
+	for _, name := range names {
+		u, ok := keyUsages[strings.ToLower(name)]
+		if !ok {
+			return 0, fmt.Errorf("unsupported key usage %s", name)
+		}
+		usage |= u
+	}
+	return usage, nil
+}
+
+// ParseExtKeyUsages parses the names of extended key usages, e.g. "ServerAuth"
+func ParseExtKeyUsages(names []string) ([]x509.ExtKeyUsage, error) {
+	var usages []x509.ExtKeyUsage
+	for _, name := range names {
+		u, ok := extKeyUsages[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported extended key usage %s", name)
+		}
+		usages = append(usages, u)
+	}
+	return usages, nil
+}
+
+// check verifies the patterns, ranges and usages of the policy
+func (p CertificatePolicy) check() error {
+	for _, pattern := range p.DNSNames {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid DNS name pattern %s: %v", pattern, err)
+		}
+	}
+	for _, ipRange := range p.IPRanges {
+		if _, _, err := net.ParseCIDR(ipRange); err != nil {
+			return err
+		}
+	}
+	if _, err := ParseKeyUsages(p.KeyUsages); err != nil {
+		return err
+	}
+	if _, err := ParseExtKeyUsages(p.ExtKeyUsages); err != nil {
+		return err
+	}
+	return nil
+}
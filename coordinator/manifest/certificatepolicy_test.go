@@ -0,0 +1,47 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertificatePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := CertificatePolicy{
+		DNSNames: []string{"*.tenants.example.com", "api.example.com"},
+		IPRanges: []string{"10.0.0.0/8"},
+	}
+	assert.NoError(policy.check())
+	assert.True(policy.PermitsDNSName("a.tenants.example.com"))
+	assert.True(policy.PermitsDNSName("API.example.com"))
+	assert.False(policy.PermitsDNSName("tenants.example.com"))
+	assert.False(policy.PermitsDNSName("www.example.com"))
+	assert.True(policy.PermitsIPAddress(net.ParseIP("10.0.0.1")))
+	assert.False(policy.PermitsIPAddress(net.ParseIP("192.168.0.1")))
+	assert.Equal([]string{"DigitalSignature"}, policy.AllowedKeyUsages())
+	assert.Equal([]string{"ServerAuth"}, policy.AllowedExtKeyUsages())
+	assert.EqualValues(24, policy.MaxValidFor())
+
+	usage, err := ParseKeyUsages([]string{"DigitalSignature", "keyencipherment"})
+	assert.NoError(err)
+	assert.Equal(x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment, usage)
+	extUsages, err := ParseExtKeyUsages([]string{"ClientAuth"})
+	assert.NoError(err)
+	assert.Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, extUsages)
+
+	// CA certificates can not be requested
+	assert.Error(CertificatePolicy{KeyUsages: []string{"CertSign"}}.check())
+	assert.Error(CertificatePolicy{ExtKeyUsages: []string{"Any"}}.check())
+	assert.Error(CertificatePolicy{DNSNames: []string{"[invalid"}}.check())
+	assert.Error(CertificatePolicy{IPRanges: []string{"10.0.0.1"}}.check())
+}
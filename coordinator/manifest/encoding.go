@@ -0,0 +1,468 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// EncodeSecretDataToBase64URL encodes the byte value of a secret to an unpadded Base64URL string
+func EncodeSecretDataToBase64URL(data interface{}) (string, error) {
+	raw, err := EncodeSecretDataToRaw(data)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw)), nil
+}
+
+// EncodeSecretDataToPKCS1 encodes an RSA private key to a PKCS #1 "RSA PRIVATE KEY" PEM block.
+// A public key or certificate is encoded to a PKCS #1 "RSA PUBLIC KEY" PEM block.
+func EncodeSecretDataToPKCS1(data interface{}) (string, error) {
+	switch data.(type) {
+	case PublicKey, Certificate:
+		pub, err := parsePublicKey(data)
+		if err != nil {
+			return "", err
+		}
+		rsaPub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return "", errors.New("PKCS #1 encoding requires an RSA key")
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(rsaPub)})), nil
+	}
+
+	priv, err := parsePrivateKey(data)
+	if err != nil {
+		return "", err
+	}
+	rsaPriv, ok := priv.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("PKCS #1 encoding requires an RSA key")
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaPriv)})), nil
+}
+
+// EncodeSecretDataToPKCS8 encodes a private key to a PKCS #8 "PRIVATE KEY" PEM block
+func EncodeSecretDataToPKCS8(data interface{}) (string, error) {
+	priv, err := parsePrivateKey(data)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// EncodeSecretDataToSEC1 encodes an ECDSA private key to a SEC 1 "EC PRIVATE KEY" PEM block
+func EncodeSecretDataToSEC1(data interface{}) (string, error) {
+	priv, err := parsePrivateKey(data)
+	if err != nil {
+		return "", err
+	}
+	ecPriv, ok := priv.(*ecdsa.PrivateKey)
+	if !ok {
+		return "", errors.New("SEC 1 encoding requires an ECDSA key")
+	}
+	der, err := x509.MarshalECPrivateKey(ecPriv)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})), nil
+}
+
+// EncodeSecretDataToPemChain encodes one or more certificates to concatenated "CERTIFICATE" PEM blocks.
+// This is useful to build a full chain, e.g. {{ chain .Secrets.foo .Marblerun.RootCA }}.
+func EncodeSecretDataToPemChain(data interface{}, more ...interface{}) (string, error) {
+	certs, err := parseCertificates(append([]interface{}{data}, more...))
+	if err != nil {
+		return "", err
+	}
+	var chain strings.Builder
+	for _, cert := range certs {
+		chain.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	}
+	return chain.String(), nil
+}
+
+// EncodeSecretDataToJWK encodes a secret to a JSON Web Key (RFC 7517).
+// A Secret or PrivateKey results in a private JWK, a PublicKey or Certificate in a public JWK.
+// Symmetric keys and plain secrets are encoded as keys of type "oct".
+func EncodeSecretDataToJWK(data interface{}) (string, error) {
+	var key *jsonWebKey
+	var err error
+
+	switch secret := data.(type) {
+	case Secret:
+		key, err = secretToJWK(secret)
+	case *Secret:
+		if secret == nil {
+			return "", errors.New("tried to parse secret with empty value")
+		}
+		key, err = secretToJWK(*secret)
+	case PrivateKey:
+		var priv crypto.PrivateKey
+		if priv, err = parsePrivateKey(secret); err == nil {
+			key, err = privateKeyToJWK(priv)
+		}
+	case PublicKey, Certificate:
+		key, err = publicJWK(secret)
+	default:
+		return "", errors.New("invalid secret type")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	jwk, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return string(jwk), nil
+}
+
+// EncodeSecretDataToJWKS encodes the public keys of one or more secrets to a JSON Web Key Set (RFC 7517)
+func EncodeSecretDataToJWKS(data interface{}, more ...interface{}) (string, error) {
+	keySet := struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}{}
+	for _, secret := range append([]interface{}{data}, more...) {
+		key, err := publicJWK(secret)
+		if err != nil {
+			return "", err
+		}
+		keySet.Keys = append(keySet.Keys, key)
+	}
+
+	jwks, err := json.Marshal(keySet)
+	if err != nil {
+		return "", err
+	}
+	return string(jwks), nil
+}
+
+// jsonWebKey is the JSON representation of a key as defined in RFC 7517 and RFC 7518
+type jsonWebKey struct {
+	Kty string   `json:"kty"`
+	Kid string   `json:"kid,omitempty"`
+	Alg string   `json:"alg,omitempty"`
+	Crv string   `json:"crv,omitempty"`
+	N   string   `json:"n,omitempty"`
+	E   string   `json:"e,omitempty"`
+	X   string   `json:"x,omitempty"`
+	Y   string   `json:"y,omitempty"`
+	D   string   `json:"d,omitempty"`
+	P   string   `json:"p,omitempty"`
+	Q   string   `json:"q,omitempty"`
+	Dp  string   `json:"dp,omitempty"`
+	Dq  string   `json:"dq,omitempty"`
+	Qi  string   `json:"qi,omitempty"`
+	K   string   `json:"k,omitempty"`
+	X5c []string `json:"x5c,omitempty"`
+}
+
+// secretToJWK returns the private JWK of a key secret or an "oct" JWK of a symmetric secret
+func secretToJWK(secret Secret) (*jsonWebKey, error) {
+	if secret.Type == "key-x25519" {
+		return x25519ToJWK(secret, true)
+	}
+	if len(secret.Private) > 0 {
+		if priv, err := parsePrivateKey(secret.Private); err == nil {
+			key, err := privateKeyToJWK(priv)
+			if err != nil {
+				return nil, err
+			}
+			if len(secret.Cert.Raw) > 0 {
+				key.X5c = []string{base64.StdEncoding.EncodeToString(secret.Cert.Raw)}
+			}
+			return key, nil
+		}
+	}
+	if len(secret.Cert.Raw) > 0 {
+		return nil, errors.New("failed to parse the private key of the secret")
+	}
+	if len(secret.Public) <= 0 {
+		return nil, errors.New("tried to parse secret with empty value")
+	}
+	key := &jsonWebKey{Kty: "oct", K: base64.RawURLEncoding.EncodeToString(secret.Public)}
+	if secret.Type == "jwt-hmac" {
+		key.Alg = fmt.Sprintf("HS%d", secret.Size)
+	}
+	return key, key.setThumbprint()
+}
+
+// x25519ToJWK returns the JWK of a key-x25519 secret, which stores the raw keys
+func x25519ToJWK(secret Secret, private bool) (*jsonWebKey, error) {
+	if len(secret.Public) != curve25519.PointSize || len(secret.Private) != curve25519.ScalarSize {
+		return nil, errors.New("invalid X25519 key")
+	}
+	key := &jsonWebKey{Kty: "OKP", Crv: "X25519", X: base64.RawURLEncoding.EncodeToString(secret.Public)}
+	if err := key.setThumbprint(); err != nil {
+		return nil, err
+	}
+	if private {
+		key.D = base64.RawURLEncoding.EncodeToString(secret.Private)
+	}
+	return key, nil
+}
+
+// publicJWK returns the public JWK of a secret, public key or certificate
+func publicJWK(data interface{}) (*jsonWebKey, error) {
+	switch secret := data.(type) {
+	case Secret:
+		if secret.Type == "key-x25519" {
+			return x25519ToJWK(secret, false)
+		}
+	case *Secret:
+		if secret != nil && secret.Type == "key-x25519" {
+			return x25519ToJWK(*secret, false)
+		}
+	}
+
+	pub, err := parsePublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := publicKeyToJWK(pub)
+	if err != nil {
+		return nil, err
+	}
+	if certs, err := parseCertificates([]interface{}{data}); err == nil {
+		key.X5c = []string{base64.StdEncoding.EncodeToString(certs[0].Raw)}
+	}
+	return key, nil
+}
+
+func publicKeyToJWK(pub crypto.PublicKey) (*jsonWebKey, error) {
+	var key jsonWebKey
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		key.Kty = "RSA"
+		key.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		key.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		crv, err := jwkCurveName(pub.Curve)
+		if err != nil {
+			return nil, err
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		key.Kty = "EC"
+		key.Crv = crv
+		key.X = base64.RawURLEncoding.EncodeToString(padBytes(pub.X.Bytes(), size))
+		key.Y = base64.RawURLEncoding.EncodeToString(padBytes(pub.Y.Bytes(), size))
+	case ed25519.PublicKey:
+		key.Kty = "OKP"
+		key.Crv = "Ed25519"
+		key.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+	return &key, key.setThumbprint()
+}
+
+func privateKeyToJWK(priv crypto.PrivateKey) (*jsonWebKey, error) {
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", priv)
+	}
+	key, err := publicKeyToJWK(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	switch priv := priv.(type) {
+	case *rsa.PrivateKey:
+		if len(priv.Primes) != 2 {
+			return nil, errors.New("RSA keys with more than two primes are not supported")
+		}
+		priv.Precompute()
+		key.D = base64.RawURLEncoding.EncodeToString(priv.D.Bytes())
+		key.P = base64.RawURLEncoding.EncodeToString(priv.Primes[0].Bytes())
+		key.Q = base64.RawURLEncoding.EncodeToString(priv.Primes[1].Bytes())
+		key.Dp = base64.RawURLEncoding.EncodeToString(priv.Precomputed.Dp.Bytes())
+		key.Dq = base64.RawURLEncoding.EncodeToString(priv.Precomputed.Dq.Bytes())
+		key.Qi = base64.RawURLEncoding.EncodeToString(priv.Precomputed.Qinv.Bytes())
+	case *ecdsa.PrivateKey:
+		size := (priv.Curve.Params().BitSize + 7) / 8
+		key.D = base64.RawURLEncoding.EncodeToString(padBytes(priv.D.Bytes(), size))
+	case ed25519.PrivateKey:
+		key.D = base64.RawURLEncoding.EncodeToString(priv.Seed())
+	}
+	return key, nil
+}
+
+// setThumbprint sets the key ID to the JWK thumbprint as defined in RFC 7638
+func (k *jsonWebKey) setThumbprint() error {
+	var members []string
+	switch k.Kty {
+	case "RSA":
+		members = []string{"e", k.E, "kty", k.Kty, "n", k.N}
+	case "EC":
+		members = []string{"crv", k.Crv, "kty", k.Kty, "x", k.X, "y", k.Y}
+	case "OKP":
+		members = []string{"crv", k.Crv, "kty", k.Kty, "x", k.X}
+	case "oct":
+		members = []string{"k", k.K, "kty", k.Kty}
+	default:
+		return fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+
+	var canonical strings.Builder
+	canonical.WriteString("{")
+	for i := 0; i < len(members); i += 2 {
+		if i > 0 {
+			canonical.WriteString(",")
+		}
+		fmt.Fprintf(&canonical, "%q:%q", members[i], members[i+1])
+	}
+	canonical.WriteString("}")
+
+	thumbprint := sha256.Sum256([]byte(canonical.String()))
+	k.Kid = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+	return nil
+}
+
+func jwkCurveName(curve elliptic.Curve) (string, error) {
+	switch curve {
+	case elliptic.P256():
+		return "P-256", nil
+	case elliptic.P384():
+		return "P-384", nil
+	case elliptic.P521():
+		return "P-521", nil
+	}
+	return "", fmt.Errorf("unsupported curve %s", curve.Params().Name)
+}
+
+// padBytes prepends zeros to b until it has the given size
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+// ParsePrivateKey parses the private key of the secret. PKCS #8, PKCS #1 and SEC 1 encoded keys are supported.
+func (s Secret) ParsePrivateKey() (crypto.PrivateKey, error) {
+	return parsePrivateKey(s.Private)
+}
+
+// parsePrivateKey parses the private key of a Secret or PrivateKey.
+// PKCS #8, PKCS #1 and SEC 1 encoded keys are supported.
+func parsePrivateKey(data interface{}) (crypto.PrivateKey, error) {
+	var der []byte
+	switch secret := data.(type) {
+	case Secret:
+		der = secret.Private
+	case *Secret:
+		if secret != nil {
+			der = secret.Private
+		}
+	case PrivateKey:
+		der = secret
+	default:
+		return nil, errors.New("invalid secret type: expected a secret or private key")
+	}
+	if len(der) <= 0 {
+		return nil, errors.New("tried to parse secret with empty value")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("failed to parse private key")
+}
+
+// parsePublicKey parses the public key of a Secret, PublicKey or Certificate
+func parsePublicKey(data interface{}) (crypto.PublicKey, error) {
+	var secret Secret
+	switch data := data.(type) {
+	case Secret:
+		secret = data
+	case *Secret:
+		if data != nil {
+			secret = *data
+		}
+	case PublicKey:
+		secret.Public = data
+	case Certificate:
+		secret.Cert = data
+	default:
+		return nil, errors.New("invalid secret type: expected a secret, public key or certificate")
+	}
+
+	if len(secret.Cert.Raw) > 0 {
+		certs, err := parseCertificates([]interface{}{secret.Cert})
+		if err != nil {
+			return nil, err
+		}
+		return certs[0].PublicKey, nil
+	}
+	if len(secret.Public) <= 0 {
+		return nil, errors.New("tried to parse secret with empty value")
+	}
+	if key, err := x509.ParsePKIXPublicKey(secret.Public); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(secret.Public); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("failed to parse public key")
+}
+
+// parseCertificates parses the certificates of Secrets or Certificates
+func parseCertificates(data []interface{}) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, d := range data {
+		var raw []byte
+		switch secret := d.(type) {
+		case Secret:
+			raw = secret.Cert.Raw
+		case *Secret:
+			if secret != nil {
+				raw = secret.Cert.Raw
+			}
+		case Certificate:
+			raw = secret.Raw
+		default:
+			return nil, errors.New("invalid secret type: expected a secret or certificate")
+		}
+		if len(raw) <= 0 {
+			return nil, errors.New("tried to parse certificate with empty value")
+		}
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
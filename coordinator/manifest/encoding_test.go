@@ -0,0 +1,430 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/pkcs12"
+)
+
+func TestKeyEncodings(t *testing.T) {
+	certs, err := getPlaceholderKeys()
+	require.NoError(t, err)
+	rsaSecret, ecdsaSecret, ed25519Secret := certs["cert-rsa"], certs["cert-ecdsa"], certs["cert-ed25519"]
+
+	testCases := map[string]struct {
+		encode    func(interface{}) (string, error)
+		data      interface{}
+		wantType  string
+		wantError bool
+	}{
+		"pkcs1 private":        {encode: EncodeSecretDataToPKCS1, data: rsaSecret, wantType: "RSA PRIVATE KEY"},
+		"pkcs1 private key":    {encode: EncodeSecretDataToPKCS1, data: rsaSecret.Private, wantType: "RSA PRIVATE KEY"},
+		"pkcs1 public":         {encode: EncodeSecretDataToPKCS1, data: rsaSecret.Public, wantType: "RSA PUBLIC KEY"},
+		"pkcs1 certificate":    {encode: EncodeSecretDataToPKCS1, data: rsaSecret.Cert, wantType: "RSA PUBLIC KEY"},
+		"pkcs1 ecdsa":          {encode: EncodeSecretDataToPKCS1, data: ecdsaSecret, wantError: true},
+		"pkcs8 rsa":            {encode: EncodeSecretDataToPKCS8, data: rsaSecret, wantType: "PRIVATE KEY"},
+		"pkcs8 ecdsa":          {encode: EncodeSecretDataToPKCS8, data: ecdsaSecret.Private, wantType: "PRIVATE KEY"},
+		"pkcs8 ed25519":        {encode: EncodeSecretDataToPKCS8, data: &ed25519Secret, wantType: "PRIVATE KEY"},
+		"pkcs8 public":         {encode: EncodeSecretDataToPKCS8, data: ecdsaSecret.Public, wantError: true},
+		"sec1":                 {encode: EncodeSecretDataToSEC1, data: ecdsaSecret, wantType: "EC PRIVATE KEY"},
+		"sec1 rsa":             {encode: EncodeSecretDataToSEC1, data: rsaSecret, wantError: true},
+		"sec1 symmetric":       {encode: EncodeSecretDataToSEC1, data: Secret{Private: []byte{1, 2, 3}}, wantError: true},
+		"pkcs8 invalid type":   {encode: EncodeSecretDataToPKCS8, data: 1, wantError: true},
+		"pkcs8 nil secret":     {encode: EncodeSecretDataToPKCS8, data: (*Secret)(nil), wantError: true},
+		"pkcs1 empty secret":   {encode: EncodeSecretDataToPKCS1, data: Secret{}, wantError: true},
+		"sec1 empty key value": {encode: EncodeSecretDataToSEC1, data: PrivateKey{}, wantError: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			encoded, err := tc.encode(tc.data)
+			if tc.wantError {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			block, rest := pem.Decode([]byte(encoded))
+			require.NotNil(block)
+			assert.Empty(rest)
+			assert.Equal(tc.wantType, block.Type)
+
+			switch block.Type {
+			case "RSA PRIVATE KEY":
+				_, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+			case "RSA PUBLIC KEY":
+				_, err = x509.ParsePKCS1PublicKey(block.Bytes)
+			case "PRIVATE KEY":
+				_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+			case "EC PRIVATE KEY":
+				_, err = x509.ParseECPrivateKey(block.Bytes)
+			}
+			assert.NoError(err)
+		})
+	}
+}
+
+func TestEncodeSecretDataToBase64URL(t *testing.T) {
+	assert := assert.New(t)
+
+	encoded, err := EncodeSecretDataToBase64URL(Secret{Public: []byte{0xfb, 0xff}})
+	assert.NoError(err)
+	assert.Equal("-_8", encoded)
+
+	_, err = EncodeSecretDataToBase64URL(Secret{})
+	assert.Error(err)
+}
+
+func TestEncodeSecretDataToPemChain(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	certs, err := getPlaceholderKeys()
+	require.NoError(err)
+	leaf, ca := certs["cert-rsa"], certs["cert-ecdsa"]
+
+	chain, err := EncodeSecretDataToPemChain(leaf, ca.Cert)
+	require.NoError(err)
+
+	var chainCerts [][]byte
+	for rest := []byte(chain); ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		assert.Equal("CERTIFICATE", block.Type)
+		chainCerts = append(chainCerts, block.Bytes)
+	}
+	assert.Equal([][]byte{leaf.Cert.Raw, ca.Cert.Raw}, chainCerts)
+
+	_, err = EncodeSecretDataToPemChain(leaf, Secret{Type: "symmetric-key", Public: []byte{1}})
+	assert.Error(err)
+}
+
+func TestEncodeSecretDataToJWK(t *testing.T) {
+	certs, err := getPlaceholderKeys()
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		data        interface{}
+		wantKty     string
+		wantCrv     string
+		wantPrivate bool
+		wantX5c     bool
+		wantError   bool
+	}{
+		"rsa secret":          {data: certs["cert-rsa"], wantKty: "RSA", wantPrivate: true, wantX5c: true},
+		"ecdsa secret":        {data: certs["cert-ecdsa"], wantKty: "EC", wantCrv: "P-256", wantPrivate: true, wantX5c: true},
+		"ed25519 secret":      {data: certs["cert-ed25519"], wantKty: "OKP", wantCrv: "Ed25519", wantPrivate: true, wantX5c: true},
+		"private key":         {data: certs["cert-ecdsa"].Private, wantKty: "EC", wantCrv: "P-256", wantPrivate: true},
+		"public key":          {data: certs["cert-rsa"].Public, wantKty: "RSA"},
+		"certificate":         {data: certs["cert-ed25519"].Cert, wantKty: "OKP", wantCrv: "Ed25519", wantX5c: true},
+		"symmetric key":       {data: Secret{Type: "symmetric-key", Public: []byte{1, 2}, Private: []byte{1, 2}}, wantKty: "oct"},
+		"empty secret":        {data: Secret{}, wantError: true},
+		"invalid public key":  {data: PublicKey{1, 2}, wantError: true},
+		"invalid private key": {data: PrivateKey{1, 2}, wantError: true},
+		"invalid type":        {data: []byte{1, 2}, wantError: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			encoded, err := EncodeSecretDataToJWK(tc.data)
+			if tc.wantError {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			var key jsonWebKey
+			require.NoError(json.Unmarshal([]byte(encoded), &key))
+			assert.Equal(tc.wantKty, key.Kty)
+			assert.Equal(tc.wantCrv, key.Crv)
+			assert.NotEmpty(key.Kid)
+			assert.Equal(tc.wantPrivate, key.D != "")
+			assert.Equal(tc.wantX5c, len(key.X5c) > 0)
+		})
+	}
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// example from RFC 7638, section 3.1
+	key := jsonWebKey{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	require.NoError(t, key.setThumbprint())
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", key.Kid)
+}
+
+func TestEncodeSecretDataToJWKS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	certs, err := getPlaceholderKeys()
+	require.NoError(err)
+
+	encoded, err := EncodeSecretDataToJWKS(certs["cert-rsa"], certs["cert-ecdsa"].Cert, certs["cert-ed25519"].Public)
+	require.NoError(err)
+
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	require.NoError(json.Unmarshal([]byte(encoded), &keySet))
+	require.Len(keySet.Keys, 3)
+	for _, key := range keySet.Keys {
+		assert.Empty(key.D, "key set must only contain public keys")
+	}
+
+	privateJWK, err := EncodeSecretDataToJWK(certs["cert-rsa"])
+	require.NoError(err)
+	var privateKey jsonWebKey
+	require.NoError(json.Unmarshal([]byte(privateJWK), &privateKey))
+	assert.Equal(privateKey.Kid, keySet.Keys[0].Kid)
+
+	_, err = EncodeSecretDataToJWKS(Secret{Type: "symmetric-key", Public: []byte{1}})
+	assert.Error(err)
+}
+
+func TestEncodeSecretDataToPKCS12(t *testing.T) {
+	certs, err := getPlaceholderKeys()
+	require.NoError(t, err)
+	password := Secret{Type: "plain", Public: []byte("sëcret")}
+
+	for _, secretType := range []string{"cert-rsa", "cert-ecdsa"} {
+		t.Run(secretType, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			secret, ca := certs[secretType], certs["cert-ed25519"]
+
+			pfx, err := EncodeSecretDataToPKCS12(secret, password, ca)
+			require.NoError(err)
+
+			blocks, err := pkcs12.ToPEM([]byte(pfx), "sëcret")
+			require.NoError(err)
+			require.Len(blocks, 3)
+			assert.Equal(secret.Cert.Raw, blocks[0].Bytes)
+			assert.Equal(ca.Cert.Raw, blocks[1].Bytes)
+			assert.Equal("PRIVATE KEY", blocks[2].Type)
+
+			_, err = pkcs12.ToPEM([]byte(pfx), "wrong")
+			assert.Error(err)
+		})
+	}
+
+	_, err = EncodeSecretDataToPKCS12(certs["cert-rsa"], Secret{})
+	assert.Error(t, err)
+	_, err = EncodeSecretDataToPKCS12(Secret{Type: "symmetric-key", Public: []byte{1}, Private: []byte{1}}, password)
+	assert.Error(t, err)
+}
+
+func TestEncodeSecretDataToJKS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	certs, err := getPlaceholderKeys()
+	require.NoError(err)
+	secret, ca := certs["cert-ecdsa"], certs["cert-rsa"]
+
+	encoded, err := EncodeSecretDataToJKS(secret, "password", ca.Cert)
+	require.NoError(err)
+	keyStore := []byte(encoded)
+	passwordBytes := utf16BigEndian("password")
+
+	// verify the integrity digest
+	data, digest := keyStore[:len(keyStore)-sha1.Size], keyStore[len(keyStore)-sha1.Size:]
+	expectedDigest := sha1.Sum(append(append(append([]byte{}, passwordBytes...), jksWhitener...), data...))
+	assert.Equal(expectedDigest[:], digest)
+
+	r := bytes.NewReader(data)
+	readUint32 := func() uint32 {
+		var v uint32
+		require.NoError(binary.Read(r, binary.BigEndian, &v))
+		return v
+	}
+	readBytes := func(n int) []byte {
+		b := make([]byte, n)
+		_, err := r.Read(b)
+		require.NoError(err)
+		return b
+	}
+	readUTF := func() string {
+		var length uint16
+		require.NoError(binary.Read(r, binary.BigEndian, &length))
+		return string(readBytes(int(length)))
+	}
+
+	assert.EqualValues(jksMagic, readUint32())
+	assert.EqualValues(jksVersion, readUint32())
+	assert.EqualValues(1, readUint32())
+	assert.EqualValues(jksPrivateKeyEntry, readUint32())
+	assert.Equal(jksKeyAlias, readUTF())
+	readBytes(8)
+
+	// decrypt the protected key
+	var keyInfo encryptedPrivateKeyInfo
+	_, err = asn1.Unmarshal(readBytes(int(readUint32())), &keyInfo)
+	require.NoError(err)
+	assert.True(keyInfo.Algorithm.Algorithm.Equal(oidJavaKeyProtector))
+	protected := keyInfo.EncryptedData
+	salt, encrypted, check := protected[:sha1.Size], protected[sha1.Size:len(protected)-sha1.Size], protected[len(protected)-sha1.Size:]
+	var plainKey []byte
+	for digest := salt; len(plainKey) < len(encrypted); {
+		sum := sha1.Sum(append(append([]byte{}, passwordBytes...), digest...))
+		digest = sum[:]
+		for _, b := range digest {
+			if len(plainKey) < len(encrypted) {
+				plainKey = append(plainKey, encrypted[len(plainKey)]^b)
+			}
+		}
+	}
+	expectedCheck := sha1.Sum(append(append([]byte{}, passwordBytes...), plainKey...))
+	assert.Equal(expectedCheck[:], check)
+	key, err := x509.ParsePKCS8PrivateKey(plainKey)
+	require.NoError(err)
+	assert.IsType(&ecdsa.PrivateKey{}, key)
+
+	// the certificate chain contains the secret's certificate and the CA certificate
+	assert.EqualValues(2, readUint32())
+	for _, cert := range []Certificate{secret.Cert, ca.Cert} {
+		assert.Equal("X.509", readUTF())
+		assert.Equal(cert.Raw, readBytes(int(readUint32())))
+	}
+	assert.Zero(r.Len())
+}
+
+// TestEncodeJKSFixture compares the key store with a fixture written with a fixed salt and creation date
+// by an independent implementation of OpenJDK's JavaKeyStore.engineStore and KeyProtector.protect.
+// The key store was created from testdata/jks_key.pem and testdata/jks_chain.pem with the password "changeit".
+func TestEncodeJKSFixture(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	keyPEM, err := ioutil.ReadFile(filepath.Join("testdata", "jks_key.pem"))
+	require.NoError(err)
+	keyBlock, _ := pem.Decode(keyPEM)
+	require.NotNil(keyBlock)
+	chainPEM, err := ioutil.ReadFile(filepath.Join("testdata", "jks_chain.pem"))
+	require.NoError(err)
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(chainPEM); block != nil; block, rest = pem.Decode(rest) {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(err)
+		certs = append(certs, cert)
+	}
+	require.Len(certs, 2)
+	expected, err := ioutil.ReadFile(filepath.Join("testdata", "keystore.jks"))
+	require.NoError(err)
+
+	salt := make([]byte, sha1.Size)
+	for i := range salt {
+		salt[i] = byte(i)
+	}
+	keyStore, err := encodeJKS(keyBlock.Bytes, certs, utf16BigEndian("changeit"), salt, time.Unix(1600000000, 0))
+	require.NoError(err)
+	assert.Equal(expected, keyStore)
+
+	// the password protects the key and the integrity of the key store
+	otherKeyStore, err := encodeJKS(keyBlock.Bytes, certs, utf16BigEndian("other"), salt, time.Unix(1600000000, 0))
+	require.NoError(err)
+	assert.NotEqual(expected, otherKeyStore)
+}
+
+func TestPlaceholderKeys(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	certs, err := getPlaceholderKeys()
+	require.NoError(err)
+
+	for secretType, keyType := range map[string]interface{}{"cert-rsa": &rsa.PrivateKey{}, "cert-ecdsa": &ecdsa.PrivateKey{}, "cert-ed25519": ed25519.PrivateKey{}} {
+		key, err := parsePrivateKey(certs[secretType])
+		require.NoError(err)
+		assert.IsType(keyType, key)
+	}
+}
+
+func TestEncodeSecretDataToAge(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	keys, err := getPlaceholderKeys()
+	require.NoError(err)
+	secret := keys["key-x25519"]
+
+	identity, err := EncodeSecretDataToAge(secret)
+	require.NoError(err)
+	assert.Regexp("^AGE-SECRET-KEY-1[QPZRY9X8GF2TVDW0S3JN54KHCE6MUA7L]{58}$", identity)
+	recipient, err := EncodeSecretDataToAge(secret.Public)
+	require.NoError(err)
+	assert.Regexp("^age1[qpzry9x8gf2tvdw0s3jn54khce6mua7l]{58}$", recipient)
+
+	_, err = EncodeSecretDataToAge(keys["key-ed25519"])
+	assert.Error(err)
+}
+
+func TestBech32Encode(t *testing.T) {
+	// test vectors from BIP 173
+	assert.Equal(t, "a12uel5l", bech32Encode("a", nil))
+	var values []byte
+	for i := byte(0); i < 32; i++ {
+		values = append(values, i)
+	}
+	assert.Equal(t, "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", bech32Encode("abcdef", values))
+}
+
+func TestKeySecretsToJWK(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	keys, err := getPlaceholderKeys()
+	require.NoError(err)
+
+	encoded, err := EncodeSecretDataToJWK(keys["key-x25519"])
+	require.NoError(err)
+	var key jsonWebKey
+	require.NoError(json.Unmarshal([]byte(encoded), &key))
+	assert.Equal("OKP", key.Kty)
+	assert.Equal("X25519", key.Crv)
+	assert.NotEmpty(key.D)
+
+	encoded, err = EncodeSecretDataToJWKS(keys["key-x25519"])
+	require.NoError(err)
+	assert.NotContains(encoded, `"d"`)
+
+	hmacKey := make([]byte, 32)
+	encoded, err = EncodeSecretDataToJWK(Secret{Type: "jwt-hmac", Size: 256, Private: hmacKey, Public: hmacKey})
+	require.NoError(err)
+	key = jsonWebKey{}
+	require.NoError(json.Unmarshal([]byte(encoded), &key))
+	assert.Equal("oct", key.Kty)
+	assert.Equal("HS256", key.Alg)
+}
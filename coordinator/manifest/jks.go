@@ -0,0 +1,133 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	jksMagic           = 0xFEEDFEED
+	jksVersion         = 2
+	jksPrivateKeyEntry = 1
+	// jksKeyAlias is the alias of the private key entry in generated key stores
+	jksKeyAlias = "marblerun"
+	// jksWhitener is mixed into the integrity digest of a Java key store
+	jksWhitener = "Mighty Aphrodite"
+)
+
+// oidJavaKeyProtector identifies Sun's proprietary key protection algorithm used in JKS files
+var oidJavaKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// EncodeSecretDataToJKS encodes the certificate and private key of a secret to a Java KeyStore (JKS).
+// The key store contains a single private key entry with alias "marblerun", which holds the certificate
+// and the additional CA certificates as its chain. The key store and the key are protected with password,
+// e.g. {{ jks .Secrets.foo .Secrets.password .Marblerun.RootCA | base64 }}.
+func EncodeSecretDataToJKS(data interface{}, password interface{}, caCerts ...interface{}) (string, error) {
+	key, certs, err := parseKeyStoreEntry(data, caCerts)
+	if err != nil {
+		return "", err
+	}
+	pass, err := EncodeSecretDataToRaw(password)
+	if err != nil {
+		return "", err
+	}
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	salt := make([]byte, sha1.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	keyStore, err := encodeJKS(pkcs8Key, certs, utf16BigEndian(pass), salt, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return string(keyStore), nil
+}
+
+// encodeJKS writes a key store with a single private key entry in the format of OpenJDK's JavaKeyStore.engineStore
+func encodeJKS(pkcs8Key []byte, certs []*x509.Certificate, passwordBytes, salt []byte, created time.Time) ([]byte, error) {
+	protectedKey, err := jksProtectKey(pkcs8Key, passwordBytes, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyStore bytes.Buffer
+	writeUint32 := func(v uint32) { _ = binary.Write(&keyStore, binary.BigEndian, v) }
+	writeUTF := func(s string) {
+		_ = binary.Write(&keyStore, binary.BigEndian, uint16(len(s)))
+		keyStore.WriteString(s)
+	}
+
+	writeUint32(jksMagic)
+	writeUint32(jksVersion)
+	writeUint32(1)
+
+	writeUint32(jksPrivateKeyEntry)
+	writeUTF(jksKeyAlias)
+	_ = binary.Write(&keyStore, binary.BigEndian, created.UnixNano()/int64(time.Millisecond))
+	writeUint32(uint32(len(protectedKey)))
+	keyStore.Write(protectedKey)
+	writeUint32(uint32(len(certs)))
+	for _, cert := range certs {
+		writeUTF("X.509")
+		writeUint32(uint32(len(cert.Raw)))
+		keyStore.Write(cert.Raw)
+	}
+
+	digest := sha1.New()
+	digest.Write(passwordBytes)
+	digest.Write([]byte(jksWhitener))
+	digest.Write(keyStore.Bytes())
+	keyStore.Write(digest.Sum(nil))
+
+	return keyStore.Bytes(), nil
+}
+
+// jksProtectKey encrypts a PKCS #8 key with the key protection algorithm of OpenJDK's KeyProtector
+// and returns the EncryptedPrivateKeyInfo. salt must have the size of a SHA-1 digest.
+func jksProtectKey(pkcs8Key, passwordBytes, salt []byte) ([]byte, error) {
+	// the key is XORed with a key stream generated by repeatedly hashing the password and the previous digest
+	keyStream := make([]byte, 0, len(pkcs8Key)+sha1.Size)
+	digest := salt
+	for len(keyStream) < len(pkcs8Key) {
+		sum := sha1.Sum(append(append([]byte{}, passwordBytes...), digest...))
+		digest = sum[:]
+		keyStream = append(keyStream, digest...)
+	}
+	encrypted := make([]byte, len(pkcs8Key))
+	for i := range pkcs8Key {
+		encrypted[i] = pkcs8Key[i] ^ keyStream[i]
+	}
+	check := sha1.Sum(append(append([]byte{}, passwordBytes...), pkcs8Key...))
+
+	protected := append(append(append([]byte{}, salt...), encrypted...), check[:]...)
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidJavaKeyProtector, Parameters: asn1.NullRawValue},
+		EncryptedData: protected,
+	})
+}
+
+// utf16BigEndian encodes a password to a big-endian UTF-16 string as Java's key stores expect it
+func utf16BigEndian(s string) []byte {
+	var ret []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		ret = append(ret, byte(r>>8), byte(r))
+	}
+	return ret
+}
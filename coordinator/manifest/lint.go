@@ -0,0 +1,172 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/edgelesssys/marblerun/coordinator/user"
+)
+
+// maxSecretReaders is the number of users which may read a secret before Lint warns about it
+const maxSecretReaders = 2
+
+// Rules reported by Lint
+const (
+	LintDebugPackage         = "debug-package"
+	LintUnlimitedActivations = "unlimited-activations"
+	LintUnusedSecret         = "unused-secret"
+	LintUnusedRole           = "unused-role"
+	LintUnusedTLSTag         = "unused-tls-tag"
+	LintUserWithoutRoles     = "user-without-roles"
+	LintWidelyReadableSecret = "widely-readable-secret"
+	LintMixedIdentity        = "mixed-package-identity"
+)
+
+// LintWarning describes a configuration which is accepted by Check, but is likely unintended or risky
+type LintWarning struct {
+	// Rule identifies the kind of the warning
+	Rule string
+	// Path is the location of the affected entry in the manifest, e.g. "Packages.frontend"
+	Path string
+	// Message describes the warning
+	Message string
+}
+
+// Lint returns warnings for risky configurations of a manifest, sorted by their path.
+// The manifest should be checked with Check before, since Lint assumes all references are valid.
+func (m Manifest) Lint() []LintWarning {
+	var warnings []LintWarning
+	warn := func(rule, path, format string, args ...interface{}) {
+		warnings = append(warnings, LintWarning{Rule: rule, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for name, pkg := range m.Packages {
+		if pkg.Debug {
+			warn(LintDebugPackage, "Packages."+name, "package %s allows enclaves in debug mode, whose memory can be inspected by the host", name)
+		}
+		if pkg.UniqueID != "" && (pkg.SignerID != "" || pkg.ProductID != nil || pkg.SecurityVersion != nil) {
+			warn(LintMixedIdentity, "Packages."+name, "package %s specifies UniqueID and SignerID/ProductID/SecurityVersion, which is only accepted in debug mode", name)
+		}
+	}
+
+	usedSecrets := make(map[string]bool)
+	usedTags := make(map[string]bool)
+	for name, marble := range m.Marbles {
+		if marble.MaxActivations == 0 {
+			warn(LintUnlimitedActivations, "Marbles."+name, "marble %s can be activated an unlimited number of times", name)
+		}
+		for _, tag := range marble.TLS {
+			usedTags[tag] = true
+		}
+		for _, secretName := range marble.Secrets {
+			usedSecrets[secretName] = true
+		}
+		for secretName := range marble.TransitKeys {
+			usedSecrets[secretName] = true
+		}
+		if marble.Parameters == nil {
+			continue
+		}
+		templates := append([]string{}, marble.Parameters.Argv...)
+		for _, data := range marble.Parameters.Files {
+			templates = append(templates, data)
+		}
+		for _, data := range marble.Parameters.Env {
+			templates = append(templates, data)
+		}
+		for _, data := range templates {
+			referencedSecrets, err := ReferencedSecrets(data)
+			if err == errUnrestrictedSecretAccess {
+				for secretName := range m.Secrets {
+					usedSecrets[secretName] = true
+				}
+			}
+			for _, secretName := range referencedSecrets {
+				usedSecrets[secretName] = true
+			}
+		}
+	}
+	for _, tag := range m.TLS {
+		for _, entry := range tag.Incoming {
+			usedSecrets[entry.Cert] = true
+		}
+	}
+	for _, secret := range m.Secrets {
+		usedSecrets[secret.Issuer] = true
+		usedSecrets[secret.DerivedFrom] = true
+		if secret.SSHCertificate != nil {
+			usedSecrets[secret.SSHCertificate.Issuer] = true
+		}
+	}
+
+	usedRoles := make(map[string]bool)
+	for name, usr := range m.Users {
+		if len(usr.Roles) <= 0 {
+			warn(LintUserWithoutRoles, "Users."+name, "user %s has no roles", name)
+		}
+		for _, role := range usr.Roles {
+			usedRoles[role] = true
+		}
+	}
+
+	secretReaders := make(map[string]map[string]bool)
+	for roleName, role := range m.Roles {
+		if !usedRoles[roleName] {
+			warn(LintUnusedRole, "Roles."+roleName, "role %s is not assigned to any user", roleName)
+		}
+		if role.ResourceType != "Secrets" {
+			continue
+		}
+		var readRole bool
+		for _, action := range role.Actions {
+			if strings.ToLower(action) == user.PermissionReadSecret {
+				readRole = true
+			}
+		}
+		for _, secretName := range role.ResourceNames {
+			usedSecrets[secretName] = true
+			if !readRole {
+				continue
+			}
+			if secretReaders[secretName] == nil {
+				secretReaders[secretName] = make(map[string]bool)
+			}
+			for userName, usr := range m.Users {
+				for _, userRole := range usr.Roles {
+					if userRole == roleName {
+						secretReaders[secretName][userName] = true
+					}
+				}
+			}
+		}
+	}
+
+	for name := range m.Secrets {
+		if !usedSecrets[name] {
+			warn(LintUnusedSecret, "Secrets."+name, "secret %s is not used by any marble, secret or role", name)
+		}
+		if readers := len(secretReaders[name]); readers > maxSecretReaders {
+			warn(LintWidelyReadableSecret, "Secrets."+name, "secret %s can be read by %d users", name, readers)
+		}
+	}
+	for name := range m.TLS {
+		if !usedTags[name] {
+			warn(LintUnusedTLSTag, "TLS."+name, "TLS tag %s is not used by any marble", name)
+		}
+	}
+
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].Path != warnings[j].Path {
+			return warnings[i].Path < warnings[j].Path
+		}
+		return warnings[i].Rule < warnings[j].Rule
+	})
+	return warnings
+}
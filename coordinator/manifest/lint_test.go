@@ -0,0 +1,78 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"testing"
+
+	"github.com/edgelesssys/marblerun/coordinator/quote"
+	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint(t *testing.T) {
+	assert := assert.New(t)
+
+	productID := uint64(1)
+	securityVersion := uint(1)
+	m := Manifest{
+		Packages: map[string]quote.PackageProperties{
+			"release": {SignerID: "signer", ProductID: &productID, SecurityVersion: &securityVersion},
+			"debug":   {UniqueID: "unique", SignerID: "signer", Debug: true},
+		},
+		Marbles: map[string]Marble{
+			"backend": {
+				Package:        "release",
+				MaxActivations: 1,
+				Parameters:     &rpc.Parameters{Env: map[string]string{"KEY": "{{ hex .Secrets.used }}"}},
+				TLS:            []string{"web"},
+			},
+			"frontend": {Package: "debug", Secrets: []string{"listed"}},
+		},
+		Secrets: map[string]Secret{
+			"used":       {Type: "symmetric-key", Size: 128},
+			"listed":     {Type: "symmetric-key", Size: 128},
+			"ca":         {Type: "cert-ecdsa", Size: 256, Shared: true},
+			"issued":     {Type: "cert-ecdsa", Size: 256, Shared: true, Issuer: "ca"},
+			"master":     {Type: "symmetric-key", Size: 256, UserDefined: true},
+			"derived":    {Type: "symmetric-key", Size: 128, DerivedFrom: "master"},
+			"userSecret": {Type: "plain", UserDefined: true},
+		},
+		Users: map[string]User{
+			"alice": {Roles: []string{"reader"}},
+			"bob":   {Roles: []string{"reader"}},
+			"carol": {Roles: []string{"reader"}},
+			"dave":  {},
+		},
+		Roles: map[string]Role{
+			"reader": {ResourceType: "Secrets", ResourceNames: []string{"userSecret"}, Actions: []string{"ReadSecret"}},
+			"unused": {ResourceType: "Manifest", Actions: []string{"ReadManifest"}},
+		},
+		TLS: map[string]TLStag{
+			"web":    {},
+			"unused": {},
+		},
+	}
+
+	assert.Equal([]LintWarning{
+		{Rule: LintUnlimitedActivations, Path: "Marbles.frontend", Message: "marble frontend can be activated an unlimited number of times"},
+		{Rule: LintDebugPackage, Path: "Packages.debug", Message: "package debug allows enclaves in debug mode, whose memory can be inspected by the host"},
+		{Rule: LintMixedIdentity, Path: "Packages.debug", Message: "package debug specifies UniqueID and SignerID/ProductID/SecurityVersion, which is only accepted in debug mode"},
+		{Rule: LintUnusedRole, Path: "Roles.unused", Message: "role unused is not assigned to any user"},
+		{Rule: LintUnusedSecret, Path: "Secrets.derived", Message: "secret derived is not used by any marble, secret or role"},
+		{Rule: LintUnusedSecret, Path: "Secrets.issued", Message: "secret issued is not used by any marble, secret or role"},
+		{Rule: LintWidelyReadableSecret, Path: "Secrets.userSecret", Message: "secret userSecret can be read by 3 users"},
+		{Rule: LintUnusedTLSTag, Path: "TLS.unused", Message: "TLS tag unused is not used by any marble"},
+		{Rule: LintUserWithoutRoles, Path: "Users.dave", Message: "user dave has no roles"},
+	}, m.Lint())
+
+	// templates which range over all secrets use every secret
+	m.Marbles["backend"].Parameters.Env["ALL"] = "{{ range .Secrets }}{{ end }}"
+	for _, warning := range m.Lint() {
+		assert.NotEqual(LintUnusedSecret, warning.Rule)
+	}
+}
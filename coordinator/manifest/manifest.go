@@ -7,7 +7,11 @@
 package manifest
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
@@ -17,6 +21,7 @@ import (
 	"fmt"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/edgelesssys/marblerun/coordinator/quote"
 	"github.com/edgelesssys/marblerun/coordinator/rpc"
@@ -24,6 +29,9 @@ import (
 	"go.uber.org/zap"
 )
 
+// minRSAKeySize is the minimum size in bits of RSA keys generated for key-rsa and ssh-rsa secrets
+const minRSAKeySize = 2048
+
 // Manifest defines the rules of a mesh.
 type Manifest struct {
 	// Packages contains the allowed enclaves and their properties.
@@ -44,6 +52,8 @@ type Manifest struct {
 	Roles map[string]Role
 	// TLS contains tags which can be assiged to Marbles to specify which connections should be elevated to TLS
 	TLS map[string]TLStag
+	// SecretProviders are external services the Coordinator fetches secrets from
+	SecretProviders map[string]SecretProvider `json:",omitempty"`
 }
 
 // Marble describes a service in the mesh that should be handled and verified by the Coordinator
@@ -57,6 +67,14 @@ type Marble struct {
 	Parameters *rpc.Parameters
 	// TLS holds a list of tags which are specified in the manifest
 	TLS []string
+	// Secrets restricts the secrets the marble can access to the listed ones.
+	// If Secrets is not set, the marble can access all secrets.
+	Secrets []string
+	// CertificatePolicy allows activated marbles of this type to request certificates at runtime
+	CertificatePolicy *CertificatePolicy `json:",omitempty"`
+	// TransitKeys allows activated marbles of this type to use the named secrets for cryptographic operations performed by the Coordinator.
+	// The key material of these secrets is not passed to the marble unless it is referenced in Parameters.
+	TransitKeys map[string]TransitKeyPolicy `json:",omitempty"`
 }
 
 // TLStag describes which entries should be used to determine the ttls connections of a marble
@@ -83,6 +101,32 @@ type User struct {
 	Roles []string
 }
 
+// ParseCertificate parses the PEM encoded certificate of a user
+func (u User) ParseCertificate() (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(u.Certificate))
+	if block == nil {
+		return nil, errors.New("invalid certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// ParseRecoveryKey parses a PEM encoded RSA public key of the manifest's recovery keys
+func ParseRecoveryKey(rawKey string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(rawKey))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("invalid public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("unsupported type of public key")
+	}
+	return rsaPub, nil
+}
+
 // Role describes a set of actions permitted for a specific set of resources
 type Role struct {
 	// ResourceType is the type of the affected resources
@@ -172,6 +216,9 @@ func (m Manifest) Check(ctx context.Context, zaplogger *zap.Logger) error {
 		if len(user.Certificate) <= 0 {
 			return fmt.Errorf("manifest does not contain a certificate for user %s", userName)
 		}
+		if _, err := user.ParseCertificate(); err != nil {
+			return fmt.Errorf("received invalid certificate for user %s: %v", userName, err)
+		}
 		for _, role := range user.Roles {
 			if _, ok := m.Roles[role]; !ok {
 				return fmt.Errorf("manifest specifies role %s for user %s, but role does not exist", role, userName)
@@ -179,6 +226,12 @@ func (m Manifest) Check(ctx context.Context, zaplogger *zap.Logger) error {
 		}
 	}
 
+	for name, rawKey := range m.RecoveryKeys {
+		if _, err := ParseRecoveryKey(rawKey); err != nil {
+			return fmt.Errorf("recovery key %s: %v", name, err)
+		}
+	}
+
 	for roleName, role := range m.Roles {
 		switch role.ResourceType {
 		case "Packages":
@@ -187,23 +240,69 @@ func (m Manifest) Check(ctx context.Context, zaplogger *zap.Logger) error {
 					return fmt.Errorf("role %s: resource %s of type Packages is not defined in manifest", roleName, resource)
 				}
 			}
-			for _, action := range role.Actions {
-				if !(strings.ToLower(action) == user.PermissionUpdatePackage) {
-					return fmt.Errorf("unkown action: %s for type Packages in role: %s", action, roleName)
+			if err := checkRoleActions(roleName, role, user.PermissionUpdatePackage); err != nil {
+				return err
+			}
+		case "Manifest":
+			if err := checkRoleWithoutResources(roleName, role, user.PermissionReadManifest); err != nil {
+				return err
+			}
+		case "UpdateLog":
+			if err := checkRoleWithoutResources(roleName, role, user.PermissionReadUpdateLog); err != nil {
+				return err
+			}
+		case "Recovery":
+			if err := checkRoleWithoutResources(roleName, role, user.PermissionRecover); err != nil {
+				return err
+			}
+		case "RootCA":
+			if err := checkRoleWithoutResources(roleName, role, user.PermissionRotateRootCA, user.PermissionSetExternalCA); err != nil {
+				return err
+			}
+		case "SealKeys":
+			if err := checkRoleWithoutResources(roleName, role, user.PermissionRotateSealKey, user.PermissionExportSealKeys, user.PermissionImportSealKeys); err != nil {
+				return err
+			}
+		case "Activations", "Marbles":
+			for _, resource := range role.ResourceNames {
+				if _, ok := m.Marbles[resource]; !ok {
+					return fmt.Errorf("role %s: resource %s of type %s is not defined in manifest", roleName, resource, role.ResourceType)
 				}
 			}
+			allowedAction := user.PermissionReadActivations
+			if role.ResourceType == "Marbles" {
+				allowedAction = user.PermissionRevokeMarble
+			}
+			if err := checkRoleActions(roleName, role, allowedAction); err != nil {
+				return err
+			}
+		case "Users":
+			for _, resource := range role.ResourceNames {
+				if _, ok := m.Users[resource]; !ok {
+					return fmt.Errorf("role %s: resource %s of type Users is not defined in manifest", roleName, resource)
+				}
+			}
+			if err := checkRoleActions(roleName, role, user.PermissionManageUsers); err != nil {
+				return err
+			}
 		case "Secrets":
+			if err := checkRoleActions(roleName, role, user.PermissionWriteSecret, user.PermissionReadSecret, user.PermissionDeleteSecret, user.PermissionRotateSecret); err != nil {
+				return err
+			}
 			var writeRole bool
 			var readRole bool
+			var deleteRole bool
+			var rotateRole bool
 			for _, action := range role.Actions {
-				if !(strings.ToLower(action) == user.PermissionWriteSecret || strings.ToLower(action) == user.PermissionReadSecret) {
-					return fmt.Errorf("unkown action: %s for type Secrets in role: %s", action, roleName)
-				}
-				if strings.ToLower(action) == user.PermissionWriteSecret {
+				switch strings.ToLower(action) {
+				case user.PermissionWriteSecret:
 					writeRole = true
-				}
-				if strings.ToLower(action) == user.PermissionReadSecret {
+				case user.PermissionReadSecret:
 					readRole = true
+				case user.PermissionDeleteSecret:
+					deleteRole = true
+				case user.PermissionRotateSecret:
+					rotateRole = true
 				}
 			}
 			for _, secretName := range role.ResourceNames {
@@ -214,28 +313,296 @@ func (m Manifest) Check(ctx context.Context, zaplogger *zap.Logger) error {
 				if !secret.UserDefined && writeRole {
 					return fmt.Errorf("manifest specifies write permission for role %s and secret %s, but secret is not user-defined", roleName, secretName)
 				}
-				if !secret.Shared && !secret.UserDefined && readRole {
+				if !secret.Shared && !secret.UserDefined && !secret.PerMarbleType && readRole {
 					return fmt.Errorf("manifest specifies read permission for role %s and per-marble-unique secret %s", roleName, secretName)
 				}
+				if !secret.UserDefined && deleteRole {
+					return fmt.Errorf("manifest specifies delete permission for role %s and secret %s, but secret is not user-defined", roleName, secretName)
+				}
+				if (!secret.Shared || secret.UserDefined || secret.Type == "plain" || secret.Source != nil || secret.DerivedFrom != "") && rotateRole {
+					return fmt.Errorf("manifest specifies rotate permission for role %s and secret %s, but secret is not a shared generated secret", roleName, secretName)
+				}
 			}
 		default:
-			return fmt.Errorf("unrecognized resource type: %s for role: %s", role, roleName)
+			return fmt.Errorf("unrecognized resource type: %s for role: %s", role.ResourceType, roleName)
+		}
+	}
+
+	for name, provider := range m.SecretProviders {
+		if err := provider.check(name); err != nil {
+			return err
 		}
 	}
 
 	for name, s := range m.Secrets {
+		if strings.Contains(name, "/") {
+			return fmt.Errorf("invalid name for secret %s: must not contain '/'", name)
+		}
+		if s.PerMarbleType && (s.Shared || s.UserDefined) {
+			return fmt.Errorf("secret %s is defined per marble type and can not be shared or user-defined", name)
+		}
 		switch s.Type {
 		case "plain", "symmetric-key":
-			continue
 		case "cert-rsa", "cert-ed25519", "cert-ecdsa":
 			if !s.Cert.NotAfter.IsZero() && (s.ValidFor != 0) {
 				return fmt.Errorf("ambigious certificate validity duration for secret: %s, both NotAfter and ValidFor are specified", name)
 			}
+		case "key-rsa", "ssh-rsa":
+			if s.Size == 0 {
+				return fmt.Errorf("missing key size for secret: %s", name)
+			}
+			if s.Size < minRSAKeySize {
+				return fmt.Errorf("invalid size %d for secret: %s, RSA keys must have at least %d bits", s.Size, name, minRSAKeySize)
+			}
+		case "key-ecdsa":
+			if s.Size != 224 && s.Size != 256 && s.Size != 384 && s.Size != 521 {
+				return fmt.Errorf("invalid size %d for secret: %s, only 224, 256, 384 and 521 are supported", s.Size, name)
+			}
+		case "ssh-ecdsa":
+			if s.Size != 256 && s.Size != 384 && s.Size != 521 {
+				return fmt.Errorf("invalid size %d for secret: %s, only 256, 384 and 521 are supported", s.Size, name)
+			}
+		case "key-ed25519", "key-x25519", "ssh-ed25519":
+			if s.Size != 0 {
+				return fmt.Errorf("invalid size %d for secret: %s, none is expected", s.Size, name)
+			}
+		case "jwt-hmac":
+			if s.Size != 256 && s.Size != 384 && s.Size != 512 {
+				return fmt.Errorf("invalid size %d for secret: %s, only 256, 384 and 512 are supported", s.Size, name)
+			}
 		default:
 			return fmt.Errorf("unkown type: %s for secret: %s", s.Type, name)
 		}
+
+		// only certificates, symmetric keys and plain secrets can be uploaded by users
+		if s.UserDefined && (strings.HasPrefix(s.Type, "key-") || strings.HasPrefix(s.Type, "ssh-") || s.Type == "jwt-hmac") {
+			return fmt.Errorf("secret %s of type %s can not be user-defined", name, s.Type)
+		}
+		if s.SSHCertificate != nil {
+			if err := m.checkSSHCertificate(name, s); err != nil {
+				return err
+			}
+		}
+		if s.Issuer != "" {
+			if err := m.checkIssuer(name, s); err != nil {
+				return err
+			}
+		}
+		if s.Source != nil {
+			if err := m.checkSource(name, s); err != nil {
+				return err
+			}
+		}
+		if s.DerivedFrom != "" {
+			if err := m.checkDerivedFrom(name, s); err != nil {
+				return err
+			}
+		} else if s.Label != "" {
+			return fmt.Errorf("secret %s has a label, but is not derived from a master key", name)
+		}
+	}
+
+	if err := m.checkTemplates(); err != nil {
+		return err
+	}
+	for marbleName, marble := range m.Marbles {
+		if marble.Secrets != nil {
+			if err := m.checkMarbleSecrets(marbleName, marble); err != nil {
+				return err
+			}
+		}
+		if err := m.checkTransitOnlySecrets(marbleName, marble); err != nil {
+			return err
+		}
+		if marble.CertificatePolicy != nil {
+			if err := marble.CertificatePolicy.check(); err != nil {
+				return fmt.Errorf("certificate policy of marble %s: %v", marbleName, err)
+			}
+		}
+		for secretName, policy := range marble.TransitKeys {
+			secret, ok := m.Secrets[secretName]
+			if !ok {
+				return fmt.Errorf("marble %s: transit key %s is not defined in manifest", marbleName, secretName)
+			}
+			if err := policy.check(secretName, secret); err != nil {
+				return fmt.Errorf("marble %s: %v", marbleName, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkTransitOnlySecrets checks that a marble does not reference transit-only secrets in its secrets, parameters or TLS configuration
+func (m Manifest) checkTransitOnlySecrets(marbleName string, marble Marble) error {
+	referenced := append([]string{}, marble.Secrets...)
+	if marble.Parameters != nil {
+		templates := append([]string{}, marble.Parameters.Argv...)
+		for _, data := range marble.Parameters.Files {
+			templates = append(templates, data)
+		}
+		for _, data := range marble.Parameters.Env {
+			templates = append(templates, data)
+		}
+		for _, data := range templates {
+			// unrestricted access to all secrets is allowed, transit-only secrets are left out when templating
+			referencedSecrets, _ := ReferencedSecrets(data)
+			referenced = append(referenced, referencedSecrets...)
+		}
+	}
+	for _, tag := range marble.TLS {
+		for _, entry := range m.TLS[tag].Incoming {
+			referenced = append(referenced, entry.Cert)
+		}
+	}
+
+	for _, secretName := range referenced {
+		if m.Secrets[secretName].TransitOnly {
+			return fmt.Errorf("marble %s references secret %s, which can only be used as transit key", marbleName, secretName)
+		}
+	}
+	return nil
+}
+
+// checkIssuer checks that the certificate of a secret can be signed by its issuer and that the resulting chain
+// satisfies the basic constraints of all CA secrets in the chain
+func (m Manifest) checkIssuer(name string, s Secret) error {
+	if !strings.HasPrefix(s.Type, "cert-") {
+		return fmt.Errorf("secret %s of type %s can not have an issuer", name, s.Type)
+	}
+	if s.UserDefined {
+		return fmt.Errorf("secret %s is user-defined and can not have an issuer", name)
+	}
+
+	// walk up the chain; intermediates counts the CA certificates between the secret and the current issuer
+	visited := map[string]bool{name: true}
+	intermediates := 0
+	for issuerName := s.Issuer; issuerName != ""; {
+		if visited[issuerName] {
+			return fmt.Errorf("issuer chain of secret %s contains a cycle at %s", name, issuerName)
+		}
+		visited[issuerName] = true
+
+		issuer, ok := m.Secrets[issuerName]
+		if !ok {
+			return fmt.Errorf("secret %s references undefined issuer %s", name, issuerName)
+		}
+		if !strings.HasPrefix(issuer.Type, "cert-") {
+			return fmt.Errorf("issuer %s of secret %s must be a certificate", issuerName, name)
+		}
+		if !issuer.Shared && !issuer.UserDefined {
+			return fmt.Errorf("issuer %s of secret %s must be shared or user-defined", issuerName, name)
+		}
+		// the certificates of user-defined issuers are checked when they are uploaded
+		if !issuer.UserDefined {
+			if !issuer.Cert.IsCA {
+				return fmt.Errorf("issuer %s of secret %s is not a CA", issuerName, name)
+			}
+			if issuer.Cert.KeyUsage != 0 && issuer.Cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+				return fmt.Errorf("issuer %s of secret %s is not allowed to sign certificates", issuerName, name)
+			}
+			if (issuer.Cert.MaxPathLen > 0 || issuer.Cert.MaxPathLenZero) && intermediates > issuer.Cert.MaxPathLen {
+				return fmt.Errorf("issuer chain of secret %s exceeds the path length constraint of %s", name, issuerName)
+			}
+		}
+
+		intermediates++
+		issuerName = issuer.Issuer
 	}
+	return nil
+}
 
+// checkDerivedFrom checks that a secret can be derived from its master key
+func (m Manifest) checkDerivedFrom(name string, s Secret) error {
+	if s.Type != "symmetric-key" && s.Type != "jwt-hmac" {
+		return fmt.Errorf("secret %s of type %s can not be derived from a master key", name, s.Type)
+	}
+	if s.UserDefined || s.Source != nil {
+		return fmt.Errorf("secret %s is derived from a master key and can not be user-defined or have a source", name)
+	}
+	if s.Size == 0 || s.Size%8 != 0 {
+		return fmt.Errorf("invalid size %d for secret: %s, must be a multiple of 8", s.Size, name)
+	}
+	master, ok := m.Secrets[s.DerivedFrom]
+	if !ok {
+		return fmt.Errorf("secret %s references undefined master key %s", name, s.DerivedFrom)
+	}
+	if !master.UserDefined || master.Type != "symmetric-key" {
+		return fmt.Errorf("master key %s of secret %s must be a user-defined symmetric-key", s.DerivedFrom, name)
+	}
+	return nil
+}
+
+// checkSSHCertificate checks that the SSH certificate of a secret can be signed by its issuer
+func (m Manifest) checkSSHCertificate(name string, s Secret) error {
+	if !strings.HasPrefix(s.Type, "ssh-") {
+		return fmt.Errorf("secret %s of type %s can not have an SSH certificate", name, s.Type)
+	}
+	switch s.SSHCertificate.CertType {
+	case "", "host", "user":
+	default:
+		return fmt.Errorf("invalid SSH certificate type %s for secret: %s, only host and user are supported", s.SSHCertificate.CertType, name)
+	}
+	if len(s.SSHCertificate.Principals) <= 0 {
+		return fmt.Errorf("SSH certificate of secret %s does not specify any principals", name)
+	}
+
+	issuer, ok := m.Secrets[s.SSHCertificate.Issuer]
+	if !ok {
+		return fmt.Errorf("SSH certificate of secret %s references undefined issuer %s", name, s.SSHCertificate.Issuer)
+	}
+	if s.SSHCertificate.Issuer == name {
+		return fmt.Errorf("SSH certificate of secret %s can not be signed by the secret itself", name)
+	}
+	// RSA certificate authorities would sign with SHA-1, which current OpenSSH versions reject
+	if issuer.Type != "ssh-ed25519" && issuer.Type != "ssh-ecdsa" {
+		return fmt.Errorf("issuer %s of SSH certificate for secret %s must be of type ssh-ed25519 or ssh-ecdsa", s.SSHCertificate.Issuer, name)
+	}
+	if !issuer.Shared {
+		return fmt.Errorf("issuer %s of SSH certificate for secret %s must be shared", s.SSHCertificate.Issuer, name)
+	}
+	return nil
+}
+
+// checkMarbleSecrets checks that a marble only references the secrets it is allowed to access
+func (m Manifest) checkMarbleSecrets(marbleName string, marble Marble) error {
+	allowed := make(map[string]bool)
+	for _, secretName := range marble.Secrets {
+		if _, ok := m.Secrets[secretName]; !ok {
+			return fmt.Errorf("marble %s references undefined secret %s", marbleName, secretName)
+		}
+		allowed[secretName] = true
+	}
+
+	var templates []string
+	if marble.Parameters != nil {
+		for _, data := range marble.Parameters.Files {
+			templates = append(templates, data)
+		}
+		for _, data := range marble.Parameters.Env {
+			templates = append(templates, data)
+		}
+		templates = append(templates, marble.Parameters.Argv...)
+	}
+	for _, data := range templates {
+		referencedSecrets, err := ReferencedSecrets(data)
+		if err != nil {
+			return fmt.Errorf("marble %s: %v", marbleName, err)
+		}
+		for _, secretName := range referencedSecrets {
+			if !allowed[secretName] {
+				return fmt.Errorf("marble %s references secret %s, which is not in its list of secrets", marbleName, secretName)
+			}
+		}
+	}
+
+	for _, tag := range marble.TLS {
+		for _, entry := range m.TLS[tag].Incoming {
+			if entry.Cert != "" && !allowed[entry.Cert] {
+				return fmt.Errorf("marble %s uses secret %s in TLS.Incoming.%s, which is not in its list of secrets", marbleName, entry.Cert, tag)
+			}
+		}
+	}
 	return nil
 }
 
@@ -251,10 +618,70 @@ type Secret struct {
 	Size        uint
 	Shared      bool
 	UserDefined bool
-	Cert        Certificate
-	ValidFor    uint
-	Private     PrivateKey
-	Public      PublicKey
+	// PerMarbleType secrets have one value for all Marbles of the same type, but different values across types
+	PerMarbleType bool
+	Cert          Certificate
+	ValidFor      uint
+	// Issuer is the name of a shared or user-defined cert-* secret used to sign the certificate instead of the Marble root certificate
+	Issuer  string
+	Private PrivateKey
+	Public  PublicKey
+	// SSHCertificate requests an OpenSSH certificate for ssh-* secrets
+	SSHCertificate *SSHCertificate `json:",omitempty"`
+	// Source references an external secret provider the Coordinator fetches the secret from, instead of generating it
+	Source *SecretSource `json:",omitempty"`
+	// DerivedFrom is the name of a user-defined symmetric-key secret the key is derived from, instead of the Coordinator's private key.
+	// Uploading the same master key to a new Coordinator yields the same derived keys.
+	DerivedFrom string `json:",omitempty"`
+	// Label is part of the context a key is derived with. It defaults to the name of the secret.
+	Label string `json:",omitempty"`
+	// TransitOnly secrets can only be used as transit keys. They are neither available in the parameters of marbles nor readable by users.
+	TransitOnly bool `json:",omitempty"`
+	// Previous is the version of the secret before the last update or rotation. It is only set when templating a marble's parameters.
+	Previous *Secret `json:"-"`
+}
+
+// SSHCertificate defines an OpenSSH certificate signed by another ssh-* secret of the manifest
+type SSHCertificate struct {
+	// Issuer is the name of the shared ssh-* secret used as certificate authority
+	Issuer string
+	// CertType is either "host" or "user". It defaults to "host".
+	CertType string
+	// Principals are the host or user names the certificate is valid for
+	Principals []string
+	// KeyID identifies the certificate in the logs of SSH servers
+	KeyID string
+	// Raw is the certificate in SSH wire format. It is set by the Coordinator.
+	Raw []byte
+}
+
+// Fingerprint returns the hex encoded SHA-256 hash of the secret's certificate or, if it has none, of its public value
+func (s Secret) Fingerprint() string {
+	data := s.Cert.Raw
+	if len(data) <= 0 {
+		data = s.Public
+	}
+	if len(data) <= 0 {
+		return ""
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// SecretVersion describes one version in the history of a secret
+type SecretVersion struct {
+	// Version is incremented every time the secret is set, rotated or rolled back
+	Version uint
+	// User is the name of the user who created the version. It is empty for secrets generated by the Coordinator on its own.
+	User string
+	// Created is the time the version was created
+	Created time.Time
+	// Fingerprint identifies the value of the secret without revealing it
+	Fingerprint string
+	// Secret is the value of the secret. It is omitted when returning the history to a user.
+	Secret *Secret `json:",omitempty"`
+	// Deleted is true if the secret was deleted in this version. Deleted versions have no value.
+	Deleted bool `json:",omitempty"`
 }
 
 // Certificate is an x509.Certificate
@@ -326,12 +753,18 @@ func EncodeSecretDataToRaw(data interface{}) (string, error) {
 	switch secret := data.(type) {
 	case []byte:
 		raw = secret
+	case string:
+		raw = []byte(secret)
 	case PrivateKey:
 		raw = secret
 	case PublicKey:
 		raw = secret
 	case Secret:
 		raw = secret.Public
+	case *Secret:
+		if secret != nil {
+			raw = secret.Public
+		}
 	case Certificate:
 		raw = secret.Raw
 	default:
@@ -355,10 +788,23 @@ func EncodeSecretDataToBase64(data interface{}) (string, error) {
 
 // ManifestTemplateFuncMap defines the functions which can be specified for secrets in the in go template format
 var ManifestTemplateFuncMap = template.FuncMap{
-	"pem":    EncodeSecretDataToPem,
-	"hex":    EncodeSecretDataToHex,
-	"raw":    EncodeSecretDataToRaw,
-	"base64": EncodeSecretDataToBase64,
+	"pem":           EncodeSecretDataToPem,
+	"hex":           EncodeSecretDataToHex,
+	"raw":           EncodeSecretDataToRaw,
+	"base64":        EncodeSecretDataToBase64,
+	"base64url":     EncodeSecretDataToBase64URL,
+	"pkcs1":         EncodeSecretDataToPKCS1,
+	"pkcs8":         EncodeSecretDataToPKCS8,
+	"sec1":          EncodeSecretDataToSEC1,
+	"chain":         EncodeSecretDataToPemChain,
+	"jwk":           EncodeSecretDataToJWK,
+	"jwks":          EncodeSecretDataToJWKS,
+	"pkcs12":        EncodeSecretDataToPKCS12,
+	"jks":           EncodeSecretDataToJKS,
+	"openssh":       EncodeSecretDataToOpenSSH,
+	"authorizedkey": EncodeSecretDataToAuthorizedKey,
+	"sshcert":       EncodeSecretDataToSSHCertificate,
+	"age":           EncodeSecretDataToAge,
 }
 
 // CheckUpdate checks if the manifest is consistent and only contains supported values.
@@ -416,56 +862,116 @@ func ParseUserSecrets(ctx context.Context, newSecrets map[string]UserSecret, ori
 			return nil, fmt.Errorf("secret %s is not writeable", secretName)
 		}
 
-		// check correctness of the supplied secrets
-		switch originalSecret.Type {
-		case "symmetric-key":
-			// verify the length specified in the original manifest is constant
-			if originalSecret.Size == 0 || originalSecret.Size%8 != 0 {
-				return nil, fmt.Errorf("invalid secret size: %s", secretName)
-			}
-			// make sure the supplied secret is actually of the specified length
-			if len(singleSecret.Key) != int(originalSecret.Size/8) {
-				return nil, fmt.Errorf("declared size and actual size don't match: %s", secretName)
-			}
-			// make sure only a symmetric key was supplied
-			if singleSecret.Cert.Raw != nil || singleSecret.Private != nil {
-				return nil, fmt.Errorf("secret %s is set to be of type symmetric-key but specified values for a certificate", secretName)
-			}
-			parsedSecret := originalSecret
-			parsedSecret.Private = singleSecret.Key
-			parsedSecret.Public = singleSecret.Key
-			parsedSecrets[secretName] = parsedSecret
-		case "cert-rsa", "cert-ecdsa", "cert-ed25519":
-			// make sure only certificate data was supplied
-			if singleSecret.Key != nil {
-				return nil, fmt.Errorf("secret %s is set to be of type %s but specified values for a symmetric-key", secretName, originalSecret.Type)
-			}
-			// correctnes of the private key is not checked here, and can even be left empty
-			// if it is left empty trying to start a marble using the key will fail
-			var err error
-			parsedSecret := originalSecret
-			parsedSecret.Cert = singleSecret.Cert
-			parsedSecret.Private = singleSecret.Private
-			parsedSecret.Public, err = x509.MarshalPKIXPublicKey(singleSecret.Cert.PublicKey)
-			if err != nil {
-				return nil, err
-			}
-			parsedSecrets[secretName] = parsedSecret
-		case "plain":
-			// make sure only a key data was supplied
-			if singleSecret.Cert.Raw != nil || singleSecret.Private != nil {
-				return nil, fmt.Errorf("secret %s is set to be of type symmetric-key but specified values for a certificate", secretName)
-			}
-			parsedSecret := originalSecret
-			parsedSecret.Private = singleSecret.Key
-			parsedSecret.Public = singleSecret.Key
-			parsedSecrets[secretName] = parsedSecret
+		parsedSecret, err := ParseUserSecret(secretName, singleSecret, originalSecret)
+		if err != nil {
+			return nil, err
 		}
-
+		parsedSecrets[secretName] = parsedSecret
 	}
 	return parsedSecrets, nil
 }
 
+// ParseUserSecret checks if a UserSecret matches the type of the secret in the manifest and parses it to a Secret
+func ParseUserSecret(secretName string, singleSecret UserSecret, originalSecret Secret) (Secret, error) {
+	// check correctness of the supplied secrets
+	switch originalSecret.Type {
+	case "symmetric-key":
+		// verify the length specified in the original manifest is constant
+		if originalSecret.Size == 0 || originalSecret.Size%8 != 0 {
+			return Secret{}, fmt.Errorf("invalid secret size: %s", secretName)
+		}
+		// make sure the supplied secret is actually of the specified length
+		if len(singleSecret.Key) != int(originalSecret.Size/8) {
+			return Secret{}, fmt.Errorf("declared size and actual size don't match: %s", secretName)
+		}
+		// make sure only a symmetric key was supplied
+		if singleSecret.Cert.Raw != nil || singleSecret.Private != nil {
+			return Secret{}, fmt.Errorf("secret %s is set to be of type symmetric-key but specified values for a certificate", secretName)
+		}
+		parsedSecret := originalSecret
+		parsedSecret.Private = singleSecret.Key
+		parsedSecret.Public = singleSecret.Key
+		return parsedSecret, nil
+	case "cert-rsa", "cert-ecdsa", "cert-ed25519":
+		// make sure only certificate data was supplied
+		if singleSecret.Key != nil {
+			return Secret{}, fmt.Errorf("secret %s is set to be of type %s but specified values for a symmetric-key", secretName, originalSecret.Type)
+		}
+		// the private key can be left empty
+		// if it is left empty trying to start a marble using the key will fail
+		var err error
+		parsedSecret := originalSecret
+		parsedSecret.Cert = singleSecret.Cert
+		parsedSecret.Private = singleSecret.Private
+		parsedSecret.Public, err = x509.MarshalPKIXPublicKey(singleSecret.Cert.PublicKey)
+		if err != nil {
+			return Secret{}, err
+		}
+		if len(parsedSecret.Private) > 0 {
+			if err := checkKeyPair(parsedSecret); err != nil {
+				return Secret{}, fmt.Errorf("secret %s: %w", secretName, err)
+			}
+		}
+		return parsedSecret, nil
+	case "plain":
+		// make sure only a key data was supplied
+		if singleSecret.Cert.Raw != nil || singleSecret.Private != nil {
+			return Secret{}, fmt.Errorf("secret %s is set to be of type symmetric-key but specified values for a certificate", secretName)
+		}
+		parsedSecret := originalSecret
+		parsedSecret.Private = singleSecret.Key
+		parsedSecret.Public = singleSecret.Key
+		return parsedSecret, nil
+	default:
+		return Secret{}, fmt.Errorf("secret %s of type %s can not be set", secretName, originalSecret.Type)
+	}
+}
+
+// checkKeyPair verifies that the private key of a secret belongs to its public key
+func checkKeyPair(secret Secret) error {
+	privKey, err := secret.ParsePrivateKey()
+	if err != nil {
+		return err
+	}
+	signer, ok := privKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported private key type %T", privKey)
+	}
+	public, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(public, secret.Public) {
+		return errors.New("private key does not match the certificate")
+	}
+	return nil
+}
+
+// checkRoleActions verifies that a role only specifies the given actions for its resource type
+func checkRoleActions(roleName string, role Role, allowedActions ...string) error {
+	for _, action := range role.Actions {
+		var ok bool
+		for _, allowed := range allowedActions {
+			if strings.ToLower(action) == allowed {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unkown action: %s for type %s in role: %s", action, role.ResourceType, roleName)
+		}
+	}
+	return nil
+}
+
+// checkRoleWithoutResources verifies a role whose resource type refers to the Coordinator as a whole and thus takes no resource names
+func checkRoleWithoutResources(roleName string, role Role, allowedActions ...string) error {
+	if len(role.ResourceNames) > 0 {
+		return fmt.Errorf("role %s: resource type %s does not accept resource names", roleName, role.ResourceType)
+	}
+	return checkRoleActions(roleName, role, allowedActions...)
+}
+
 func warnOrFailForMissingValue(debugMode bool, parameter string, packageName string, zaplogger *zap.Logger) error {
 	if debugMode {
 		zaplogger.Warn("Manifest misses value in package declaration. This is not accepted in non-debug mode, please check your configuration.", zap.String("parameter", parameter), zap.String("packageName", packageName))
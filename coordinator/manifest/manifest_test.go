@@ -0,0 +1,87 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/edgelesssys/marblerun/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCheckDerivedFrom(t *testing.T) {
+	assert := assert.New(t)
+
+	m := Manifest{Secrets: map[string]Secret{
+		"master":    {Type: "symmetric-key", Size: 256, UserDefined: true},
+		"generated": {Type: "symmetric-key", Size: 256, Shared: true},
+		"cert":      {Type: "cert-ecdsa", Size: 256, UserDefined: true},
+	}}
+
+	assert.NoError(m.checkDerivedFrom("key", Secret{Type: "symmetric-key", Size: 128, DerivedFrom: "master"}))
+	assert.NoError(m.checkDerivedFrom("key", Secret{Type: "jwt-hmac", Size: 256, PerMarbleType: true, DerivedFrom: "master", Label: "jwt"}))
+	assert.Error(m.checkDerivedFrom("key", Secret{Type: "cert-ecdsa", Size: 256, DerivedFrom: "master"}))
+	assert.Error(m.checkDerivedFrom("key", Secret{Type: "symmetric-key", Size: 128, UserDefined: true, DerivedFrom: "master"}))
+	assert.Error(m.checkDerivedFrom("key", Secret{Type: "symmetric-key", Size: 12, DerivedFrom: "master"}))
+	assert.Error(m.checkDerivedFrom("key", Secret{Type: "symmetric-key", Size: 128, DerivedFrom: "missing"}))
+	assert.Error(m.checkDerivedFrom("key", Secret{Type: "symmetric-key", Size: 128, DerivedFrom: "generated"}))
+	assert.Error(m.checkDerivedFrom("key", Secret{Type: "symmetric-key", Size: 128, DerivedFrom: "cert"}))
+}
+
+func TestCheckRSAKeySize(t *testing.T) {
+	assert := assert.New(t)
+
+	var m Manifest
+	require.NoError(t, json.Unmarshal([]byte(test.ManifestJSON), &m))
+
+	for _, secretType := range []string{"key-rsa", "ssh-rsa"} {
+		for size, valid := range map[uint]bool{0: false, 512: false, 1024: false, 2048: true, 4096: true} {
+			m.Secrets["key"] = Secret{Type: secretType, Size: size, Shared: true}
+			err := m.Check(context.Background(), zap.NewNop())
+			if valid {
+				assert.NoError(err, "%s %d", secretType, size)
+			} else {
+				assert.Error(err, "%s %d", secretType, size)
+			}
+		}
+	}
+}
+
+func TestCheckUsersAndRecoveryKeys(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var m Manifest
+	require.NoError(json.Unmarshal([]byte(test.ManifestJSONWithRecoveryKey), &m))
+	require.NoError(m.Check(context.Background(), zap.NewNop()))
+
+	// user certificates must be valid
+	admin := m.Users["admin"]
+	validCert := admin.Certificate
+	admin.Certificate = "-----BEGIN CERTIFICATE-----\naW52YWxpZA==\n-----END CERTIFICATE-----\n"
+	m.Users["admin"] = admin
+	assert.Error(m.Check(context.Background(), zap.NewNop()))
+	admin.Certificate = "invalid"
+	m.Users["admin"] = admin
+	assert.Error(m.Check(context.Background(), zap.NewNop()))
+	admin.Certificate = validCert
+	m.Users["admin"] = admin
+
+	// recovery keys must be PEM encoded RSA public keys
+	for name, rawKey := range m.RecoveryKeys {
+		_, err := ParseRecoveryKey(rawKey)
+		assert.NoError(err, name)
+	}
+	m.RecoveryKeys["invalid"] = validCert
+	assert.Error(m.Check(context.Background(), zap.NewNop()))
+	m.RecoveryKeys["invalid"] = "invalid"
+	assert.Error(m.Check(context.Background(), zap.NewNop()))
+}
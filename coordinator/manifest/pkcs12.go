@@ -0,0 +1,279 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
+
+const pkcs12Iterations = 2048
+
+var (
+	oidDataContentType            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS8ShroudedKeyBag        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag                    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509Certificate    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidLocalKeyID                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidPBEWithSHAAnd3KeyTripleDES = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidSHA1                       = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe pkcs12ContentInfo
+	MacData  pkcs12MacData
+}
+
+type pkcs12ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type pkcs12MacData struct {
+	Mac        pkcs12DigestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type pkcs12DigestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type pkcs12SafeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type pkcs12CertBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type pkcs12PBEParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// EncodeSecretDataToPKCS12 encodes the certificate and private key of a secret to a PKCS #12 (PFX) bundle.
+// The bundle is protected with password, which is usually another secret. Additional CA certificates can be
+// appended, e.g. {{ pkcs12 .Secrets.foo .Secrets.password .Marblerun.RootCA | base64 }}.
+func EncodeSecretDataToPKCS12(data interface{}, password interface{}, caCerts ...interface{}) (string, error) {
+	key, certs, err := parseKeyStoreEntry(data, caCerts)
+	if err != nil {
+		return "", err
+	}
+	pass, err := EncodeSecretDataToRaw(password)
+	if err != nil {
+		return "", err
+	}
+	bmpPassword := bmpString(pass)
+
+	localKeyID := sha1.Sum(certs[0].Raw)
+	localKeyIDAttr, err := pkcs12LocalKeyIDAttribute(localKeyID[:])
+	if err != nil {
+		return "", err
+	}
+
+	// the certificates are stored unencrypted, so they can be read without the password
+	var certBags []pkcs12SafeBag
+	for i, cert := range certs {
+		certBag, err := asn1.Marshal(pkcs12CertBag{ID: oidCertTypeX509Certificate, Data: cert.Raw})
+		if err != nil {
+			return "", err
+		}
+		bag := pkcs12SafeBag{ID: oidCertBag, Value: explicitTag(certBag)}
+		if i == 0 {
+			bag.Attributes = []pkcs12Attribute{localKeyIDAttr}
+		}
+		certBags = append(certBags, bag)
+	}
+
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	shroudedKey, err := pkcs12ShroudKey(pkcs8Key, bmpPassword)
+	if err != nil {
+		return "", err
+	}
+	keyBags := []pkcs12SafeBag{{ID: oidPKCS8ShroudedKeyBag, Value: explicitTag(shroudedKey), Attributes: []pkcs12Attribute{localKeyIDAttr}}}
+
+	var authenticatedSafe []pkcs12ContentInfo
+	for _, bags := range [][]pkcs12SafeBag{certBags, keyBags} {
+		safeContents, err := asn1.Marshal(bags)
+		if err != nil {
+			return "", err
+		}
+		contentInfo, err := pkcs12DataContentInfo(safeContents)
+		if err != nil {
+			return "", err
+		}
+		authenticatedSafe = append(authenticatedSafe, contentInfo)
+	}
+	authenticatedSafeBytes, err := asn1.Marshal(authenticatedSafe)
+	if err != nil {
+		return "", err
+	}
+
+	macSalt := make([]byte, 8)
+	if _, err := rand.Read(macSalt); err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha1.New, pkcs12KDF(macSalt, bmpPassword, pkcs12Iterations, 3, 20))
+	mac.Write(authenticatedSafeBytes)
+
+	authSafe, err := pkcs12DataContentInfo(authenticatedSafeBytes)
+	if err != nil {
+		return "", err
+	}
+	pfx, err := asn1.Marshal(pfxPdu{
+		Version:  3,
+		AuthSafe: authSafe,
+		MacData: pkcs12MacData{
+			Mac: pkcs12DigestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+				Digest:    mac.Sum(nil),
+			},
+			MacSalt:    macSalt,
+			Iterations: pkcs12Iterations,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(pfx), nil
+}
+
+// parseKeyStoreEntry returns the private key and the certificate chain of a key store entry
+func parseKeyStoreEntry(data interface{}, caCerts []interface{}) (crypto.PrivateKey, []*x509.Certificate, error) {
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	certs, err := parseCertificates(append([]interface{}{data}, caCerts...))
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, certs, nil
+}
+
+// pkcs12ShroudKey encrypts a PKCS #8 key with pbeWithSHAAnd3-KeyTripleDES-CBC and returns the EncryptedPrivateKeyInfo
+func pkcs12ShroudKey(pkcs8Key, bmpPassword []byte) ([]byte, error) {
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pkcs12PBEParams{Salt: salt, Iterations: pkcs12Iterations})
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := des.NewTripleDESCipher(pkcs12KDF(salt, bmpPassword, pkcs12Iterations, 1, 24))
+	if err != nil {
+		return nil, err
+	}
+	iv := pkcs12KDF(salt, bmpPassword, pkcs12Iterations, 2, block.BlockSize())
+
+	padding := block.BlockSize() - len(pkcs8Key)%block.BlockSize()
+	encrypted := append(append([]byte{}, pkcs8Key...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBEWithSHAAnd3KeyTripleDES, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: encrypted,
+	})
+}
+
+func pkcs12DataContentInfo(data []byte) (pkcs12ContentInfo, error) {
+	octetString, err := asn1.Marshal(data)
+	if err != nil {
+		return pkcs12ContentInfo{}, err
+	}
+	return pkcs12ContentInfo{ContentType: oidDataContentType, Content: explicitTag(octetString)}, nil
+}
+
+func pkcs12LocalKeyIDAttribute(id []byte) (pkcs12Attribute, error) {
+	value, err := asn1.Marshal(id)
+	if err != nil {
+		return pkcs12Attribute{}, err
+	}
+	return pkcs12Attribute{ID: oidLocalKeyID, Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value}}, nil
+}
+
+// explicitTag wraps DER encoded data in an explicit [0] tag
+func explicitTag(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+// bmpString returns the password as a null-terminated big-endian UTF-16 string as required by PKCS #12
+func bmpString(s string) []byte {
+	return append(utf16BigEndian(s), 0, 0)
+}
+
+// pkcs12KDF derives key material from a password as defined in RFC 7292, Appendix B.2, using SHA-1
+func pkcs12KDF(salt, password []byte, iterations int, id byte, size int) []byte {
+	const v = 64
+
+	d := bytes.Repeat([]byte{id}, v)
+	i := append(fillWithRepeats(salt, v), fillWithRepeats(password, v)...)
+
+	var a []byte
+	for len(a) < size {
+		hash := sha1.Sum(append(append([]byte{}, d...), i...))
+		ai := hash[:]
+		for j := 1; j < iterations; j++ {
+			hash = sha1.Sum(ai)
+			ai = hash[:]
+		}
+		a = append(a, ai...)
+		if len(a) >= size {
+			break
+		}
+
+		// I_j = (I_j + B + 1) mod 2^v for each v-bit block of I
+		b := fillWithRepeats(ai, v)[:v]
+		for j := 0; j < len(i); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(i[j+k]) + int(b[k]) + carry
+				i[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return a[:size]
+}
+
+// fillWithRepeats repeats pattern until the result is a multiple of v bytes long
+func fillWithRepeats(pattern []byte, v int) []byte {
+	if len(pattern) == 0 {
+		return nil
+	}
+	outputLen := v * ((len(pattern) + v - 1) / v)
+	return bytes.Repeat(pattern, (outputLen+len(pattern)-1)/len(pattern))[:outputLen]
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Failure behaviors of remote secrets
+const (
+	// OnFailureCached continues with the last fetched value if a refresh fails
+	OnFailureCached = "cached"
+	// OnFailureFail rejects the activation of marbles until a failed refresh succeeds
+	OnFailureFail = "fail"
+)
+
+// SecretProvider defines an external service the Coordinator fetches secrets from over TLS
+//
+// The Coordinator authenticates to the service with its root certificate, which clients can verify with the Coordinator's quote.
+type SecretProvider struct {
+	// Type of the provider. Only "http" is supported: the Coordinator sends GET requests to URL/<path>
+	// and expects a UserSecret in JSON format, like the ones uploaded with WriteSecrets.
+	Type string
+	// URL is the base URL of the service. It must use https.
+	URL string
+	// RootCA is the PEM encoded certificate used to verify the TLS certificate of the service
+	RootCA string
+}
+
+// SecretSource references a secret of an external secret provider
+type SecretSource struct {
+	// Provider is the name of the secret provider in the manifest
+	Provider string
+	// Path identifies the secret at the provider
+	Path string
+	// RefreshInterval is the time after which the secret is fetched again in the background, e.g. "1h".
+	// If it is not set, the secret is only fetched when the manifest is set.
+	RefreshInterval string
+	// OnFailure defines the behavior if a refresh fails: "cached" (default) continues with the last fetched value, "fail" rejects activations until the secret is fetched again.
+	OnFailure string
+}
+
+// Refresh returns the refresh interval of the secret, or 0 if it is never refreshed
+func (s SecretSource) Refresh() time.Duration {
+	interval, _ := time.ParseDuration(s.RefreshInterval)
+	return interval
+}
+
+// check verifies the settings of a secret provider
+func (p SecretProvider) check(name string) error {
+	if p.Type != "http" {
+		return fmt.Errorf("secret provider %s: unsupported type %s", name, p.Type)
+	}
+	providerURL, err := url.Parse(p.URL)
+	if err != nil {
+		return fmt.Errorf("secret provider %s: %v", name, err)
+	}
+	if providerURL.Scheme != "https" || providerURL.Host == "" {
+		return fmt.Errorf("secret provider %s: URL must be an absolute https URL", name)
+	}
+	block, _ := pem.Decode([]byte(p.RootCA))
+	if block == nil {
+		return fmt.Errorf("secret provider %s: RootCA is not a PEM encoded certificate", name)
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return fmt.Errorf("secret provider %s: %v", name, err)
+	}
+	return nil
+}
+
+// checkSource verifies that a secret with a source references a defined provider and can be fetched
+func (m Manifest) checkSource(name string, s Secret) error {
+	if !s.Shared || s.UserDefined {
+		return fmt.Errorf("secret %s has a source and must be shared, but not user-defined", name)
+	}
+	switch s.Type {
+	case "plain", "symmetric-key", "cert-rsa", "cert-ecdsa", "cert-ed25519":
+	default:
+		return fmt.Errorf("secret %s of type %s can not have a source", name, s.Type)
+	}
+	if s.Issuer != "" {
+		return fmt.Errorf("secret %s has a source and can not have an issuer", name)
+	}
+	if _, ok := m.SecretProviders[s.Source.Provider]; !ok {
+		return fmt.Errorf("secret %s references undefined secret provider %s", name, s.Source.Provider)
+	}
+	if s.Source.Path == "" {
+		return fmt.Errorf("secret %s: source misses Path", name)
+	}
+	if s.Source.RefreshInterval != "" {
+		interval, err := time.ParseDuration(s.Source.RefreshInterval)
+		if err != nil {
+			return fmt.Errorf("secret %s: invalid refresh interval: %v", name, err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("secret %s: refresh interval must be positive", name)
+		}
+	}
+	switch s.Source.OnFailure {
+	case "", OnFailureCached, OnFailureFail:
+	default:
+		return fmt.Errorf("secret %s: unknown failure behavior %s", name, s.Source.OnFailure)
+	}
+	return nil
+}
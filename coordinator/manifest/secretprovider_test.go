@@ -0,0 +1,47 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretProvider(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cert, _, err := util.GenerateCert([]string{"localhost"}, nil, false)
+	require.NoError(err)
+	rootCA := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+
+	assert.NoError(SecretProvider{Type: "http", URL: "https://vault.example.com/v1", RootCA: rootCA}.check("vault"))
+	assert.Error(SecretProvider{Type: "kmip", URL: "https://vault.example.com/v1", RootCA: rootCA}.check("vault"))
+	assert.Error(SecretProvider{Type: "http", URL: "http://vault.example.com/v1", RootCA: rootCA}.check("vault"))
+	assert.Error(SecretProvider{Type: "http", URL: "https://vault.example.com/v1"}.check("vault"))
+
+	m := Manifest{SecretProviders: map[string]SecretProvider{"vault": {}}}
+	source := &SecretSource{Provider: "vault", Path: "db-key", RefreshInterval: "1h", OnFailure: OnFailureFail}
+	assert.NoError(m.checkSource("key", Secret{Type: "symmetric-key", Size: 128, Shared: true, Source: source}))
+	assert.NoError(m.checkSource("cert", Secret{Type: "cert-ecdsa", Shared: true, Source: &SecretSource{Provider: "vault", Path: "cert"}}))
+	// remote secrets are stored by the Coordinator and can not be uploaded
+	assert.Error(m.checkSource("key", Secret{Type: "symmetric-key", Size: 128, Source: source}))
+	assert.Error(m.checkSource("key", Secret{Type: "symmetric-key", Size: 128, Shared: true, UserDefined: true, Source: source}))
+	assert.Error(m.checkSource("key", Secret{Type: "key-rsa", Size: 2048, Shared: true, Source: source}))
+	assert.Error(m.checkSource("key", Secret{Type: "symmetric-key", Size: 128, Shared: true, Source: &SecretSource{Provider: "other", Path: "db-key"}}))
+	assert.Error(m.checkSource("key", Secret{Type: "symmetric-key", Size: 128, Shared: true, Source: &SecretSource{Provider: "vault"}}))
+	assert.Error(m.checkSource("key", Secret{Type: "symmetric-key", Size: 128, Shared: true, Source: &SecretSource{Provider: "vault", Path: "db-key", RefreshInterval: "-1h"}}))
+	assert.Error(m.checkSource("key", Secret{Type: "symmetric-key", Size: 128, Shared: true, Source: &SecretSource{Provider: "vault", Path: "db-key", OnFailure: "retry"}}))
+
+	assert.Equal(time.Hour, source.Refresh())
+	assert.Zero(SecretSource{}.Refresh())
+}
@@ -0,0 +1,124 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// EncodeSecretDataToOpenSSH encodes a private key to an unencrypted "OPENSSH PRIVATE KEY" PEM block as written by ssh-keygen
+func EncodeSecretDataToOpenSSH(data interface{}) (string, error) {
+	priv, err := parsePrivateKey(data)
+	if err != nil {
+		return "", err
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return "", err
+	}
+
+	// the key specific fields as defined in OpenSSH's PROTOCOL.key
+	var keyFields []byte
+	switch priv := priv.(type) {
+	case *rsa.PrivateKey:
+		priv.Precompute()
+		keyFields = ssh.Marshal(struct {
+			N, E, D, Iqmp, P, Q *big.Int
+		}{priv.N, big.NewInt(int64(priv.E)), priv.D, priv.Precomputed.Qinv, priv.Primes[0], priv.Primes[1]})
+	case *ecdsa.PrivateKey:
+		curve := strings.TrimPrefix(signer.PublicKey().Type(), "ecdsa-sha2-")
+		keyFields = ssh.Marshal(struct {
+			Curve string
+			Pub   []byte
+			D     *big.Int
+		}{curve, elliptic.Marshal(priv.Curve, priv.X, priv.Y), priv.D})
+	case ed25519.PrivateKey:
+		keyFields = ssh.Marshal(struct {
+			Pub  []byte
+			Priv []byte
+		}{priv.Public().(ed25519.PublicKey), priv})
+	default:
+		return "", fmt.Errorf("unsupported key type %T", priv)
+	}
+
+	checkBytes := make([]byte, 4)
+	if _, err := rand.Read(checkBytes); err != nil {
+		return "", err
+	}
+	check := binary.BigEndian.Uint32(checkBytes)
+
+	privKeyBlock := ssh.Marshal(struct {
+		Check1, Check2 uint32
+		KeyType        string
+	}{check, check, signer.PublicKey().Type()})
+	privKeyBlock = append(privKeyBlock, keyFields...)
+	privKeyBlock = append(privKeyBlock, ssh.Marshal(struct{ Comment string }{""})...)
+	// pad to the block size of the "none" cipher
+	for i := 1; len(privKeyBlock)%8 != 0; i++ {
+		privKeyBlock = append(privKeyBlock, byte(i))
+	}
+
+	key := append([]byte("openssh-key-v1\x00"), ssh.Marshal(struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}{"none", "none", "", 1, signer.PublicKey().Marshal(), privKeyBlock})...)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: key})), nil
+}
+
+// EncodeSecretDataToAuthorizedKey encodes a public key to the OpenSSH authorized_keys format, e.g. "ssh-ed25519 AAAA..."
+func EncodeSecretDataToAuthorizedKey(data interface{}) (string, error) {
+	pub, err := parsePublicKey(data)
+	if err != nil {
+		return "", err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))), nil
+}
+
+// EncodeSecretDataToSSHCertificate encodes the OpenSSH certificate of an ssh-* secret to the format of ssh-keygen's *-cert.pub files
+func EncodeSecretDataToSSHCertificate(data interface{}) (string, error) {
+	var sshCertificate *SSHCertificate
+	switch secret := data.(type) {
+	case Secret:
+		sshCertificate = secret.SSHCertificate
+	case *Secret:
+		if secret != nil {
+			sshCertificate = secret.SSHCertificate
+		}
+	default:
+		return "", errors.New("invalid secret type: expected a secret")
+	}
+	if sshCertificate == nil || len(sshCertificate.Raw) <= 0 {
+		return "", errors.New("secret has no SSH certificate")
+	}
+
+	cert, err := ssh.ParsePublicKey(sshCertificate.Raw)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert))), nil
+}
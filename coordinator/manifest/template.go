@@ -0,0 +1,412 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ssh"
+)
+
+// errUnrestrictedSecretAccess is returned if a template accesses the secrets in a way we can not resolve to secret names
+var errUnrestrictedSecretAccess = errors.New("template accesses .Secrets without naming a secret")
+
+// ReservedSecrets are the secrets the Coordinator generates for every marble on activation
+type ReservedSecrets struct {
+	RootCA     Secret
+	MarbleCert Secret
+	SealKey    Secret
+	// SealKeyID identifies the version of SealKey
+	SealKeyID string
+	// SealKeys holds the marble's seal keys of all versions by their ID, so data sealed before a rotation can still be unsealed
+	SealKeys map[string]Secret
+}
+
+// MarbleMetadata holds information about a marble's activation
+type MarbleMetadata struct {
+	// Type is the marble type as defined in the manifest
+	Type string
+	// UUID is the marble's UUID
+	UUID string
+	// DNSNames are the DNS names requested in the marble's certificate signing request
+	DNSNames []string
+	// CoordinatorDNSNames are the DNS names of the Coordinator
+	CoordinatorDNSNames []string
+	// ActivationTime is the time the marble was activated
+	ActivationTime time.Time
+}
+
+// SecretsWrapper is passed to the templates in a marble's parameters. It defines the "Marblerun" prefix for reserved secrets,
+// the "Secrets" prefix for the secrets of the manifest and the "Marble" prefix for the marble's activation metadata.
+type SecretsWrapper struct {
+	Marblerun ReservedSecrets
+	Secrets   map[string]Secret
+	Marble    MarbleMetadata
+}
+
+// ReferencedSecrets returns the names of all secrets referenced in a template of a marble's parameters
+func ReferencedSecrets(data string) ([]string, error) {
+	tpl, err := template.New("data").Funcs(ManifestTemplateFuncMap).Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := newTemplateReferences()
+	refs.collect(tpl.Tree.Root)
+	if refs.allSecrets {
+		return nil, errUnrestrictedSecretAccess
+	}
+	return sortedKeys(refs.secrets), nil
+}
+
+// checkTemplates verifies that all templates in the marbles' parameters can be executed with the secrets defined in the manifest.
+// All problems are reported with their path in the manifest.
+func (m Manifest) checkTemplates() error {
+	var problems []string
+	for marbleName, marble := range m.Marbles {
+		if marble.Parameters == nil {
+			continue
+		}
+		for path, data := range marble.Parameters.Files {
+			if err := checkTemplate(data, m.Secrets); err != nil {
+				problems = append(problems, fmt.Sprintf("Marbles.%s.Parameters.Files.%s: %v", marbleName, path, err))
+			}
+		}
+		for name, data := range marble.Parameters.Env {
+			if err := checkTemplate(data, m.Secrets); err != nil {
+				problems = append(problems, fmt.Sprintf("Marbles.%s.Parameters.Env.%s: %v", marbleName, name, err))
+			}
+		}
+		for i, data := range marble.Parameters.Argv {
+			if err := checkTemplate(data, m.Secrets); err != nil {
+				problems = append(problems, fmt.Sprintf("Marbles.%s.Parameters.Argv[%d]: %v", marbleName, i, err))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("manifest contains invalid templates: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkTemplate parses a template and verifies that it only references defined secrets.
+// The template is executed with placeholder values to detect encodings which do not fit the secrets.
+func checkTemplate(data string, secrets map[string]Secret) error {
+	tpl, err := template.New("data").Funcs(ManifestTemplateFuncMap).Option("missingkey=error").Parse(data)
+	if err != nil {
+		return err
+	}
+
+	refs := newTemplateReferences()
+	refs.collect(tpl.Tree.Root)
+	for _, name := range sortedKeys(refs.secrets) {
+		if _, ok := secrets[name]; !ok {
+			return fmt.Errorf("undefined secret %s", name)
+		}
+	}
+	reservedType := reflect.TypeOf(ReservedSecrets{})
+	for _, name := range sortedKeys(refs.reserved) {
+		if _, ok := reservedType.FieldByName(name); !ok {
+			return fmt.Errorf("undefined reserved secret Marblerun.%s", name)
+		}
+	}
+	metadataType := reflect.TypeOf(MarbleMetadata{})
+	for _, name := range sortedKeys(refs.metadata) {
+		if _, ok := metadataType.FieldByName(name); !ok {
+			return fmt.Errorf("undefined marble metadata Marble.%s", name)
+		}
+	}
+
+	placeholders, err := placeholderSecrets(secrets)
+	if err != nil {
+		return err
+	}
+	return tpl.Execute(ioutil.Discard, placeholders)
+}
+
+// placeholderSecrets returns secrets filled with placeholder values according to their type.
+// Certificates and keys are real, so encodings which parse them can be checked.
+func placeholderSecrets(secrets map[string]Secret) (SecretsWrapper, error) {
+	keys, err := getPlaceholderKeys()
+	if err != nil {
+		return SecretsWrapper{}, err
+	}
+	sealKey := make([]byte, 32)
+
+	wrapped := SecretsWrapper{
+		Marblerun: ReservedSecrets{
+			RootCA:     Secret{Cert: keys["cert-ecdsa"].Cert},
+			MarbleCert: keys["cert-ecdsa"],
+			SealKey:    Secret{Public: sealKey, Private: sealKey},
+			SealKeyID:  "1",
+			SealKeys:   map[string]Secret{"1": {Public: sealKey, Private: sealKey}},
+		},
+		Secrets: make(map[string]Secret),
+		Marble: MarbleMetadata{
+			Type:                "placeholder",
+			UUID:                "00000000-0000-0000-0000-000000000000",
+			DNSNames:            []string{"localhost"},
+			CoordinatorDNSNames: []string{"localhost"},
+			ActivationTime:      time.Now(),
+		},
+	}
+	for name, secret := range secrets {
+		if key, ok := keys[secret.Type]; ok {
+			secret.Cert, secret.Public, secret.Private = key.Cert, key.Public, key.Private
+			if secret.SSHCertificate != nil {
+				sshCertificate := *secret.SSHCertificate
+				sshCertificate.Raw = key.SSHCertificate.Raw
+				secret.SSHCertificate = &sshCertificate
+			}
+		} else {
+			size := secret.Size / 8
+			if size <= 0 {
+				size = 16
+			}
+			value := make([]byte, size)
+			secret.Cert, secret.Public, secret.Private = Certificate{}, value, value
+		}
+		previous := secret
+		secret.Previous = &previous
+		wrapped.Secrets[name] = secret
+	}
+	return wrapped, nil
+}
+
+var placeholderKeys struct {
+	once sync.Once
+	keys map[string]Secret
+	err  error
+}
+
+// getPlaceholderKeys returns a placeholder for each secret type with asymmetric keys.
+// Certificates are self-signed. The keys are generated once, since key generation is slow.
+func getPlaceholderKeys() (map[string]Secret, error) {
+	placeholderKeys.once.Do(func() {
+		placeholderKeys.keys, placeholderKeys.err = generatePlaceholderKeys()
+	})
+	return placeholderKeys.keys, placeholderKeys.err
+}
+
+func generatePlaceholderKeys() (map[string]Secret, error) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]Secret)
+	for algorithm, key := range map[string]crypto.Signer{"rsa": rsaKey, "ecdsa": ecdsaKey, "ed25519": ed25519Key} {
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "placeholder"},
+			NotBefore:             time.Now(),
+			NotAfter:              time.Now().Add(time.Hour),
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		certRaw, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(certRaw)
+		if err != nil {
+			return nil, err
+		}
+		public, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		private, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		sshPublic, err := ssh.NewPublicKey(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		sshSigner, err := ssh.NewSignerFromSigner(key)
+		if err != nil {
+			return nil, err
+		}
+		sshCert := &ssh.Certificate{Key: sshPublic, CertType: ssh.HostCert, ValidPrincipals: []string{"localhost"}, ValidBefore: ssh.CertTimeInfinity}
+		if err := sshCert.SignCert(rand.Reader, sshSigner); err != nil {
+			return nil, err
+		}
+
+		keys["cert-"+algorithm] = Secret{Type: "cert-" + algorithm, Cert: Certificate(*cert), Public: public, Private: private}
+		keys["key-"+algorithm] = Secret{Type: "key-" + algorithm, Public: public, Private: private}
+		keys["ssh-"+algorithm] = Secret{Type: "ssh-" + algorithm, Public: public, Private: private, SSHCertificate: &SSHCertificate{Raw: sshCert.Marshal()}}
+	}
+
+	x25519Private := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(x25519Private); err != nil {
+		return nil, err
+	}
+	x25519Public, err := curve25519.X25519(x25519Private, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	keys["key-x25519"] = Secret{Type: "key-x25519", Public: x25519Public, Private: x25519Private}
+
+	return keys, nil
+}
+
+// templateReferences holds the secrets referenced in a template
+type templateReferences struct {
+	// secrets are the names referenced with the "Secrets" prefix
+	secrets map[string]bool
+	// reserved are the names referenced with the "Marblerun" prefix
+	reserved map[string]bool
+	// metadata are the names referenced with the "Marble" prefix
+	metadata map[string]bool
+	// allSecrets is set if the template accesses .Secrets without naming a secret
+	allSecrets bool
+}
+
+func newTemplateReferences() *templateReferences {
+	return &templateReferences{
+		secrets:  make(map[string]bool),
+		reserved: make(map[string]bool),
+		metadata: make(map[string]bool),
+	}
+}
+
+// collect walks a template's parse tree and records all referenced secrets
+func (r *templateReferences) collect(node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, n := range node.Nodes {
+			r.collect(n)
+		}
+	case *parse.ActionNode:
+		r.collect(node.Pipe)
+	case *parse.IfNode:
+		r.collectBranch(&node.BranchNode)
+	case *parse.RangeNode:
+		r.collectBranch(&node.BranchNode)
+	case *parse.WithNode:
+		r.collectBranch(&node.BranchNode)
+	case *parse.TemplateNode:
+		r.collect(node.Pipe)
+	case *parse.PipeNode:
+		if node == nil {
+			return
+		}
+		for _, cmd := range node.Cmds {
+			r.collect(cmd)
+		}
+	case *parse.CommandNode:
+		// index .Secrets "name"
+		if len(node.Args) >= 3 {
+			if ident, ok := node.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "index" && isSecretsNode(node.Args[1]) {
+				if name, ok := node.Args[2].(*parse.StringNode); ok {
+					r.secrets[name.Text] = true
+					for _, arg := range node.Args[3:] {
+						r.collect(arg)
+					}
+					return
+				}
+			}
+		}
+		for _, arg := range node.Args {
+			r.collect(arg)
+		}
+	case *parse.FieldNode:
+		r.addField(node.Ident)
+	case *parse.VariableNode:
+		if len(node.Ident) > 0 && node.Ident[0] == "$" {
+			r.addField(node.Ident[1:])
+		}
+	case *parse.ChainNode:
+		if field, ok := node.Node.(*parse.FieldNode); ok {
+			r.addField(append(append([]string{}, field.Ident...), node.Field...))
+			return
+		}
+		r.collect(node.Node)
+	}
+}
+
+func (r *templateReferences) collectBranch(node *parse.BranchNode) {
+	r.collect(node.Pipe)
+	r.collect(node.List)
+	r.collect(node.ElseList)
+}
+
+// addField records the secret or metadata of a field chain like .Secrets.name.Cert, .Marblerun.SealKey or .Marble.UUID
+func (r *templateReferences) addField(ident []string) {
+	if len(ident) <= 0 {
+		return
+	}
+	switch ident[0] {
+	case "Secrets":
+		if len(ident) < 2 {
+			r.allSecrets = true
+			return
+		}
+		r.secrets[ident[1]] = true
+	case "Marblerun":
+		if len(ident) >= 2 {
+			r.reserved[ident[1]] = true
+		}
+	case "Marble":
+		if len(ident) >= 2 {
+			r.metadata[ident[1]] = true
+		}
+	}
+}
+
+// isSecretsNode returns true if node refers to the map of all secrets
+func isSecretsNode(node parse.Node) bool {
+	switch node := node.(type) {
+	case *parse.FieldNode:
+		return len(node.Ident) == 1 && node.Ident[0] == "Secrets"
+	case *parse.VariableNode:
+		return len(node.Ident) == 2 && node.Ident[0] == "$" && node.Ident[1] == "Secrets"
+	}
+	return false
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,182 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"testing"
+
+	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferencedSecrets(t *testing.T) {
+	testCases := map[string]struct {
+		data    string
+		secrets []string
+		wantErr bool
+	}{
+		"no template": {
+			data: "plain value",
+		},
+		"reserved secrets": {
+			data: "{{ hex .Marblerun.SealKey }}",
+		},
+		"field": {
+			data:    "{{ pem .Secrets.foo.Cert }}",
+			secrets: []string{"foo"},
+		},
+		"multiple": {
+			data:    "{{ raw .Secrets.foo }} {{ pem .Secrets.bar.Private }} {{ hex .Secrets.foo }}",
+			secrets: []string{"foo", "bar"},
+		},
+		"index": {
+			data:    `{{ raw (index .Secrets "foo") }}`,
+			secrets: []string{"foo"},
+		},
+		"variable": {
+			data:    "{{ with .Marblerun }}{{ raw $.Secrets.foo }}{{ end }}",
+			secrets: []string{"foo"},
+		},
+		"branch": {
+			data:    "{{ if .Secrets.foo }}{{ raw .Secrets.bar }}{{ else }}{{ raw .Secrets.baz }}{{ end }}",
+			secrets: []string{"foo", "bar", "baz"},
+		},
+		"unrestricted": {
+			data:    "{{ range .Secrets }}{{ raw . }}{{ end }}",
+			wantErr: true,
+		},
+		"unresolvable index": {
+			data:    "{{ raw (index .Secrets .Marblerun.SealKey) }}",
+			wantErr: true,
+		},
+		"invalid template": {
+			data:    "{{ raw .Secrets.foo",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			secrets, err := ReferencedSecrets(tc.data)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.ElementsMatch(tc.secrets, secrets)
+		})
+	}
+}
+
+func TestCheckTemplates(t *testing.T) {
+	secrets := map[string]Secret{
+		"symmetric_key": {Type: "symmetric-key", Size: 128, Shared: true},
+		"cert":          {Type: "cert-ecdsa", Size: 256},
+		"plain":         {Type: "plain", UserDefined: true},
+		"ssh_ca":        {Type: "ssh-ed25519", Shared: true},
+		"ssh_host":      {Type: "ssh-ecdsa", Size: 256, SSHCertificate: &SSHCertificate{Issuer: "ssh_ca", Principals: []string{"localhost"}}},
+		"x25519":        {Type: "key-x25519", Shared: true},
+	}
+
+	testCases := map[string]struct {
+		env     map[string]string
+		argv    []string
+		wantErr string
+	}{
+		"valid": {
+			env: map[string]string{
+				"KEY":      "{{ hex .Secrets.symmetric_key }}",
+				"CERT":     "{{ pem .Secrets.cert.Cert }}",
+				"PRIV":     "{{ pem .Secrets.cert.Private }}",
+				"PLAIN":    "{{ raw .Secrets.plain }}",
+				"PREVIOUS": "{{ base64 .Secrets.symmetric_key.Previous }}",
+				"SEAL_KEY": "{{ hex .Marblerun.SealKey }}",
+				"ROOT_CA":  "{{ pem .Marblerun.RootCA.Cert }}",
+				"UUID":     "{{ .Marble.UUID }}",
+				"TIME":     "{{ .Marble.ActivationTime.Unix }}",
+				"JWK":      "{{ jwk .Secrets.cert }}",
+				"SEC1":     "{{ sec1 .Secrets.cert }}",
+				"CHAIN":    "{{ chain .Secrets.cert .Marblerun.RootCA }}",
+				"PKCS12":   "{{ pkcs12 .Secrets.cert .Secrets.plain .Marblerun.RootCA | base64 }}",
+				"JKS":      "{{ jks .Secrets.cert .Secrets.symmetric_key | base64 }}",
+				"SSH_KEY":  "{{ openssh .Secrets.ssh_host }}",
+				"SSH_CERT": "{{ sshcert .Secrets.ssh_host }}",
+				"SSH_CA":   "@cert-authority * {{ authorizedkey .Secrets.ssh_ca }}",
+				"AGE":      "{{ age .Secrets.x25519 }}",
+			},
+		},
+		"undefined metadata": {
+			env:     map[string]string{"KEY": "{{ .Marble.Foo }}"},
+			wantErr: "Marbles.backend.Parameters.Env.KEY: undefined marble metadata Marble.Foo",
+		},
+		"syntax error": {
+			env:     map[string]string{"KEY": "{{ hex .Secrets.symmetric_key "},
+			wantErr: "Marbles.backend.Parameters.Env.KEY: template: data:1: unclosed action",
+		},
+		"unknown function": {
+			env:     map[string]string{"KEY": "{{ foo .Secrets.symmetric_key }}"},
+			wantErr: `Marbles.backend.Parameters.Env.KEY: template: data:1: function "foo" not defined`,
+		},
+		"undefined secret": {
+			env:     map[string]string{"KEY": "{{ hex .Secrets.foo }}"},
+			wantErr: "Marbles.backend.Parameters.Env.KEY: undefined secret foo",
+		},
+		"undefined secret in branch": {
+			env:     map[string]string{"KEY": "{{ if false }}{{ hex .Secrets.foo }}{{ end }}"},
+			wantErr: "Marbles.backend.Parameters.Env.KEY: undefined secret foo",
+		},
+		"undefined reserved secret": {
+			env:     map[string]string{"KEY": "{{ hex .Marblerun.Foo }}"},
+			wantErr: "Marbles.backend.Parameters.Env.KEY: undefined reserved secret Marblerun.Foo",
+		},
+		"wrong encoding": {
+			env:     map[string]string{"KEY": "{{ pem .Secrets.symmetric_key }}"},
+			wantErr: "Marbles.backend.Parameters.Env.KEY: template: data:1:3: executing \"data\" at <pem .Secrets.symmetric_key>: error calling pem: invalid secret type",
+		},
+		"key encoding does not fit the key type": {
+			env:     map[string]string{"KEY": "{{ pkcs1 .Secrets.cert }}"},
+			wantErr: "Marbles.backend.Parameters.Env.KEY: template: data:1:3: executing \"data\" at <pkcs1 .Secrets.cert>: error calling pkcs1: PKCS #1 encoding requires an RSA key",
+		},
+		"symmetric key has no certificate": {
+			env:     map[string]string{"KEY": "{{ pem .Secrets.symmetric_key.Cert }}"},
+			wantErr: "Marbles.backend.Parameters.Env.KEY: template: data:1:3: executing \"data\" at <pem .Secrets.symmetric_key.Cert>: error calling pem: tried to parse secret with empty value",
+		},
+		"argv": {
+			argv:    []string{"serve", "--node-id={{ .Marble.UUID }}", "--key={{ hex .Secrets.foo }}"},
+			wantErr: "Marbles.backend.Parameters.Argv[2]: undefined secret foo",
+		},
+		"all problems are reported": {
+			env: map[string]string{
+				"A": "{{ hex .Secrets.foo }}",
+				"B": "{{ hex .Secrets.bar }}",
+			},
+			wantErr: "manifest contains invalid templates: Marbles.backend.Parameters.Env.A: undefined secret foo; Marbles.backend.Parameters.Env.B: undefined secret bar",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			m := Manifest{
+				Marbles: map[string]Marble{
+					"backend": {Parameters: &rpc.Parameters{Env: tc.env, Argv: tc.argv}},
+				},
+				Secrets: secrets,
+			}
+			err := m.checkTemplates()
+			if tc.wantErr == "" {
+				assert.NoError(err)
+				return
+			}
+			assert.Error(err)
+			assert.Contains(err.Error(), tc.wantErr)
+		})
+	}
+}
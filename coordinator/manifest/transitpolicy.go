@@ -0,0 +1,83 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Cryptographic operations marbles can perform with transit keys
+const (
+	TransitOperationEncrypt = "encrypt"
+	TransitOperationDecrypt = "decrypt"
+	TransitOperationSign    = "sign"
+	TransitOperationVerify  = "verify"
+	TransitOperationDerive  = "derive"
+)
+
+// TransitKeyPolicy defines the cryptographic operations activated marbles may perform with a secret via the Coordinator
+type TransitKeyPolicy struct {
+	// Operations are the allowed operations: "encrypt", "decrypt", "sign", "verify" or "derive"
+	Operations []string
+	// RequestsPerMinute limits the operations each marble may perform with the secret. It must be positive, since every use is recorded in the update log.
+	RequestsPerMinute uint
+}
+
+// transitOperations are the operations supported by each secret type
+var transitOperations = map[string][]string{
+	"symmetric-key": {TransitOperationEncrypt, TransitOperationDecrypt, TransitOperationSign, TransitOperationVerify, TransitOperationDerive},
+	"jwt-hmac":      {TransitOperationSign, TransitOperationVerify, TransitOperationDerive},
+	"key-rsa":       {TransitOperationEncrypt, TransitOperationDecrypt, TransitOperationSign, TransitOperationVerify},
+	"cert-rsa":      {TransitOperationEncrypt, TransitOperationDecrypt, TransitOperationSign, TransitOperationVerify},
+	"key-ecdsa":     {TransitOperationSign, TransitOperationVerify},
+	"cert-ecdsa":    {TransitOperationSign, TransitOperationVerify},
+	"key-ed25519":   {TransitOperationSign, TransitOperationVerify},
+	"cert-ed25519":  {TransitOperationSign, TransitOperationVerify},
+}
+
+// Permits returns true if the policy allows the operation
+func (p TransitKeyPolicy) Permits(operation string) bool {
+	for _, op := range p.Operations {
+		if strings.EqualFold(op, operation) {
+			return true
+		}
+	}
+	return false
+}
+
+// check verifies that the secret is stored by the Coordinator and supports the operations of the policy
+func (p TransitKeyPolicy) check(secretName string, secret Secret) error {
+	if !secret.Shared && !secret.UserDefined && !secret.PerMarbleType {
+		return fmt.Errorf("transit key %s must be shared, user-defined or defined per marble type", secretName)
+	}
+	supported, ok := transitOperations[secret.Type]
+	if !ok {
+		return fmt.Errorf("transit key %s: secrets of type %s are not supported", secretName, secret.Type)
+	}
+	if len(p.Operations) == 0 {
+		return fmt.Errorf("transit key %s does not allow any operation", secretName)
+	}
+	if p.RequestsPerMinute == 0 {
+		return fmt.Errorf("transit key %s must limit the requests per minute", secretName)
+	}
+	for _, op := range p.Operations {
+		if !containsFold(supported, op) {
+			return fmt.Errorf("transit key %s: operation %s is not supported for secrets of type %s", secretName, op, secret.Type)
+		}
+	}
+	return nil
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
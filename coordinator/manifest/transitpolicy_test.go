@@ -0,0 +1,58 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"testing"
+
+	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransitKeyPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := TransitKeyPolicy{Operations: []string{"Encrypt", "decrypt"}, RequestsPerMinute: 10}
+	assert.True(policy.Permits(TransitOperationEncrypt))
+	assert.True(policy.Permits(TransitOperationDecrypt))
+	assert.False(policy.Permits(TransitOperationSign))
+
+	assert.NoError(policy.check("key", Secret{Type: "symmetric-key", Size: 256, Shared: true}))
+	assert.NoError(policy.check("key", Secret{Type: "key-rsa", Size: 2048, PerMarbleType: true}))
+	// the key must be stored by the Coordinator
+	assert.Error(policy.check("key", Secret{Type: "symmetric-key", Size: 256}))
+	// the operations must be supported by the key type
+	assert.Error(policy.check("key", Secret{Type: "key-ecdsa", Size: 256, Shared: true}))
+	assert.Error(policy.check("key", Secret{Type: "plain", UserDefined: true}))
+	assert.Error(TransitKeyPolicy{}.check("key", Secret{Type: "symmetric-key", Size: 256, Shared: true}))
+
+	// the requests must be limited
+	assert.Error(TransitKeyPolicy{Operations: []string{"encrypt"}}.check("key", Secret{Type: "symmetric-key", Size: 256, Shared: true}))
+
+	signPolicy := TransitKeyPolicy{Operations: []string{"sign", "verify"}, RequestsPerMinute: 10}
+	assert.NoError(signPolicy.check("key", Secret{Type: "key-ecdsa", Size: 256, Shared: true}))
+	assert.NoError(signPolicy.check("key", Secret{Type: "cert-ed25519", Shared: true}))
+	assert.Error(TransitKeyPolicy{Operations: []string{"unknown"}, RequestsPerMinute: 10}.check("key", Secret{Type: "symmetric-key", Size: 256, Shared: true}))
+}
+
+func TestCheckTransitOnlySecrets(t *testing.T) {
+	assert := assert.New(t)
+
+	mnf := Manifest{
+		Secrets: map[string]Secret{
+			"transit": {Type: "symmetric-key", Size: 256, Shared: true, TransitOnly: true},
+			"other":   {Type: "symmetric-key", Size: 256, Shared: true},
+		},
+		TLS: map[string]TLStag{"web": {Incoming: []TLSTagEntry{{Port: "8080", Cert: "transit"}}}},
+	}
+
+	assert.NoError(mnf.checkTransitOnlySecrets("marble", Marble{Secrets: []string{"other"}}))
+	assert.NoError(mnf.checkTransitOnlySecrets("marble", Marble{Parameters: &rpc.Parameters{Env: map[string]string{"ALL": "{{ .Secrets }}"}}}))
+	assert.Error(mnf.checkTransitOnlySecrets("marble", Marble{Secrets: []string{"transit"}}))
+	assert.Error(mnf.checkTransitOnlySecrets("marble", Marble{Parameters: &rpc.Parameters{Env: map[string]string{"KEY": "{{ raw .Secrets.transit }}"}}}))
+	assert.Error(mnf.checkTransitOnlySecrets("marble", Marble{TLS: []string{"web"}}))
+}
@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.23.0
+// 	protoc-gen-go v1.25.0
 // 	protoc        v3.13.0
 // source: coordinator.proto
 
@@ -211,6 +211,854 @@ func (x *Parameters) GetArgv() []string {
 	return nil
 }
 
+type IssueCertificateReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// CSR is the DER encoded certificate signing request.
+	CSR []byte `protobuf:"bytes,1,opt,name=CSR,proto3" json:"CSR,omitempty"`
+	// KeyUsages and ExtKeyUsages default to all usages allowed by the marble's certificate policy.
+	KeyUsages    []string `protobuf:"bytes,2,rep,name=KeyUsages,proto3" json:"KeyUsages,omitempty"`
+	ExtKeyUsages []string `protobuf:"bytes,3,rep,name=ExtKeyUsages,proto3" json:"ExtKeyUsages,omitempty"`
+	// ValidForHours defaults to the maximum lifetime allowed by the marble's certificate policy.
+	ValidForHours uint32 `protobuf:"varint,4,opt,name=ValidForHours,proto3" json:"ValidForHours,omitempty"`
+}
+
+func (x *IssueCertificateReq) Reset() {
+	*x = IssueCertificateReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IssueCertificateReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IssueCertificateReq) ProtoMessage() {}
+
+func (x *IssueCertificateReq) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IssueCertificateReq.ProtoReflect.Descriptor instead.
+func (*IssueCertificateReq) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *IssueCertificateReq) GetCSR() []byte {
+	if x != nil {
+		return x.CSR
+	}
+	return nil
+}
+
+func (x *IssueCertificateReq) GetKeyUsages() []string {
+	if x != nil {
+		return x.KeyUsages
+	}
+	return nil
+}
+
+func (x *IssueCertificateReq) GetExtKeyUsages() []string {
+	if x != nil {
+		return x.ExtKeyUsages
+	}
+	return nil
+}
+
+func (x *IssueCertificateReq) GetValidForHours() uint32 {
+	if x != nil {
+		return x.ValidForHours
+	}
+	return 0
+}
+
+type IssueCertificateResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Certificate is the DER encoded certificate.
+	Certificate []byte `protobuf:"bytes,1,opt,name=Certificate,proto3" json:"Certificate,omitempty"`
+}
+
+func (x *IssueCertificateResp) Reset() {
+	*x = IssueCertificateResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IssueCertificateResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IssueCertificateResp) ProtoMessage() {}
+
+func (x *IssueCertificateResp) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IssueCertificateResp.ProtoReflect.Descriptor instead.
+func (*IssueCertificateResp) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *IssueCertificateResp) GetCertificate() []byte {
+	if x != nil {
+		return x.Certificate
+	}
+	return nil
+}
+
+type JWTSVIDReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Audience []string `protobuf:"bytes,1,rep,name=Audience,proto3" json:"Audience,omitempty"`
+}
+
+func (x *JWTSVIDReq) Reset() {
+	*x = JWTSVIDReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *JWTSVIDReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JWTSVIDReq) ProtoMessage() {}
+
+func (x *JWTSVIDReq) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JWTSVIDReq.ProtoReflect.Descriptor instead.
+func (*JWTSVIDReq) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *JWTSVIDReq) GetAudience() []string {
+	if x != nil {
+		return x.Audience
+	}
+	return nil
+}
+
+type JWTSVIDResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	SVID string `protobuf:"bytes,1,opt,name=SVID,proto3" json:"SVID,omitempty"`
+}
+
+func (x *JWTSVIDResp) Reset() {
+	*x = JWTSVIDResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *JWTSVIDResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JWTSVIDResp) ProtoMessage() {}
+
+func (x *JWTSVIDResp) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JWTSVIDResp.ProtoReflect.Descriptor instead.
+func (*JWTSVIDResp) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *JWTSVIDResp) GetSVID() string {
+	if x != nil {
+		return x.SVID
+	}
+	return ""
+}
+
+type JWTBundleReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *JWTBundleReq) Reset() {
+	*x = JWTBundleReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *JWTBundleReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JWTBundleReq) ProtoMessage() {}
+
+func (x *JWTBundleReq) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JWTBundleReq.ProtoReflect.Descriptor instead.
+func (*JWTBundleReq) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{7}
+}
+
+type JWTBundleResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Bundle is the SPIFFE bundle with the keys JWT-SVIDs are signed with.
+	Bundle []byte `protobuf:"bytes,1,opt,name=Bundle,proto3" json:"Bundle,omitempty"`
+}
+
+func (x *JWTBundleResp) Reset() {
+	*x = JWTBundleResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *JWTBundleResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JWTBundleResp) ProtoMessage() {}
+
+func (x *JWTBundleResp) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JWTBundleResp.ProtoReflect.Descriptor instead.
+func (*JWTBundleResp) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *JWTBundleResp) GetBundle() []byte {
+	if x != nil {
+		return x.Bundle
+	}
+	return nil
+}
+
+type EncryptReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Secret is the name of the transit key in the manifest.
+	Secret    string `protobuf:"bytes,1,opt,name=Secret,proto3" json:"Secret,omitempty"`
+	Plaintext []byte `protobuf:"bytes,2,opt,name=Plaintext,proto3" json:"Plaintext,omitempty"`
+	// AdditionalData is authenticated, but not encrypted. It is only supported by symmetric keys.
+	AdditionalData []byte `protobuf:"bytes,3,opt,name=AdditionalData,proto3" json:"AdditionalData,omitempty"`
+}
+
+func (x *EncryptReq) Reset() {
+	*x = EncryptReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EncryptReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EncryptReq) ProtoMessage() {}
+
+func (x *EncryptReq) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EncryptReq.ProtoReflect.Descriptor instead.
+func (*EncryptReq) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *EncryptReq) GetSecret() string {
+	if x != nil {
+		return x.Secret
+	}
+	return ""
+}
+
+func (x *EncryptReq) GetPlaintext() []byte {
+	if x != nil {
+		return x.Plaintext
+	}
+	return nil
+}
+
+func (x *EncryptReq) GetAdditionalData() []byte {
+	if x != nil {
+		return x.AdditionalData
+	}
+	return nil
+}
+
+type EncryptResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Ciphertext []byte `protobuf:"bytes,1,opt,name=Ciphertext,proto3" json:"Ciphertext,omitempty"`
+}
+
+func (x *EncryptResp) Reset() {
+	*x = EncryptResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EncryptResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EncryptResp) ProtoMessage() {}
+
+func (x *EncryptResp) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EncryptResp.ProtoReflect.Descriptor instead.
+func (*EncryptResp) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *EncryptResp) GetCiphertext() []byte {
+	if x != nil {
+		return x.Ciphertext
+	}
+	return nil
+}
+
+type DecryptReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Secret         string `protobuf:"bytes,1,opt,name=Secret,proto3" json:"Secret,omitempty"`
+	Ciphertext     []byte `protobuf:"bytes,2,opt,name=Ciphertext,proto3" json:"Ciphertext,omitempty"`
+	AdditionalData []byte `protobuf:"bytes,3,opt,name=AdditionalData,proto3" json:"AdditionalData,omitempty"`
+}
+
+func (x *DecryptReq) Reset() {
+	*x = DecryptReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DecryptReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DecryptReq) ProtoMessage() {}
+
+func (x *DecryptReq) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DecryptReq.ProtoReflect.Descriptor instead.
+func (*DecryptReq) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *DecryptReq) GetSecret() string {
+	if x != nil {
+		return x.Secret
+	}
+	return ""
+}
+
+func (x *DecryptReq) GetCiphertext() []byte {
+	if x != nil {
+		return x.Ciphertext
+	}
+	return nil
+}
+
+func (x *DecryptReq) GetAdditionalData() []byte {
+	if x != nil {
+		return x.AdditionalData
+	}
+	return nil
+}
+
+type DecryptResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Plaintext []byte `protobuf:"bytes,1,opt,name=Plaintext,proto3" json:"Plaintext,omitempty"`
+}
+
+func (x *DecryptResp) Reset() {
+	*x = DecryptResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DecryptResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DecryptResp) ProtoMessage() {}
+
+func (x *DecryptResp) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DecryptResp.ProtoReflect.Descriptor instead.
+func (*DecryptResp) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *DecryptResp) GetPlaintext() []byte {
+	if x != nil {
+		return x.Plaintext
+	}
+	return nil
+}
+
+type SignReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Secret string `protobuf:"bytes,1,opt,name=Secret,proto3" json:"Secret,omitempty"`
+	Data   []byte `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`
+}
+
+func (x *SignReq) Reset() {
+	*x = SignReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SignReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SignReq) ProtoMessage() {}
+
+func (x *SignReq) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SignReq.ProtoReflect.Descriptor instead.
+func (*SignReq) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *SignReq) GetSecret() string {
+	if x != nil {
+		return x.Secret
+	}
+	return ""
+}
+
+func (x *SignReq) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type SignResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Signature []byte `protobuf:"bytes,1,opt,name=Signature,proto3" json:"Signature,omitempty"`
+}
+
+func (x *SignResp) Reset() {
+	*x = SignResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SignResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SignResp) ProtoMessage() {}
+
+func (x *SignResp) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SignResp.ProtoReflect.Descriptor instead.
+func (*SignResp) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *SignResp) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+type VerifyReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Secret    string `protobuf:"bytes,1,opt,name=Secret,proto3" json:"Secret,omitempty"`
+	Data      []byte `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`
+	Signature []byte `protobuf:"bytes,3,opt,name=Signature,proto3" json:"Signature,omitempty"`
+}
+
+func (x *VerifyReq) Reset() {
+	*x = VerifyReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *VerifyReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyReq) ProtoMessage() {}
+
+func (x *VerifyReq) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyReq.ProtoReflect.Descriptor instead.
+func (*VerifyReq) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *VerifyReq) GetSecret() string {
+	if x != nil {
+		return x.Secret
+	}
+	return ""
+}
+
+func (x *VerifyReq) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *VerifyReq) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+type VerifyResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Valid bool `protobuf:"varint,1,opt,name=Valid,proto3" json:"Valid,omitempty"`
+}
+
+func (x *VerifyResp) Reset() {
+	*x = VerifyResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *VerifyResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyResp) ProtoMessage() {}
+
+func (x *VerifyResp) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyResp.ProtoReflect.Descriptor instead.
+func (*VerifyResp) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *VerifyResp) GetValid() bool {
+	if x != nil {
+		return x.Valid
+	}
+	return false
+}
+
+type DeriveKeyReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Secret string `protobuf:"bytes,1,opt,name=Secret,proto3" json:"Secret,omitempty"`
+	// Context binds the derived key to its purpose. Different contexts yield independent keys.
+	Context []byte `protobuf:"bytes,2,opt,name=Context,proto3" json:"Context,omitempty"`
+	// Size of the derived key in bits.
+	Size uint32 `protobuf:"varint,3,opt,name=Size,proto3" json:"Size,omitempty"`
+}
+
+func (x *DeriveKeyReq) Reset() {
+	*x = DeriveKeyReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[17]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeriveKeyReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeriveKeyReq) ProtoMessage() {}
+
+func (x *DeriveKeyReq) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[17]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeriveKeyReq.ProtoReflect.Descriptor instead.
+func (*DeriveKeyReq) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *DeriveKeyReq) GetSecret() string {
+	if x != nil {
+		return x.Secret
+	}
+	return ""
+}
+
+func (x *DeriveKeyReq) GetContext() []byte {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
+func (x *DeriveKeyReq) GetSize() uint32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type DeriveKeyResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Key []byte `protobuf:"bytes,1,opt,name=Key,proto3" json:"Key,omitempty"`
+}
+
+func (x *DeriveKeyResp) Reset() {
+	*x = DeriveKeyResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_coordinator_proto_msgTypes[18]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeriveKeyResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeriveKeyResp) ProtoMessage() {}
+
+func (x *DeriveKeyResp) ProtoReflect() protoreflect.Message {
+	mi := &file_coordinator_proto_msgTypes[18]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeriveKeyResp.ProtoReflect.Descriptor instead.
+func (*DeriveKeyResp) Descriptor() ([]byte, []int) {
+	return file_coordinator_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *DeriveKeyResp) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
 var File_coordinator_proto protoreflect.FileDescriptor
 
 var file_coordinator_proto_rawDesc = []byte{
@@ -241,14 +1089,101 @@ var file_coordinator_proto_rawDesc = []byte{
 	0x02, 0x38, 0x01, 0x1a, 0x36, 0x0a, 0x08, 0x45, 0x6e, 0x76, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12,
 	0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65,
 	0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x32, 0x3d, 0x0a, 0x06, 0x4d,
-	0x61, 0x72, 0x62, 0x6c, 0x65, 0x12, 0x33, 0x0a, 0x08, 0x41, 0x63, 0x74, 0x69, 0x76, 0x61, 0x74,
-	0x65, 0x12, 0x12, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x63, 0x74, 0x69, 0x76, 0x61, 0x74, 0x69,
-	0x6f, 0x6e, 0x52, 0x65, 0x71, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x63, 0x74, 0x69,
-	0x76, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x42, 0x26, 0x5a, 0x24, 0x67, 0x69,
-	0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x65, 0x64, 0x67, 0x65, 0x6c, 0x65, 0x73,
-	0x73, 0x73, 0x79, 0x73, 0x2f, 0x6d, 0x61, 0x72, 0x62, 0x6c, 0x65, 0x72, 0x75, 0x6e, 0x2f, 0x72,
-	0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x8f, 0x01, 0x0a, 0x13,
+	0x49, 0x73, 0x73, 0x75, 0x65, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65,
+	0x52, 0x65, 0x71, 0x12, 0x10, 0x0a, 0x03, 0x43, 0x53, 0x52, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x03, 0x43, 0x53, 0x52, 0x12, 0x1c, 0x0a, 0x09, 0x4b, 0x65, 0x79, 0x55, 0x73, 0x61, 0x67,
+	0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x4b, 0x65, 0x79, 0x55, 0x73, 0x61,
+	0x67, 0x65, 0x73, 0x12, 0x22, 0x0a, 0x0c, 0x45, 0x78, 0x74, 0x4b, 0x65, 0x79, 0x55, 0x73, 0x61,
+	0x67, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0c, 0x45, 0x78, 0x74, 0x4b, 0x65,
+	0x79, 0x55, 0x73, 0x61, 0x67, 0x65, 0x73, 0x12, 0x24, 0x0a, 0x0d, 0x56, 0x61, 0x6c, 0x69, 0x64,
+	0x46, 0x6f, 0x72, 0x48, 0x6f, 0x75, 0x72, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0d,
+	0x56, 0x61, 0x6c, 0x69, 0x64, 0x46, 0x6f, 0x72, 0x48, 0x6f, 0x75, 0x72, 0x73, 0x22, 0x38, 0x0a,
+	0x14, 0x49, 0x73, 0x73, 0x75, 0x65, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74,
+	0x65, 0x52, 0x65, 0x73, 0x70, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69,
+	0x63, 0x61, 0x74, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0b, 0x43, 0x65, 0x72, 0x74,
+	0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x22, 0x28, 0x0a, 0x0a, 0x4a, 0x57, 0x54, 0x53, 0x56,
+	0x49, 0x44, 0x52, 0x65, 0x71, 0x12, 0x1a, 0x0a, 0x08, 0x41, 0x75, 0x64, 0x69, 0x65, 0x6e, 0x63,
+	0x65, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08, 0x41, 0x75, 0x64, 0x69, 0x65, 0x6e, 0x63,
+	0x65, 0x22, 0x21, 0x0a, 0x0b, 0x4a, 0x57, 0x54, 0x53, 0x56, 0x49, 0x44, 0x52, 0x65, 0x73, 0x70,
+	0x12, 0x12, 0x0a, 0x04, 0x53, 0x56, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x53, 0x56, 0x49, 0x44, 0x22, 0x0e, 0x0a, 0x0c, 0x4a, 0x57, 0x54, 0x42, 0x75, 0x6e, 0x64, 0x6c,
+	0x65, 0x52, 0x65, 0x71, 0x22, 0x27, 0x0a, 0x0d, 0x4a, 0x57, 0x54, 0x42, 0x75, 0x6e, 0x64, 0x6c,
+	0x65, 0x52, 0x65, 0x73, 0x70, 0x12, 0x16, 0x0a, 0x06, 0x42, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x42, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x22, 0x6a, 0x0a,
+	0x0a, 0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x52, 0x65, 0x71, 0x12, 0x16, 0x0a, 0x06, 0x53,
+	0x65, 0x63, 0x72, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x53, 0x65, 0x63,
+	0x72, 0x65, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x50, 0x6c, 0x61, 0x69, 0x6e, 0x74, 0x65, 0x78, 0x74,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x50, 0x6c, 0x61, 0x69, 0x6e, 0x74, 0x65, 0x78,
+	0x74, 0x12, 0x26, 0x0a, 0x0e, 0x41, 0x64, 0x64, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x61, 0x6c, 0x44,
+	0x61, 0x74, 0x61, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0e, 0x41, 0x64, 0x64, 0x69, 0x74,
+	0x69, 0x6f, 0x6e, 0x61, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x22, 0x2d, 0x0a, 0x0b, 0x45, 0x6e, 0x63,
+	0x72, 0x79, 0x70, 0x74, 0x52, 0x65, 0x73, 0x70, 0x12, 0x1e, 0x0a, 0x0a, 0x43, 0x69, 0x70, 0x68,
+	0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x43, 0x69,
+	0x70, 0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x22, 0x6c, 0x0a, 0x0a, 0x44, 0x65, 0x63, 0x72,
+	0x79, 0x70, 0x74, 0x52, 0x65, 0x71, 0x12, 0x16, 0x0a, 0x06, 0x53, 0x65, 0x63, 0x72, 0x65, 0x74,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x53, 0x65, 0x63, 0x72, 0x65, 0x74, 0x12, 0x1e,
+	0x0a, 0x0a, 0x43, 0x69, 0x70, 0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0c, 0x52, 0x0a, 0x43, 0x69, 0x70, 0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x12, 0x26,
+	0x0a, 0x0e, 0x41, 0x64, 0x64, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x61, 0x6c, 0x44, 0x61, 0x74, 0x61,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0e, 0x41, 0x64, 0x64, 0x69, 0x74, 0x69, 0x6f, 0x6e,
+	0x61, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x22, 0x2b, 0x0a, 0x0b, 0x44, 0x65, 0x63, 0x72, 0x79, 0x70,
+	0x74, 0x52, 0x65, 0x73, 0x70, 0x12, 0x1c, 0x0a, 0x09, 0x50, 0x6c, 0x61, 0x69, 0x6e, 0x74, 0x65,
+	0x78, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x50, 0x6c, 0x61, 0x69, 0x6e, 0x74,
+	0x65, 0x78, 0x74, 0x22, 0x35, 0x0a, 0x07, 0x53, 0x69, 0x67, 0x6e, 0x52, 0x65, 0x71, 0x12, 0x16,
+	0x0a, 0x06, 0x53, 0x65, 0x63, 0x72, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x53, 0x65, 0x63, 0x72, 0x65, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x44, 0x61, 0x74, 0x61, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x44, 0x61, 0x74, 0x61, 0x22, 0x28, 0x0a, 0x08, 0x53, 0x69,
+	0x67, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x12, 0x1c, 0x0a, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74,
+	0x75, 0x72, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61,
+	0x74, 0x75, 0x72, 0x65, 0x22, 0x55, 0x0a, 0x09, 0x56, 0x65, 0x72, 0x69, 0x66, 0x79, 0x52, 0x65,
+	0x71, 0x12, 0x16, 0x0a, 0x06, 0x53, 0x65, 0x63, 0x72, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x53, 0x65, 0x63, 0x72, 0x65, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x44, 0x61, 0x74,
+	0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x44, 0x61, 0x74, 0x61, 0x12, 0x1c, 0x0a,
+	0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x22, 0x22, 0x0a, 0x0a, 0x56,
+	0x65, 0x72, 0x69, 0x66, 0x79, 0x52, 0x65, 0x73, 0x70, 0x12, 0x14, 0x0a, 0x05, 0x56, 0x61, 0x6c,
+	0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x56, 0x61, 0x6c, 0x69, 0x64, 0x22,
+	0x54, 0x0a, 0x0c, 0x44, 0x65, 0x72, 0x69, 0x76, 0x65, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x71, 0x12,
+	0x16, 0x0a, 0x06, 0x53, 0x65, 0x63, 0x72, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x53, 0x65, 0x63, 0x72, 0x65, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x43, 0x6f, 0x6e, 0x74, 0x65,
+	0x78, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x78,
+	0x74, 0x12, 0x12, 0x0a, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x04, 0x53, 0x69, 0x7a, 0x65, 0x22, 0x21, 0x0a, 0x0d, 0x44, 0x65, 0x72, 0x69, 0x76, 0x65, 0x4b,
+	0x65, 0x79, 0x52, 0x65, 0x73, 0x70, 0x12, 0x10, 0x0a, 0x03, 0x4b, 0x65, 0x79, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x03, 0x4b, 0x65, 0x79, 0x32, 0xce, 0x03, 0x0a, 0x06, 0x4d, 0x61, 0x72,
+	0x62, 0x6c, 0x65, 0x12, 0x33, 0x0a, 0x08, 0x41, 0x63, 0x74, 0x69, 0x76, 0x61, 0x74, 0x65, 0x12,
+	0x12, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x63, 0x74, 0x69, 0x76, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x52, 0x65, 0x71, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x63, 0x74, 0x69, 0x76, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x12, 0x47, 0x0a, 0x10, 0x49, 0x73, 0x73, 0x75,
+	0x65, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x12, 0x18, 0x2e, 0x72,
+	0x70, 0x63, 0x2e, 0x49, 0x73, 0x73, 0x75, 0x65, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63,
+	0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x1a, 0x19, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x49, 0x73, 0x73,
+	0x75, 0x65, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73,
+	0x70, 0x12, 0x2f, 0x0a, 0x0a, 0x47, 0x65, 0x74, 0x4a, 0x57, 0x54, 0x53, 0x56, 0x49, 0x44, 0x12,
+	0x0f, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x4a, 0x57, 0x54, 0x53, 0x56, 0x49, 0x44, 0x52, 0x65, 0x71,
+	0x1a, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x4a, 0x57, 0x54, 0x53, 0x56, 0x49, 0x44, 0x52, 0x65,
+	0x73, 0x70, 0x12, 0x35, 0x0a, 0x0c, 0x47, 0x65, 0x74, 0x4a, 0x57, 0x54, 0x42, 0x75, 0x6e, 0x64,
+	0x6c, 0x65, 0x12, 0x11, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x4a, 0x57, 0x54, 0x42, 0x75, 0x6e, 0x64,
+	0x6c, 0x65, 0x52, 0x65, 0x71, 0x1a, 0x12, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x4a, 0x57, 0x54, 0x42,
+	0x75, 0x6e, 0x64, 0x6c, 0x65, 0x52, 0x65, 0x73, 0x70, 0x12, 0x2c, 0x0a, 0x07, 0x45, 0x6e, 0x63,
+	0x72, 0x79, 0x70, 0x74, 0x12, 0x0f, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6e, 0x63, 0x72, 0x79,
+	0x70, 0x74, 0x52, 0x65, 0x71, 0x1a, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6e, 0x63, 0x72,
+	0x79, 0x70, 0x74, 0x52, 0x65, 0x73, 0x70, 0x12, 0x2c, 0x0a, 0x07, 0x44, 0x65, 0x63, 0x72, 0x79,
+	0x70, 0x74, 0x12, 0x0f, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x65, 0x63, 0x72, 0x79, 0x70, 0x74,
+	0x52, 0x65, 0x71, 0x1a, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x65, 0x63, 0x72, 0x79, 0x70,
+	0x74, 0x52, 0x65, 0x73, 0x70, 0x12, 0x23, 0x0a, 0x04, 0x53, 0x69, 0x67, 0x6e, 0x12, 0x0c, 0x2e,
+	0x72, 0x70, 0x63, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x52, 0x65, 0x71, 0x1a, 0x0d, 0x2e, 0x72, 0x70,
+	0x63, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x12, 0x29, 0x0a, 0x06, 0x56, 0x65,
+	0x72, 0x69, 0x66, 0x79, 0x12, 0x0e, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x56, 0x65, 0x72, 0x69, 0x66,
+	0x79, 0x52, 0x65, 0x71, 0x1a, 0x0f, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x56, 0x65, 0x72, 0x69, 0x66,
+	0x79, 0x52, 0x65, 0x73, 0x70, 0x12, 0x32, 0x0a, 0x09, 0x44, 0x65, 0x72, 0x69, 0x76, 0x65, 0x4b,
+	0x65, 0x79, 0x12, 0x11, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x65, 0x72, 0x69, 0x76, 0x65, 0x4b,
+	0x65, 0x79, 0x52, 0x65, 0x71, 0x1a, 0x12, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x65, 0x72, 0x69,
+	0x76, 0x65, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x73, 0x70, 0x42, 0x26, 0x5a, 0x24, 0x67, 0x69, 0x74,
+	0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x65, 0x64, 0x67, 0x65, 0x6c, 0x65, 0x73, 0x73,
+	0x73, 0x79, 0x73, 0x2f, 0x6d, 0x61, 0x72, 0x62, 0x6c, 0x65, 0x72, 0x75, 0x6e, 0x2f, 0x72, 0x70,
+	0x63, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -263,25 +1198,57 @@ func file_coordinator_proto_rawDescGZIP() []byte {
 	return file_coordinator_proto_rawDescData
 }
 
-var file_coordinator_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_coordinator_proto_msgTypes = make([]protoimpl.MessageInfo, 21)
 var file_coordinator_proto_goTypes = []interface{}{
-	(*ActivationReq)(nil),  // 0: rpc.ActivationReq
-	(*ActivationResp)(nil), // 1: rpc.ActivationResp
-	(*Parameters)(nil),     // 2: rpc.Parameters
-	nil,                    // 3: rpc.Parameters.FilesEntry
-	nil,                    // 4: rpc.Parameters.EnvEntry
+	(*ActivationReq)(nil),        // 0: rpc.ActivationReq
+	(*ActivationResp)(nil),       // 1: rpc.ActivationResp
+	(*Parameters)(nil),           // 2: rpc.Parameters
+	(*IssueCertificateReq)(nil),  // 3: rpc.IssueCertificateReq
+	(*IssueCertificateResp)(nil), // 4: rpc.IssueCertificateResp
+	(*JWTSVIDReq)(nil),           // 5: rpc.JWTSVIDReq
+	(*JWTSVIDResp)(nil),          // 6: rpc.JWTSVIDResp
+	(*JWTBundleReq)(nil),         // 7: rpc.JWTBundleReq
+	(*JWTBundleResp)(nil),        // 8: rpc.JWTBundleResp
+	(*EncryptReq)(nil),           // 9: rpc.EncryptReq
+	(*EncryptResp)(nil),          // 10: rpc.EncryptResp
+	(*DecryptReq)(nil),           // 11: rpc.DecryptReq
+	(*DecryptResp)(nil),          // 12: rpc.DecryptResp
+	(*SignReq)(nil),              // 13: rpc.SignReq
+	(*SignResp)(nil),             // 14: rpc.SignResp
+	(*VerifyReq)(nil),            // 15: rpc.VerifyReq
+	(*VerifyResp)(nil),           // 16: rpc.VerifyResp
+	(*DeriveKeyReq)(nil),         // 17: rpc.DeriveKeyReq
+	(*DeriveKeyResp)(nil),        // 18: rpc.DeriveKeyResp
+	nil,                          // 19: rpc.Parameters.FilesEntry
+	nil,                          // 20: rpc.Parameters.EnvEntry
 }
 var file_coordinator_proto_depIdxs = []int32{
-	2, // 0: rpc.ActivationResp.Parameters:type_name -> rpc.Parameters
-	3, // 1: rpc.Parameters.Files:type_name -> rpc.Parameters.FilesEntry
-	4, // 2: rpc.Parameters.Env:type_name -> rpc.Parameters.EnvEntry
-	0, // 3: rpc.Marble.Activate:input_type -> rpc.ActivationReq
-	1, // 4: rpc.Marble.Activate:output_type -> rpc.ActivationResp
-	4, // [4:5] is the sub-list for method output_type
-	3, // [3:4] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	2,  // 0: rpc.ActivationResp.Parameters:type_name -> rpc.Parameters
+	19, // 1: rpc.Parameters.Files:type_name -> rpc.Parameters.FilesEntry
+	20, // 2: rpc.Parameters.Env:type_name -> rpc.Parameters.EnvEntry
+	0,  // 3: rpc.Marble.Activate:input_type -> rpc.ActivationReq
+	3,  // 4: rpc.Marble.IssueCertificate:input_type -> rpc.IssueCertificateReq
+	5,  // 5: rpc.Marble.GetJWTSVID:input_type -> rpc.JWTSVIDReq
+	7,  // 6: rpc.Marble.GetJWTBundle:input_type -> rpc.JWTBundleReq
+	9,  // 7: rpc.Marble.Encrypt:input_type -> rpc.EncryptReq
+	11, // 8: rpc.Marble.Decrypt:input_type -> rpc.DecryptReq
+	13, // 9: rpc.Marble.Sign:input_type -> rpc.SignReq
+	15, // 10: rpc.Marble.Verify:input_type -> rpc.VerifyReq
+	17, // 11: rpc.Marble.DeriveKey:input_type -> rpc.DeriveKeyReq
+	1,  // 12: rpc.Marble.Activate:output_type -> rpc.ActivationResp
+	4,  // 13: rpc.Marble.IssueCertificate:output_type -> rpc.IssueCertificateResp
+	6,  // 14: rpc.Marble.GetJWTSVID:output_type -> rpc.JWTSVIDResp
+	8,  // 15: rpc.Marble.GetJWTBundle:output_type -> rpc.JWTBundleResp
+	10, // 16: rpc.Marble.Encrypt:output_type -> rpc.EncryptResp
+	12, // 17: rpc.Marble.Decrypt:output_type -> rpc.DecryptResp
+	14, // 18: rpc.Marble.Sign:output_type -> rpc.SignResp
+	16, // 19: rpc.Marble.Verify:output_type -> rpc.VerifyResp
+	18, // 20: rpc.Marble.DeriveKey:output_type -> rpc.DeriveKeyResp
+	12, // [12:21] is the sub-list for method output_type
+	3,  // [3:12] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_coordinator_proto_init() }
@@ -302,8 +1269,116 @@ func file_coordinator_proto_init() {
 				return nil
 			}
 		}
-		file_coordinator_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ActivationResp); i {
+		file_coordinator_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ActivationResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Parameters); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IssueCertificateReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IssueCertificateResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*JWTSVIDReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*JWTSVIDResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*JWTBundleReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*JWTBundleResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EncryptReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EncryptResp); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -314,8 +1389,92 @@ func file_coordinator_proto_init() {
 				return nil
 			}
 		}
-		file_coordinator_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Parameters); i {
+		file_coordinator_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DecryptReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DecryptResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SignReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SignResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*VerifyReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*VerifyResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeriveKeyReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_coordinator_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeriveKeyResp); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -333,7 +1492,7 @@ func file_coordinator_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_coordinator_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   21,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -361,6 +1520,22 @@ const _ = grpc.SupportPackageIsVersion6
 type MarbleClient interface {
 	// Activate activates a marble in the mesh.
 	Activate(ctx context.Context, in *ActivationReq, opts ...grpc.CallOption) (*ActivationResp, error)
+	// IssueCertificate issues a certificate for an activated marble as permitted by its certificate policy.
+	IssueCertificate(ctx context.Context, in *IssueCertificateReq, opts ...grpc.CallOption) (*IssueCertificateResp, error)
+	// GetJWTSVID issues a SPIFFE JWT-SVID for an activated marble.
+	GetJWTSVID(ctx context.Context, in *JWTSVIDReq, opts ...grpc.CallOption) (*JWTSVIDResp, error)
+	// GetJWTBundle returns the keys to validate JWT-SVIDs with.
+	GetJWTBundle(ctx context.Context, in *JWTBundleReq, opts ...grpc.CallOption) (*JWTBundleResp, error)
+	// Encrypt encrypts data with a transit key of the marble.
+	Encrypt(ctx context.Context, in *EncryptReq, opts ...grpc.CallOption) (*EncryptResp, error)
+	// Decrypt decrypts data with a transit key of the marble.
+	Decrypt(ctx context.Context, in *DecryptReq, opts ...grpc.CallOption) (*DecryptResp, error)
+	// Sign signs data with a transit key of the marble.
+	Sign(ctx context.Context, in *SignReq, opts ...grpc.CallOption) (*SignResp, error)
+	// Verify verifies a signature with a transit key of the marble.
+	Verify(ctx context.Context, in *VerifyReq, opts ...grpc.CallOption) (*VerifyResp, error)
+	// DeriveKey derives a key from a transit key of the marble.
+	DeriveKey(ctx context.Context, in *DeriveKeyReq, opts ...grpc.CallOption) (*DeriveKeyResp, error)
 }
 
 type marbleClient struct {
@@ -380,10 +1555,98 @@ func (c *marbleClient) Activate(ctx context.Context, in *ActivationReq, opts ...
 	return out, nil
 }
 
+func (c *marbleClient) IssueCertificate(ctx context.Context, in *IssueCertificateReq, opts ...grpc.CallOption) (*IssueCertificateResp, error) {
+	out := new(IssueCertificateResp)
+	err := c.cc.Invoke(ctx, "/rpc.Marble/IssueCertificate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marbleClient) GetJWTSVID(ctx context.Context, in *JWTSVIDReq, opts ...grpc.CallOption) (*JWTSVIDResp, error) {
+	out := new(JWTSVIDResp)
+	err := c.cc.Invoke(ctx, "/rpc.Marble/GetJWTSVID", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marbleClient) GetJWTBundle(ctx context.Context, in *JWTBundleReq, opts ...grpc.CallOption) (*JWTBundleResp, error) {
+	out := new(JWTBundleResp)
+	err := c.cc.Invoke(ctx, "/rpc.Marble/GetJWTBundle", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marbleClient) Encrypt(ctx context.Context, in *EncryptReq, opts ...grpc.CallOption) (*EncryptResp, error) {
+	out := new(EncryptResp)
+	err := c.cc.Invoke(ctx, "/rpc.Marble/Encrypt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marbleClient) Decrypt(ctx context.Context, in *DecryptReq, opts ...grpc.CallOption) (*DecryptResp, error) {
+	out := new(DecryptResp)
+	err := c.cc.Invoke(ctx, "/rpc.Marble/Decrypt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marbleClient) Sign(ctx context.Context, in *SignReq, opts ...grpc.CallOption) (*SignResp, error) {
+	out := new(SignResp)
+	err := c.cc.Invoke(ctx, "/rpc.Marble/Sign", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marbleClient) Verify(ctx context.Context, in *VerifyReq, opts ...grpc.CallOption) (*VerifyResp, error) {
+	out := new(VerifyResp)
+	err := c.cc.Invoke(ctx, "/rpc.Marble/Verify", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marbleClient) DeriveKey(ctx context.Context, in *DeriveKeyReq, opts ...grpc.CallOption) (*DeriveKeyResp, error) {
+	out := new(DeriveKeyResp)
+	err := c.cc.Invoke(ctx, "/rpc.Marble/DeriveKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MarbleServer is the server API for Marble service.
 type MarbleServer interface {
 	// Activate activates a marble in the mesh.
 	Activate(context.Context, *ActivationReq) (*ActivationResp, error)
+	// IssueCertificate issues a certificate for an activated marble as permitted by its certificate policy.
+	IssueCertificate(context.Context, *IssueCertificateReq) (*IssueCertificateResp, error)
+	// GetJWTSVID issues a SPIFFE JWT-SVID for an activated marble.
+	GetJWTSVID(context.Context, *JWTSVIDReq) (*JWTSVIDResp, error)
+	// GetJWTBundle returns the keys to validate JWT-SVIDs with.
+	GetJWTBundle(context.Context, *JWTBundleReq) (*JWTBundleResp, error)
+	// Encrypt encrypts data with a transit key of the marble.
+	Encrypt(context.Context, *EncryptReq) (*EncryptResp, error)
+	// Decrypt decrypts data with a transit key of the marble.
+	Decrypt(context.Context, *DecryptReq) (*DecryptResp, error)
+	// Sign signs data with a transit key of the marble.
+	Sign(context.Context, *SignReq) (*SignResp, error)
+	// Verify verifies a signature with a transit key of the marble.
+	Verify(context.Context, *VerifyReq) (*VerifyResp, error)
+	// DeriveKey derives a key from a transit key of the marble.
+	DeriveKey(context.Context, *DeriveKeyReq) (*DeriveKeyResp, error)
 }
 
 // UnimplementedMarbleServer can be embedded to have forward compatible implementations.
@@ -393,6 +1656,30 @@ type UnimplementedMarbleServer struct {
 func (*UnimplementedMarbleServer) Activate(context.Context, *ActivationReq) (*ActivationResp, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Activate not implemented")
 }
+func (*UnimplementedMarbleServer) IssueCertificate(context.Context, *IssueCertificateReq) (*IssueCertificateResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IssueCertificate not implemented")
+}
+func (*UnimplementedMarbleServer) GetJWTSVID(context.Context, *JWTSVIDReq) (*JWTSVIDResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJWTSVID not implemented")
+}
+func (*UnimplementedMarbleServer) GetJWTBundle(context.Context, *JWTBundleReq) (*JWTBundleResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJWTBundle not implemented")
+}
+func (*UnimplementedMarbleServer) Encrypt(context.Context, *EncryptReq) (*EncryptResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Encrypt not implemented")
+}
+func (*UnimplementedMarbleServer) Decrypt(context.Context, *DecryptReq) (*DecryptResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Decrypt not implemented")
+}
+func (*UnimplementedMarbleServer) Sign(context.Context, *SignReq) (*SignResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sign not implemented")
+}
+func (*UnimplementedMarbleServer) Verify(context.Context, *VerifyReq) (*VerifyResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Verify not implemented")
+}
+func (*UnimplementedMarbleServer) DeriveKey(context.Context, *DeriveKeyReq) (*DeriveKeyResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeriveKey not implemented")
+}
 
 func RegisterMarbleServer(s *grpc.Server, srv MarbleServer) {
 	s.RegisterService(&_Marble_serviceDesc, srv)
@@ -416,6 +1703,150 @@ func _Marble_Activate_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Marble_IssueCertificate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IssueCertificateReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarbleServer).IssueCertificate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Marble/IssueCertificate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarbleServer).IssueCertificate(ctx, req.(*IssueCertificateReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Marble_GetJWTSVID_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JWTSVIDReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarbleServer).GetJWTSVID(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Marble/GetJWTSVID",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarbleServer).GetJWTSVID(ctx, req.(*JWTSVIDReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Marble_GetJWTBundle_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JWTBundleReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarbleServer).GetJWTBundle(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Marble/GetJWTBundle",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarbleServer).GetJWTBundle(ctx, req.(*JWTBundleReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Marble_Encrypt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EncryptReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarbleServer).Encrypt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Marble/Encrypt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarbleServer).Encrypt(ctx, req.(*EncryptReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Marble_Decrypt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DecryptReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarbleServer).Decrypt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Marble/Decrypt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarbleServer).Decrypt(ctx, req.(*DecryptReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Marble_Sign_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarbleServer).Sign(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Marble/Sign",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarbleServer).Sign(ctx, req.(*SignReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Marble_Verify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarbleServer).Verify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Marble/Verify",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarbleServer).Verify(ctx, req.(*VerifyReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Marble_DeriveKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeriveKeyReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarbleServer).DeriveKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Marble/DeriveKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarbleServer).DeriveKey(ctx, req.(*DeriveKeyReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Marble_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "rpc.Marble",
 	HandlerType: (*MarbleServer)(nil),
@@ -424,6 +1855,38 @@ var _Marble_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Activate",
 			Handler:    _Marble_Activate_Handler,
 		},
+		{
+			MethodName: "IssueCertificate",
+			Handler:    _Marble_IssueCertificate_Handler,
+		},
+		{
+			MethodName: "GetJWTSVID",
+			Handler:    _Marble_GetJWTSVID_Handler,
+		},
+		{
+			MethodName: "GetJWTBundle",
+			Handler:    _Marble_GetJWTBundle_Handler,
+		},
+		{
+			MethodName: "Encrypt",
+			Handler:    _Marble_Encrypt_Handler,
+		},
+		{
+			MethodName: "Decrypt",
+			Handler:    _Marble_Decrypt_Handler,
+		},
+		{
+			MethodName: "Sign",
+			Handler:    _Marble_Sign_Handler,
+		},
+		{
+			MethodName: "Verify",
+			Handler:    _Marble_Verify_Handler,
+		},
+		{
+			MethodName: "DeriveKey",
+			Handler:    _Marble_DeriveKey_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "coordinator.proto",
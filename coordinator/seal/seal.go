@@ -32,6 +32,28 @@ type Sealer interface {
 	Seal(unencryptedData []byte, toBeEncrypted []byte) error
 	Unseal() (unencryptedData []byte, decryptedData []byte, err error)
 	SetEncryptionKey(key []byte) error
+	UnsealWithKey(key []byte) (unencryptedData []byte, decryptedData []byte, err error)
+}
+
+// splitSealedData splits sealed data into its unencrypted and encrypted part
+func splitSealedData(sealedData []byte) ([]byte, []byte, error) {
+	if len(sealedData) <= 4 {
+		return nil, nil, errors.New("sealed state is missing data")
+	}
+
+	// Retrieve recovery secret hash map
+	encodedUnencryptDataLength := binary.LittleEndian.Uint32(sealedData[:4])
+
+	// Check if we do not go out of bounds
+	if 4+uint64(encodedUnencryptDataLength) > uint64(len(sealedData)) {
+		return nil, nil, errors.New("sealed state is corrupted, embedded length does not fit the data")
+	}
+
+	var unencryptedData []byte
+	if encodedUnencryptDataLength != 0 {
+		unencryptedData = sealedData[4 : 4+encodedUnencryptDataLength]
+	}
+	return unencryptedData, sealedData[4+encodedUnencryptDataLength:], nil
 }
 
 // AESGCMSealer implements the Sealer interface using AES-GCM for confidentiallity and authentication
@@ -58,23 +80,10 @@ func (s *AESGCMSealer) Unseal() ([]byte, []byte, error) {
 		return nil, nil, err
 	}
 
-	if len(sealedData) <= 4 {
-		return nil, nil, errors.New("sealed state is missing data")
-	}
-
-	// Retrieve recovery secret hash map
-	encodedUnencryptDataLength := binary.LittleEndian.Uint32(sealedData[:4])
-
-	// Check if we do not go out of bounds
-	if 4+encodedUnencryptDataLength > uint32(len(sealedData)) {
-		return nil, nil, errors.New("sealed state is corrupted, embedded length does not fit the data")
-	}
-
-	var unencryptedData []byte
-	if encodedUnencryptDataLength != 0 {
-		unencryptedData = sealedData[4 : 4+encodedUnencryptDataLength]
+	unencryptedData, ciphertext, err := splitSealedData(sealedData)
+	if err != nil {
+		return nil, nil, err
 	}
-	ciphertext := sealedData[4+encodedUnencryptDataLength:]
 
 	// Decrypt generated encryption key with seal key, if needed
 	if err = s.unsealEncryptionKey(); err != nil {
@@ -90,6 +99,23 @@ func (s *AESGCMSealer) Unseal() ([]byte, []byte, error) {
 	return unencryptedData, decryptedData, nil
 }
 
+// UnsealWithKey reads and decrypts stored information from the fs with the given key, without setting the key
+func (s *AESGCMSealer) UnsealWithKey(encryptionKey []byte) ([]byte, []byte, error) {
+	sealedData, err := ioutil.ReadFile(s.getFname(SealedDataFname))
+	if err != nil {
+		return nil, nil, err
+	}
+	unencryptedData, ciphertext, err := splitSealedData(sealedData)
+	if err != nil {
+		return nil, nil, err
+	}
+	decryptedData, err := ecrypto.Decrypt(ciphertext, encryptionKey)
+	if err != nil {
+		return unencryptedData, nil, err
+	}
+	return unencryptedData, decryptedData, nil
+}
+
 // Seal encrypts and stores information to the fs
 func (s *AESGCMSealer) Seal(unencryptedData []byte, toBeEncrypted []byte) error {
 	// If we don't have an AES key to encrypt the state, generate one
@@ -217,6 +243,11 @@ func (s *MockSealer) SetEncryptionKey(key []byte) error {
 	return nil
 }
 
+// UnsealWithKey implements the Sealer interface
+func (s *MockSealer) UnsealWithKey(key []byte) ([]byte, []byte, error) {
+	return s.unencryptedData, s.data, nil
+}
+
 // NoEnclaveSealer is a sealed for a -noenclave instance and does perform encryption with a fixed key
 type NoEnclaveSealer struct {
 	sealDir       string
@@ -281,19 +312,10 @@ func (s *NoEnclaveSealer) Unseal() ([]byte, []byte, error) {
 		return nil, nil, err
 	}
 
-	// Retrieve recovery secret hash map
-	encodedUnencryptDataLength := binary.LittleEndian.Uint32(sealedData[:4])
-
-	// Check if we do not go out of bounds
-	if 4+int(encodedUnencryptDataLength) > len(sealedData) {
-		return nil, nil, errors.New("sealed state is corrupted, embedded length does not fit the data")
-	}
-
-	var unencryptedData []byte
-	if encodedUnencryptDataLength != 0 {
-		unencryptedData = sealedData[4 : 4+encodedUnencryptDataLength]
+	unencryptedData, ciphertext, err := splitSealedData(sealedData)
+	if err != nil {
+		return nil, nil, err
 	}
-	ciphertext := sealedData[4+encodedUnencryptDataLength:]
 
 	// Decrypt data with key from disk
 	decryptedData, err := ecrypto.Decrypt(ciphertext, keyData)
@@ -304,6 +326,23 @@ func (s *NoEnclaveSealer) Unseal() ([]byte, []byte, error) {
 	return unencryptedData, decryptedData, nil
 }
 
+// UnsealWithKey reads the plaintext state from disk with the given key, without setting the key
+func (s *NoEnclaveSealer) UnsealWithKey(encryptionKey []byte) ([]byte, []byte, error) {
+	sealedData, err := ioutil.ReadFile(s.getFname(SealedDataFname))
+	if err != nil {
+		return nil, nil, err
+	}
+	unencryptedData, ciphertext, err := splitSealedData(sealedData)
+	if err != nil {
+		return nil, nil, err
+	}
+	decryptedData, err := ecrypto.Decrypt(ciphertext, encryptionKey)
+	if err != nil {
+		return unencryptedData, nil, err
+	}
+	return unencryptedData, decryptedData, nil
+}
+
 // SetEncryptionKey implements the Sealer interface
 func (s *NoEnclaveSealer) SetEncryptionKey(key []byte) error {
 	s.encryptionKey = key
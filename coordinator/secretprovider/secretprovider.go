@@ -0,0 +1,105 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package secretprovider implements the external sources the Coordinator fetches secrets from.
+package secretprovider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+)
+
+// requestTimeout limits the time to fetch a single secret
+const requestTimeout = 30 * time.Second
+
+// maxResponseSize limits the size of a fetched secret
+const maxResponseSize = 1 << 20
+
+// SecretProvider fetches secrets from an external source
+type SecretProvider interface {
+	// GetSecret fetches the secret identified by path
+	GetSecret(ctx context.Context, path string) (manifest.UserSecret, error)
+}
+
+// New creates the secret provider defined in the manifest. The Coordinator authenticates to the provider with clientCert.
+func New(provider manifest.SecretProvider, clientCert tls.Certificate) (SecretProvider, error) {
+	switch provider.Type {
+	case "http":
+		return newHTTPProvider(provider, clientCert)
+	default:
+		return nil, fmt.Errorf("unsupported secret provider type %s", provider.Type)
+	}
+}
+
+// httpProvider fetches secrets in the JSON format of manifest.UserSecret with GET requests
+type httpProvider struct {
+	baseURL *url.URL
+	client  *http.Client
+}
+
+func newHTTPProvider(provider manifest.SecretProvider, clientCert tls.Certificate) (*httpProvider, error) {
+	baseURL, err := url.Parse(provider.URL)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(provider.RootCA)) {
+		return nil, errors.New("failed to parse root certificate of secret provider")
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      roots,
+		MinVersion:   tls.VersionTLS12,
+	}
+	return &httpProvider{
+		baseURL: baseURL,
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			Timeout:   requestTimeout,
+		},
+	}, nil
+}
+
+// GetSecret implements the SecretProvider interface
+func (p *httpProvider) GetSecret(ctx context.Context, secretPath string) (manifest.UserSecret, error) {
+	secretURL := *p.baseURL
+	secretURL.Path = path.Join("/", p.baseURL.Path, secretPath)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, secretURL.String(), nil)
+	if err != nil {
+		return manifest.UserSecret{}, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return manifest.UserSecret{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return manifest.UserSecret{}, fmt.Errorf("secret provider returned %s for %s", resp.Status, secretPath)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return manifest.UserSecret{}, err
+	}
+	var secret manifest.UserSecret
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return manifest.UserSecret{}, fmt.Errorf("invalid secret %s: %v", secretPath, err)
+	}
+	return secret, nil
+}
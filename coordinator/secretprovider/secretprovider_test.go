@@ -0,0 +1,77 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package secretprovider
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+	"github.com/edgelesssys/marblerun/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPProvider(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	clientCert, clientPrivK, err := util.GenerateCert([]string{"localhost"}, nil, false)
+	require.NoError(err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the Coordinator authenticates with its certificate
+		if len(r.TLS.PeerCertificates) != 1 || !r.TLS.PeerCertificates[0].Equal(clientCert) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secrets/key":
+			w.Write([]byte(`{"Key":"AAECAwQFBgcICQoLDA0ODw=="}`))
+		case "/v1/secrets/invalid":
+			w.Write([]byte(`not json`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	definition := manifest.SecretProvider{
+		Type:   "http",
+		URL:    server.URL + "/v1/secrets",
+		RootCA: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+	}
+	provider, err := New(definition, *util.TLSCertFromDER(clientCert.Raw, clientPrivK))
+	require.NoError(err)
+
+	secret, err := provider.GetSecret(context.Background(), "key")
+	require.NoError(err)
+	assert.Equal([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, secret.Key)
+
+	_, err = provider.GetSecret(context.Background(), "missing")
+	assert.Error(err)
+	_, err = provider.GetSecret(context.Background(), "invalid")
+	assert.Error(err)
+
+	// the provider is verified with its root certificate
+	otherCert, _, err := util.GenerateCert([]string{"localhost"}, nil, false)
+	require.NoError(err)
+	definition.RootCA = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherCert.Raw}))
+	provider, err = New(definition, *util.TLSCertFromDER(clientCert.Raw, clientPrivK))
+	require.NoError(err)
+	_, err = provider.GetSecret(context.Background(), "key")
+	assert.Error(err)
+
+	_, err = New(manifest.SecretProvider{Type: "kmip"}, tls.Certificate{})
+	assert.Error(err)
+}
@@ -9,6 +9,7 @@ package server
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -17,6 +18,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/edgelesssys/marblerun/coordinator/core"
 	"github.com/edgelesssys/marblerun/coordinator/rpc"
@@ -44,6 +46,10 @@ type certQuoteResp struct {
 	Cert  string
 	Quote []byte
 }
+type intermediateCSRResp struct {
+	CSR   string
+	Quote []byte
+}
 type statusResp struct {
 	StatusCode    int
 	StatusMessage string
@@ -135,6 +141,10 @@ func CreateServeMux(cc core.ClientCore, promFactory *promauto.Factory) serveMux
 		switch r.Method {
 		case http.MethodGet:
 			signature, manifest := cc.GetManifestSignature(r.Context())
+			// the signature stays public, so everyone can verify the manifest, but its content may be restricted
+			if err := cc.AuthorizeRead(r.Context(), authenticatedUser(r, cc), user.PermissionReadManifest); err != nil {
+				manifest = nil
+			}
 			writeJSON(w, manifestSignatureResp{
 				ManifestSignature: hex.EncodeToString(signature),
 				Manifest:          manifest,
@@ -145,6 +155,15 @@ func CreateServeMux(cc core.ClientCore, promFactory *promauto.Factory) serveMux
 				writeJSONError(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			if isDryRun(r) {
+				changes, err := cc.SetManifestDryRun(r.Context(), manifest)
+				if err != nil {
+					writeJSONError(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				writeJSON(w, changes)
+				return
+			}
 			recoverySecretMap, err := cc.SetManifest(r.Context(), manifest)
 
 			if err != nil {
@@ -191,8 +210,14 @@ func CreateServeMux(cc core.ClientCore, promFactory *promauto.Factory) serveMux
 				return
 			}
 
+			// Users can only be authenticated once the state is recovered, so pass on the client certificates
+			var clientCerts []*x509.Certificate
+			if r.TLS != nil {
+				clientCerts = r.TLS.PeerCertificates
+			}
+
 			// Perform recover and receive amount of remaining secrets (for multi-party recovery)
-			remaining, err := cc.Recover(r.Context(), key)
+			remaining, err := cc.Recover(r.Context(), key, clientCerts)
 
 			if err != nil {
 				writeJSONError(w, err.Error(), http.StatusInternalServerError)
@@ -226,6 +251,15 @@ func CreateServeMux(cc core.ClientCore, promFactory *promauto.Factory) serveMux
 				writeJSONError(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			if isDryRun(r) {
+				changes, err := cc.UpdateManifestDryRun(r.Context(), updateManifest, user)
+				if err != nil {
+					writeJSONError(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				writeJSON(w, changes)
+				return
+			}
 			err = cc.UpdateManifest(r.Context(), updateManifest, user)
 			if err != nil {
 				writeJSONError(w, err.Error(), http.StatusBadRequest)
@@ -233,6 +267,10 @@ func CreateServeMux(cc core.ClientCore, promFactory *promauto.Factory) serveMux
 			}
 			writeJSON(w, nil)
 		case http.MethodGet:
+			if err := cc.AuthorizeRead(r.Context(), authenticatedUser(r, cc), user.PermissionReadUpdateLog); err != nil {
+				writeJSONError(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
 			updateLog, err := cc.GetUpdateLog(r.Context())
 			if err != nil {
 				writeJSONError(w, err.Error(), http.StatusInternalServerError)
@@ -243,6 +281,73 @@ func CreateServeMux(cc core.ClientCore, promFactory *promauto.Factory) serveMux
 		}
 	})
 
+	mux.HandleFunc("/activations", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			user := verifyUser(w, r, cc)
+			if user == nil {
+				return
+			}
+			activations, err := cc.GetActivations(r.Context(), user)
+			if err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, activations)
+		default:
+			writeJSONError(w, "", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/marbles/revoke", func(w http.ResponseWriter, r *http.Request) {
+		user := verifyUser(w, r, cc)
+		if user == nil {
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			marbleUUID := r.URL.Query().Get("uuid")
+			if len(marbleUUID) <= 0 {
+				writeJSONError(w, "invalid query", http.StatusBadRequest)
+				return
+			}
+			if err := cc.RevokeMarble(r.Context(), marbleUUID, user); err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, nil)
+		default:
+			writeJSONError(w, "", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/users/certificate", func(w http.ResponseWriter, r *http.Request) {
+		user := verifyUser(w, r, cc)
+		if user == nil {
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			userName := r.URL.Query().Get("name")
+			if len(userName) <= 0 {
+				writeJSONError(w, "invalid query", http.StatusBadRequest)
+				return
+			}
+			cert, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				writeJSONError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := cc.SetUserCertificate(r.Context(), userName, cert, user); err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, nil)
+		default:
+			writeJSONError(w, "", http.StatusMethodNotAllowed)
+		}
+	})
+
 	mux.HandleFunc("/secrets", func(w http.ResponseWriter, r *http.Request) {
 		user := verifyUser(w, r, cc)
 		if user == nil {
@@ -262,24 +367,230 @@ func CreateServeMux(cc core.ClientCore, promFactory *promauto.Factory) serveMux
 			}
 			writeJSON(w, nil)
 		case http.MethodGet:
-			// Secrets are requested via the query string in the form of ?s=<secret_one>&s=<secret_two>&s=...
-			requestedSecrets := r.URL.Query()["s"]
-			if len(requestedSecrets) <= 0 {
+			requestedSecrets := secretsFromQuery(w, r)
+			if requestedSecrets == nil {
+				return
+			}
+			response, err := cc.GetSecrets(r.Context(), requestedSecrets, user)
+			if err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, response)
+		case http.MethodDelete:
+			requestedSecrets := secretsFromQuery(w, r)
+			if requestedSecrets == nil {
+				return
+			}
+			if err := cc.DeleteSecrets(r.Context(), requestedSecrets, user); err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, nil)
+		default:
+			writeJSONError(w, "", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/secrets/history", func(w http.ResponseWriter, r *http.Request) {
+		user := verifyUser(w, r, cc)
+		if user == nil {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			secretName := r.URL.Query().Get("s")
+			if len(secretName) <= 0 {
+				writeJSONError(w, "invalid query", http.StatusBadRequest)
+				return
+			}
+			history, err := cc.GetSecretHistory(r.Context(), secretName, user)
+			if err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, history)
+		default:
+			writeJSONError(w, "", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/secrets/rollback", func(w http.ResponseWriter, r *http.Request) {
+		user := verifyUser(w, r, cc)
+		if user == nil {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			// The secret is requested via the query string in the form of ?s=<secret>&version=<version>
+			// If no version is given, the secret is restored to the version before the current one
+			secretName := r.URL.Query().Get("s")
+			if len(secretName) <= 0 {
 				writeJSONError(w, "invalid query", http.StatusBadRequest)
 				return
 			}
-			for _, req := range requestedSecrets {
-				if len(req) <= 0 {
+			var version uint64
+			if rawVersion := r.URL.Query().Get("version"); len(rawVersion) > 0 {
+				var err error
+				version, err = strconv.ParseUint(rawVersion, 10, 0)
+				if err != nil {
 					writeJSONError(w, "malformed query string", http.StatusBadRequest)
 					return
 				}
 			}
-			response, err := cc.GetSecrets(r.Context(), requestedSecrets, user)
+			if err := cc.RollbackSecret(r.Context(), secretName, uint(version), user); err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, nil)
+		default:
+			writeJSONError(w, "", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/secrets/rotate", func(w http.ResponseWriter, r *http.Request) {
+		user := verifyUser(w, r, cc)
+		if user == nil {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			requestedSecrets := secretsFromQuery(w, r)
+			if requestedSecrets == nil {
+				return
+			}
+			if err := cc.RotateSecrets(r.Context(), requestedSecrets, user); err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, nil)
+		default:
+			writeJSONError(w, "", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/rootca/rotate", func(w http.ResponseWriter, r *http.Request) {
+		user := verifyUser(w, r, cc)
+		if user == nil {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			if err := cc.RotateRootCA(r.Context(), user); err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, nil)
+		default:
+			writeJSONError(w, "", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/sealkeys", func(w http.ResponseWriter, r *http.Request) {
+		user := verifyUser(w, r, cc)
+		if user == nil {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			sealKeys, err := cc.ExportSealKeys(r.Context(), user)
 			if err != nil {
 				writeJSONError(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-			writeJSON(w, response)
+			writeJSON(w, sealKeys)
+		case http.MethodPost:
+			rawSealKeys, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := cc.ImportSealKeys(r.Context(), rawSealKeys, user); err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, nil)
+		default:
+			writeJSONError(w, "", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/sealkeys/rotate", func(w http.ResponseWriter, r *http.Request) {
+		user := verifyUser(w, r, cc)
+		if user == nil {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			if err := cc.RotateSealKey(r.Context(), user); err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, nil)
+		default:
+			writeJSONError(w, "", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/spiffe/bundle", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			bundle, err := cc.GetSPIFFEBundle(r.Context())
+			if err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// SPIFFE bundles are served as plain JWKS documents, so SPIFFE-aware components can consume them directly
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(bundle)
+		default:
+			writeJSONError(w, "", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/intermediate/csr", func(w http.ResponseWriter, r *http.Request) {
+		user := verifyUser(w, r, cc)
+		if user == nil {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			csr, quote, err := cc.GetIntermediateCSR(r.Context(), user)
+			if err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, intermediateCSRResp{string(csr), quote})
+		default:
+			writeJSONError(w, "", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/intermediate", func(w http.ResponseWriter, r *http.Request) {
+		user := verifyUser(w, r, cc)
+		if user == nil {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			certChain, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := cc.SetIntermediateCertificate(r.Context(), certChain, user); err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, nil)
 		default:
 			writeJSONError(w, "", http.StatusMethodNotAllowed)
 		}
@@ -302,6 +613,40 @@ func verifyUser(w http.ResponseWriter, r *http.Request, cc core.ClientCore) *use
 	return verifiedUser
 }
 
+// authenticatedUser returns the user of the request's client certificate, or nil if the request is not authenticated
+func authenticatedUser(r *http.Request, cc core.ClientCore) *user.User {
+	if r.TLS == nil {
+		return nil
+	}
+	verifiedUser, err := cc.VerifyUser(r.Context(), r.TLS.PeerCertificates)
+	if err != nil {
+		return nil
+	}
+	return verifiedUser
+}
+
+// secretsFromQuery returns the secret names requested via the query string in the form of ?s=<secret_one>&s=<secret_two>&s=...
+func secretsFromQuery(w http.ResponseWriter, r *http.Request) []string {
+	requestedSecrets := r.URL.Query()["s"]
+	if len(requestedSecrets) <= 0 {
+		writeJSONError(w, "invalid query", http.StatusBadRequest)
+		return nil
+	}
+	for _, req := range requestedSecrets {
+		if len(req) <= 0 {
+			writeJSONError(w, "malformed query string", http.StatusBadRequest)
+			return nil
+		}
+	}
+	return requestedSecrets
+}
+
+// isDryRun returns true if the request only asks which changes it would make
+func isDryRun(r *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	return dryRun
+}
+
 func writeJSON(w http.ResponseWriter, v interface{}) {
 	dataToReturn := GeneralResponse{Status: "success", Data: v}
 	if err := json.NewEncoder(w).Encode(dataToReturn); err != nil {
@@ -13,6 +13,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -21,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/edgelesssys/marblerun/coordinator/core"
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
 	"github.com/edgelesssys/marblerun/test"
 	"github.com/edgelesssys/marblerun/util"
 	"github.com/stretchr/testify/assert"
@@ -99,6 +101,103 @@ func TestManifestWithRecoveryKey(t *testing.T) {
 	require.NotNil(recoveryData)
 }
 
+func TestManifestRestricted(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := core.NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), manifestWithAdminRoles(map[string]manifest.Role{
+		"manifest_reader": {ResourceType: "Manifest", Actions: []string{"ReadManifest"}},
+	}))
+	require.NoError(err)
+	mux := CreateServeMux(c, nil)
+	sig, _ := c.GetManifestSignature(context.TODO())
+
+	// unauthenticated users only get the signature
+	req := httptest.NewRequest(http.MethodGet, "/manifest", nil)
+	resp := httptest.NewRecorder()
+	mux.ServeHTTP(resp, req)
+	require.Equal(http.StatusOK, resp.Code)
+	assert.Equal(hex.EncodeToString(sig), gjson.Get(resp.Body.String(), "data.ManifestSignature").String())
+	assert.Empty(gjson.Get(resp.Body.String(), "data.Manifest").String())
+
+	// users with the ReadManifest permission get the manifest
+	adminTestCert, _ := test.MustSetupTestCerts(test.RecoveryPrivateKey)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{adminTestCert}}
+	resp = httptest.NewRecorder()
+	mux.ServeHTTP(resp, req)
+	require.Equal(http.StatusOK, resp.Code)
+	assert.NotEmpty(gjson.Get(resp.Body.String(), "data.Manifest").String())
+}
+
+func TestGetUpdateLogRestricted(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := core.NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), manifestWithAdminRoles(map[string]manifest.Role{
+		"log_reader": {ResourceType: "UpdateLog", Actions: []string{"ReadUpdateLog"}},
+	}))
+	require.NoError(err)
+	mux := CreateServeMux(c, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/update", nil)
+	resp := httptest.NewRecorder()
+	err = testRequestWithCert(req, resp, mux)
+	assert.NoError(err)
+}
+
+func TestRevokeMarble(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := core.NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), manifestWithAdminRoles(map[string]manifest.Role{
+		"marble_revoker": {ResourceType: "Marbles", ResourceNames: []string{"frontend"}, Actions: []string{"RevokeMarble"}},
+	}))
+	require.NoError(err)
+	mux := CreateServeMux(c, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/marbles/revoke?uuid=00000000-0000-0000-0000-000000000000", nil)
+	resp := httptest.NewRecorder()
+	mux.ServeHTTP(resp, req)
+	assert.Equal(http.StatusUnauthorized, resp.Code)
+
+	// the user is authorized, but the marble was never activated
+	adminTestCert, _ := test.MustSetupTestCerts(test.RecoveryPrivateKey)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{adminTestCert}}
+	resp = httptest.NewRecorder()
+	mux.ServeHTTP(resp, req)
+	assert.Equal(http.StatusBadRequest, resp.Code)
+	assert.Contains(resp.Body.String(), "was not activated")
+}
+
+func TestSetUserCertificate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := core.NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), manifestWithAdminRoles(map[string]manifest.Role{
+		"user_manager": {ResourceType: "Users", ResourceNames: []string{"admin"}, Actions: []string{"ManageUsers"}},
+	}))
+	require.NoError(err)
+	mux := CreateServeMux(c, nil)
+
+	_, otherTestCert := test.MustSetupTestCerts(test.RecoveryPrivateKey)
+	newCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherTestCert.Raw}))
+	req := httptest.NewRequest(http.MethodPost, "/users/certificate?name=admin", strings.NewReader(newCert))
+	resp := httptest.NewRecorder()
+	err = testRequestWithCert(req, resp, mux)
+	assert.NoError(err)
+
+	// the old certificate is no longer accepted
+	req = httptest.NewRequest(http.MethodPost, "/users/certificate?name=admin", strings.NewReader(newCert))
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{otherTestCert}}
+	resp = httptest.NewRecorder()
+	mux.ServeHTTP(resp, req)
+	assert.Equal(http.StatusOK, resp.Code)
+}
+
 func TestGetUpdateLog(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -167,6 +266,118 @@ func TestSetSecret(t *testing.T) {
 	assert.NoError(err)
 }
 
+func TestDeleteSecret(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Setup mock core and set a manifest
+	c := core.NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	mux := CreateServeMux(c, nil)
+
+	// Make HTTP secret request with no TLS at all, should be unauthenticated
+	req := httptest.NewRequest(http.MethodDelete, "/secrets?s=generic_secret", nil)
+	resp := httptest.NewRecorder()
+	err = testRequestWithCert(req, resp, mux)
+	assert.NoError(err)
+}
+
+func TestRotateSecret(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Setup mock core and set a manifest
+	c := core.NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	mux := CreateServeMux(c, nil)
+
+	// Make HTTP secret request with no TLS at all, should be unauthenticated
+	req := httptest.NewRequest(http.MethodPost, "/secrets/rotate?s=cert_shared", nil)
+	resp := httptest.NewRecorder()
+	err = testRequestWithCert(req, resp, mux)
+	assert.NoError(err)
+}
+
+func TestRotateRootCA(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Setup mock core and set a manifest
+	c := core.NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	mux := CreateServeMux(c, nil)
+
+	// Make HTTP root CA rotation request with no TLS at all, should be unauthenticated
+	req := httptest.NewRequest(http.MethodPost, "/rootca/rotate", nil)
+	resp := httptest.NewRecorder()
+	err = testRequestWithCert(req, resp, mux)
+	assert.NoError(err)
+}
+
+func TestIntermediateCSR(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Setup mock core and set a manifest
+	c := core.NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	mux := CreateServeMux(c, nil)
+
+	// Make HTTP CSR request with no TLS at all, should be unauthenticated
+	req := httptest.NewRequest(http.MethodPost, "/intermediate/csr", nil)
+	resp := httptest.NewRecorder()
+	err = testRequestWithCert(req, resp, mux)
+	assert.NoError(err)
+
+	// Setting an invalid certificate chain should fail
+	adminTestCert, _ := test.MustSetupTestCerts(test.RecoveryPrivateKey)
+	req = httptest.NewRequest(http.MethodPost, "/intermediate", strings.NewReader("invalid"))
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{adminTestCert}}
+	resp = httptest.NewRecorder()
+	mux.ServeHTTP(resp, req)
+	assert.Equal(http.StatusBadRequest, resp.Code)
+}
+
+func TestGetActivations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Setup mock core and set a manifest
+	c := core.NewCoreWithMocks()
+	_, err := c.SetManifest(context.TODO(), []byte(test.ManifestJSONWithRecoveryKey))
+	require.NoError(err)
+	mux := CreateServeMux(c, nil)
+
+	// Make HTTP activations request with no TLS at all, should be unauthenticated
+	req := httptest.NewRequest(http.MethodGet, "/activations", nil)
+	resp := httptest.NewRecorder()
+	err = testRequestWithCert(req, resp, mux)
+	assert.NoError(err)
+}
+
+// manifestWithAdminRoles returns the test manifest with additional roles assigned to the admin user
+func manifestWithAdminRoles(roles map[string]manifest.Role) []byte {
+	var mnf manifest.Manifest
+	if err := json.Unmarshal([]byte(test.ManifestJSONWithRecoveryKey), &mnf); err != nil {
+		panic(err)
+	}
+	admin := mnf.Users["admin"]
+	for name, role := range roles {
+		mnf.Roles[name] = role
+		admin.Roles = append(admin.Roles, name)
+	}
+	mnf.Users["admin"] = admin
+	rawManifest, err := json.Marshal(mnf)
+	if err != nil {
+		panic(err)
+	}
+	return rawManifest
+}
+
 func testRequestWithCert(req *http.Request, resp *httptest.ResponseRecorder, mux serveMux) error {
 	mux.ServeHTTP(resp, req)
 	if resp.Code != http.StatusUnauthorized {
@@ -0,0 +1,290 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package spiffe implements the SPIFFE identity documents of Marbles: IDs, trust bundles and JWT-SVIDs.
+package spiffe
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/manifest"
+)
+
+// JWTSVIDValidity is the lifetime of JWT-SVIDs issued by the Coordinator
+const JWTSVIDValidity = 5 * time.Minute
+
+// Environment variables the Coordinator sets for Marbles if SPIFFE is enabled
+const (
+	// EnvironmentX509SVID holds the PEM encoded X509-SVID of the Marble: its certificate followed by the intermediate CAs up to the X.509 authorities
+	EnvironmentX509SVID = "MARBLE_PREDEFINED_SPIFFE_X509_SVID"
+	// EnvironmentX509Bundle holds the PEM encoded X.509 authorities of the trust domain
+	EnvironmentX509Bundle = "MARBLE_PREDEFINED_SPIFFE_X509_BUNDLE"
+)
+
+// ID returns the SPIFFE ID of a Marble, spiffe://<trust-domain>/<marbletype>/<uuid>
+func ID(trustDomain, marbleType, marbleUUID string) *url.URL {
+	return &url.URL{Scheme: "spiffe", Host: trustDomain, Path: "/" + marbleType + "/" + marbleUUID}
+}
+
+// IDFromCertificate returns the SPIFFE ID of an X509-SVID
+func IDFromCertificate(cert *x509.Certificate) (*url.URL, error) {
+	if len(cert.URIs) != 1 || cert.URIs[0].Scheme != "spiffe" {
+		return nil, errors.New("certificate does not contain a SPIFFE ID")
+	}
+	return cert.URIs[0], nil
+}
+
+// ValidateTrustDomain checks that a trust domain only contains the characters allowed by the SPIFFE specification
+func ValidateTrustDomain(trustDomain string) error {
+	if trustDomain == "" {
+		return errors.New("trust domain is empty")
+	}
+	for _, c := range trustDomain {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return fmt.Errorf("invalid character %q in trust domain %s", c, trustDomain)
+		}
+	}
+	return nil
+}
+
+// jwk is a JSON Web Key in a SPIFFE bundle
+type jwk map[string]interface{}
+
+// bundle is a SPIFFE bundle, a JSON Web Key Set with the X.509 and JWT authorities of a trust domain
+type bundle struct {
+	Keys []jwk `json:"keys"`
+}
+
+// NewBundle returns the SPIFFE bundle with the given X.509 authorities and JWT signing keys
+func NewBundle(x509Authorities []*x509.Certificate, jwtKeys []crypto.PublicKey) ([]byte, error) {
+	var b bundle
+	for _, cert := range x509Authorities {
+		key, err := newJWK(manifest.Certificate(*cert), "x509-svid")
+		if err != nil {
+			return nil, err
+		}
+		b.Keys = append(b.Keys, key)
+	}
+	for _, pub := range jwtKeys {
+		rawPub, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		key, err := newJWK(manifest.PublicKey(rawPub), "jwt-svid")
+		if err != nil {
+			return nil, err
+		}
+		b.Keys = append(b.Keys, key)
+	}
+	return json.Marshal(b)
+}
+
+// newJWK encodes a public key or certificate to a JWK with the given use
+func newJWK(data interface{}, use string) (jwk, error) {
+	rawKey, err := manifest.EncodeSecretDataToJWK(data)
+	if err != nil {
+		return nil, err
+	}
+	var key jwk
+	if err := json.Unmarshal([]byte(rawKey), &key); err != nil {
+		return nil, err
+	}
+	key["use"] = use
+	if use == "x509-svid" {
+		// the key ID is only used to select the JWT signing key
+		delete(key, "kid")
+	}
+	return key, nil
+}
+
+// jwtKeys returns the JWT signing keys of a SPIFFE bundle by their key ID
+func jwtKeys(rawBundle []byte) (map[string]*ecdsa.PublicKey, error) {
+	var b bundle
+	if err := json.Unmarshal(rawBundle, &b); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*ecdsa.PublicKey)
+	for _, key := range b.Keys {
+		if key["use"] != "jwt-svid" || key["kty"] != "EC" || key["crv"] != "P-256" {
+			continue
+		}
+		kid, _ := key["kid"].(string)
+		x, err := decodeBigInt(key["x"])
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(key["y"])
+		if err != nil {
+			return nil, err
+		}
+		keys[kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	}
+	return keys, nil
+}
+
+func decodeBigInt(value interface{}) (*big.Int, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("invalid JWK coordinate")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+// KeyID returns the key ID of a JWT signing key in SPIFFE bundles
+func KeyID(pub crypto.PublicKey) (string, error) {
+	rawPub, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	key, err := newJWK(manifest.PublicKey(rawPub), "jwt-svid")
+	if err != nil {
+		return "", err
+	}
+	kid, _ := key["kid"].(string)
+	return kid, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// SignJWTSVID issues a JWT-SVID for the SPIFFE ID and audience, signed with an ECDSA P-256 key (ES256)
+func SignJWTSVID(privK *ecdsa.PrivateKey, spiffeID string, audience []string, notAfter time.Time) (string, error) {
+	if len(audience) == 0 {
+		return "", errors.New("JWT-SVIDs require an audience")
+	}
+	kid, err := KeyID(privK.Public())
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(jwtHeader{Alg: "ES256", Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"sub": spiffeID,
+		"aud": audience,
+		"exp": notAfter.Unix(),
+		"iat": time.Now().Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, privK, hash[:])
+	if err != nil {
+		return "", err
+	}
+	signature := append(padBytes(r.Bytes(), 32), padBytes(s.Bytes(), 32)...)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ValidateJWTSVID verifies a JWT-SVID with the JWT signing keys of a SPIFFE bundle and checks that it was issued for the audience.
+// It returns the SPIFFE ID and the claims of the token.
+func ValidateJWTSVID(token string, rawBundle []byte, audience string) (string, map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", nil, errors.New("malformed JWT")
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", nil, err
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return "", nil, err
+	}
+	if header.Alg != "ES256" {
+		return "", nil, fmt.Errorf("unsupported JWT algorithm %s", header.Alg)
+	}
+	keys, err := jwtKeys(rawBundle)
+	if err != nil {
+		return "", nil, err
+	}
+	pub, ok := keys[header.Kid]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown JWT key ID %s", header.Kid)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, err
+	}
+	if len(signature) != 64 {
+		return "", nil, errors.New("invalid JWT signature")
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(pub, hash[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		return "", nil, errors.New("invalid JWT signature")
+	}
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, err
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return "", nil, err
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Now().After(time.Unix(int64(exp), 0)) {
+		return "", nil, errors.New("JWT-SVID is expired")
+	}
+	if !containsAudience(claims["aud"], audience) {
+		return "", nil, fmt.Errorf("JWT-SVID was not issued for audience %s", audience)
+	}
+	spiffeID, ok := claims["sub"].(string)
+	if !ok || !strings.HasPrefix(spiffeID, "spiffe://") {
+		return "", nil, errors.New("JWT-SVID does not contain a SPIFFE ID")
+	}
+	return spiffeID, claims, nil
+}
+
+// containsAudience returns true if the aud claim, a string or a list of strings, contains the audience
+func containsAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// padBytes prepends zeros to b until it has the given size
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
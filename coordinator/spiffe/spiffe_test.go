@@ -0,0 +1,80 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package spiffe
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestID(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("spiffe://example.org/frontend/1234", ID("example.org", "frontend", "1234").String())
+
+	assert.NoError(ValidateTrustDomain("example.org"))
+	assert.NoError(ValidateTrustDomain("my-domain_1.local"))
+	assert.Error(ValidateTrustDomain(""))
+	assert.Error(ValidateTrustDomain("Example.org"))
+	assert.Error(ValidateTrustDomain("example.org/path"))
+	assert.Error(ValidateTrustDomain("example.org:443"))
+}
+
+func TestJWTSVID(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privK, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	bundle, err := NewBundle(nil, []crypto.PublicKey{privK.Public()})
+	require.NoError(err)
+
+	const spiffeID = "spiffe://example.org/frontend/1234"
+	_, err = SignJWTSVID(privK, spiffeID, nil, time.Now().Add(time.Minute))
+	assert.Error(err)
+	token, err := SignJWTSVID(privK, spiffeID, []string{"backend", "db"}, time.Now().Add(time.Minute))
+	require.NoError(err)
+
+	subject, claims, err := ValidateJWTSVID(token, bundle, "db")
+	require.NoError(err)
+	assert.Equal(spiffeID, subject)
+	assert.Equal(spiffeID, claims["sub"])
+
+	// the token is only valid for its audience
+	_, _, err = ValidateJWTSVID(token, bundle, "other")
+	assert.Error(err)
+
+	// tokens signed by other keys are rejected
+	otherPrivK, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	otherBundle, err := NewBundle(nil, []crypto.PublicKey{otherPrivK.Public()})
+	require.NoError(err)
+	_, _, err = ValidateJWTSVID(token, otherBundle, "db")
+	assert.Error(err)
+
+	// tampered tokens are rejected
+	otherToken, err := SignJWTSVID(privK, "spiffe://example.org/backend/5678", []string{"db"}, time.Now().Add(time.Minute))
+	require.NoError(err)
+	_, _, err = ValidateJWTSVID(token[:len(token)-86]+otherToken[len(otherToken)-86:], bundle, "db")
+	assert.Error(err)
+
+	// expired tokens are rejected
+	expiredToken, err := SignJWTSVID(privK, spiffeID, []string{"db"}, time.Now().Add(-time.Minute))
+	require.NoError(err)
+	_, _, err = ValidateJWTSVID(expiredToken, bundle, "db")
+	assert.Error(err)
+
+	_, _, err = ValidateJWTSVID("invalid", bundle, "db")
+	assert.Error(err)
+}
@@ -88,10 +88,21 @@ func (s *StdStore) BeginTransaction() (Transaction, error) {
 
 // LoadState loads sealed data into StdStore's data
 func (s *StdStore) LoadState() ([]byte, error) {
+	return s.loadState(s.sealer.Unseal)
+}
+
+// LoadStateWithKey loads sealed data into StdStore's data, decrypting it with the given key instead of the sealer's one
+func (s *StdStore) LoadStateWithKey(encryptionKey []byte) ([]byte, error) {
+	return s.loadState(func() ([]byte, []byte, error) {
+		return s.sealer.UnsealWithKey(encryptionKey)
+	})
+}
+
+func (s *StdStore) loadState(unseal func() ([]byte, []byte, error)) ([]byte, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	encodedRecoveryData, stateRaw, err := s.sealer.Unseal()
+	encodedRecoveryData, stateRaw, err := unseal()
 	if err != nil {
 		s.recoveryMode = true
 		return encodedRecoveryData, err
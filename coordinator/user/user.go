@@ -12,9 +12,22 @@ import (
 )
 
 const (
-	PermissionWriteSecret   = "writesecret"
-	PermissionReadSecret    = "readsecret"
-	PermissionUpdatePackage = "updatesecurityversion"
+	PermissionWriteSecret     = "writesecret"
+	PermissionReadSecret      = "readsecret"
+	PermissionDeleteSecret    = "deletesecret"
+	PermissionRotateSecret    = "rotatesecret"
+	PermissionUpdatePackage   = "updatesecurityversion"
+	PermissionReadManifest    = "readmanifest"
+	PermissionReadUpdateLog   = "readupdatelog"
+	PermissionReadActivations = "readactivations"
+	PermissionRevokeMarble    = "revokemarble"
+	PermissionManageUsers     = "manageusers"
+	PermissionRecover         = "recover"
+	PermissionRotateRootCA    = "rotaterootca"
+	PermissionSetExternalCA   = "setexternalca"
+	PermissionRotateSealKey   = "rotatesealkey"
+	PermissionExportSealKeys  = "exportsealkeys"
+	PermissionImportSealKeys  = "importsealkeys"
 )
 
 // User represents a privileged user of Marblerun
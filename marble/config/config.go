@@ -33,3 +33,6 @@ const UUIDFile = "EDG_MARBLE_UUID_FILE"
 
 // UUIDFileDefault is the default file path to store the marble's uuid
 func UUIDFileDefault() string { return filepath.Join(util.MustGetwd(), "uuid") }
+
+// SPIFFEEndpointSocket is the path of the unix socket the marble serves the SPIFFE Workload API on. It can also be set in the manifest.
+const SPIFFEEndpointSocket = "EDG_MARBLE_SPIFFE_ENDPOINT_SOCKET"
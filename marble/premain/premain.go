@@ -11,6 +11,8 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -18,10 +20,13 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/edgelesssys/ego/marble"
 	"github.com/edgelesssys/marblerun/coordinator/quote"
 	"github.com/edgelesssys/marblerun/coordinator/quote/ertvalidator"
 	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	coordinatorSPIFFE "github.com/edgelesssys/marblerun/coordinator/spiffe"
 	"github.com/edgelesssys/marblerun/marble/config"
+	"github.com/edgelesssys/marblerun/marble/spiffe"
 	"github.com/edgelesssys/marblerun/util"
 	"github.com/google/uuid"
 	"github.com/spf13/afero"
@@ -187,6 +192,14 @@ func PreMainEx(issuer quote.Issuer, activate ActivateFunc, hostfs, enclavefs afe
 		return err
 	}
 
+	// the socket path may also be set by the manifest
+	if socketPath := os.Getenv(config.SPIFFEEndpointSocket); socketPath != "" {
+		log.Println("starting SPIFFE Workload API on", socketPath)
+		if err := startSPIFFEAgent(socketPath, coordAddr); err != nil {
+			return err
+		}
+	}
+
 	log.Println("done with PreMain")
 	return nil
 }
@@ -211,6 +224,57 @@ func ActivateRPC(req *rpc.ActivationReq, coordAddr string, tlsCredentials creden
 	return activationResp.GetParameters(), nil
 }
 
+// startSPIFFEAgent serves the SPIFFE Workload API for the Marble certificate in the background.
+func startSPIFFEAgent(socketPath, coordAddr string) error {
+	certChainPEM := []byte(os.Getenv(marble.MarbleEnvironmentCertificateChain))
+	privKeyPEM := []byte(os.Getenv(marble.MarbleEnvironmentPrivateKey))
+	svidPEM := []byte(os.Getenv(coordinatorSPIFFE.EnvironmentX509SVID))
+	bundlePEM := []byte(os.Getenv(coordinatorSPIFFE.EnvironmentX509Bundle))
+	if len(svidPEM) == 0 || len(bundlePEM) == 0 {
+		return errors.New("SPIFFE is not enabled on the Coordinator")
+	}
+
+	// the Coordinator authenticates the Marble by its activated certificate
+	certBlock, _ := pem.Decode(certChainPEM)
+	keyBlock, _ := pem.Decode(privKeyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return errors.New("marble certificate or private key missing")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return err
+	}
+	privK, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return err
+	}
+	ecdsaPrivK, ok := privK.(*ecdsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("unsupported key type %T", privK)
+	}
+	tlsCredentials, err := util.LoadGRPCTLSCredentials(cert, ecdsaPrivK, true)
+	if err != nil {
+		return err
+	}
+	connection, err := grpc.Dial(coordAddr, grpc.WithTransportCredentials(tlsCredentials))
+	if err != nil {
+		return err
+	}
+
+	server, err := spiffe.NewServer(svidPEM, privKeyPEM, bundlePEM, rpc.NewMarbleClient(connection))
+	if err != nil {
+		connection.Close()
+		return err
+	}
+	go func() {
+		defer connection.Close()
+		if err := server.Serve(socketPath); err != nil {
+			log.Println("SPIFFE Workload API stopped:", err)
+		}
+	}()
+	return nil
+}
+
 func applyParameters(params *rpc.Parameters, fs afero.Fs) error {
 	// Store files in file system
 	log.Println("creating files from manifest")
@@ -0,0 +1,220 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package spiffe implements an agent serving the SPIFFE Workload API to the application of a Marble.
+package spiffe
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+
+	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/edgelesssys/marblerun/coordinator/spiffe"
+	"github.com/edgelesssys/marblerun/marble/spiffe/workload"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// securityHeader is the metadata key every Workload API request must set to "true"
+const securityHeader = "workload.spiffe.io"
+
+// Server serves the SPIFFE Workload API for the X509-SVID of a Marble.
+// JWT-SVIDs and JWT bundles are requested from the Coordinator.
+type Server struct {
+	spiffeID    string
+	trustDomain string
+	svid        []byte
+	svidKey     []byte
+	bundle      []byte
+	client      rpc.MarbleClient
+}
+
+// NewServer creates a Workload API server from the PEM encoded X509-SVID, private key and X.509 authorities of a Marble.
+// The X509-SVID is the Marble certificate followed by its intermediate CAs. client must authenticate to the Coordinator with the Marble certificate.
+func NewServer(svidPEM, privKeyPEM, bundlePEM []byte, client rpc.MarbleClient) (*Server, error) {
+	svidCerts, err := parsePEMCertificates(svidPEM)
+	if err != nil {
+		return nil, err
+	}
+	if len(svidCerts) == 0 {
+		return nil, errors.New("certificate chain does not contain a certificate")
+	}
+	spiffeID, err := spiffe.IDFromCertificate(svidCerts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	keyBlock, _ := pem.Decode(privKeyPEM)
+	if keyBlock == nil {
+		return nil, errors.New("invalid private key")
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes); err != nil {
+		return nil, err
+	}
+	authorities, err := parsePEMCertificates(bundlePEM)
+	if err != nil {
+		return nil, err
+	}
+	if len(authorities) == 0 {
+		return nil, errors.New("invalid X.509 bundle")
+	}
+
+	var svid, bundle []byte
+	for _, cert := range svidCerts {
+		svid = append(svid, cert.Raw...)
+	}
+	for _, cert := range authorities {
+		bundle = append(bundle, cert.Raw...)
+	}
+	return &Server{
+		spiffeID:    spiffeID.String(),
+		trustDomain: "spiffe://" + spiffeID.Host,
+		svid:        svid,
+		svidKey:     keyBlock.Bytes,
+		bundle:      bundle,
+		client:      client,
+	}, nil
+}
+
+// parsePEMCertificates parses all certificates of PEM encoded data
+func parsePEMCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// Serve serves the Workload API on a unix socket at socketPath
+func (s *Server) Serve(socketPath string) error {
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	lis, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	grpcServer := grpc.NewServer()
+	workload.RegisterSpiffeWorkloadAPIServer(grpcServer, s)
+	return grpcServer.Serve(lis)
+}
+
+// FetchX509SVID sends the X509-SVID of the Marble
+func (s *Server) FetchX509SVID(req *workload.X509SVIDRequest, stream workload.SpiffeWorkloadAPI_FetchX509SVIDServer) error {
+	if err := checkSecurityHeader(stream.Context()); err != nil {
+		return err
+	}
+	resp := &workload.X509SVIDResponse{
+		Svids: []*workload.X509SVID{{
+			SpiffeId:    s.spiffeID,
+			X509Svid:    s.svid,
+			X509SvidKey: s.svidKey,
+			Bundle:      s.bundle,
+		}},
+	}
+	if err := stream.Send(resp); err != nil {
+		return err
+	}
+	// the SVID is valid for the lifetime of the Marble, so there are no updates
+	<-stream.Context().Done()
+	return nil
+}
+
+// FetchX509Bundles sends the X.509 bundle of the trust domain
+func (s *Server) FetchX509Bundles(req *workload.X509BundlesRequest, stream workload.SpiffeWorkloadAPI_FetchX509BundlesServer) error {
+	if err := checkSecurityHeader(stream.Context()); err != nil {
+		return err
+	}
+	if err := stream.Send(&workload.X509BundlesResponse{Bundles: map[string][]byte{s.trustDomain: s.bundle}}); err != nil {
+		return err
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+// FetchJWTSVID requests a JWT-SVID for the audience from the Coordinator
+func (s *Server) FetchJWTSVID(ctx context.Context, req *workload.JWTSVIDRequest) (*workload.JWTSVIDResponse, error) {
+	if err := checkSecurityHeader(ctx); err != nil {
+		return nil, err
+	}
+	if len(req.GetAudience()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "audience must be specified")
+	}
+	if req.GetSpiffeId() != "" && req.GetSpiffeId() != s.spiffeID {
+		return nil, status.Errorf(codes.PermissionDenied, "no identity issued for %s", req.GetSpiffeId())
+	}
+	resp, err := s.client.GetJWTSVID(ctx, &rpc.JWTSVIDReq{Audience: req.GetAudience()})
+	if err != nil {
+		return nil, err
+	}
+	return &workload.JWTSVIDResponse{Svids: []*workload.JWTSVID{{SpiffeId: s.spiffeID, Svid: resp.GetSVID()}}}, nil
+}
+
+// FetchJWTBundles sends the JWT bundle of the trust domain
+func (s *Server) FetchJWTBundles(req *workload.JWTBundlesRequest, stream workload.SpiffeWorkloadAPI_FetchJWTBundlesServer) error {
+	if err := checkSecurityHeader(stream.Context()); err != nil {
+		return err
+	}
+	resp, err := s.client.GetJWTBundle(stream.Context(), &rpc.JWTBundleReq{})
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&workload.JWTBundlesResponse{Bundles: map[string][]byte{s.trustDomain: resp.GetBundle()}}); err != nil {
+		return err
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+// ValidateJWTSVID validates a JWT-SVID with the JWT bundle of the trust domain
+func (s *Server) ValidateJWTSVID(ctx context.Context, req *workload.ValidateJWTSVIDRequest) (*workload.ValidateJWTSVIDResponse, error) {
+	if err := checkSecurityHeader(ctx); err != nil {
+		return nil, err
+	}
+	if req.GetAudience() == "" {
+		return nil, status.Error(codes.InvalidArgument, "audience must be specified")
+	}
+	if req.GetSvid() == "" {
+		return nil, status.Error(codes.InvalidArgument, "svid must be specified")
+	}
+	resp, err := s.client.GetJWTBundle(ctx, &rpc.JWTBundleReq{})
+	if err != nil {
+		return nil, err
+	}
+	spiffeID, claims, err := spiffe.ValidateJWTSVID(req.GetSvid(), resp.GetBundle(), req.GetAudience())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	claimsStruct, err := structpb.NewStruct(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &workload.ValidateJWTSVIDResponse{SpiffeId: spiffeID, Claims: claimsStruct}, nil
+}
+
+// checkSecurityHeader verifies that the request was sent by a Workload API client and not forwarded by a browser or proxy
+func checkSecurityHeader(ctx context.Context) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(securityHeader)) != 1 || md.Get(securityHeader)[0] != "true" {
+		return status.Error(codes.InvalidArgument, "security header missing from request")
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Copyright (c) Edgeless Systems GmbH.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package spiffe
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/marblerun/coordinator/rpc"
+	"github.com/edgelesssys/marblerun/coordinator/spiffe"
+	"github.com/edgelesssys/marblerun/marble/spiffe/workload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const testSPIFFEID = "spiffe://example.org/frontend/1234"
+
+func TestServer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	certChainPEM, privKeyPEM, rootCAPEM := mustGenerateSVID(t)
+	jwtPrivK, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	server, err := NewServer(certChainPEM, privKeyPEM, rootCAPEM, &stubMarbleClient{jwtPrivK: jwtPrivK})
+	require.NoError(err)
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "agent.sock")
+	go server.Serve(socketPath)
+
+	conn, err := grpc.Dial("unix://"+socketPath, grpc.WithInsecure())
+	require.NoError(err)
+	defer conn.Close()
+	client := workload.NewSpiffeWorkloadAPIClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// requests without the security header are rejected
+	_, err = client.FetchJWTSVID(ctx, &workload.JWTSVIDRequest{Audience: []string{"backend"}}, grpc.WaitForReady(true))
+	assert.Error(err)
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "workload.spiffe.io", "true")
+
+	x509Stream, err := client.FetchX509SVID(ctx, &workload.X509SVIDRequest{})
+	require.NoError(err)
+	x509Resp, err := x509Stream.Recv()
+	require.NoError(err)
+	require.Len(x509Resp.Svids, 1)
+	svid := x509Resp.Svids[0]
+	assert.Equal(testSPIFFEID, svid.SpiffeId)
+	certs, err := x509.ParseCertificates(svid.X509Svid)
+	require.NoError(err)
+	assert.Len(certs, 2)
+	_, err = x509.ParsePKCS8PrivateKey(svid.X509SvidKey)
+	assert.NoError(err)
+	authorities, err := x509.ParseCertificates(svid.Bundle)
+	require.NoError(err)
+	require.Len(authorities, 1)
+	assert.True(authorities[0].IsCA)
+	roots := x509.NewCertPool()
+	roots.AddCert(authorities[0])
+	_, err = certs[0].Verify(x509.VerifyOptions{Roots: roots})
+	assert.NoError(err)
+
+	bundlesStream, err := client.FetchX509Bundles(ctx, &workload.X509BundlesRequest{})
+	require.NoError(err)
+	bundlesResp, err := bundlesStream.Recv()
+	require.NoError(err)
+	assert.Equal(svid.Bundle, bundlesResp.Bundles["spiffe://example.org"])
+
+	// JWT-SVIDs are only issued for the identity of the Marble
+	_, err = client.FetchJWTSVID(ctx, &workload.JWTSVIDRequest{Audience: []string{"backend"}, SpiffeId: "spiffe://example.org/other/1"})
+	assert.Error(err)
+	_, err = client.FetchJWTSVID(ctx, &workload.JWTSVIDRequest{})
+	assert.Error(err)
+	jwtResp, err := client.FetchJWTSVID(ctx, &workload.JWTSVIDRequest{Audience: []string{"backend"}})
+	require.NoError(err)
+	require.Len(jwtResp.Svids, 1)
+	assert.Equal(testSPIFFEID, jwtResp.Svids[0].SpiffeId)
+
+	jwtBundlesStream, err := client.FetchJWTBundles(ctx, &workload.JWTBundlesRequest{})
+	require.NoError(err)
+	jwtBundlesResp, err := jwtBundlesStream.Recv()
+	require.NoError(err)
+	assert.NotEmpty(jwtBundlesResp.Bundles["spiffe://example.org"])
+
+	validateResp, err := client.ValidateJWTSVID(ctx, &workload.ValidateJWTSVIDRequest{Audience: "backend", Svid: jwtResp.Svids[0].Svid})
+	require.NoError(err)
+	assert.Equal(testSPIFFEID, validateResp.SpiffeId)
+	assert.Equal(testSPIFFEID, validateResp.Claims.AsMap()["sub"])
+	_, err = client.ValidateJWTSVID(ctx, &workload.ValidateJWTSVIDRequest{Audience: "other", Svid: jwtResp.Svids[0].Svid})
+	assert.Error(err)
+}
+
+func TestNewServer(t *testing.T) {
+	assert := assert.New(t)
+
+	certChainPEM, privKeyPEM, rootCAPEM := mustGenerateSVID(t)
+	_, err := NewServer(nil, privKeyPEM, rootCAPEM, nil)
+	assert.Error(err)
+	_, err = NewServer(certChainPEM, nil, rootCAPEM, nil)
+	assert.Error(err)
+	_, err = NewServer(certChainPEM, privKeyPEM, nil, nil)
+	assert.Error(err)
+	_, err = NewServer(certChainPEM, privKeyPEM, []byte("-----BEGIN CERTIFICATE-----\naW52YWxpZA==\n-----END CERTIFICATE-----\n"), nil)
+	assert.Error(err)
+	// the Marble certificate must be an X509-SVID
+	_, err = NewServer(rootCAPEM, privKeyPEM, rootCAPEM, nil)
+	assert.Error(err)
+}
+
+// mustGenerateSVID returns the PEM encoded certificate chain, private key and root CA of an X509-SVID
+func mustGenerateSVID(t *testing.T) ([]byte, []byte, []byte) {
+	require := require.New(t)
+
+	rootPrivK, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	rootRaw, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootPrivK.PublicKey, rootPrivK)
+	require.NoError(err)
+
+	privK, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{spiffe.ID("example.org", "frontend", "1234")},
+	}
+	certRaw, err := x509.CreateCertificate(rand.Reader, template, rootTemplate, &privK.PublicKey, rootPrivK)
+	require.NoError(err)
+	privKRaw, err := x509.MarshalPKCS8PrivateKey(privK)
+	require.NoError(err)
+
+	rootPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootRaw})
+	certChainPEM := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certRaw}), rootPEM...)
+	return certChainPEM, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privKRaw}), rootPEM
+}
+
+// stubMarbleClient issues JWT-SVIDs like the Coordinator
+type stubMarbleClient struct {
+	rpc.MarbleClient
+	jwtPrivK *ecdsa.PrivateKey
+}
+
+func (c *stubMarbleClient) GetJWTSVID(ctx context.Context, in *rpc.JWTSVIDReq, opts ...grpc.CallOption) (*rpc.JWTSVIDResp, error) {
+	svid, err := spiffe.SignJWTSVID(c.jwtPrivK, testSPIFFEID, in.GetAudience(), time.Now().Add(spiffe.JWTSVIDValidity))
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.JWTSVIDResp{SVID: svid}, nil
+}
+
+func (c *stubMarbleClient) GetJWTBundle(ctx context.Context, in *rpc.JWTBundleReq, opts ...grpc.CallOption) (*rpc.JWTBundleResp, error) {
+	bundle, err := spiffe.NewBundle(nil, []crypto.PublicKey{c.jwtPrivK.Public()})
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.JWTBundleResp{Bundle: bundle}, nil
+}
@@ -63,7 +63,8 @@ const ManifestJSON string = `{
 					"SEAL_KEY": "{{ hex .Marblerun.SealKey }}",
 					"TEST_SECRET_SYMMETRIC_KEY": "{{ raw .Secrets.symmetric_key_shared }}",
 					"TEST_SECRET_CERT": "{{ pem .Secrets.cert_shared.Cert }}",
-					"TEST_SECRET_PRIVATE_CERT": "{{ pem .Secrets.cert_private.Cert }}"
+					"TEST_SECRET_PRIVATE_CERT": "{{ pem .Secrets.cert_private.Cert }}",
+					"TEST_SECRET_MARBLE_TYPE_KEY": "{{ hex .Secrets.symmetric_key_marble_type }}"
 				},
 				"Argv": [
 					"--first",
@@ -80,14 +81,22 @@ const ManifestJSON string = `{
 				"Env": {
 					"SEAL_KEY": "{{ hex .Marblerun.SealKey }}",
 					"TEST_SECRET_CERT": "{{ pem .Secrets.cert_shared.Cert }}",
-					"TEST_SECRET_PRIVATE_CERT": "{{ pem .Secrets.cert_private.Cert }}"
+					"TEST_SECRET_PRIVATE_CERT": "{{ pem .Secrets.cert_private.Cert }}",
+					"TEST_SECRET_MARBLE_TYPE_KEY": "{{ hex .Secrets.symmetric_key_marble_type }}",
+					"TEST_MARBLE_TYPE": "{{ .Marble.Type }}"
 				},
 				"Argv": [
-					"serve"
+					"serve",
+					"--node-id={{ .Marble.UUID }}"
 				]
 			},
 			"TLS": [
 				"web", "anotherWeb"
+			],
+			"Secrets": [
+				"cert_shared",
+				"cert_private",
+				"symmetric_key_marble_type"
 			]
 		},
 		"frontend": {
@@ -112,6 +121,11 @@ const ManifestJSON string = `{
 			"Size": 256,
 			"Type": "symmetric-key"
 		},
+		"symmetric_key_marble_type": {
+			"Size": 128,
+			"PerMarbleType": true,
+			"Type": "symmetric-key"
+		},
 		"cert_private": {
 			"Size": 2048,
 			"Type": "cert-rsa",
@@ -232,6 +246,15 @@ var ManifestJSONWithRecoveryKey string = `{
 			},
 			"ValidFor": 7
 		},
+		"cert_marble_type": {
+			"PerMarbleType": true,
+			"Type": "cert-ed25519",
+			"Cert": {
+				"Subject": {
+					"CommonName": "Marblerun Unit Test Marble Type"
+				}
+			}
+		},
 		"symmetric_key_unset": {
 			"Type": "symmetric-key",
 			"Size": 128,
@@ -255,7 +278,10 @@ var ManifestJSONWithRecoveryKey string = `{
 			"Roles": [
 				"secret_manager",
 				"read_only",
-				"update_manager"
+				"update_manager",
+				"auditor",
+				"secret_rotator",
+				"root_ca_rotator"
 			]
 		}
 	},
@@ -272,19 +298,31 @@ var ManifestJSONWithRecoveryKey string = `{
 			],
 			"Actions": [
 				"ReadSecret",
-				"WriteSecret"
+				"WriteSecret",
+				"DeleteSecret"
 			]
 		},
 		"read_only": {
 			"ResourceType": "Secrets",
 			"ResourceNames": [
 				"symmetric_key_shared",
-				"cert_shared"
+				"cert_shared",
+				"cert_marble_type"
 			],
 			"Actions": [
 				"ReadSecret"
 			]
 		},
+		"secret_rotator": {
+			"ResourceType": "Secrets",
+			"ResourceNames": [
+				"symmetric_key_shared",
+				"cert_shared"
+			],
+			"Actions": [
+				"RotateSecret"
+			]
+		},
 		"update_manager": {
 			"ResourceType": "Packages",
 			"ResourceNames": [
@@ -293,6 +331,22 @@ var ManifestJSONWithRecoveryKey string = `{
 			"Actions": [
 				"UpdateSecurityVersion"
 			]
+		},
+		"auditor": {
+			"ResourceType": "Activations",
+			"ResourceNames": [
+				"frontend"
+			],
+			"Actions": [
+				"ReadActivations"
+			]
+		},
+		"root_ca_rotator": {
+			"ResourceType": "RootCA",
+			"Actions": [
+				"RotateRootCA",
+				"SetExternalCA"
+			]
 		}
 	}
 }`